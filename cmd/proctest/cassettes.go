@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/cassette"
+	"github.com/dacharyc/spike-procedural-testing/internal/parser"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+func cassettesCommand(args []string) int {
+	flags := flag.NewFlagSet("cassettes", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest cassettes [flags] <file|directory>...")
+		fmt.Fprintln(flags.Output(), "\nReports cassettes that are missing or stale because the documented requests changed.")
+		flags.PrintDefaults()
+	}
+	var opts runner.Options
+	flags.StringVar(&opts.CassetteDir, "cassettes", cassette.DefaultDir, "directory cassettes are stored in")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		return exitError
+	}
+	files, err := discover(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+
+	r := runner.New(opts)
+	current, outdated := 0, 0
+	for _, file := range files {
+		doc, err := parser.New(nil).ParseFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+		statuses, err := r.CheckCassettes(doc)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+		for _, st := range statuses {
+			name := st.Procedure.Title
+			if st.Variant != nil && st.Variant.Label != "" {
+				name += " (" + st.Variant.Label + ")"
+			}
+			if len(st.Problems) == 0 {
+				current++
+				fmt.Printf("✓ %s\n", name)
+				continue
+			}
+			outdated++
+			fmt.Printf("✗ %s\n  %s\n", name, st.Path)
+			for _, p := range st.Problems {
+				fmt.Printf("    %s\n", p)
+			}
+		}
+	}
+	fmt.Printf("\n%d current, %d to record\n", current, outdated)
+	if outdated > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
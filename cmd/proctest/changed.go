@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/deps"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+// changedSinceFlag defines --changed-since on flags.
+func changedSinceFlag(flags *flag.FlagSet) *string {
+	return flags.String("changed-since", "", "only run test cases whose content changed since the commit where HEAD branched from this git ref, such as origin/main, through the page or the includes, literalincludes, extracts and constants it uses")
+}
+
+// changedJobs returns the jobs whose test cases the changes in the
+// working tree since ref affect.
+func changedJobs(ref string, jobs []runner.Job) ([]runner.Job, error) {
+	changes, err := deps.ChangedSince(ref)
+	if err != nil {
+		return nil, err
+	}
+	var pages []string
+	seen := map[string]bool{}
+	for _, j := range jobs {
+		if !seen[j.Doc.File] {
+			seen[j.Doc.File] = true
+			pages = append(pages, j.Doc.File)
+		}
+	}
+	g, err := deps.Build(pages)
+	if err != nil {
+		return nil, err
+	}
+	var out []runner.Job
+	for _, j := range jobs {
+		if changes.Affects(g, j.Doc, j.Procedure, j.Variant) {
+			out = append(out, j)
+		}
+	}
+	return out, nil
+}
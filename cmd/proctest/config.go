@@ -0,0 +1,482 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/cleanup"
+	"github.com/dacharyc/spike-procedural-testing/internal/config"
+	"github.com/dacharyc/spike-procedural-testing/internal/executor"
+	"github.com/dacharyc/spike-procedural-testing/internal/parser"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+	"github.com/dacharyc/spike-procedural-testing/internal/snooty"
+)
+
+// configFlag defines --config on flags.
+func configFlag(flags *flag.FlagSet) *string {
+	return flags.String("config", "", "configuration file to read instead of the .proctest.toml or .proctest.yaml files from the repository root down to the pages")
+}
+
+// loadConfig reads the configuration file at path or, when path is empty,
+// merges those from the repository root down to the current directory.
+// Without any, it returns an empty configuration, and warns when there is
+// a .proctest.js that was not converted.
+func loadConfig(path string) (*config.Config, error) {
+	if path != "" {
+		c, err := config.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		return config.Merge(c), nil
+	}
+	layers, err := config.Discover(".")
+	if err != nil {
+		return nil, err
+	}
+	if len(layers) == 0 {
+		if _, err := os.Stat(config.LegacyFile); err == nil {
+			fmt.Fprintf(os.Stderr, "proctest: %s is not read; convert it with \"proctest config convert\"\n", config.LegacyFile)
+		}
+	}
+	return config.Merge(layers...), nil
+}
+
+// configGroup is pages that have the same configuration files, with
+// the configuration they merge to and, once they are parsed, their jobs
+// and the runner that runs them.
+type configGroup struct {
+	cfg    *config.Config
+	files  []string
+	jobs   []runner.Job
+	runner *runner.Runner
+}
+
+// configGroups splits files by their configuration: the configuration
+// files from the repository root down to the directory each is in,
+// merged. The groups are in the order of their first page. With --config,
+// or without files, there is one group, which has cfg.
+func configGroups(cfg *config.Config, path string, files []string) ([]*configGroup, error) {
+	if path != "" || len(files) == 0 {
+		return []*configGroup{{cfg: cfg, files: files}}, nil
+	}
+	var groups []*configGroup
+	byFiles := map[string]*configGroup{}
+	byDir := map[string]*configGroup{}
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		g := byDir[dir]
+		if g == nil {
+			layers, err := config.Discover(dir)
+			if err != nil {
+				return nil, err
+			}
+			key := strings.Join(configPaths(layers), "\x00")
+			if g = byFiles[key]; g == nil {
+				g = &configGroup{cfg: config.Merge(layers...)}
+				byFiles[key] = g
+				groups = append(groups, g)
+			}
+			byDir[dir] = g
+		}
+		g.files = append(g.files, file)
+	}
+	return groups, nil
+}
+
+// pageConfig returns the configuration page runs with: the file at path,
+// or the files from the repository root down to the page, merged.
+func pageConfig(path, page string) (*config.Config, error) {
+	var cfg *config.Config
+	if path != "" {
+		var err error
+		if cfg, err = loadConfig(path); err != nil {
+			return nil, err
+		}
+	}
+	groups, err := configGroups(cfg, path, []string{page})
+	if err != nil {
+		return nil, err
+	}
+	return groups[0].cfg, nil
+}
+
+func configPaths(layers []*config.Config) []string {
+	var paths []string
+	for _, c := range layers {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
+
+// configPages returns the pages to run: those args name, or those the
+// configuration's testFiles match when there are no args. It returns nil
+// when there are neither.
+func configPages(cfg *config.Config, args []string) ([]string, error) {
+	if len(args) > 0 {
+		return discover(args)
+	}
+	if len(cfg.TestFiles) == 0 {
+		return nil, nil
+	}
+	files, err := cfg.Pages()
+	if err == nil && len(files) == 0 {
+		err = fmt.Errorf("%s: no pages match testFiles", cfg.Sources["testFiles"])
+	}
+	return files, err
+}
+
+// configParser returns a parser that reads the configuration's
+// snootyConfig, if it has one, instead of the snooty.toml above each
+// page.
+func configParser(cfg *config.Config) (*parser.Parser, error) {
+	if cfg.SnootyConfig == "" {
+		return parser.New(nil), nil
+	}
+	project, err := snooty.LoadFile(cfg.SnootyConfig)
+	if err != nil {
+		return nil, err
+	}
+	return parser.New(project), nil
+}
+
+// setFlags returns the names of the flags given on the command line.
+func setFlags(flags *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// applyConfig sets the runner options the configuration has and the
+// flags in set did not.
+func applyConfig(cfg *config.Config, set map[string]bool, opts *runner.Options) error {
+	if len(cfg.EnvFiles) > 0 {
+		env, err := cfg.Environ(os.Environ())
+		if err != nil {
+			return err
+		}
+		opts.Env = env
+	}
+	if len(cfg.IDEExecution.Commands) > 0 {
+		opts.IDECommands = map[string]string{}
+		for lang, command := range cfg.IDEExecution.Commands {
+			opts.IDECommands[config.Language(lang)] = command
+		}
+	}
+	opts.SkipIDE = cfg.IDEExecution.Skip != nil && *cfg.IDEExecution.Skip
+	if !set["timeout"] && cfg.Timeout > 0 {
+		opts.Timeout = time.Duration(cfg.Timeout)
+	}
+	for lang, e := range cfg.Executors {
+		if opts.Runtimes == nil {
+			opts.Runtimes = map[string]executor.Runtime{}
+		}
+		rt := executor.Runtime{Command: e.Command, Timeout: time.Duration(e.Timeout)}
+		for _, k := range slices.Sorted(maps.Keys(e.Env)) {
+			rt.Env = append(rt.Env, k+"="+e.Env[k])
+		}
+		opts.Runtimes[config.Language(lang)] = rt
+	}
+	if !set["keep-artifacts"] && cfg.Cleanup.KeepArtifacts != "" {
+		opts.KeepArtifacts = runner.Keep(cfg.Cleanup.KeepArtifacts)
+	}
+	if !set["no-cleanup"] && !cfg.CleanupEnabled() {
+		opts.NoCleanup = true
+	}
+	if p := cfg.Cleanup.DatabasePattern; p != "" {
+		opts.DatabasePattern = regexp.MustCompile(p)
+	}
+	if p := cfg.Cleanup.CollectionPattern; p != "" {
+		opts.CollectionPattern = regexp.MustCompile(p)
+	}
+	return nil
+}
+
+// configReporters returns the configuration's reporters.
+func configReporters(cfg *config.Config) ([]reporterFlag, error) {
+	var specs []reporterFlag
+	for _, r := range cfg.Reporters {
+		spec, err := parseReporter(r.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cfg.Sources["reporters"], err)
+		}
+		spec.path = r.Output
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func configCommand(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "convert":
+			return configConvert(args[1:])
+		case "explain":
+			return configExplain(args[1:])
+		case "-h", "-help", "--help", "help":
+			configUsage()
+			return exitOK
+		}
+		fmt.Fprintf(os.Stderr, "proctest: unknown config command %q\n", args[0])
+	}
+	configUsage()
+	return exitError
+}
+
+func configUsage() {
+	fmt.Fprint(os.Stderr, `Usage: proctest config <command> [flags]
+
+Commands:
+  convert  convert a .proctest.js to .proctest.toml or .proctest.yaml
+  explain  show the settings a page runs with and the files that set them
+
+Run "proctest config <command> -h" for the flags of a command.
+`)
+}
+
+func configConvert(args []string) int {
+	flags := flag.NewFlagSet("config convert", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest config convert [flags] [.proctest.js]")
+		fmt.Fprintln(flags.Output(), "\nConverts a .proctest.js configuration to the declarative format proctest reads, without running it. Settings that cannot be converted, such as hooks, are listed at the top of the new file.")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "toml", "format to write: toml or yaml")
+	output := flags.String("output", "", `file to write, or "-" for stdout (default .proctest.toml or .proctest.yaml next to the input)`)
+	force := flags.Bool("force", false, "overwrite the output file if it exists")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	if len(args) > 1 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "toml" && *format != "yaml" {
+		fmt.Fprintf(os.Stderr, "proctest: invalid --format %q: use toml or yaml\n", *format)
+		return exitError
+	}
+	input := config.LegacyFile
+	if len(args) == 1 {
+		input = args[0]
+	}
+	if *output == "" {
+		*output = filepath.Join(filepath.Dir(input), ".proctest."+*format)
+	}
+	if err := convertConfig(input, *output, *format, *force); err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func convertConfig(input, output, format string, force bool) error {
+	src, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	cfg, notes, err := config.Convert(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", input, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("%s: the converted configuration is not valid: %w", input, err)
+	}
+	var data []byte
+	if format == "yaml" {
+		data, err = config.EncodeYAML(cfg)
+	} else {
+		data, err = config.EncodeTOML(cfg)
+	}
+	if err != nil {
+		return err
+	}
+	header := fmt.Sprintf("# Converted from %s by proctest config convert.\n", filepath.Base(input))
+	if len(notes) > 0 {
+		header += "#\n# Not converted:\n"
+		for _, n := range notes {
+			header += "#   - " + n + "\n"
+		}
+	}
+	data = append([]byte(header+"\n"), data...)
+	if output == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		flag |= os.O_EXCL
+	}
+	f, err := os.OpenFile(output, flag, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s exists; use --force to overwrite it", output)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", output)
+	if len(notes) > 0 {
+		fmt.Fprintf(os.Stderr, "Not converted:\n  - %s\n", strings.Join(notes, "\n  - "))
+	}
+	return nil
+}
+
+func configExplain(args []string) int {
+	flags := flag.NewFlagSet("config explain", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest config explain [flags] <page|directory>")
+		fmt.Fprintln(flags.Output(), "\nShows the value of every setting a page runs with and the configuration file that set it. The files from the repository root down to the page apply, the nearer file winning; flags given to proctest test win over all of them.")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "text", "output format: text or json")
+	configPath := configFlag(flags)
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	if len(args) != 1 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "proctest: invalid --format %q: use text or json\n", *format)
+		return exitError
+	}
+	dir := args[0]
+	info, err := os.Stat(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	if !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	var layers []*config.Config
+	if *configPath != "" {
+		c, err := config.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+		layers = []*config.Config{c}
+	} else if layers, err = config.Discover(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	out := explainJSON{Files: configPaths(layers), Settings: explainSettings(config.Merge(layers...))}
+	if out.Files == nil {
+		out.Files = []string{}
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(out)
+	} else {
+		err = writeExplain(os.Stdout, out)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// explainJSON is the JSON output of config explain.
+type explainJSON struct {
+	// Files are the configuration files that apply, the nearest last.
+	Files    []string         `json:"files"`
+	Settings []config.Setting `json:"settings"`
+}
+
+// configDefaults are the values of the settings when no configuration
+// file sets them.
+var configDefaults = []config.Setting{
+	{Key: "testFiles", Value: []string{}},
+	{Key: "exclude", Value: []string{}},
+	{Key: "envFiles", Value: []string{}},
+	{Key: "snootyConfig", Value: "the snooty.toml above each page"},
+	{Key: "ideExecution.commands", Value: "built in"},
+	{Key: "ideExecution.skip", Value: false},
+	{Key: "timeout", Value: executor.DefaultTimeout.String()},
+	{Key: "executors", Value: "built in"},
+	{Key: "cleanup.enabled", Value: true},
+	{Key: "cleanup.keepArtifacts", Value: string(runner.KeepOnFailure)},
+	{Key: "cleanup.databasePattern", Value: cleanup.DefaultPattern.String()},
+	{Key: "cleanup.collectionPattern", Value: cleanup.DefaultPattern.String()},
+	{Key: "reporters", Value: []string{"human"}},
+	{Key: "verbose", Value: false},
+}
+
+// explainSettings returns the settings of cfg, with the default of each
+// setting it does not have. The languages of ideExecution.commands and
+// executors are settings of their own, which replace the default of the
+// whole table.
+func explainSettings(cfg *config.Config) []config.Setting {
+	settings := cfg.Settings()
+	for _, d := range configDefaults {
+		if !slices.ContainsFunc(settings, func(s config.Setting) bool {
+			return s.Key == d.Key || strings.HasPrefix(s.Key, d.Key+".")
+		}) {
+			d.Source = "default"
+			settings = append(settings, d)
+		}
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings
+}
+
+func writeExplain(w io.Writer, out explainJSON) error {
+	var b strings.Builder
+	if len(out.Files) == 0 {
+		b.WriteString("No configuration files apply.\n")
+	} else {
+		b.WriteString("Configuration files, the nearest last:\n")
+		for _, f := range out.Files {
+			b.WriteString("  " + f + "\n")
+		}
+	}
+	b.WriteString("\n")
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSET BY")
+	for _, s := range out.Settings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Key, settingValue(s.Value), s.Source)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// settingValue writes a setting's value the way the configuration file
+// would: lists in brackets and strings quoted inside them.
+func settingValue(v any) string {
+	list, ok := v.([]string)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = strconv.Quote(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+// writePlan describes what test would run for the jobs of groups under
+// f, without running it: each test case with the steps and actions it
+// would run, and the placeholders its group's runner cannot fill in,
+// which would fail it.
+func writePlan(w io.Writer, groups []*configGroup, f runner.Filter) error {
+	var b strings.Builder
+	var total, steps, actions int
+	for _, g := range groups {
+		total += len(g.jobs)
+	}
+	fmt.Fprintf(&b, "Would run %s:\n", plural(total, "test case"))
+	for _, g := range groups {
+		for _, j := range g.jobs {
+			tc := runner.ProcedureResult{Procedure: j.Procedure, Variant: j.Variant}
+			loc := j.Procedure.Location.Outermost()
+			fmt.Fprintf(&b, "\n%s [%s] %s:%d\n", tc.Name(), tc.ID(), loc.File, loc.StartLine)
+			var nodes []*treeNode
+			var unresolved []string
+			seen := map[string]bool{}
+			for _, ps := range f.Plan(j) {
+				steps++
+				actions += len(ps.Actions)
+				nodes = append(nodes, &treeNode{label: fmt.Sprintf("Step %s: %s", ps.Step, ps.Title), children: actionNodes(j.Procedure, ps.Actions)})
+				for _, a := range ps.Actions {
+					for _, p := range ast.Placeholders(a) {
+						if _, _, ok := g.runner.Resolver.Resolve(p); !ok && !seen[p] {
+							seen[p] = true
+							unresolved = append(unresolved, p)
+						}
+					}
+				}
+			}
+			if len(nodes) == 0 {
+				nodes = append(nodes, &treeNode{label: "No steps"})
+			}
+			drawTree(&b, "", nodes)
+			if len(unresolved) > 0 {
+				fmt.Fprintf(&b, "   Unresolved placeholders: %s\n", strings.Join(unresolved, ", "))
+			}
+		}
+	}
+	fmt.Fprintf(&b, "\n%s, %s, %s\n", plural(total, "test case"), plural(steps, "step"), plural(actions, "action"))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+// filterFlags defines the flags that select test cases, and the steps
+// and actions of them, on flags, and returns the filter they fill in.
+func filterFlags(flags *flag.FlagSet) *runner.Filter {
+	f := &runner.Filter{}
+	flags.Func("grep", "only run test cases whose procedure title, name or ID matches this regular expression", func(v string) error {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return err
+		}
+		f.Grep = re
+		return nil
+	})
+	flags.Func("variant", "only run this variant, by ID, label, value or selection such as interface=driver,language=go (repeatable)", func(v string) error {
+		if _, _, err := runner.ParseVariantSelection(v); err != nil {
+			return err
+		}
+		f.Variants = append(f.Variants, v)
+		return nil
+	})
+	flags.Func("steps", "only run these steps, such as 2-4 or 1,3-", func(v string) error {
+		ranges, err := runner.ParseStepRanges(v)
+		if err != nil {
+			return err
+		}
+		f.Steps = append(f.Steps, ranges...)
+		return nil
+	})
+	flags.Func("action-type", "only run actions of these types, such as shell,file (repeatable)", func(v string) error {
+		for _, name := range strings.Split(v, ",") {
+			t := ast.ActionType(strings.TrimSpace(name))
+			if !slices.Contains(ast.ActionTypes, t) {
+				return fmt.Errorf("unknown action type %q", name)
+			}
+			f.ActionTypes = append(f.ActionTypes, t)
+		}
+		return nil
+	})
+	return f
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/deps"
+)
+
+func graphCommand(args []string) int {
+	flags := flag.NewFlagSet("graph", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest graph [flags] <file|directory>...")
+		fmt.Fprintln(flags.Output(), "\nShows what pages are made of: the includes, literalincludes, extracts and constants they use, directly or through other includes.")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "text", "output format: text, dot, mermaid or json")
+	output := flags.String("output", "", "file to write to instead of stdout")
+	var uses []string
+	flags.Func("uses", "only show what uses this file, extract ref or {+constant+}, such as create-index.go or /includes/steps-connect.rst (repeatable)", func(v string) error {
+		uses = append(uses, v)
+		return nil
+	})
+	orphans := flags.Bool("orphans", false, "list the files under includes/ that no page uses; pass every page of the project")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		return exitError
+	}
+	if !slices.Contains([]string{"text", "dot", "mermaid", "json"}, *format) {
+		fmt.Fprintf(os.Stderr, "proctest: invalid --format %q: use text, dot, mermaid or json\n", *format)
+		return exitError
+	}
+	switch {
+	case *orphans && len(uses) > 0:
+		fmt.Fprintln(os.Stderr, "proctest: --orphans and --uses cannot be combined")
+		return exitError
+	case *orphans && *format != "text" && *format != "json":
+		fmt.Fprintln(os.Stderr, "proctest: --orphans writes text or json")
+		return exitError
+	}
+	files, err := discover(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	g, err := deps.Build(files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	var found []string
+	for _, q := range uses {
+		ids := g.Find(q)
+		if len(ids) == 0 {
+			fmt.Fprintf(os.Stderr, "proctest: no page uses %s\n", q)
+			return exitError
+		}
+		found = append(found, ids...)
+	}
+
+	var outs outputs
+	defer outs.close()
+	w, err := outs.open(*output)
+	if err == nil {
+		switch {
+		case *orphans:
+			err = writeOrphans(w, g, *format)
+		case len(found) > 0 && *format == "text":
+			err = writeUsers(w, g, found)
+		default:
+			if len(found) > 0 {
+				g = g.Subgraph(g.Users(found...))
+			}
+			switch *format {
+			case "text":
+				err = writeGraph(w, g)
+			case "dot":
+				err = writeDOT(w, g)
+			case "mermaid":
+				err = writeMermaid(w, g)
+			case "json":
+				err = writeGraphJSON(w, g)
+			}
+		}
+	}
+	if err == nil {
+		err = outs.close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// nodeIDs returns the IDs of the nodes of g of the given kind, or of
+// every kind when kind is empty, sorted.
+func nodeIDs(g *deps.Graph, kind deps.Kind) []string {
+	var ids []string
+	for id, n := range g.Nodes {
+		if kind == "" || n.Kind == kind {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// nodeLabel names a node the way pages refer to it.
+func nodeLabel(n *deps.Node) string {
+	switch n.Kind {
+	case deps.KindConstant:
+		return "{+" + n.Name + "+}"
+	case deps.KindShared:
+		return "sharedinclude " + n.Name
+	}
+	return n.ID
+}
+
+// kindLabel is the kind of a node, and whether it is missing, for the
+// text output.
+func kindLabel(n *deps.Node) string {
+	if n.Missing {
+		return string(n.Kind) + ", missing"
+	}
+	return string(n.Kind)
+}
+
+// writeGraph draws each page with what it uses as a tree.
+func writeGraph(w io.Writer, g *deps.Graph) error {
+	var b strings.Builder
+	pages := nodeIDs(g, deps.KindPage)
+	for i, page := range pages {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(page + "\n")
+		drawTree(&b, "", useNodes(g, page, map[string]bool{page: true}))
+	}
+	fmt.Fprintf(&b, "\n%s, %s\n", plural(len(pages), "page"), plural(len(g.Nodes)-len(pages), "dependency"))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// useNodes lists what id uses, and what those use in turn. A node that
+// uses itself through others is not expanded again.
+func useNodes(g *deps.Graph, id string, path map[string]bool) []*treeNode {
+	var out []*treeNode
+	for _, e := range g.Uses(id) {
+		n := g.Nodes[e.To]
+		node := &treeNode{label: fmt.Sprintf("line %d: %s (%s)", e.Line, nodeLabel(n), kindLabel(n))}
+		if !path[e.To] {
+			path[e.To] = true
+			node.children = useNodes(g, e.To, path)
+			delete(path, e.To)
+		}
+		out = append(out, node)
+	}
+	return out
+}
+
+// writeUsers draws each of ids with what uses it as a tree, out to the
+// pages, and counts the pages.
+func writeUsers(w io.Writer, g *deps.Graph, ids []string) error {
+	var b strings.Builder
+	for i, id := range ids {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		n := g.Nodes[id]
+		fmt.Fprintf(&b, "%s (%s)\n", nodeLabel(n), kindLabel(n))
+		drawTree(&b, "", userNodes(g, id, map[string]bool{id: true}))
+		fmt.Fprintf(&b, "Used by %s\n", plural(len(g.Pages(id)), "page"))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func userNodes(g *deps.Graph, id string, path map[string]bool) []*treeNode {
+	var out []*treeNode
+	for _, e := range g.UsedBy(id) {
+		n := g.Nodes[e.From]
+		node := &treeNode{label: fmt.Sprintf("%s:%d (%s)", nodeLabel(n), e.Line, kindLabel(n))}
+		if !path[e.From] {
+			path[e.From] = true
+			node.children = userNodes(g, e.From, path)
+			delete(path, e.From)
+		}
+		out = append(out, node)
+	}
+	return out
+}
+
+func writeOrphans(w io.Writer, g *deps.Graph, format string) error {
+	orphans, err := g.Orphans()
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(append([]string{}, orphans...))
+	}
+	var b strings.Builder
+	for _, path := range orphans {
+		b.WriteString(path + "\n")
+	}
+	fmt.Fprintf(&b, "%s that no page uses\n", plural(len(orphans), "file"))
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// writeDOT writes the graph in the Graphviz DOT language.
+func writeDOT(w io.Writer, g *deps.Graph) error {
+	shapes := map[deps.Kind]string{
+		deps.KindPage:     "box",
+		deps.KindInclude:  "note",
+		deps.KindLiteral:  "component",
+		deps.KindExtract:  "tab",
+		deps.KindConstant: "ellipse",
+		deps.KindShared:   "box3d",
+	}
+	var b strings.Builder
+	b.WriteString("digraph proctest {\n  rankdir=LR;\n")
+	for _, id := range nodeIDs(g, "") {
+		n := g.Nodes[id]
+		attrs := fmt.Sprintf("label=%s, shape=%s", strconv.Quote(nodeLabel(n)), shapes[n.Kind])
+		if n.Missing {
+			attrs += ", style=dashed"
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", strconv.Quote(id), attrs)
+	}
+	for _, e := range linkedPairs(g) {
+		fmt.Fprintf(&b, "  %s -> %s;\n", strconv.Quote(e.From), strconv.Quote(e.To))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// linkedPairs returns the edges of g without their lines, once for each
+// pair of nodes.
+func linkedPairs(g *deps.Graph) []deps.Edge {
+	var out []deps.Edge
+	seen := map[deps.Edge]bool{}
+	for _, e := range g.Edges {
+		e.Line = 0
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// writeMermaid writes the graph as a Mermaid flowchart, which GitHub
+// renders in Markdown.
+func writeMermaid(w io.Writer, g *deps.Graph) error {
+	shapes := map[deps.Kind][2]string{
+		deps.KindPage:     {"[", "]"},
+		deps.KindInclude:  {"(", ")"},
+		deps.KindLiteral:  {"[/", "/]"},
+		deps.KindExtract:  {"[[", "]]"},
+		deps.KindConstant: {"{{", "}}"},
+		deps.KindShared:   {"[(", ")]"},
+	}
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	names := map[string]string{}
+	var missing []string
+	for i, id := range nodeIDs(g, "") {
+		n := g.Nodes[id]
+		names[id] = "n" + strconv.Itoa(i)
+		shape := shapes[n.Kind]
+		label := strings.ReplaceAll(nodeLabel(n), `"`, "#quot;")
+		fmt.Fprintf(&b, "  %s%s\"%s\"%s\n", names[id], shape[0], label, shape[1])
+		if n.Missing {
+			missing = append(missing, names[id])
+		}
+	}
+	for _, e := range linkedPairs(g) {
+		fmt.Fprintf(&b, "  %s --> %s\n", names[e.From], names[e.To])
+	}
+	if len(missing) > 0 {
+		b.WriteString("  classDef missing stroke-dasharray: 5 5\n")
+		fmt.Fprintf(&b, "  class %s missing\n", strings.Join(missing, ","))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// graphJSON is the JSON output of graph.
+type graphJSON struct {
+	Nodes []*deps.Node `json:"nodes"`
+	Edges []deps.Edge  `json:"edges"`
+}
+
+func writeGraphJSON(w io.Writer, g *deps.Graph) error {
+	out := graphJSON{Nodes: []*deps.Node{}, Edges: append([]deps.Edge{}, g.Edges...)}
+	for _, id := range nodeIDs(g, "") {
+		out.Nodes = append(out.Nodes, g.Nodes[id])
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGraphUsesAndOrphans(t *testing.T) {
+	files := map[string]string{
+		"snooty.toml": "name = \"docs\"\n\n[constants]\nversion = \"8.0\"\n",
+		"source/index.txt": `Index
+=====
+
+.. include:: /includes/steps-connect.rst
+
+MongoDB {+version+}
+`,
+		"source/other.txt": `Other
+=====
+
+.. include:: /includes/steps-connect.rst
+`,
+		"source/includes/steps-connect.rst": ".. literalinclude:: /includes/code/connect.go\n",
+		"source/includes/code/connect.go":   "package main\n",
+		"source/includes/unused.rst":        ".. include:: /includes/only-unused.rst\n",
+		"source/includes/only-unused.rst":   "Only unused.rst includes this.\n",
+	}
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		want     string
+	}{
+		{
+			name:     "uses",
+			args:     []string{"--uses", "connect.go", "source/"},
+			wantCode: exitOK,
+			want: `source/includes/code/connect.go (literalinclude)
+└─ source/includes/steps-connect.rst:1 (include)
+   ├─ source/index.txt:4 (page)
+   └─ source/other.txt:4 (page)
+Used by 2 pages
+`,
+		},
+		{
+			name:     "uses a constant",
+			args:     []string{"--uses", "{+version+}", "source/"},
+			wantCode: exitOK,
+			want: `{+version+} (constant)
+└─ source/index.txt:6 (page)
+Used by 1 page
+`,
+		},
+		{
+			name:     "uses as JSON keeps the part that leads to the file",
+			args:     []string{"--uses", "{+version+}", "--format", "json", "source/"},
+			wantCode: exitOK,
+			want: `{
+  "nodes": [
+    {
+      "id": "snooty.toml#version",
+      "kind": "constant",
+      "file": "snooty.toml",
+      "name": "version"
+    },
+    {
+      "id": "source/index.txt",
+      "kind": "page",
+      "file": "source/index.txt"
+    }
+  ],
+  "edges": [
+    {
+      "from": "source/index.txt",
+      "to": "snooty.toml#version",
+      "line": 6
+    }
+  ]
+}
+`,
+		},
+		{
+			name:     "uses nothing a page uses",
+			args:     []string{"--uses", "unused.rst", "source/"},
+			wantCode: exitError,
+		},
+		{
+			name:     "orphans",
+			args:     []string{"--orphans", "source/"},
+			wantCode: exitOK,
+			want: `source/includes/only-unused.rst
+source/includes/unused.rst
+2 files that no page uses
+`,
+		},
+		{
+			name:     "orphans of some pages",
+			args:     []string{"--orphans", "--format", "json", "source/other.txt"},
+			wantCode: exitOK,
+			want: `[
+  "source/includes/only-unused.rst",
+  "source/includes/unused.rst"
+]
+`,
+		},
+		{
+			name:     "orphans and uses",
+			args:     []string{"--orphans", "--uses", "connect.go", "source/"},
+			wantCode: exitError,
+		},
+		{
+			name:     "orphans as DOT",
+			args:     []string{"--orphans", "--format", "dot", "source/"},
+			wantCode: exitError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			writeFiles(t, files)
+			if code := graphCommand(append([]string{"--output", "graph.out"}, tt.args...)); code != tt.wantCode {
+				t.Fatalf("graph exited with %d, want %d", code, tt.wantCode)
+			}
+			if tt.wantCode != exitOK {
+				return
+			}
+			got, err := os.ReadFile("graph.out")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("graph wrote:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/history"
+)
+
+func historyCommand(args []string) int {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest history [flags]")
+		fmt.Fprintln(flags.Output(), "\nLists the flakiest test cases, the slowest steps and the test cases that are broken, with the run they broke in.")
+		flags.PrintDefaults()
+	}
+	file := flags.String("history", history.DefaultPath, "history file that proctest test appends to")
+	add := flags.String("add", "", "append the results file --reporter json wrote to the history, instead of listing it")
+	commit := flags.String("commit", "", "commit the results of --add tested")
+	since := flags.Duration("since", 0, "only consider runs in this period, such as 720h")
+	owner := flags.String("owner", "", "only list test cases this owner is responsible for")
+	top := flags.Int("top", 10, "how many flaky test cases and slow steps to list")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	if len(args) > 0 {
+		flags.Usage()
+		return exitError
+	}
+
+	if *add != "" {
+		doc, err := readResults(*add)
+		if err == nil {
+			err = history.Append(*file, history.Records(doc, *commit))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	records, err := history.Load(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	if *since > 0 {
+		records = history.Since(records, time.Now().Add(-*since))
+	}
+	if *owner != "" {
+		records = slices.DeleteFunc(records, func(r history.Record) bool { return r.Owner != *owner })
+	}
+	if len(records) == 0 {
+		fmt.Printf("No runs recorded in %s\n", *file)
+		return exitOK
+	}
+	trends := history.Analyze(records)
+	runs := map[time.Time]bool{}
+	for _, r := range records {
+		runs[r.Run] = true
+	}
+	fmt.Printf("%s of %s\n", plural(len(runs), "run"), plural(len(trends), "test case"))
+	writeFlaky(os.Stdout, trends, *top)
+	writeSlow(os.Stdout, history.Steps(records), *top)
+	writeBroken(os.Stdout, trends)
+	return exitOK
+}
+
+// writeFlaky lists the test cases that flip between passing and failing
+// or pass only after retries, flakiest first.
+func writeFlaky(w io.Writer, trends []*history.Trend, top int) {
+	var flaky []*history.Trend
+	for _, t := range trends {
+		if t.Flakiness() > 0 {
+			flaky = append(flaky, t)
+		}
+	}
+	slices.SortStableFunc(flaky, func(a, b *history.Trend) int {
+		return cmp.Or(cmp.Compare(b.Flakiness(), a.Flakiness()), cmp.Compare(b.Runs, a.Runs))
+	})
+	fmt.Fprintln(w, "\nFlakiest test cases:")
+	if len(flaky) == 0 {
+		fmt.Fprintln(w, "  none")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  FLAKY\tPASS RATE\tFLIPS\tRUNS\tTEST CASE")
+	for _, t := range flaky[:min(top, len(flaky))] {
+		fmt.Fprintf(tw, "  %.0f%%\t%.0f%%\t%d\t%d\t%s (%s)\n", 100*t.Flakiness(), 100*t.PassRate(), t.Flips, t.Runs, t.Name, t.File)
+	}
+	tw.Flush()
+}
+
+// writeSlow lists the steps that take longest on average, with how much
+// their recent runs changed.
+func writeSlow(w io.Writer, steps []*history.StepTrend, top int) {
+	slices.SortStableFunc(steps, func(a, b *history.StepTrend) int { return cmp.Compare(b.Mean(), a.Mean()) })
+	fmt.Fprintln(w, "\nSlowest steps:")
+	if len(steps) == 0 {
+		fmt.Fprintln(w, "  none")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  MEAN\tLAST\tTREND\tSTEP")
+	for _, s := range steps[:min(top, len(steps))] {
+		trend := "-"
+		if c := s.Change(); c != 0 {
+			trend = fmt.Sprintf("%+.0f%%", 100*c)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s › Step %d: %s\n", millis(s.Mean()), millis(s.Durations[len(s.Durations)-1]), trend, s.Name, s.Number, s.Title)
+	}
+	tw.Flush()
+}
+
+// writeBroken lists the test cases whose last run failed, longest broken
+// first, with the run and commit they broke in.
+func writeBroken(w io.Writer, trends []*history.Trend) {
+	var broken []*history.Trend
+	for _, t := range trends {
+		if t.Broken() {
+			broken = append(broken, t)
+		}
+	}
+	slices.SortStableFunc(broken, func(a, b *history.Trend) int { return a.BrokenSince.Compare(b.BrokenSince) })
+	fmt.Fprintln(w, "\nBroken:")
+	if len(broken) == 0 {
+		fmt.Fprintln(w, "  none")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  BROKEN SINCE\tFAILED RUNS\tCOMMIT\tLAST PASSED\tTEST CASE")
+	for _, t := range broken {
+		commit := cmp.Or(t.BrokenCommit, "-")
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		passed := "never"
+		if !t.LastPassed.IsZero() {
+			passed = t.LastPassed.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "  %s\t%d\t%s\t%s\t%s (%s)\n", t.BrokenSince.Local().Format(time.DateTime), t.Streak, commit, passed, t.Name, t.File)
+		if t.LastError != "" {
+			fmt.Fprintf(tw, "  \t\t\t\t  %s\n", t.LastError)
+		}
+	}
+	tw.Flush()
+}
+
+// millis formats a duration in milliseconds.
+func millis(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	if d < time.Second {
+		return d.String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+func plural(n int, thing string) string {
+	if n == 1 {
+		return "1 " + thing
+	}
+	if strings.HasSuffix(thing, "y") {
+		return fmt.Sprintf("%d %sies", n, strings.TrimSuffix(thing, "y"))
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
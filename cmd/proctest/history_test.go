@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/history"
+)
+
+func TestHistoryReadsTheFileTestWrites(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("GREETING", "hello")
+	writeFiles(t, map[string]string{
+		".git/HEAD":        "ref: refs/heads/main\n",
+		"source/greet.txt": greetPage,
+	})
+	if code := testCommand([]string{"--history", "runs.jsonl", "-q", "source/greet.txt"}); code != exitOK {
+		t.Fatalf("test exited with %d", code)
+	}
+	if _, err := os.Stat(history.DefaultPath); err == nil {
+		t.Errorf("test wrote %s as well as runs.jsonl", history.DefaultPath)
+	}
+	if code := historyCommand([]string{"--history", "runs.jsonl"}); code != exitOK {
+		t.Errorf("history --history exited with %d", code)
+	}
+}
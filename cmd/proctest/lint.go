@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/lint"
+	"github.com/dacharyc/spike-procedural-testing/internal/parser"
+	"github.com/dacharyc/spike-procedural-testing/internal/report"
+)
+
+func lintCommand(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest lint [flags] <file|directory>...")
+		fmt.Fprintln(flags.Output(), "\nReports problems in pages without running them: missing includes, unknown code languages, deprecated markup and implicit directory navigation.")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "text", "output format: text or sarif")
+	output := flags.String("output", "", "file to write to instead of stdout")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "text" && *format != "sarif" {
+		fmt.Fprintf(os.Stderr, "proctest: invalid --format %q: use text or sarif\n", *format)
+		return exitError
+	}
+	files, err := discover(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+
+	var diags []lint.Diagnostic
+	for _, file := range files {
+		doc, err := parser.New(nil).ParseFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+		diags = append(diags, lint.Check(doc)...)
+	}
+
+	var outs outputs
+	defer outs.close()
+	w, err := outs.open(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	if *format == "sarif" {
+		err = report.WriteSARIF(w, diags)
+	} else {
+		err = writeDiagnostics(w, diags)
+	}
+	if err == nil {
+		err = outs.close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	for _, d := range diags {
+		if d.Severity == lint.SeverityError {
+			return exitFailed
+		}
+	}
+	return exitOK
+}
+
+// writeDiagnostics lists diagnostics as file:line: severity: message.
+func writeDiagnostics(w io.Writer, diags []lint.Diagnostic) error {
+	for _, d := range diags {
+		if _, err := fmt.Fprintf(w, "%s: %s: %s [%s]\n", d.Location, d.Severity, d.Message, d.Rule); err != nil {
+			return err
+		}
+		for _, loc := range d.Location.Chain()[1:] {
+			fmt.Fprintf(w, "  included from %s\n", loc)
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d problem(s)\n", len(diags))
+	return err
+}
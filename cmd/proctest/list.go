@@ -0,0 +1,140 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+// listEntry is a test case in the JSON output of list.
+type listEntry struct {
+	ID        string       `json:"id"`
+	File      string       `json:"file"`
+	Name      string       `json:"name"`
+	Procedure string       `json:"procedure"`
+	Line      int          `json:"line"`
+	Variant   *ast.Variant `json:"variant,omitempty"`
+}
+
+func listCommand(args []string) int {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest list [flags] [file|directory]...")
+		fmt.Fprintln(flags.Output(), "\nLists the test cases proctest test would run, with their IDs: every procedure, or every variant of a procedure that has them.")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "text", "output format: text or json")
+	output := flags.String("output", "", "file to write to instead of stdout")
+	filter := filterFlags(flags)
+	changedSince := changedSinceFlag(flags)
+	configPath := configFlag(flags)
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	if len(args) == 0 && len(cfg.TestFiles) == 0 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "proctest: invalid --format %q: use text or json\n", *format)
+		return exitError
+	}
+	files, err := configPages(cfg, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	groups, err := configGroups(cfg, *configPath, files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	var jobs []runner.Job
+	for _, g := range groups {
+		_, groupJobs, err := parseGroup(g, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+		jobs = append(jobs, groupJobs...)
+	}
+	jobs = filter.Jobs(jobs)
+	if *changedSince != "" {
+		jobs, err = changedJobs(*changedSince, jobs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+	}
+
+	var outs outputs
+	defer outs.close()
+	w, err := outs.open(*output)
+	if err == nil {
+		if *format == "json" {
+			err = writeListJSON(w, jobs)
+		} else {
+			err = writeList(w, jobs)
+		}
+	}
+	if err == nil {
+		err = outs.close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// writeList lists the test cases as a table.
+func writeList(w io.Writer, jobs []runner.Job) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTEST CASE\tLOCATION\tSELECTION")
+	for _, j := range jobs {
+		r := runner.ProcedureResult{Procedure: j.Procedure, Variant: j.Variant}
+		sel := "-"
+		if j.Variant != nil {
+			sel = cmp.Or(j.Variant.Selection.String(), "-")
+		}
+		loc := j.Procedure.Location.Outermost()
+		fmt.Fprintf(tw, "%s\t%s\t%s:%d\t%s\n", r.ID(), r.Name(), loc.File, loc.StartLine, sel)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s\n", plural(len(jobs), "test case"))
+	return err
+}
+
+func writeListJSON(w io.Writer, jobs []runner.Job) error {
+	entries := []listEntry{}
+	for _, j := range jobs {
+		r := runner.ProcedureResult{Procedure: j.Procedure, Variant: j.Variant}
+		loc := j.Procedure.Location.Outermost()
+		entries = append(entries, listEntry{
+			ID:        r.ID(),
+			File:      loc.File,
+			Name:      r.Name(),
+			Procedure: j.Procedure.Title,
+			Line:      loc.StartLine,
+			Variant:   j.Variant,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
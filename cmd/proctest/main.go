@@ -0,0 +1,122 @@
+// Command proctest tests documentation procedures by running them as
+// written.
+//
+// Usage:
+//
+//	proctest test [flags] <file|directory>...
+//	proctest parse [flags] <file|directory>...
+//	proctest list [flags] [file|directory]...
+//	proctest sweep [flags]
+//	proctest cassettes [flags] <file|directory>...
+//	proctest lint [flags] <file|directory>...
+//	proctest graph [flags] <file|directory>...
+//	proctest report [flags] <results.json>
+//	proctest history [flags]
+//	proctest registry <add|verify|prune|expire-skips> [flags]
+//	proctest config convert [flags] [.proctest.js]
+//	proctest config explain [flags] <page|directory>
+//	proctest schema [results|registry|config]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Exit codes.
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitError  = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return exitError
+	}
+	switch args[0] {
+	case "test":
+		return testCommand(args[1:])
+	case "parse":
+		return parseCommand(args[1:])
+	case "list":
+		return listCommand(args[1:])
+	case "sweep":
+		return sweepCommand(args[1:])
+	case "cassettes":
+		return cassettesCommand(args[1:])
+	case "lint":
+		return lintCommand(args[1:])
+	case "graph":
+		return graphCommand(args[1:])
+	case "report":
+		return reportCommand(args[1:])
+	case "history":
+		return historyCommand(args[1:])
+	case "registry":
+		return registryCommand(args[1:])
+	case "config":
+		return configCommand(args[1:])
+	case "schema":
+		return schemaCommand(args[1:])
+	case "-h", "-help", "--help", "help":
+		usage()
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "proctest: unknown command %q\n", args[0])
+	usage()
+	return exitError
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage: proctest <command> [flags] [arguments]
+
+Commands:
+  test       run the procedures in documentation pages
+  parse      show the procedures, steps and actions found in pages
+  list       list the test cases in pages and their variants
+  sweep      remove test resources left behind by interrupted runs
+  cassettes  report recorded interactions that are missing or stale
+  lint       report problems in pages without running them
+  graph      show the includes, literalincludes, extracts and constants pages use
+  report     render JSON results as an HTML report or Markdown summary
+  history    list flaky, slow and broken procedures from earlier runs
+  registry   add, verify and prune the entries of a test registry
+  config     convert a .proctest.js, or explain the configuration a page runs with
+  schema     print the JSON Schema of the JSON results, the test registry or the configuration file
+
+Run "proctest <command> -h" for the flags of a command. Flags can come
+before or after the files.
+
+Exit status is 0 when everything passed, 1 when a test case failed or
+lint found an error, and 2 for invalid flags, unreadable pages and other
+errors.
+`)
+}
+
+// parseFlags parses args like flags.Parse but lets flags follow the
+// positional arguments, as in "proctest test page.txt --verbose", and
+// returns the positional arguments. Everything after "--" is positional.
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := flags.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
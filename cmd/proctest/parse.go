@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/parser"
+)
+
+func parseCommand(args []string) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest parse [flags] <file|directory>...")
+		fmt.Fprintln(flags.Output(), "\nShows the procedures, steps and testable actions found in pages, and the placeholders they need, without running them.")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "tree", "output format: tree, json or yaml")
+	output := flags.String("output", "", "file to write to instead of stdout")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "tree" && *format != "json" && *format != "yaml" {
+		fmt.Fprintf(os.Stderr, "proctest: invalid --format %q: use tree, json or yaml\n", *format)
+		return exitError
+	}
+	docs, err := parseFiles(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+
+	var outs outputs
+	defer outs.close()
+	w, err := outs.open(*output)
+	if err == nil {
+		switch *format {
+		case "json":
+			err = writeJSON(w, docs)
+		case "yaml":
+			err = writeYAML(w, docs)
+		default:
+			err = writeTree(w, docs)
+		}
+	}
+	if err == nil {
+		err = outs.close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// parseFiles parses the pages args name.
+func parseFiles(args []string) ([]*ast.Document, error) {
+	files, err := discover(args)
+	if err != nil {
+		return nil, err
+	}
+	var docs []*ast.Document
+	for _, file := range files {
+		doc, err := parser.New(nil).ParseFile(file)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// writeJSON writes the document of a single page, or an array of them.
+func writeJSON(w io.Writer, docs []*ast.Document) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if len(docs) == 1 {
+		return enc.Encode(docs[0])
+	}
+	return enc.Encode(docs)
+}
+
+// writeYAML writes one YAML document per page.
+func writeYAML(w io.Writer, docs []*ast.Document) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// treeNode is a line of the tree view and the lines nested under it.
+type treeNode struct {
+	label    string
+	children []*treeNode
+}
+
+// writeTree draws each page's procedures as a tree, then lists the
+// placeholders the pages need and totals what was found.
+func writeTree(w io.Writer, docs []*ast.Document) error {
+	var b strings.Builder
+	var placeholders []string
+	uses := map[string]int{}
+	var procedures, steps int
+	actions := map[ast.ActionType]int{}
+	count := func(as []ast.Action) {
+		for _, a := range as {
+			actions[a.Kind()]++
+			for _, p := range ast.Placeholders(a) {
+				if uses[p] == 0 {
+					placeholders = append(placeholders, p)
+				}
+				uses[p]++
+			}
+		}
+	}
+	for i, doc := range docs {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if len(docs) > 1 {
+			fmt.Fprintf(&b, "%s\n", doc.File)
+		}
+		if len(doc.Procedures) == 0 {
+			b.WriteString("No procedures found\n")
+		}
+		for _, proc := range doc.Procedures {
+			procedures++
+			fmt.Fprintf(&b, "Procedure: %s [%s]\n", proc.Title, proc.ID)
+			var nodes []*treeNode
+			if proc.Prerequisites != nil && len(proc.Prerequisites.Requirements) > 0 {
+				n := &treeNode{label: "Prerequisites"}
+				for _, req := range proc.Prerequisites.Requirements {
+					n.children = append(n.children, &treeNode{label: requirementLabel(req)})
+				}
+				nodes = append(nodes, n)
+			}
+			if len(proc.Variants) > 0 {
+				n := &treeNode{label: "Variants"}
+				for _, v := range proc.Variants {
+					n.children = append(n.children, &treeNode{label: fmt.Sprintf("@%s: %s (%s)", v.ID, v.Label, v.Selection)})
+				}
+				nodes = append(nodes, n)
+			}
+			for _, step := range proc.Steps {
+				steps++
+				count(step.Actions)
+				n := &treeNode{label: fmt.Sprintf("Step %d: %s", step.Number, step.Title), children: actionNodes(proc, step.Actions)}
+				for _, sub := range step.SubSteps {
+					count(sub.Actions)
+					n.children = append(n.children, &treeNode{
+						label:    fmt.Sprintf("Step %d.%s: %s", step.Number, sub.Number, sub.Title),
+						children: actionNodes(proc, sub.Actions),
+					})
+				}
+				nodes = append(nodes, n)
+			}
+			drawTree(&b, "", nodes)
+		}
+	}
+
+	if len(placeholders) > 0 {
+		b.WriteString("\nPlaceholders found:\n")
+		for _, p := range placeholders {
+			fmt.Fprintf(&b, "  - %s (%s)\n", p, plural(uses[p], "occurrence"))
+		}
+	}
+	total := 0
+	var kinds []string
+	for _, t := range ast.ActionTypes {
+		if n := actions[t]; n > 0 {
+			total += n
+			kinds = append(kinds, fmt.Sprintf("%d %s", n, actionNames[t]))
+		}
+	}
+	b.WriteString("\nSummary:\n")
+	if len(docs) > 1 {
+		fmt.Fprintf(&b, "  Files: %d\n", len(docs))
+	}
+	fmt.Fprintf(&b, "  Procedures: %d\n", procedures)
+	fmt.Fprintf(&b, "  Steps: %d\n", steps)
+	fmt.Fprintf(&b, "  Testable Actions: %d", total)
+	if len(kinds) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(kinds, ", "))
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func drawTree(b *strings.Builder, prefix string, nodes []*treeNode) {
+	for i, n := range nodes {
+		branch, indent := "├─ ", "│  "
+		if i == len(nodes)-1 {
+			branch, indent = "└─ ", "   "
+		}
+		fmt.Fprintf(b, "%s%s%s\n", prefix, branch, n.label)
+		drawTree(b, prefix+indent, n.children)
+	}
+}
+
+// actionNodes lists actions with their IDs, shortened to the part after
+// the procedure ID.
+func actionNodes(proc *ast.Procedure, actions []ast.Action) []*treeNode {
+	var out []*treeNode
+	for _, a := range actions {
+		id := strings.TrimPrefix(a.Base().ID, proc.ID+"/")
+		out = append(out, &treeNode{label: fmt.Sprintf("%s [%s]", actionLabel(a), id)})
+	}
+	return out
+}
+
+// requirementLabel describes a prerequisite on one line.
+func requirementLabel(req ast.Requirement) string {
+	label := req.Subject()
+	switch req := req.(type) {
+	case *ast.SoftwareRequirement:
+		if req.Version != "" {
+			label += " " + req.Version
+		}
+	case *ast.ConfigurationRequirement:
+		if req.Path != "" {
+			label += " (" + req.Path + ")"
+		}
+	}
+	label = requirementNames[req.Kind()] + ": " + label
+	if req.Base().Optional {
+		label += " (optional)"
+	}
+	return label
+}
+
+// requirementNames are the names the tree view gives requirement types.
+var requirementNames = map[ast.RequirementType]string{
+	ast.RequirementSoftware:      "Software",
+	ast.RequirementEnvironment:   "Environment",
+	ast.RequirementService:       "Service",
+	ast.RequirementConfiguration: "Configuration",
+}
+
+// actionNames are the names the tree view gives action types.
+var actionNames = map[ast.ActionType]string{
+	ast.ActionCode:     "Code",
+	ast.ActionShell:    "Shell",
+	ast.ActionUI:       "UI",
+	ast.ActionCLI:      "CLI",
+	ast.ActionAPI:      "API",
+	ast.ActionDownload: "Download",
+	ast.ActionURL:      "URL",
+	ast.ActionFile:     "File",
+	ast.ActionWait:     "Wait",
+}
+
+// actionLabel describes an action on one line: its type and the first
+// line of what it runs.
+func actionLabel(a ast.Action) string {
+	var what string
+	switch a := a.(type) {
+	case *ast.CodeAction:
+		what = a.Language + " " + a.FilePath
+		if a.FilePath == "" {
+			what = a.Language + ": " + a.Code
+		}
+	case *ast.ShellAction:
+		what = a.Command
+	case *ast.UIAction:
+		what = a.Description
+	case *ast.CLIAction:
+		what = a.Tool + ": " + a.Command
+	case *ast.APIAction:
+		what = a.Method + " " + a.Endpoint
+	case *ast.DownloadAction:
+		what = a.URL
+	case *ast.URLAction:
+		what = a.URL
+	case *ast.FileAction:
+		what = a.Operation + " " + a.Path
+	case *ast.WaitAction:
+		what = a.Target()
+	}
+	return actionNames[a.Kind()] + ": " + summarize(what)
+}
+
+// summarize shortens s to the start of its first line, marking what was
+// left out.
+func summarize(s string) string {
+	line, _, more := strings.Cut(strings.TrimSpace(s), "\n")
+	if r := []rune(line); len(r) > 72 {
+		line, more = string(r[:72]), true
+	}
+	if more {
+		line += " …"
+	}
+	return line
+}
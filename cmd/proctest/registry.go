@@ -0,0 +1,507 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/parser"
+	"github.com/dacharyc/spike-procedural-testing/internal/registry"
+	"github.com/dacharyc/spike-procedural-testing/internal/report"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+// registryFlags select the entries of a test registry to run.
+type registryFlags struct {
+	path           string
+	tags           []string
+	owner          string
+	includeSkipped bool
+}
+
+func addRegistryFlags(flags *flag.FlagSet) *registryFlags {
+	rf := &registryFlags{}
+	flags.StringVar(&rf.path, "registry", "", "run the pages listed in this test registry instead of, or limited to, the files given")
+	flags.Func("tags", "only run registry entries with any of these tags, such as atlas,tutorial (repeatable)", func(v string) error {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				rf.tags = append(rf.tags, tag)
+			}
+		}
+		return nil
+	})
+	flags.StringVar(&rf.owner, "owner", "", "only run registry entries this team or person owns")
+	flags.BoolVar(&rf.includeSkipped, "include-skipped", false, "run registry entries that are skipped for now too")
+	return rf
+}
+
+// check reports the flags that only apply with --registry.
+func (rf *registryFlags) check() error {
+	if rf.path == "" && (len(rf.tags) > 0 || rf.owner != "" || rf.includeSkipped) {
+		return errors.New("--tags, --owner and --include-skipped need --registry")
+	}
+	return nil
+}
+
+// pages returns the pages of the registry entries the flags select, so
+// that they can be grouped by their configuration files before they are
+// parsed.
+func (rf *registryFlags) pages() ([]string, error) {
+	reg, err := registry.Load(rf.path)
+	if err != nil {
+		return nil, err
+	}
+	var pages []string
+	for _, e := range reg.Select(rf.tags, rf.owner) {
+		if page := reg.Path(e); !slices.Contains(pages, page) {
+			pages = append(pages, page)
+		}
+	}
+	return pages, nil
+}
+
+// registryJobs loads the registry and returns the pages and test cases of
+// the entries the flags select, parsed with p. When files are given, only
+// the entries for those files are run. It fails when an entry's page does
+// not exist or lacks a variant the entry lists.
+func registryJobs(rf *registryFlags, files []string, p *parser.Parser) ([]*ast.Document, []runner.Job, error) {
+	reg, err := registry.Load(rf.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries := reg.Select(rf.tags, rf.owner)
+	if files != nil {
+		entries = slices.DeleteFunc(entries, func(e *registry.Entry) bool {
+			return !slices.ContainsFunc(files, func(f string) bool { return samePath(f, reg.Path(e)) })
+		})
+	}
+	docs, err := reg.Pages(entries, p.ParseFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	var jobs []runner.Job
+	for i, e := range entries {
+		for _, j := range e.Jobs(docs[i], now) {
+			if rf.includeSkipped {
+				j.SkipReason = ""
+			}
+			jobs = append(jobs, j)
+		}
+	}
+	return docs, jobs, nil
+}
+
+func samePath(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && a == b
+}
+
+func registryCommand(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "add":
+			return registryAdd(args[1:])
+		case "verify":
+			return registryVerify(args[1:])
+		case "prune":
+			return registryPrune(args[1:])
+		case "expire-skips":
+			return registryExpireSkips(args[1:])
+		case "-h", "-help", "--help", "help":
+			registryUsage()
+			return exitOK
+		}
+		fmt.Fprintf(os.Stderr, "proctest: unknown registry command %q\n", args[0])
+	}
+	registryUsage()
+	return exitError
+}
+
+func registryUsage() {
+	fmt.Fprint(os.Stderr, `Usage: proctest registry <command> --registry <file> [flags]
+
+Commands:
+  add           run a page and add it to the registry with the variants that passed
+  verify        report entries whose page was moved or deleted or lost a variant
+  prune         remove entries whose page was deleted, and variants pages lost
+  expire-skips  report skips whose skipUntil date has come
+
+Changes keep the order and formatting of the rest of the file.
+`)
+}
+
+// openRegistry opens the registry file --registry names.
+func openRegistry(flags *flag.FlagSet, path string) (*registry.File, bool) {
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "proctest: --registry is required")
+		flags.Usage()
+		return nil, false
+	}
+	f, err := registry.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return nil, false
+	}
+	return f, true
+}
+
+func registryAdd(args []string) int {
+	flags := flag.NewFlagSet("registry add", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest registry add --registry <file> --owner <team> [flags] <page>")
+		fmt.Fprintln(flags.Output(), "\nRuns the page and adds an entry for it to the registry, with today's date. When some variants fail or are skipped, the entry lists the variants that passed; when all pass, it lists none, which tests every variant.")
+		flags.PrintDefaults()
+	}
+	path := flags.String("registry", "", "test registry file to change")
+	owner := flags.String("owner", "", "team or person responsible for the page")
+	id := flags.String("id", "", "entry ID (default: the page ID with / replaced by -)")
+	var tags []string
+	flags.Func("tags", "tags to select the entry by, such as atlas,tutorial (repeatable)", func(v string) error {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		return nil
+	})
+	notes := flags.String("notes", "", "what the entry tests or needs")
+	var variants []string
+	flags.Func("variant", "only consider this variant, by ID, label, value or selection (repeatable)", func(v string) error {
+		if _, _, err := runner.ParseVariantSelection(v); err != nil {
+			return err
+		}
+		variants = append(variants, v)
+		return nil
+	})
+	noRun := flags.Bool("no-run", false, "add the page without running it")
+	configPath := configFlag(flags)
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	if len(args) != 1 {
+		flags.Usage()
+		return exitError
+	}
+	if *owner == "" {
+		fmt.Fprintln(os.Stderr, "proctest: --owner is required")
+		return exitError
+	}
+	f, ok := openRegistry(flags, *path)
+	if !ok {
+		return exitError
+	}
+	page := args[0]
+	rel, err := f.RelativePath(page)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	for _, e := range f.Tests {
+		if e.Path == rel {
+			fmt.Fprintf(os.Stderr, "proctest: %s is already in the registry as %s\n", rel, e.ID)
+			return exitError
+		}
+	}
+	// The page is parsed and run with its own configuration, as
+	// proctest test would.
+	cfg, err := pageConfig(*configPath, page)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	p, err := configParser(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	doc, err := p.ParseFile(page)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	var opts runner.Options
+	if err := applyConfig(cfg, nil, &opts); err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	jobs := runner.Jobs(doc)
+	if len(variants) > 0 {
+		jobs = runner.Filter{Variants: variants}.Jobs(jobs)
+	}
+	if len(jobs) == 0 {
+		fmt.Fprintf(os.Stderr, "proctest: %s has no procedures to test\n", page)
+		return exitError
+	}
+
+	entry := &registry.Entry{
+		ID:        cmp.Or(*id, strings.ReplaceAll(doc.ID, "/", "-")),
+		Path:      rel,
+		Owner:     *owner,
+		AddedDate: time.Now().Format(registry.DateFormat),
+		Tags:      tags,
+		Notes:     *notes,
+	}
+	passed, all := verifiedVariants(runner.New(opts), jobs, *noRun)
+	if passed == nil {
+		fmt.Fprintf(os.Stderr, "proctest: not adding %s: no test case passed\n", rel)
+		return exitFailed
+	}
+	if !all || len(variants) > 0 {
+		entry.Variants = passed
+	}
+	if err := f.Add(entry); err == nil {
+		err = f.Save()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("Added %s (%s) to %s", entry.ID, rel, f.Path())
+	if len(entry.Variants) > 0 {
+		fmt.Printf(" with variants %s", strings.Join(entry.Variants, ", "))
+	}
+	fmt.Println()
+	return exitOK
+}
+
+// verifiedVariants runs jobs on r, unless noRun is set, and returns the IDs of
+// the variants that passed and whether every test case did. It returns
+// nil when nothing passed, or a procedure without variants failed or was
+// skipped, since the entry would run it anyway.
+func verifiedVariants(r *runner.Runner, jobs []runner.Job, noRun bool) (passed []string, all bool) {
+	passed, all = []string{}, true
+	add := func(v *ast.Variant) {
+		if v != nil && !slices.Contains(passed, v.ID) {
+			passed = append(passed, v.ID)
+		}
+	}
+	if noRun {
+		for _, j := range jobs {
+			add(j.Variant)
+		}
+		return passed, true
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	human := report.NewHuman(os.Stdout)
+	human.Redactor = r.Redactor
+	human.Total = len(jobs)
+	var results []runner.ProcedureResult
+	ok := true
+	r.Run(ctx, jobs, func(res runner.ProcedureResult) {
+		human.Procedure(&res)
+		results = append(results, res)
+		switch {
+		case res.Status() == runner.StatusPassed:
+			add(res.Variant)
+		case res.Variant == nil:
+			ok = false
+		default:
+			all = false
+		}
+	})
+	summary := runner.Summarize(results)
+	human.Summary(&summary)
+	fmt.Println()
+	if !ok || len(results) < len(jobs) || len(passed) == 0 && !all {
+		return nil, false
+	}
+	return passed, all
+}
+
+func registryVerify(args []string) int {
+	flags := flag.NewFlagSet("registry verify", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest registry verify --registry <file>")
+		fmt.Fprintln(flags.Output(), "\nReports registry entries whose page was moved or deleted, cannot be parsed, or no longer has a variant the entry lists.")
+		flags.PrintDefaults()
+	}
+	path := flags.String("registry", "", "test registry file to check")
+	configPath := configFlag(flags)
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	if len(args) > 0 {
+		flags.Usage()
+		return exitError
+	}
+	f, ok := openRegistry(flags, *path)
+	if !ok {
+		return exitError
+	}
+	_, problems := f.Check(f.Tests, configParse(*configPath))
+	for _, p := range problems {
+		fmt.Printf("✗ %s\n", problemText(f, p))
+	}
+	fmt.Printf("%s, %s\n", plural(len(f.Tests), "entry"), plural(len(problems), "problem"))
+	if len(problems) > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// problemText describes p, with where a missing page seems to have moved.
+func problemText(f *registry.File, p registry.Problem) string {
+	text := strings.TrimPrefix(p.Error(), "registry entry ")
+	if p.Missing {
+		if moved := f.Moved(p.Entry); moved != "" {
+			text += fmt.Sprintf("; moved to %s?", moved)
+		}
+	}
+	return text
+}
+
+func registryPrune(args []string) int {
+	flags := flag.NewFlagSet("registry prune", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest registry prune --registry <file> [flags]")
+		fmt.Fprintln(flags.Output(), "\nRemoves entries whose page was deleted, and variants their pages no longer have. An entry that loses every variant it lists is removed. Entries whose page seems to have moved are kept for you to update.")
+		flags.PrintDefaults()
+	}
+	path := flags.String("registry", "", "test registry file to change")
+	dryRun := flags.Bool("dry-run", false, "report what would be removed without changing the file")
+	configPath := configFlag(flags)
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	if len(args) > 0 {
+		flags.Usage()
+		return exitError
+	}
+	f, ok := openRegistry(flags, *path)
+	if !ok {
+		return exitError
+	}
+	_, problems := f.Check(f.Tests, configParse(*configPath))
+	removed, changed := 0, 0
+	for _, p := range problems {
+		e := p.Entry
+		switch {
+		case p.Missing && f.Moved(e) != "":
+			fmt.Printf("kept %s\n", problemText(f, p))
+			continue
+		case p.Err != nil:
+			fmt.Printf("kept %s\n", problemText(f, p))
+			continue
+		case p.Missing || len(p.Variants) == len(e.Variants):
+			fmt.Printf("removed %s\n", problemText(f, p))
+			removed++
+			err = f.Remove(e.ID)
+		default:
+			fmt.Printf("updated %s\n", problemText(f, p))
+			changed++
+			cp := *e
+			cp.Variants = slices.DeleteFunc(slices.Clone(e.Variants), func(v string) bool { return slices.Contains(p.Variants, v) })
+			err = f.Update(&cp)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+	}
+	if !*dryRun && removed+changed > 0 {
+		if err := f.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+	}
+	fmt.Printf("%s removed, %s updated", plural(removed, "entry"), plural(changed, "entry"))
+	if *dryRun {
+		fmt.Print(" (dry run)")
+	}
+	fmt.Println()
+	return exitOK
+}
+
+func registryExpireSkips(args []string) int {
+	flags := flag.NewFlagSet("registry expire-skips", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest registry expire-skips --registry <file> [flags]")
+		fmt.Fprintln(flags.Output(), "\nReports skips whose skipUntil date has come, so that their entries run again, and the skips still in effect. Exits with status 1 when expired skips are left in the file.")
+		flags.PrintDefaults()
+	}
+	path := flags.String("registry", "", "test registry file to check")
+	remove := flags.Bool("remove", false, "remove the expired skips from the file")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	if len(args) > 0 {
+		flags.Usage()
+		return exitError
+	}
+	f, ok := openRegistry(flags, *path)
+	if !ok {
+		return exitError
+	}
+	now := time.Now()
+	var expired []*registry.Entry
+	active := 0
+	for _, e := range f.Tests {
+		switch {
+		case e.Expired(now):
+			expired = append(expired, e)
+			fmt.Printf("✗ %s: skipped until %s (%s), owner %s\n", e.ID, e.Skip.SkipUntil, e.Skip.Reason, e.Owner)
+		case e.Skip != nil:
+			active++
+			fmt.Printf("- %s: %s\n", e.ID, strings.TrimPrefix(e.SkipReason(now), "skipped in the test registry "))
+		}
+	}
+	fmt.Printf("%s expired, %s in effect\n", plural(len(expired), "skip"), plural(active, "skip"))
+	if len(expired) == 0 {
+		return exitOK
+	}
+	if !*remove {
+		return exitFailed
+	}
+	for _, e := range expired {
+		cp := *e
+		cp.Skip = nil
+		if err := f.Update(&cp); err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+	}
+	if err := f.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("Removed %s from %s\n", plural(len(expired), "expired skip"), f.Path())
+	return exitOK
+}
+
+// configParse returns a function that parses a page with the parser of
+// the page's configuration, as proctest test does: the file at path, or
+// the files from the repository root down to the page.
+func configParse(path string) func(page string) (*ast.Document, error) {
+	parsers := map[string]*parser.Parser{}
+	return func(page string) (*ast.Document, error) {
+		dir := filepath.Dir(page)
+		p := parsers[dir]
+		if p == nil {
+			cfg, err := pageConfig(path, page)
+			if err != nil {
+				return nil, err
+			}
+			if p, err = configParser(cfg); err != nil {
+				return nil, err
+			}
+			parsers[dir] = p
+		}
+		return p.ParseFile(page)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files, by path, under the current directory.
+func writeFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+const greetPage = `=====
+Greet
+=====
+
+.. procedure::
+
+   .. step:: Check the greeting
+
+      Run the following command in your terminal:
+
+      .. code-block:: sh
+
+         test "$GREETING" = hello
+`
+
+func TestRegistryAddUsesThePageConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		args      []string
+		wantCode  int
+		wantAdded bool
+	}{
+		{
+			name:     "no configuration",
+			wantCode: exitFailed,
+		},
+		{
+			name: "the page's env file",
+			files: map[string]string{
+				"source/.proctest.toml": `envFiles = ["greet.env"]`,
+				"source/greet.env":      "GREETING=hello\n",
+			},
+			wantCode:  exitOK,
+			wantAdded: true,
+		},
+		{
+			name: "another directory's env file",
+			files: map[string]string{
+				"other/.proctest.toml": `envFiles = ["greet.env"]`,
+				"other/greet.env":      "GREETING=hello\n",
+			},
+			wantCode: exitFailed,
+		},
+		{
+			name: "--config",
+			files: map[string]string{
+				"ci.toml":   `envFiles = ["greet.env"]`,
+				"greet.env": "GREETING=hello\n",
+			},
+			args:      []string{"--config", "ci.toml"},
+			wantCode:  exitOK,
+			wantAdded: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			// Env files do not override the environment.
+			t.Setenv("GREETING", "")
+			os.Unsetenv("GREETING")
+			writeFiles(t, map[string]string{
+				".git/HEAD":        "ref: refs/heads/main\n",
+				"registry.json":    `{"version": "1.0", "tests": []}`,
+				"source/greet.txt": greetPage,
+			})
+			writeFiles(t, tt.files)
+			args := append([]string{"--registry", "registry.json", "--owner", "docs"}, tt.args...)
+			if code := registryAdd(append(args, "source/greet.txt")); code != tt.wantCode {
+				t.Errorf("registry add exited with %d, want %d", code, tt.wantCode)
+			}
+			data, err := os.ReadFile("registry.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if added := strings.Contains(string(data), `"source/greet.txt"`); added != tt.wantAdded {
+				t.Errorf("page added = %v, want %v; registry:\n%s", added, tt.wantAdded, data)
+			}
+		})
+	}
+}
+
+func TestTestRegistryUsesThePagesConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{"every entry", nil, exitOK},
+		{"entries by tag", []string{"--tags", "greeting"}, exitOK},
+		{"entries for a file", []string{"app/greet.txt"}, exitOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			t.Setenv("GREETING", "")
+			os.Unsetenv("GREETING")
+			writeFiles(t, map[string]string{
+				".git/HEAD":          "ref: refs/heads/main\n",
+				"app/.proctest.toml": `envFiles = ["greet.env"]`,
+				"app/greet.env":      "GREETING=hello\n",
+				"app/greet.txt":      greetPage,
+				"registry.json": `{"version": "1.0", "tests": [
+  {"id": "greet", "path": "app/greet.txt", "owner": "docs", "addedDate": "2025-01-01", "tags": ["greeting"]}
+]}`,
+			})
+			args := append([]string{"--registry", "registry.json", "--history", "", "-q"}, tt.args...)
+			if code := testCommand(args); code != tt.wantCode {
+				t.Errorf("test exited with %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
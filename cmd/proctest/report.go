@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/report"
+	"github.com/dacharyc/spike-procedural-testing/results"
+)
+
+func reportCommand(args []string) int {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest report [flags] <results.json>")
+		fmt.Fprintln(flags.Output(), "\nRenders the results that --reporter json wrote, such as those of an archived run.")
+		fmt.Fprintln(flags.Output(), "With --previous, the Markdown summary reports only what changed since that run.")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "html", "output format: html or markdown")
+	output := flags.String("output", "", "file to write to instead of stdout")
+	previous := flags.String("previous", "", "results of an earlier run to compare with (markdown)")
+	limit := flags.Int("limit", report.DefaultMarkdownLimit, "maximum size of the Markdown summary in bytes")
+	linkBase := flags.String("link-base", report.GitHubLinkBase(), "URL that file paths are appended to for links (markdown)")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	if len(args) != 1 {
+		flags.Usage()
+		return exitError
+	}
+	if *format != "html" && *format != "markdown" {
+		fmt.Fprintf(os.Stderr, "proctest: invalid --format %q: use html or markdown\n", *format)
+		return exitError
+	}
+
+	doc, err := readResults(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	var prev *results.Document
+	if *previous != "" {
+		if prev, err = readResults(*previous); err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+	}
+	var outs outputs
+	defer outs.close()
+	w, err := outs.open(*output)
+	if err == nil {
+		if *format == "markdown" {
+			md := report.NewMarkdown(w)
+			md.Previous, md.Limit, md.LinkBase = prev, *limit, *linkBase
+			err = md.Write(doc)
+		} else {
+			err = report.WriteHTML(w, doc)
+		}
+	}
+	if err == nil {
+		err = outs.close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// readResults reads a results file written by --reporter json.
+func readResults(path string) (*results.Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	doc, err := results.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc, nil
+}
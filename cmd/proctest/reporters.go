@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/lint"
+	"github.com/dacharyc/spike-procedural-testing/internal/redact"
+	"github.com/dacharyc/spike-procedural-testing/internal/report"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+// reporterNames lists the formats --reporter accepts.
+var reporterNames = []string{"human", "json", "junit", "sarif", "html", "markdown", "ndjson", "tap"}
+
+// reporterFlag is one --reporter: a format, and the file to write it to,
+// or "" for stdout.
+type reporterFlag struct {
+	name string
+	path string
+}
+
+// parseReporter parses "junit" or "junit=results.xml".
+func parseReporter(v string) (reporterFlag, error) {
+	name, path, _ := strings.Cut(v, "=")
+	if !slices.Contains(reporterNames, name) {
+		return reporterFlag{}, fmt.Errorf("unknown reporter %q: use %s", name, strings.Join(reporterNames, ", "))
+	}
+	return reporterFlag{name: name, path: path}, nil
+}
+
+// outputs opens the files reporters write to. Closing it closes them.
+type outputs []*os.File
+
+func (o *outputs) open(path string) (io.Writer, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	*o = append(*o, f)
+	return f, nil
+}
+
+func (o *outputs) close() error {
+	var first error
+	for _, f := range *o {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	*o = nil
+	return first
+}
+
+// reporterSpecs applies --output to the reporters given without a file
+// and checks that only one format is written to stdout.
+func reporterSpecs(specs []reporterFlag, output string) ([]reporterFlag, error) {
+	if output != "" {
+		var unset []int
+		for i, s := range specs {
+			if s.path == "" && s.name != "human" {
+				unset = append(unset, i)
+			}
+		}
+		switch {
+		case len(unset) == 0:
+			return nil, fmt.Errorf("--output needs a --reporter other than human")
+		case len(unset) > 1:
+			return nil, fmt.Errorf("--output is ambiguous with several reporters: use --reporter name=file")
+		}
+		specs[unset[0]].path = output
+	}
+	stdout := 0
+	for _, s := range specs {
+		if s.name != "human" && (s.path == "" || s.path == "-") {
+			stdout++
+		}
+	}
+	if stdout > 1 {
+		return nil, fmt.Errorf("only one reporter can write to stdout: use --reporter name=file")
+	}
+	return specs, nil
+}
+
+// toStdout reports whether a reporter other than the human one writes to
+// stdout, which then moves the human output to stderr.
+func toStdout(specs []reporterFlag) bool {
+	for _, s := range specs {
+		if s.name != "human" && (s.path == "" || s.path == "-") {
+			return true
+		}
+	}
+	return false
+}
+
+// newReporter creates the machine-readable reporter a --reporter names.
+// diags are the lint findings for the pages being run and total the
+// number of test cases.
+func newReporter(name string, w io.Writer, redactor *redact.Redactor, diags []lint.Diagnostic, total int) report.Reporter {
+	switch name {
+	case "json":
+		j := report.NewJSON(w)
+		j.Redactor = redactor
+		return j
+	case "junit":
+		j := report.NewJUnit(w)
+		j.Redactor = redactor
+		return j
+	case "html":
+		h := report.NewHTML(w)
+		h.Redactor = redactor
+		return h
+	case "markdown":
+		m := report.NewMarkdown(w)
+		m.Redactor = redactor
+		return m
+	case "ndjson":
+		n := report.NewNDJSON(w)
+		n.Total = total
+		n.Redactor = redactor
+		return n
+	case "tap":
+		t := report.NewTAP(w)
+		t.Redactor = redactor
+		return t
+	case "sarif":
+		s := report.NewSARIF(w)
+		s.Diagnostics = diags
+		s.Redactor = redactor
+		return s
+	}
+	return nil
+}
+
+// eventListener is a reporter that follows the run as it happens.
+type eventListener interface {
+	Event(runner.Event)
+}
+
+// fanOut returns a Runner.OnEvent that passes events to every reporter
+// that listens for them.
+func fanOut(reporters []report.Reporter) func(runner.Event) {
+	var listeners []eventListener
+	for _, rep := range reporters {
+		if l, ok := rep.(eventListener); ok {
+			listeners = append(listeners, l)
+		}
+	}
+	return func(e runner.Event) {
+		for _, l := range listeners {
+			l.Event(e)
+		}
+	}
+}
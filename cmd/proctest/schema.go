@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/config"
+	"github.com/dacharyc/spike-procedural-testing/internal/registry"
+	"github.com/dacharyc/spike-procedural-testing/results"
+)
+
+func schemaCommand(args []string) int {
+	flags := flag.NewFlagSet("schema", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest schema [results|registry|config]")
+		fmt.Fprintln(flags.Output(), "\nPrints the JSON Schema of the results that --reporter json writes, of the test registry, or of the configuration file.")
+		flags.PrintDefaults()
+	}
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	if len(args) > 1 {
+		flags.Usage()
+		return exitError
+	}
+	schema := results.Schema
+	if len(args) == 1 {
+		switch args[0] {
+		case "results":
+		case "registry":
+			schema = registry.Schema
+		case "config":
+			schema = config.Schema
+		default:
+			fmt.Fprintf(os.Stderr, "proctest: unknown schema %q: use results, registry or config\n", args[0])
+			return exitError
+		}
+	}
+	if _, err := os.Stdout.Write(schema); err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/cleanup"
+	"github.com/dacharyc/spike-procedural-testing/internal/sandbox"
+)
+
+func sweepCommand(args []string) int {
+	flags := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest sweep [flags]")
+		fmt.Fprintln(flags.Output(), "\nRemoves test databases, collections, search indexes and sandboxes left behind by interrupted runs.")
+		flags.PrintDefaults()
+	}
+	pattern := flags.String("pattern", cleanup.DefaultPattern.String(), "regular expression matching test database, collection and search index names")
+	uri := flags.String("uri", os.Getenv("MONGODB_URI"), "connection string of the deployment to sweep (default $MONGODB_URI)")
+	runsDir := flags.String("runs-dir", sandbox.DefaultRunsDir, "directory procedure sandboxes are created in")
+	minAge := flags.Duration("min-age", time.Hour, "only remove sandboxes older than this")
+	dryRun := flags.Bool("dry-run", false, "list what would be removed without removing it")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	if len(args) > 0 {
+		flags.Usage()
+		return exitError
+	}
+	re, err := regexp.Compile(*pattern)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: invalid --pattern: %v\n", err)
+		return exitError
+	}
+	if *uri == "" {
+		fmt.Fprintln(os.Stderr, "proctest: no connection string, sweeping sandboxes only (set MONGODB_URI or --uri)")
+	}
+
+	ctx := context.Background()
+	m := &cleanup.Mongo{URI: *uri, Env: os.Environ()}
+	orphans, err := cleanup.FindOrphans(ctx, m, re, *runsDir, *minAge)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	reg := orphans.Registry(m)
+	if reg.Len() == 0 {
+		fmt.Println("Nothing to sweep.")
+		return exitOK
+	}
+
+	if *dryRun {
+		fmt.Println("Would remove:")
+		for _, r := range reg.Skip() {
+			fmt.Printf("  %s\n", r.Description)
+		}
+		return exitOK
+	}
+	ctx, cancel := context.WithTimeout(ctx, cleanup.DefaultTimeout)
+	defer cancel()
+	code := exitOK
+	for _, r := range reg.Run(ctx) {
+		if r.Success {
+			fmt.Printf("✓ %s\n", r.Description)
+			continue
+		}
+		fmt.Printf("✗ %s: %s\n", r.Description, r.Error)
+		code = exitFailed
+	}
+	return code
+}
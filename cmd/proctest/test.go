@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/cassette"
+	"github.com/dacharyc/spike-procedural-testing/internal/history"
+	"github.com/dacharyc/spike-procedural-testing/internal/lint"
+	"github.com/dacharyc/spike-procedural-testing/internal/redact"
+	"github.com/dacharyc/spike-procedural-testing/internal/report"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+	"github.com/dacharyc/spike-procedural-testing/internal/sandbox"
+)
+
+func testCommand(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: proctest test [flags] <file|directory>...\n       proctest test --registry <file> [flags] [file|directory]...\n\nWithout files, the pages the configuration file's testFiles match are run.")
+		flags.PrintDefaults()
+	}
+	var opts runner.Options
+	flags.BoolVar(&opts.SkipPrerequisites, "skip-prerequisites", false, "do not check prerequisites")
+	flags.BoolVar(&opts.IgnorePrerequisites, "ignore-prerequisites", false, "check prerequisites but run procedures even when they are not met")
+	flags.DurationVar(&opts.Timeout, "timeout", 0, "timeout for each action (default 5m)")
+	flags.BoolVar(&opts.NoCleanup, "no-cleanup", false, "leave working directories, background processes and test databases in place")
+	flags.StringVar(&opts.RunsDir, "runs-dir", sandbox.DefaultRunsDir, "directory to create procedure sandboxes in")
+	record := flags.Bool("record", false, "record external interactions (API requests, downloads, CLI sessions) to cassettes")
+	replay := flags.Bool("replay", false, "replay external interactions from cassettes instead of performing them")
+	flags.StringVar(&opts.CassetteDir, "cassettes", cassette.DefaultDir, "directory to store cassettes in")
+	flags.IntVar(&opts.Jobs, "jobs", 1, "number of procedure variants to run at once")
+	opts.Limits = map[string]int{}
+	flags.Func("limit", "cap how many variants that need a resource class run at once, as class=N (repeatable); classes: "+strings.Join(runner.ResourceClasses, ", "), func(v string) error {
+		class, n, ok := strings.Cut(v, "=")
+		limit, err := strconv.Atoi(n)
+		if !ok || err != nil || limit < 1 {
+			return fmt.Errorf("want class=N with N at least 1, got %q", v)
+		}
+		if !slices.Contains(runner.ResourceClasses, class) {
+			return fmt.Errorf("unknown resource class %q", class)
+		}
+		opts.Limits[class] = limit
+		return nil
+	})
+	flags.DurationVar(&opts.WaitTimeout, "wait-timeout", runner.DefaultWaitTimeout, "how long to wait for a resource to be ready, unless the page says it takes longer")
+	flags.DurationVar(&opts.WaitInterval, "wait-interval", runner.DefaultWaitInterval, "time between checks while waiting for a resource")
+	retries := flags.Int("retries", 4, "how many times to retry a failing action a retry policy applies to; 0 turns retries off")
+	backoff := flags.Duration("retry-backoff", 5*time.Second, "wait before the first retry; it doubles with each retry, up to 30s")
+	var retry runner.RetryPolicy
+	flags.Func("retry-on", "retry failures whose output matches this regular expression (repeatable); replaces the default policy for PENDING search indexes and similar", func(v string) error {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return err
+		}
+		retry.On = append(retry.On, re)
+		return nil
+	})
+	flags.Func("retry-type", "retry only actions of this type (repeatable), such as cli or api; replaces the default policy", func(v string) error {
+		t := ast.ActionType(v)
+		if !slices.Contains(ast.ActionTypes, t) {
+			return fmt.Errorf("unknown action type %q", v)
+		}
+		retry.Types = append(retry.Types, t)
+		return nil
+	})
+	var quiet, verbose bool
+	flags.BoolVar(&quiet, "quiet", false, "only report failures and the summary")
+	flags.BoolVar(&quiet, "q", false, "shorthand for --quiet")
+	flags.BoolVar(&verbose, "verbose", false, "report every step and more of a failed command's output")
+	flags.BoolVar(&verbose, "v", false, "shorthand for --verbose")
+	color := flags.String("color", "auto", "color the output: auto, always or never; auto colors a terminal unless NO_COLOR is set")
+	keep := flags.String("keep-artifacts", string(runner.KeepOnFailure), "when to keep a procedure's sandbox: failure, always or never")
+	var specs []reporterFlag
+	flags.Func("reporter", "output format: "+strings.Join(reporterNames, ", ")+" (repeatable); name=file writes it to a file", func(v string) error {
+		spec, err := parseReporter(v)
+		if err != nil {
+			return err
+		}
+		specs = append(specs, spec)
+		return nil
+	})
+	output := flags.String("output", "", "file to write the --reporter output to")
+	historyPath := flags.String("history", history.DefaultPath, `file to append the results to for "proctest history"; empty turns it off`)
+	filter := filterFlags(flags)
+	reg := addRegistryFlags(flags)
+	changedSince := changedSinceFlag(flags)
+	configPath := configFlag(flags)
+	dryRun := flags.Bool("dry-run", false, "print the test cases, steps and actions that would run, without running them")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return exitError
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	if len(args) == 0 && reg.path == "" && len(cfg.TestFiles) == 0 {
+		flags.Usage()
+		return exitError
+	}
+	var files []string
+	if len(args) > 0 || reg.path == "" {
+		files, err = configPages(cfg, args)
+	} else {
+		files, err = reg.pages()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	// The pages' own configuration files apply rather than those of the
+	// current directory, which only choose the pages, and pages with
+	// different files run with a runner each, on one scheduler. The
+	// settings of the output as a whole come from the pages' configuration
+	// when they share one, and otherwise from the current directory's.
+	groups, err := configGroups(cfg, *configPath, files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	if len(groups) == 1 {
+		cfg = groups[0].cfg
+	}
+	set := setFlags(flags)
+	if cfg.Verbose != nil && *cfg.Verbose && !quiet && !set["verbose"] && !set["v"] {
+		verbose = true
+	}
+	if !set["reporter"] && len(cfg.Reporters) > 0 {
+		if specs, err = configReporters(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+	}
+	switch k := runner.Keep(*keep); k {
+	case runner.KeepOnFailure, runner.KeepAlways, runner.KeepNever:
+		opts.KeepArtifacts = k
+	default:
+		fmt.Fprintf(os.Stderr, "proctest: invalid --keep-artifacts %q: use failure, always or never\n", *keep)
+		return exitError
+	}
+	if quiet && verbose {
+		fmt.Fprintln(os.Stderr, "proctest: --quiet and --verbose cannot be combined")
+		return exitError
+	}
+	if *color != "auto" && *color != "always" && *color != "never" {
+		fmt.Fprintf(os.Stderr, "proctest: invalid --color %q: use auto, always or never\n", *color)
+		return exitError
+	}
+	switch {
+	case *record && *replay:
+		fmt.Fprintln(os.Stderr, "proctest: --record and --replay cannot be combined")
+		return exitError
+	case *record:
+		opts.Cassettes = cassette.ModeRecord
+		if len(filter.Steps) > 0 || len(filter.ActionTypes) > 0 {
+			fmt.Fprintln(os.Stderr, "proctest: cassettes are not saved for test cases that --steps or --action-type leave steps or actions out of")
+		}
+	case *replay:
+		opts.Cassettes = cassette.ModeReplay
+	}
+	if *retries < 0 {
+		fmt.Fprintln(os.Stderr, "proctest: --retries cannot be negative")
+		return exitError
+	}
+	opts.Retries = retryPolicies(flags, retry, *retries, *backoff)
+	specs, err = reporterSpecs(specs, *output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	if opts.SkipPrerequisites && opts.IgnorePrerequisites {
+		fmt.Fprintln(os.Stderr, "proctest: --skip-prerequisites and --ignore-prerequisites cannot be combined")
+		return exitError
+	}
+
+	if err := reg.check(); err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Parse every page first, so that a broken page fails the run before
+	// anything is executed.
+	var jobs []runner.Job
+	var diags []lint.Diagnostic
+	groupOf := map[*ast.Document]*configGroup{}
+	for _, g := range groups {
+		docs, groupJobs, err := parseGroup(g, reg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+		for _, doc := range docs {
+			groupOf[doc] = g
+			diags = append(diags, lint.Check(doc)...)
+		}
+		jobs = append(jobs, groupJobs...)
+	}
+	jobs = filter.Jobs(jobs)
+	if len(jobs) == 0 && (!filter.IsZero() || len(reg.tags) > 0 || reg.owner != "") {
+		fmt.Fprintln(os.Stderr, "proctest: no test cases match the filters")
+		return exitError
+	}
+	if *changedSince != "" {
+		jobs, err = changedJobs(*changedSince, jobs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+		if len(jobs) == 0 {
+			fmt.Fprintf(os.Stderr, "proctest: no test cases are affected by the changes since %s\n", *changedSince)
+			return exitOK
+		}
+	}
+
+	opts.Filter = *filter
+	var env []string
+	for _, g := range groups {
+		groupOpts := opts
+		if err := applyConfig(g.cfg, set, &groupOpts); err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+		g.runner = runner.New(groupOpts)
+		env = append(env, g.runner.Options.Env...)
+	}
+	for i, j := range jobs {
+		g := groupOf[j.Doc]
+		jobs[i].Runner = g.runner
+		g.jobs = append(g.jobs, jobs[i])
+	}
+	// One redactor hides the secrets of every group, as the reporters
+	// see them all.
+	redactor := redact.New(env)
+	for _, g := range groups {
+		g.runner.Redactor = redactor
+	}
+	if *dryRun {
+		if err := writePlan(os.Stdout, groups, opts.Filter); err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+	var outs outputs
+	defer outs.close()
+	// The human output moves to stderr when another format is written to
+	// stdout, so that the two do not mix.
+	humanOut := os.Stderr
+	if !toStdout(specs) {
+		humanOut = os.Stdout
+	}
+	var reporters []report.Reporter
+	for _, spec := range specs {
+		if spec.name == "human" && spec.path == "" {
+			continue
+		}
+		w, err := outs.open(spec.path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			return exitError
+		}
+		if spec.name == "human" {
+			h := report.NewHuman(w)
+			h.Redactor = redactor
+			reporters = append(reporters, h)
+			continue
+		}
+		reporters = append(reporters, newReporter(spec.name, w, redactor, diags, len(jobs)))
+	}
+	human := report.NewHuman(humanOut)
+	human.Redactor = redactor
+	human.Total = len(jobs)
+	human.Live = report.IsTerminal(humanOut)
+	human.Color = *color == "always" || *color == "auto" && report.UseColor(humanOut)
+	switch {
+	case quiet:
+		human.Verbosity = report.Quiet
+	case verbose:
+		human.Verbosity = report.Verbose
+	}
+	reporters = append([]report.Reporter{human}, reporters...)
+	// Every group's jobs share one scheduler, so --jobs and --limit apply
+	// to the run as a whole; each job runs on its group's runner.
+	for _, g := range groups {
+		g.runner.OnEvent = fanOut(reporters)
+	}
+	var results []runner.ProcedureResult
+	runner.New(opts).Run(ctx, jobs, func(res runner.ProcedureResult) {
+		for _, rep := range reporters {
+			if err := rep.Procedure(&res); err != nil {
+				fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+			}
+		}
+		results = append(results, res)
+	})
+	summary := runner.Summarize(results)
+	for _, rep := range reporters {
+		if err := rep.Summary(&summary); err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		}
+	}
+	if err := outs.close(); err != nil {
+		fmt.Fprintf(os.Stderr, "proctest: %v\n", err)
+		return exitError
+	}
+	if *historyPath != "" && len(results) > 0 {
+		doc := report.Document(&summary, redactor)
+		if err := history.Append(*historyPath, history.Records(doc, history.Commit())); err != nil {
+			fmt.Fprintf(os.Stderr, "proctest: cannot record history: %v\n", err)
+		}
+	}
+	if summary.FailedProcedures > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// parseGroup parses the pages of g, or the entries for them of the
+// registry reg, if it is not nil, with g's configuration, and returns
+// them with their jobs.
+func parseGroup(g *configGroup, reg *registryFlags) ([]*ast.Document, []runner.Job, error) {
+	p, err := configParser(g.cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reg != nil && reg.path != "" {
+		return registryJobs(reg, g.files, p)
+	}
+	var docs []*ast.Document
+	var jobs []runner.Job
+	for _, file := range g.files {
+		doc, err := p.ParseFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		docs = append(docs, doc)
+		jobs = append(jobs, runner.Jobs(doc)...)
+	}
+	return docs, jobs, nil
+}
+
+// retryPolicies returns the retry policies the flags ask for: none for
+// --retries 0, a single policy when --retry-on or --retry-type is given,
+// and otherwise the default policies with the attempts and backoff that
+// were set.
+func retryPolicies(flags *flag.FlagSet, custom runner.RetryPolicy, retries int, backoff time.Duration) []runner.RetryPolicy {
+	if retries == 0 {
+		return []runner.RetryPolicy{}
+	}
+	set := setFlags(flags)
+	policies := slices.Clone(runner.DefaultRetryPolicies)
+	if set["retry-on"] || set["retry-type"] {
+		custom.MaxBackoff = 30 * time.Second
+		policies = []runner.RetryPolicy{custom}
+	}
+	for i := range policies {
+		policies[i].Attempts = retries + 1
+		policies[i].Backoff = backoff
+	}
+	return policies
+}
+
+// discover expands directories into the pages they contain, and quoted
+// glob patterns such as "source/tutorial/install-*.txt" into the paths
+// that match. Files under an includes directory are fragments, not
+// pages, and are left out.
+func discover(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		if _, err := os.Stat(arg); err != nil && strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+			paths = append(paths, matches...)
+			continue
+		}
+		paths = append(paths, arg)
+	}
+	var files []string
+	for _, arg := range paths {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && d.Name() == "includes" {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && strings.HasSuffix(path, ".txt") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
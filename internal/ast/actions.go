@@ -0,0 +1,211 @@
+package ast
+
+import (
+	"fmt"
+	"time"
+)
+
+// ActionType identifies the kind of testable action.
+type ActionType string
+
+const (
+	ActionCode     ActionType = "code"
+	ActionShell    ActionType = "shell"
+	ActionUI       ActionType = "ui"
+	ActionCLI      ActionType = "cli"
+	ActionAPI      ActionType = "api"
+	ActionDownload ActionType = "download"
+	ActionURL      ActionType = "url"
+	ActionFile     ActionType = "file"
+	ActionWait     ActionType = "wait"
+)
+
+// ActionTypes lists every action type.
+var ActionTypes = []ActionType{ActionCode, ActionShell, ActionUI, ActionCLI, ActionAPI, ActionDownload, ActionURL, ActionFile, ActionWait}
+
+// Action is a testable action found in a step. Every concrete action
+// embeds ActionBase, which carries the fields all actions share.
+type Action interface {
+	Kind() ActionType
+	Base() *ActionBase
+}
+
+// ActionBase holds the fields common to every action.
+type ActionBase struct {
+	// ID is the ID of the step or sub-step, "/" and the position of the
+	// action in it, counting from 1. A wait's poll command adds "/poll".
+	ID        string         `json:"id" yaml:"id"`
+	Type      ActionType     `json:"actionType" yaml:"actionType"`
+	Selection Selection      `json:"selection,omitempty" yaml:"selection,omitempty"`
+	Location  SourceLocation `json:"location" yaml:"location"`
+}
+
+func (b *ActionBase) Kind() ActionType  { return b.Type }
+func (b *ActionBase) Base() *ActionBase { return b }
+
+// Code execution modes.
+const (
+	ExecutionDirect = "direct"
+	ExecutionIDE    = "ide"
+)
+
+// CodeAction runs a code example in its language runtime.
+type CodeAction struct {
+	ActionBase    `yaml:",inline"`
+	Language      string   `json:"language" yaml:"language"`
+	Code          string   `json:"code,omitempty" yaml:"code,omitempty"`
+	ExecutionMode string   `json:"executionMode" yaml:"executionMode"`
+	FilePath      string   `json:"filePath,omitempty" yaml:"filePath,omitempty"`
+	Placeholders  []string `json:"placeholders,omitempty" yaml:"placeholders,omitempty"`
+}
+
+// ShellAction runs a command in a shell.
+type ShellAction struct {
+	ActionBase     `yaml:",inline"`
+	Command        string   `json:"command" yaml:"command"`
+	ExpectedOutput string   `json:"expectedOutput,omitempty" yaml:"expectedOutput,omitempty"`
+	Placeholders   []string `json:"placeholders,omitempty" yaml:"placeholders,omitempty"`
+}
+
+// UIAction is a user interface interaction described in prose.
+type UIAction struct {
+	ActionBase  `yaml:",inline"`
+	Interaction string `json:"action" yaml:"action"`
+	Target      string `json:"target" yaml:"target"`
+	Value       string `json:"value,omitempty" yaml:"value,omitempty"`
+	Description string `json:"description" yaml:"description"`
+}
+
+// CLI tools with dedicated handling.
+const (
+	ToolMongosh  = "mongosh"
+	ToolAtlasCLI = "atlas-cli"
+)
+
+// CLIAction runs a command in an interactive tool such as mongosh.
+type CLIAction struct {
+	ActionBase     `yaml:",inline"`
+	Tool           string   `json:"tool" yaml:"tool"`
+	Command        string   `json:"command" yaml:"command"`
+	ExpectedOutput string   `json:"expectedOutput,omitempty" yaml:"expectedOutput,omitempty"`
+	Placeholders   []string `json:"placeholders,omitempty" yaml:"placeholders,omitempty"`
+}
+
+// APIAction is an HTTP request against an API.
+type APIAction struct {
+	ActionBase     `yaml:",inline"`
+	Method         string            `json:"method" yaml:"method"`
+	Endpoint       string            `json:"endpoint" yaml:"endpoint"`
+	Headers        map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body           string            `json:"body,omitempty" yaml:"body,omitempty"`
+	ExpectedStatus int               `json:"expectedStatus,omitempty" yaml:"expectedStatus,omitempty"`
+	Command        string            `json:"command,omitempty" yaml:"command,omitempty"`
+	Placeholders   []string          `json:"placeholders,omitempty" yaml:"placeholders,omitempty"`
+}
+
+// DownloadAction fetches a file to disk.
+type DownloadAction struct {
+	ActionBase   `yaml:",inline"`
+	URL          string            `json:"url" yaml:"url"`
+	OutputPath   string            `json:"outputPath,omitempty" yaml:"outputPath,omitempty"`
+	Method       string            `json:"method,omitempty" yaml:"method,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Command      string            `json:"command,omitempty" yaml:"command,omitempty"`
+	Description  string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Placeholders []string          `json:"placeholders,omitempty" yaml:"placeholders,omitempty"`
+}
+
+// URLAction checks that a linked page is reachable.
+type URLAction struct {
+	ActionBase     `yaml:",inline"`
+	URL            string `json:"url" yaml:"url"`
+	Description    string `json:"description" yaml:"description"`
+	ExpectedStatus int    `json:"expectedStatus,omitempty" yaml:"expectedStatus,omitempty"`
+}
+
+// File operations.
+const (
+	FileCreate  = "create"
+	FileReplace = "replace"
+	FileAppend  = "append"
+)
+
+// FileAction creates or modifies a file in the working directory.
+type FileAction struct {
+	ActionBase   `yaml:",inline"`
+	Operation    string   `json:"operation" yaml:"operation"`
+	Path         string   `json:"path" yaml:"path"`
+	Language     string   `json:"language,omitempty" yaml:"language,omitempty"`
+	Content      string   `json:"content" yaml:"content"`
+	Description  string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Placeholders []string `json:"placeholders,omitempty" yaml:"placeholders,omitempty"`
+}
+
+// Wait conditions.
+const (
+	// WaitExitCode waits until the poll command exits with ExitCode.
+	WaitExitCode = "exit-code"
+	// WaitField waits until the poll command's output has Field set to
+	// Value: a field of JSON output, or "field: value" in other output.
+	WaitField = "field"
+	// WaitHTTPStatus waits until URL responds with Status.
+	WaitHTTPStatus = "http-status"
+)
+
+// WaitAction polls until an asynchronous resource is ready, such as a
+// search index that is building or a cluster that is being deployed.
+type WaitAction struct {
+	ActionBase `yaml:",inline"`
+	Condition  string `json:"condition" yaml:"condition"`
+	// Poll is the command run on each try: a shell, CLI or API action. It
+	// is nil for HTTP status waits and when the page does not show a
+	// command that reports the state.
+	Poll     Action `json:"poll,omitempty" yaml:"poll,omitempty"`
+	URL      string `json:"url,omitempty" yaml:"url,omitempty"`
+	ExitCode int    `json:"exitCode,omitempty" yaml:"exitCode,omitempty"`
+	Field    string `json:"field,omitempty" yaml:"field,omitempty"`
+	Value    string `json:"value,omitempty" yaml:"value,omitempty"`
+	Status   int    `json:"status,omitempty" yaml:"status,omitempty"`
+	// Timeout is how long the page says the wait can take; zero leaves
+	// it to the runner.
+	Timeout     time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Description string        `json:"description" yaml:"description"`
+}
+
+// Target describes what the wait is waiting for.
+func (w *WaitAction) Target() string {
+	switch w.Condition {
+	case WaitHTTPStatus:
+		return fmt.Sprintf("%s responds with %d", w.URL, w.Status)
+	case WaitField:
+		if w.Field == "" {
+			return w.Value
+		}
+		return fmt.Sprintf("%s is %s", w.Field, w.Value)
+	}
+	return fmt.Sprintf("exit code %d", w.ExitCode)
+}
+
+// Placeholders returns the placeholders in an action's content, including
+// those of a wait's poll command.
+func Placeholders(a Action) []string {
+	switch a := a.(type) {
+	case *CodeAction:
+		return a.Placeholders
+	case *ShellAction:
+		return a.Placeholders
+	case *CLIAction:
+		return a.Placeholders
+	case *APIAction:
+		return a.Placeholders
+	case *DownloadAction:
+		return a.Placeholders
+	case *FileAction:
+		return a.Placeholders
+	case *WaitAction:
+		if a.Poll != nil {
+			return Placeholders(a.Poll)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Package ast defines the document model the parser produces from RST
+// pages and the executors consume. The shape follows the Parser Output
+// section of the technical specification.
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SourceLocation identifies a span of lines in a source file. IncludedFrom
+// points at the include directive that pulled the file into the page, so
+// a location inside a shared include can be traced back to the page that
+// is being tested.
+type SourceLocation struct {
+	File         string          `json:"file" yaml:"file"`
+	StartLine    int             `json:"startLine" yaml:"startLine"`
+	EndLine      int             `json:"endLine" yaml:"endLine"`
+	IncludedFrom *SourceLocation `json:"includedFrom,omitempty" yaml:"includedFrom,omitempty"`
+}
+
+// String formats the location as file:line or file:start-end.
+func (l SourceLocation) String() string {
+	if l.File == "" {
+		return ""
+	}
+	if l.EndLine > l.StartLine {
+		return fmt.Sprintf("%s:%d-%d", l.File, l.StartLine, l.EndLine)
+	}
+	return fmt.Sprintf("%s:%d", l.File, l.StartLine)
+}
+
+// Chain returns the location followed by every include site above it,
+// innermost first.
+func (l SourceLocation) Chain() []SourceLocation {
+	chain := []SourceLocation{l}
+	for p := l.IncludedFrom; p != nil; p = p.IncludedFrom {
+		chain = append(chain, *p)
+	}
+	return chain
+}
+
+// Outermost returns where the location is in the page itself: the include
+// directive that brings it in when it comes from an included file.
+func (l SourceLocation) Outermost() SourceLocation {
+	for l.IncludedFrom != nil {
+		l = *l.IncludedFrom
+	}
+	return l
+}
+
+// Warning is a non-fatal problem found while parsing, such as an include
+// that could not be resolved.
+type Warning struct {
+	// Rule identifies the kind of problem; the lint package describes
+	// each rule.
+	Rule     string         `json:"rule" yaml:"rule"`
+	Message  string         `json:"message" yaml:"message"`
+	Location SourceLocation `json:"location" yaml:"location"`
+}
+
+// Warning rules.
+const (
+	// RuleInclude is an include or literalinclude that could not be read.
+	RuleInclude = "include"
+	// RuleUnknownLanguage is a code block language the tooling does not
+	// recognize, so the block is not run as that language.
+	RuleUnknownLanguage = "unknown-language"
+	// RuleDeprecatedDirective and RuleDeprecatedRole are markup the docs
+	// toolchain has deprecated.
+	RuleDeprecatedDirective = "deprecated-directive"
+	RuleDeprecatedRole      = "deprecated-role"
+)
+
+// Document is the parsed form of one RST page.
+type Document struct {
+	// ID is the page's path in the source directory without its
+	// extension, such as "tutorial/install-driver". The IDs of its
+	// procedures, steps and actions start with it.
+	ID    string `json:"id" yaml:"id"`
+	File  string `json:"file" yaml:"file"`
+	Title string `json:"title" yaml:"title"`
+	// Tags are the page's meta keywords and facet values.
+	Tags       []string     `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Procedures []*Procedure `json:"procedures" yaml:"procedures"`
+	Variants   []Variant    `json:"variants,omitempty" yaml:"variants,omitempty"`
+	Warnings   []Warning    `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// Procedure is a sequence of steps from a procedure directive or an
+// ordered list.
+type Procedure struct {
+	// ID is the page ID, "#" and the slugs of the heading path joined
+	// with ".", such as "tutorial/install-driver#install.install-the-driver",
+	// with "-2", "-3" and so on for later procedures under the same
+	// headings.
+	ID            string         `json:"id" yaml:"id"`
+	Title         string         `json:"title" yaml:"title"`
+	HeadingPath   []string       `json:"headingPath,omitempty" yaml:"headingPath,omitempty"`
+	Style         string         `json:"style,omitempty" yaml:"style,omitempty"`
+	Selection     Selection      `json:"selection,omitempty" yaml:"selection,omitempty"`
+	Prerequisites *Prerequisites `json:"prerequisites,omitempty" yaml:"prerequisites,omitempty"`
+	Steps         []*Step        `json:"steps" yaml:"steps"`
+	// Variants are the test cases the procedure produces: one per distinct
+	// combination of the selections its own content depends on. It is
+	// empty when the content is the same for every variant of the page.
+	Variants []Variant      `json:"variants,omitempty" yaml:"variants,omitempty"`
+	Location SourceLocation `json:"location" yaml:"location"`
+}
+
+// Step is one numbered step of a procedure.
+type Step struct {
+	// ID is the procedure ID, "/" and the step number.
+	ID        string         `json:"id" yaml:"id"`
+	Number    int            `json:"number" yaml:"number"`
+	Title     string         `json:"title" yaml:"title"`
+	Selection Selection      `json:"selection,omitempty" yaml:"selection,omitempty"`
+	Actions   []Action       `json:"testableActions" yaml:"testableActions"`
+	SubSteps  []*SubStep     `json:"subSteps,omitempty" yaml:"subSteps,omitempty"`
+	Location  SourceLocation `json:"location" yaml:"location"`
+}
+
+// SubStep is a nested step such as "a." or "2." inside a step.
+type SubStep struct {
+	// ID is the step ID, "." and the sub-step number, as in "…/2.b".
+	ID        string         `json:"id" yaml:"id"`
+	Number    string         `json:"number" yaml:"number"`
+	Title     string         `json:"title" yaml:"title"`
+	Selection Selection      `json:"selection,omitempty" yaml:"selection,omitempty"`
+	Actions   []Action       `json:"testableActions" yaml:"testableActions"`
+	Location  SourceLocation `json:"location" yaml:"location"`
+}
+
+// Selection maps a variant dimension to the value that content applies
+// to. Dimensions are composable tutorial option IDs ("language": "go") or
+// tab sets ("tabs-drivers": "python"). An empty selection applies to every
+// variant.
+type Selection map[string]string
+
+// Matches reports whether content with this selection is part of the
+// variant v.
+func (s Selection) Matches(v Selection) bool {
+	for k, val := range s {
+		if v[k] != val {
+			return false
+		}
+	}
+	return true
+}
+
+// With returns a copy of the selection with dim set to value.
+func (s Selection) With(dim, value string) Selection {
+	out := make(Selection, len(s)+1)
+	for k, v := range s {
+		out[k] = v
+	}
+	out[dim] = value
+	return out
+}
+
+// Merge returns a copy of the selection with every entry of o added.
+func (s Selection) Merge(o Selection) Selection {
+	out := make(Selection, len(s)+len(o))
+	for k, v := range s {
+		out[k] = v
+	}
+	for k, v := range o {
+		out[k] = v
+	}
+	return out
+}
+
+// Keys returns the dimensions in sorted order.
+func (s Selection) Keys() []string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String formats the selection as "dim=value,dim=value" with sorted keys.
+func (s Selection) String() string {
+	parts := make([]string, 0, len(s))
+	for _, k := range s.Keys() {
+		parts = append(parts, k+"="+s[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// Variant types.
+const (
+	VariantTab                = "tab"
+	VariantComposableTutorial = "composable-tutorial"
+)
+
+// Variant is one combination of tab and composable tutorial selections
+// that produces its own test case.
+type Variant struct {
+	Type      string    `json:"type" yaml:"type"`
+	ID        string    `json:"id" yaml:"id"`
+	Label     string    `json:"label" yaml:"label"`
+	Selection Selection `json:"selection" yaml:"selection"`
+}
@@ -0,0 +1,86 @@
+package ast
+
+// RequirementType identifies the kind of prerequisite requirement.
+type RequirementType string
+
+const (
+	RequirementSoftware      RequirementType = "software"
+	RequirementEnvironment   RequirementType = "environment"
+	RequirementService       RequirementType = "service"
+	RequirementConfiguration RequirementType = "configuration"
+)
+
+// Prerequisites groups the requirements that must hold before a procedure
+// can run.
+type Prerequisites struct {
+	Title        string         `json:"title" yaml:"title"`
+	Requirements []Requirement  `json:"requirements" yaml:"requirements"`
+	Location     SourceLocation `json:"location" yaml:"location"`
+}
+
+// Requirement is a single prerequisite. Every concrete requirement embeds
+// RequirementBase.
+type Requirement interface {
+	Kind() RequirementType
+	Base() *RequirementBase
+	// Subject names what the requirement is about: a program, a variable,
+	// a service, or a configuration item.
+	Subject() string
+}
+
+// RequirementBase holds the fields common to every requirement. Source and
+// Rule record the sentence the requirement was inferred from and the
+// detection rule that matched, so authors can audit every inference.
+type RequirementBase struct {
+	Type        RequirementType `json:"requirementType" yaml:"requirementType"`
+	Description string          `json:"description" yaml:"description"`
+	Optional    bool            `json:"optional,omitempty" yaml:"optional,omitempty"`
+	Selection   Selection       `json:"selection,omitempty" yaml:"selection,omitempty"`
+	Source      string          `json:"source" yaml:"source"`
+	Rule        string          `json:"rule" yaml:"rule"`
+	Location    SourceLocation  `json:"location" yaml:"location"`
+}
+
+func (b *RequirementBase) Kind() RequirementType  { return b.Type }
+func (b *RequirementBase) Base() *RequirementBase { return b }
+
+// SoftwareRequirement is a program that must be installed, optionally at a
+// version matching a constraint such as ">=8.1" or "^18".
+type SoftwareRequirement struct {
+	RequirementBase `yaml:",inline"`
+	Name            string `json:"name" yaml:"name"`
+	Version         string `json:"version,omitempty" yaml:"version,omitempty"`
+	CheckCommand    string `json:"checkCommand,omitempty" yaml:"checkCommand,omitempty"`
+	InstallURL      string `json:"installUrl,omitempty" yaml:"installUrl,omitempty"`
+}
+
+func (r *SoftwareRequirement) Subject() string { return r.Name }
+
+// EnvironmentRequirement is an environment variable that must be set.
+type EnvironmentRequirement struct {
+	RequirementBase `yaml:",inline"`
+	Variable        string `json:"variable" yaml:"variable"`
+	Example         string `json:"example,omitempty" yaml:"example,omitempty"`
+}
+
+func (r *EnvironmentRequirement) Subject() string { return r.Variable }
+
+// ServiceRequirement is an external service, such as an Atlas cluster,
+// that must be available.
+type ServiceRequirement struct {
+	RequirementBase `yaml:",inline"`
+	Name            string `json:"name" yaml:"name"`
+	SetupURL        string `json:"setupUrl,omitempty" yaml:"setupUrl,omitempty"`
+}
+
+func (r *ServiceRequirement) Subject() string { return r.Name }
+
+// ConfigurationRequirement is a setting, access role, or configuration
+// file that must be in place.
+type ConfigurationRequirement struct {
+	RequirementBase `yaml:",inline"`
+	Name            string `json:"name" yaml:"name"`
+	Path            string `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
+func (r *ConfigurationRequirement) Subject() string { return r.Name }
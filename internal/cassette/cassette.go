@@ -0,0 +1,208 @@
+// Package cassette records the external interactions of a procedure run
+// (Admin API requests, downloads, link checks and CLI sessions against a
+// deployment) so that the run can be replayed later without network
+// access or credentials.
+//
+// There is one cassette per procedure variant. Interactions are keyed by
+// their place in the procedure ("2.b/1" is the first recordable action of
+// step 2.b) and carry a fingerprint of the action as documented, so a
+// recording made before the docs changed is detected as stale instead of
+// replayed. Cassettes are indented JSON without timestamps or durations,
+// so that re-recording produces a readable diff. Secrets are redacted
+// before they are written.
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+)
+
+// Version is the cassette format version.
+const Version = 1
+
+// DefaultDir is where cassettes are stored, relative to the current
+// directory.
+const DefaultDir = ".proctest/cassettes"
+
+// Mode selects whether a run records or replays.
+type Mode string
+
+const (
+	ModeOff    Mode = ""
+	ModeRecord Mode = "record"
+	ModeReplay Mode = "replay"
+)
+
+// Cassette holds the recorded interactions of one procedure variant.
+type Cassette struct {
+	Version      int            `json:"version"`
+	File         string         `json:"file"`
+	Procedure    string         `json:"procedure"`
+	Variant      string         `json:"variant,omitempty"`
+	Interactions []*Interaction `json:"interactions"`
+
+	path string
+}
+
+// Interaction is one recorded action.
+type Interaction struct {
+	// Key locates the action in the procedure: the step, "2" or "2.b",
+	// and the position of the action among the step's recordable ones.
+	Key  string         `json:"key"`
+	Type ast.ActionType `json:"type"`
+	// Fingerprint identifies the action as documented, before
+	// placeholders were resolved.
+	Fingerprint string `json:"fingerprint"`
+	// Command is what ran, with secrets redacted.
+	Command  string  `json:"command,omitempty"`
+	Success  bool    `json:"success"`
+	ExitCode int     `json:"exitCode"`
+	Error    string  `json:"error,omitempty"`
+	Stdout   *Output `json:"stdout,omitempty"`
+	Stderr   *Output `json:"stderr,omitempty"`
+	// File is the file a download wrote.
+	File *Blob `json:"file,omitempty"`
+}
+
+// Blob refers to a downloaded file. The content is stored once in the
+// blobs directory next to the cassettes, named by its digest.
+type Blob struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// Key returns the key of the n-th (from 1) recordable action of a step.
+func Key(step string, n int) string {
+	return fmt.Sprintf("%s/%d", step, n)
+}
+
+// Recordable reports whether a is an external interaction: something
+// that needs a network, an account or a deployment rather than only the
+// local machine.
+func Recordable(a ast.Action) bool {
+	switch a.(type) {
+	case *ast.APIAction, *ast.DownloadAction, *ast.URLAction, *ast.CLIAction:
+		return true
+	}
+	return false
+}
+
+// Fingerprint hashes the documented form of a recordable action.
+func Fingerprint(a ast.Action) string {
+	var parts []string
+	switch act := a.(type) {
+	case *ast.APIAction:
+		parts = []string{act.Method, act.Endpoint, act.Body}
+		keys := make([]string, 0, len(act.Headers))
+		for k := range act.Headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			parts = append(parts, k+": "+act.Headers[k])
+		}
+	case *ast.DownloadAction:
+		parts = []string{act.Method, act.URL, act.OutputPath}
+	case *ast.URLAction:
+		parts = []string{act.URL}
+	case *ast.CLIAction:
+		parts = []string{act.Tool, act.Command}
+	}
+	sum := sha256.Sum256([]byte(string(a.Kind()) + "\x00" + strings.Join(parts, "\x00")))
+	return "sha256:" + hex.EncodeToString(sum[:12])
+}
+
+// Path returns where the cassette of a procedure variant is stored: the
+// page's path without its extension, then the procedure ID.
+func Path(dir, file, id string) string {
+	page := strings.TrimSuffix(filepath.ToSlash(filepath.Clean(file)), filepath.Ext(file))
+	// Keep cassettes inside dir whatever the page path looks like.
+	page = strings.TrimLeft(strings.ReplaceAll(page, "../", ""), "/")
+	return filepath.Join(dir, filepath.FromSlash(page), id+".json")
+}
+
+// New returns an empty cassette that Save writes to path.
+func New(path, file, procedure, variant string) *Cassette {
+	return &Cassette{Version: Version, File: file, Procedure: procedure, Variant: variant, Interactions: []*Interaction{}, path: path}
+}
+
+// ErrNotRecorded is returned by Load when a procedure has no cassette.
+var ErrNotRecorded = errors.New("no cassette has been recorded")
+
+// Load reads a cassette.
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", path, ErrNotRecorded)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &Cassette{path: path}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if c.Version != Version {
+		return nil, fmt.Errorf("%s: cassette format version %d is not supported (want %d); record it again", path, c.Version, Version)
+	}
+	return c, nil
+}
+
+// Save writes the cassette.
+func (c *Cassette) Save() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, buf.Bytes(), 0o644)
+}
+
+// Path returns the file the cassette is stored in.
+func (c *Cassette) Path() string {
+	return c.path
+}
+
+// Add records an interaction.
+func (c *Cassette) Add(i *Interaction) {
+	c.Interactions = append(c.Interactions, i)
+}
+
+// Lookup returns the interaction recorded under key.
+func (c *Cassette) Lookup(key string) (*Interaction, bool) {
+	for _, i := range c.Interactions {
+		if i.Key == key {
+			return i, true
+		}
+	}
+	return nil, false
+}
+
+// Stale reports why an interaction no longer matches the documented
+// action, or "" when it still does.
+func (i *Interaction) Stale(a ast.Action) string {
+	if i.Type != a.Kind() {
+		return fmt.Sprintf("the recording is of a %s action but the page now has a %s action here", i.Type, a.Kind())
+	}
+	if i.Fingerprint != Fingerprint(a) {
+		return "the documented request changed since it was recorded"
+	}
+	return ""
+}
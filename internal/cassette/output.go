@@ -0,0 +1,99 @@
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Output is recorded command output or a response body, stored in the
+// form that diffs best: JSON as JSON, multi-line text as a list of lines,
+// and anything else as a string.
+type Output struct {
+	Text  string          `json:"text,omitempty"`
+	Lines []string        `json:"lines,omitempty"`
+	JSON  json.RawMessage `json:"json,omitempty"`
+}
+
+// NewOutput returns the stored form of s, or nil when s is empty.
+func NewOutput(s string) *Output {
+	if s == "" {
+		return nil
+	}
+	trimmed := strings.TrimSpace(s)
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		return &Output{JSON: json.RawMessage(trimmed)}
+	}
+	if strings.Contains(strings.TrimSuffix(s, "\n"), "\n") {
+		return &Output{Lines: strings.Split(s, "\n")}
+	}
+	return &Output{Text: s}
+}
+
+// String returns the output as the executor produced it. JSON comes back
+// compacted, which is equivalent for anything that parses it.
+func (o *Output) String() string {
+	switch {
+	case o == nil:
+		return ""
+	case o.JSON != nil:
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, o.JSON); err != nil {
+			return string(o.JSON)
+		}
+		return buf.String()
+	case o.Lines != nil:
+		return strings.Join(o.Lines, "\n")
+	}
+	return o.Text
+}
+
+// blobDir holds downloaded files, shared by all cassettes in a directory.
+const blobDir = "blobs"
+
+// StoreBlob copies a downloaded file into dir's blob store.
+func StoreBlob(dir, src, path string) (*Blob, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	dst := filepath.Join(dir, blobDir, digest)
+	if _, err := os.Stat(dst); err != nil {
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(dst, data, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	return &Blob{Path: path, SHA256: digest, Size: int64(len(data))}, nil
+}
+
+// RestoreBlob writes a recorded download to dst.
+func RestoreBlob(dir string, b *Blob, dst string) error {
+	src, err := os.Open(filepath.Join(dir, blobDir, b.SHA256))
+	if err != nil {
+		return fmt.Errorf("recorded download %s is missing from the cassette blobs: %v", b.Path, err)
+	}
+	defer src.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
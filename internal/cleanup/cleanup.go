@@ -0,0 +1,148 @@
+// Package cleanup tracks the resources a procedure creates and removes
+// them when the procedure ends, whether it passed, failed, timed out or
+// was interrupted. Tasks run in LIFO order, so a collection is dropped
+// before the database that holds it and a server is stopped before its
+// directory is removed.
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Kind identifies the type of resource a task removes.
+type Kind string
+
+const (
+	KindDatabase    Kind = "database"
+	KindCollection  Kind = "collection"
+	KindSearchIndex Kind = "search-index"
+	KindDirectory   Kind = "directory"
+	KindFile        Kind = "file"
+	KindProcess     Kind = "process"
+)
+
+// DefaultPattern matches the names of databases, collections and search
+// indexes that procedures create for testing and that are safe to drop.
+var DefaultPattern = regexp.MustCompile(`^proctest_`)
+
+// DefaultTimeout bounds the whole cleanup of one procedure.
+const DefaultTimeout = 2 * time.Minute
+
+// Task is one registered cleanup.
+type Task struct {
+	Kind        Kind
+	Description string
+	Cleanup     func(ctx context.Context) error
+}
+
+// Result is the outcome of a task.
+type Result struct {
+	Kind        Kind   `json:"kind" yaml:"kind"`
+	Description string `json:"description" yaml:"description"`
+	Success     bool   `json:"success" yaml:"success"`
+	// Skipped is set when cleanup was turned off and the resource was
+	// left in place.
+	Skipped  bool          `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+	Error    string        `json:"error,omitempty" yaml:"error,omitempty"`
+	Duration time.Duration `json:"duration" yaml:"duration"`
+}
+
+// Registry collects cleanup tasks. It is safe for concurrent use.
+type Registry struct {
+	mu    sync.Mutex
+	tasks []Task
+	keys  map[string]bool
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{keys: map[string]bool{}}
+}
+
+// registerOnce adds a task unless one with the same key was already
+// registered; a database the procedure uses in every step is dropped
+// once.
+func (r *Registry) registerOnce(key string, t Task) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keys[key] {
+		return
+	}
+	r.keys[key] = true
+	r.tasks = append(r.tasks, t)
+}
+
+// Len returns the number of pending tasks.
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.tasks)
+}
+
+// Run executes every task in LIFO order and clears the registry. A task
+// that fails does not stop the others. ctx should not be the context of
+// the run itself: cleanup has to happen after an interrupt too, so
+// callers pass context.WithoutCancel or a fresh context.
+func (r *Registry) Run(ctx context.Context) []Result {
+	r.mu.Lock()
+	tasks := r.tasks
+	r.tasks = nil
+	r.keys = map[string]bool{}
+	r.mu.Unlock()
+
+	var results []Result
+	for i := len(tasks) - 1; i >= 0; i-- {
+		t := tasks[i]
+		start := time.Now()
+		err := safely(ctx, t.Cleanup)
+		res := Result{Kind: t.Kind, Description: t.Description, Success: err == nil, Duration: time.Since(start)}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// Skip clears the registry without running any task and returns a
+// skipped result for each, newest first, so that a run with cleanup
+// turned off can still report what it left behind.
+func (r *Registry) Skip() []Result {
+	r.mu.Lock()
+	tasks := r.tasks
+	r.tasks = nil
+	r.keys = map[string]bool{}
+	r.mu.Unlock()
+
+	var results []Result
+	for i := len(tasks) - 1; i >= 0; i-- {
+		results = append(results, Result{Kind: tasks[i].Kind, Description: tasks[i].Description, Skipped: true})
+	}
+	return results
+}
+
+// safely runs fn and turns a panic into an error, so that one broken
+// handler cannot leave the remaining resources behind.
+func safely(ctx context.Context, fn func(context.Context) error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("cleanup panicked: %v", p)
+		}
+	}()
+	return fn(ctx)
+}
+
+// Failed returns the results of the tasks that ran and failed.
+func Failed(results []Result) []Result {
+	var out []Result
+	for _, r := range results {
+		if !r.Success && !r.Skipped {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRunOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		// keys are registered in order; a repeated key is registered
+		// once.
+		keys []string
+		// fail names the tasks whose cleanup returns an error, panics
+		// those that panic.
+		fail, panics []string
+		wantOrder    []string
+		wantFailed   []string
+	}{
+		{
+			name:      "newest first",
+			keys:      []string{"db", "collection", "index"},
+			wantOrder: []string{"index", "collection", "db"},
+		},
+		{
+			name:      "repeated keys run once, in the place of the first",
+			keys:      []string{"db", "dir", "db", "server"},
+			wantOrder: []string{"server", "dir", "db"},
+		},
+		{
+			name:       "a failure does not stop the others",
+			keys:       []string{"db", "collection", "index"},
+			fail:       []string{"collection"},
+			wantOrder:  []string{"index", "collection", "db"},
+			wantFailed: []string{"collection"},
+		},
+		{
+			name:       "a panic does not stop the others",
+			keys:       []string{"db", "server"},
+			panics:     []string{"server"},
+			wantOrder:  []string{"server", "db"},
+			wantFailed: []string{"server"},
+		},
+		{
+			name: "empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			var order []string
+			for _, key := range tt.keys {
+				r.registerOnce(key, Task{
+					Kind:        KindDatabase,
+					Description: key,
+					Cleanup: func(context.Context) error {
+						order = append(order, key)
+						if slices.Contains(tt.panics, key) {
+							panic("boom")
+						}
+						if slices.Contains(tt.fail, key) {
+							return errors.New("failed")
+						}
+						return nil
+					},
+				})
+			}
+			if got := r.Len(); got != len(tt.wantOrder) {
+				t.Errorf("Len() = %d, want %d", got, len(tt.wantOrder))
+			}
+			results := r.Run(context.Background())
+			if !slices.Equal(order, tt.wantOrder) {
+				t.Errorf("ran %v, want %v", order, tt.wantOrder)
+			}
+			var described []string
+			for _, res := range results {
+				described = append(described, res.Description)
+			}
+			if !slices.Equal(described, tt.wantOrder) {
+				t.Errorf("results %v, want %v", described, tt.wantOrder)
+			}
+			var failed []string
+			for _, res := range Failed(results) {
+				if res.Error == "" {
+					t.Errorf("%s failed without an error", res.Description)
+				}
+				failed = append(failed, res.Description)
+			}
+			if !slices.Equal(failed, tt.wantFailed) {
+				t.Errorf("failed %v, want %v", failed, tt.wantFailed)
+			}
+			if got := r.Len(); got != 0 {
+				t.Errorf("Len() after Run = %d, want 0", got)
+			}
+		})
+	}
+}
+
+func TestRunClearsKeys(t *testing.T) {
+	r := NewRegistry()
+	runs := 0
+	task := Task{Kind: KindDatabase, Cleanup: func(context.Context) error { runs++; return nil }}
+	r.registerOnce("db", task)
+	r.Run(context.Background())
+	r.registerOnce("db", task)
+	r.Run(context.Background())
+	if runs != 2 {
+		t.Errorf("task ran %d times, want 2: a key is registered again after Run", runs)
+	}
+}
+
+func TestSkip(t *testing.T) {
+	r := NewRegistry()
+	ran := false
+	for _, key := range []string{"first", "second"} {
+		r.registerOnce(key, Task{Kind: KindProcess, Description: key, Cleanup: func(context.Context) error {
+			ran = true
+			return nil
+		}})
+	}
+	results := r.Skip()
+	if ran {
+		t.Error("Skip ran a task")
+	}
+	var described []string
+	for _, res := range results {
+		if !res.Skipped || res.Success {
+			t.Errorf("%s: Skipped = %v, Success = %v, want skipped only", res.Description, res.Skipped, res.Success)
+		}
+		described = append(described, res.Description)
+	}
+	if want := []string{"second", "first"}; !slices.Equal(described, want) {
+		t.Errorf("skipped %v, want %v", described, want)
+	}
+	if len(Failed(results)) != 0 {
+		t.Error("Failed counts skipped tasks")
+	}
+	if r.Len() != 0 {
+		t.Errorf("Len() after Skip = %d, want 0", r.Len())
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sandbox")
+	if err := os.MkdirAll(filepath.Join(dir, "work"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry()
+	r.Directory(dir)
+	r.Directory(dir)
+	results := r.Run(context.Background())
+	if len(results) != 1 || !results[0].Success {
+		t.Fatalf("results = %+v, want one successful removal", results)
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s still exists after cleanup", dir)
+	}
+}
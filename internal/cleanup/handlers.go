@@ -0,0 +1,69 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Directory registers the removal of a directory and everything in it.
+func (r *Registry) Directory(path string) {
+	r.registerOnce("dir:"+path, Task{
+		Kind:        KindDirectory,
+		Description: "remove directory " + path,
+		Cleanup: func(context.Context) error {
+			return os.RemoveAll(path)
+		},
+	})
+}
+
+// ProcessGroup registers stopping a process group that outlived the
+// command that started it, such as "npm start &". The group gets SIGTERM
+// and, if it is still running after a grace period, SIGKILL.
+func (r *Registry) ProcessGroup(pgid int, command string) {
+	r.registerOnce(fmt.Sprintf("pgid:%d", pgid), Task{
+		Kind:        KindProcess,
+		Description: fmt.Sprintf("stop background processes of %q (process group %d)", command, pgid),
+		Cleanup: func(ctx context.Context) error {
+			return stopGroup(ctx, pgid)
+		},
+	})
+}
+
+// Database registers dropping a database.
+func (r *Registry) Database(m *Mongo, name string) {
+	r.registerOnce("db:"+name, Task{
+		Kind:        KindDatabase,
+		Description: "drop database " + name,
+		Cleanup: func(ctx context.Context) error {
+			return m.DropDatabase(ctx, name)
+		},
+	})
+}
+
+// Collection registers dropping a collection. When db is empty the
+// collection is dropped from every database that has one by that name.
+func (r *Registry) Collection(m *Mongo, db, name string) {
+	desc := "drop collection " + name
+	if db != "" {
+		desc = "drop collection " + db + "." + name
+	}
+	r.registerOnce("coll:"+db+"."+name, Task{
+		Kind:        KindCollection,
+		Description: desc,
+		Cleanup: func(ctx context.Context) error {
+			return m.DropCollection(ctx, db, name)
+		},
+	})
+}
+
+// SearchIndex registers dropping an Atlas Search or Vector Search index.
+func (r *Registry) SearchIndex(m *Mongo, db, collection, name string) {
+	r.registerOnce("index:"+db+"."+collection+"."+name, Task{
+		Kind:        KindSearchIndex,
+		Description: fmt.Sprintf("drop search index %s on %s.%s", name, db, collection),
+		Cleanup: func(ctx context.Context) error {
+			return m.DropSearchIndex(ctx, db, collection, name)
+		},
+	})
+}
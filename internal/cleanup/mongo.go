@@ -0,0 +1,70 @@
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Mongo drops databases, collections and search indexes through mongosh,
+// the same client the procedures themselves use.
+type Mongo struct {
+	URI string
+	Env []string
+}
+
+// Eval runs a script against the deployment and returns its output.
+func (m *Mongo) Eval(ctx context.Context, script string) (string, error) {
+	if m.URI == "" {
+		return "", fmt.Errorf("no connection string: set MONGODB_URI")
+	}
+	cmd := exec.CommandContext(ctx, "mongosh", m.URI, "--quiet", "--eval", script)
+	cmd.Env = m.Env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("mongosh: %s", msg)
+		}
+		return "", fmt.Errorf("mongosh: %v", err)
+	}
+	return stdout.String(), nil
+}
+
+// DropDatabase drops a database.
+func (m *Mongo) DropDatabase(ctx context.Context, name string) error {
+	_, err := m.Eval(ctx, fmt.Sprintf("db.getSiblingDB(%s).dropDatabase()", jsString(name)))
+	return err
+}
+
+// DropCollection drops a collection from db, or from every database when
+// db is empty.
+func (m *Mongo) DropCollection(ctx context.Context, db, name string) error {
+	if db != "" {
+		_, err := m.Eval(ctx, fmt.Sprintf("db.getSiblingDB(%s).getCollection(%s).drop()", jsString(db), jsString(name)))
+		return err
+	}
+	_, err := m.Eval(ctx, fmt.Sprintf(`for (const d of db.adminCommand({listDatabases: 1, nameOnly: true}).databases) {
+  const s = db.getSiblingDB(d.name);
+  if (s.getCollectionNames().includes(%[1]s)) s.getCollection(%[1]s).drop();
+}`, jsString(name)))
+	return err
+}
+
+// DropSearchIndex drops a search index. An index that no longer exists,
+// or a collection that was already dropped, is not an error.
+func (m *Mongo) DropSearchIndex(ctx context.Context, db, collection, name string) error {
+	_, err := m.Eval(ctx, fmt.Sprintf(`const c = db.getSiblingDB(%s).getCollection(%s);
+if (c.getSearchIndexes(%[3]s).length > 0) c.dropSearchIndex(%[3]s);`, jsString(db), jsString(collection), jsString(name)))
+	return err
+}
+
+// jsString quotes s as a JavaScript string literal.
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package cleanup
+
+import (
+	"context"
+	"errors"
+)
+
+// GroupAlive always reports false where process groups are not
+// available, so no background process task is registered.
+func GroupAlive(pgid int) bool { return false }
+
+func stopGroup(ctx context.Context, pgid int) error {
+	return errors.New("stopping process groups is not supported on this platform")
+}
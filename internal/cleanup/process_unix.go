@@ -0,0 +1,38 @@
+//go:build unix
+
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+)
+
+// stopGrace is how long a process group has to exit after SIGTERM.
+const stopGrace = 5 * time.Second
+
+// GroupAlive reports whether any process in the group is still running.
+func GroupAlive(pgid int) bool {
+	return syscall.Kill(-pgid, 0) == nil
+}
+
+func stopGroup(ctx context.Context, pgid int) error {
+	if err := syscall.Kill(-pgid, syscall.SIGTERM); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return nil
+		}
+		return err
+	}
+	deadline := time.Now().Add(stopGrace)
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		if !GroupAlive(pgid) {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err := syscall.Kill(-pgid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package cleanup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/sandbox"
+)
+
+// Orphans are resources that a crashed or killed run left behind.
+type Orphans struct {
+	Databases   []string `json:"databases"`
+	Collections []struct {
+		DB   string `json:"db"`
+		Name string `json:"name"`
+	} `json:"collections"`
+	SearchIndexes []struct {
+		DB         string `json:"db"`
+		Collection string `json:"collection"`
+		Name       string `json:"name"`
+	} `json:"searchIndexes"`
+	Directories []string `json:"-"`
+}
+
+// findOrphansScript lists the databases, collections and search indexes
+// whose names match the pattern. Collections and indexes in a matching
+// database are left out: dropping the database removes them. Deployments
+// without Atlas Search reject $listSearchIndexes, which is not an error.
+const findOrphansScript = `const re = new RegExp(%s);
+const out = {databases: [], collections: [], searchIndexes: []};
+for (const d of db.adminCommand({listDatabases: 1, nameOnly: true}).databases) {
+  if (["admin", "local", "config"].includes(d.name)) continue;
+  if (re.test(d.name)) { out.databases.push(d.name); continue; }
+  const s = db.getSiblingDB(d.name);
+  for (const c of s.getCollectionInfos({type: "collection"}, true)) {
+    if (re.test(c.name)) { out.collections.push({db: d.name, name: c.name}); continue; }
+    try {
+      for (const i of s.getCollection(c.name).getSearchIndexes()) {
+        if (re.test(i.name)) out.searchIndexes.push({db: d.name, collection: c.name, name: i.name});
+      }
+    } catch (e) {}
+  }
+}
+print(JSON.stringify(out));`
+
+// FindOrphans lists the resources matching pattern in the deployment at
+// m.URI, when there is one, and the sandboxes in runsDir that never got
+// a manifest and are older than minAge. A finished procedure writes its
+// manifest before its sandbox is kept, so these belong to crashed runs;
+// the age keeps a sweep from removing the sandbox of a run that is still
+// going.
+func FindOrphans(ctx context.Context, m *Mongo, pattern *regexp.Regexp, runsDir string, minAge time.Duration) (*Orphans, error) {
+	o := &Orphans{}
+	if m != nil && m.URI != "" {
+		out, err := m.Eval(ctx, fmt.Sprintf(findOrphansScript, jsString(pattern.String())))
+		if err != nil {
+			return nil, err
+		}
+		out = strings.TrimSpace(out)
+		if i := strings.LastIndexByte(out, '\n'); i >= 0 {
+			out = out[i+1:]
+		}
+		if err := json.Unmarshal([]byte(out), o); err != nil {
+			return nil, fmt.Errorf("cannot read mongosh output: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(runsDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(runsDir, e.Name())
+		if _, err := os.Stat(filepath.Join(dir, sandbox.ManifestFile)); err == nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < minAge {
+			continue
+		}
+		o.Directories = append(o.Directories, dir)
+	}
+	return o, nil
+}
+
+// Registry returns a registry with a task for every orphan.
+func (o *Orphans) Registry(m *Mongo) *Registry {
+	reg := NewRegistry()
+	for _, d := range o.Directories {
+		reg.Directory(d)
+	}
+	for _, d := range o.Databases {
+		reg.Database(m, d)
+	}
+	for _, c := range o.Collections {
+		reg.Collection(m, c.DB, c.Name)
+	}
+	for _, i := range o.SearchIndexes {
+		reg.SearchIndex(m, i.DB, i.Collection, i.Name)
+	}
+	return reg
+}
@@ -0,0 +1,188 @@
+// Package common holds the language constants shared by the parser, the
+// executors, and the reporters. The values match the canonical language
+// names used across the docs code-example tooling.
+package common
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// Programming languages
+
+	Bash       = "bash"
+	C          = "c"
+	CPP        = "cpp"
+	CSharp     = "csharp"
+	Go         = "go"
+	Java       = "java"
+	JavaScript = "javascript"
+	JSON       = "json"
+	Kotlin     = "kotlin"
+	PHP        = "php"
+	Python     = "python"
+	Ruby       = "ruby"
+	Rust       = "rust"
+	Scala      = "scala"
+	Shell      = "shell"
+	Swift      = "swift"
+	Text       = "text"
+	TypeScript = "typescript"
+	Undefined  = "undefined"
+	XML        = "xml"
+	YAML       = "yaml"
+
+	// File extensions
+
+	BashExtension       = ".sh"
+	CExtension          = ".c"
+	CPPExtension        = ".cpp"
+	CSharpExtension     = ".cs"
+	GoExtension         = ".go"
+	JavaExtension       = ".java"
+	JavaScriptExtension = ".js"
+	JSONExtension       = ".json"
+	KotlinExtension     = ".kt"
+	PHPExtension        = ".php"
+	PythonExtension     = ".py"
+	RubyExtension       = ".rb"
+	RustExtension       = ".rs"
+	ScalaExtension      = ".scala"
+	ShellExtension      = ".sh"
+	SwiftExtension      = ".swift"
+	TextExtension       = ".txt"
+	TypeScriptExtension = ".ts"
+	UndefinedExtension  = ".txt"
+	XMLExtension        = ".xml"
+	YAMLExtension       = ".yaml"
+)
+
+var CanonicalLanguages = []string{Bash, C, CPP,
+	CSharp, Go, Java, JavaScript,
+	JSON, Kotlin, PHP, Python,
+	Ruby, Rust, Scala, Shell,
+	Swift, Text, TypeScript, Undefined, XML, YAML,
+}
+
+func GetNormalizedLanguageFromString(language string) string {
+	normalizeLanguagesMap := make(map[string]string)
+
+	// Add the canonical languages and their values
+	for _, lang := range CanonicalLanguages {
+		normalizeLanguagesMap[lang] = lang
+	}
+
+	// Add variations and map to canonical values
+	normalizeLanguagesMap[""] = Undefined
+	normalizeLanguagesMap["console"] = Shell
+	normalizeLanguagesMap["cs"] = CSharp
+	normalizeLanguagesMap["c++"] = CPP
+	normalizeLanguagesMap["golang"] = Go
+	normalizeLanguagesMap["http"] = Text
+	normalizeLanguagesMap["ini"] = Text
+	normalizeLanguagesMap["js"] = JavaScript
+	normalizeLanguagesMap["none"] = Undefined
+	normalizeLanguagesMap["py"] = Python
+	normalizeLanguagesMap["python3"] = Python
+	normalizeLanguagesMap["sh"] = Shell
+	normalizeLanguagesMap["ts"] = TypeScript
+	normalizeLanguagesMap["yml"] = YAML
+	normalizeLanguagesMap["json\\n :copyable: false"] = JSON
+	normalizeLanguagesMap["json\\n :copyable: true"] = JSON
+
+	canonicalLanguage, exists := normalizeLanguagesMap[strings.ToLower(strings.TrimSpace(language))]
+	if exists {
+		return canonicalLanguage
+	} else {
+		return Undefined
+	}
+}
+
+func GetFileExtensionFromStringLang(language string) string {
+	langExtensionMap := make(map[string]string)
+
+	// Add the canonical languages and their extensions
+	langExtensionMap[Bash] = BashExtension
+	langExtensionMap[C] = CExtension
+	langExtensionMap[CPP] = CPPExtension
+	langExtensionMap[CSharp] = CSharpExtension
+	langExtensionMap[Go] = GoExtension
+	langExtensionMap[Java] = JavaExtension
+	langExtensionMap[JavaScript] = JavaScriptExtension
+	langExtensionMap[JSON] = JSONExtension
+	langExtensionMap[Kotlin] = KotlinExtension
+	langExtensionMap[PHP] = PHPExtension
+	langExtensionMap[Python] = PythonExtension
+	langExtensionMap[Ruby] = RubyExtension
+	langExtensionMap[Rust] = RustExtension
+	langExtensionMap[Scala] = ScalaExtension
+	langExtensionMap[Shell] = ShellExtension
+	langExtensionMap[Swift] = SwiftExtension
+	langExtensionMap[Text] = TextExtension
+	langExtensionMap[TypeScript] = TypeScriptExtension
+	langExtensionMap[Undefined] = UndefinedExtension
+	langExtensionMap[XML] = XMLExtension
+	langExtensionMap[YAML] = YAMLExtension
+
+	extension, exists := langExtensionMap[GetNormalizedLanguageFromString(language)]
+	if exists {
+		return extension
+	} else {
+		return UndefinedExtension
+	}
+}
+
+// GetLanguageFromFilename maps a file name to its canonical language using
+// the file extension. Unknown extensions map to Undefined.
+func GetLanguageFromFilename(filename string) string {
+	extensionLangMap := make(map[string]string)
+
+	// Add the extensions and their canonical languages. Shell wins over
+	// Bash for .sh because the executors treat both the same way.
+	extensionLangMap[ShellExtension] = Shell
+	extensionLangMap[CExtension] = C
+	extensionLangMap[CPPExtension] = CPP
+	extensionLangMap[CSharpExtension] = CSharp
+	extensionLangMap[GoExtension] = Go
+	extensionLangMap[JavaExtension] = Java
+	extensionLangMap[JavaScriptExtension] = JavaScript
+	extensionLangMap[JSONExtension] = JSON
+	extensionLangMap[KotlinExtension] = Kotlin
+	extensionLangMap[PHPExtension] = PHP
+	extensionLangMap[PythonExtension] = Python
+	extensionLangMap[RubyExtension] = Ruby
+	extensionLangMap[RustExtension] = Rust
+	extensionLangMap[ScalaExtension] = Scala
+	extensionLangMap[SwiftExtension] = Swift
+	extensionLangMap[TextExtension] = Text
+	extensionLangMap[TypeScriptExtension] = TypeScript
+	extensionLangMap[XMLExtension] = XML
+	extensionLangMap[YAMLExtension] = YAML
+
+	// Add variations and map to canonical values
+	extensionLangMap[".cc"] = CPP
+	extensionLangMap[".cjs"] = JavaScript
+	extensionLangMap[".h"] = C
+	extensionLangMap[".hpp"] = CPP
+	extensionLangMap[".mjs"] = JavaScript
+	extensionLangMap[".yml"] = YAML
+
+	language, exists := extensionLangMap[strings.ToLower(filepath.Ext(filename))]
+	if exists {
+		return language
+	} else {
+		return Undefined
+	}
+}
+
+// IsExecutableLanguage reports whether code in the given canonical language
+// can be run directly, as opposed to data or markup formats that only make
+// sense as file contents.
+func IsExecutableLanguage(language string) bool {
+	switch language {
+	case JSON, Text, Undefined, XML, YAML:
+		return false
+	}
+	return true
+}
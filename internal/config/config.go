@@ -0,0 +1,396 @@
+// Package config reads the proctest configuration file, .proctest.toml
+// or .proctest.yaml, which sets what the test command's flags do not:
+// which pages to test, the environment files to load, how code runs,
+// cleanup patterns and reporters.
+//
+// The file is declarative, unlike the .proctest.js it replaces, so that
+// proctest can read it; Convert migrates a .proctest.js. Schema describes
+// both formats, and keys it does not have are errors. Paths in the file
+// are relative to the directory it is in.
+//
+// In a monorepo, a page is configured by every file between the
+// repository root and its directory: Discover finds them and Merge
+// combines them, the nearer file winning.
+package config
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/common"
+)
+
+// Schema is the JSON Schema (draft 2020-12) of Config, in either format.
+//
+//go:embed schema.json
+var Schema []byte
+
+// Files are the names a configuration file can have, in the order they
+// are looked for.
+var Files = []string{".proctest.toml", ".proctest.yaml", ".proctest.yml"}
+
+// LegacyFile is the JavaScript configuration file that Convert migrates.
+const LegacyFile = ".proctest.js"
+
+// Config is a configuration file. Every setting is optional.
+type Config struct {
+	// TestFiles are glob patterns of the pages to test when no files are
+	// given on the command line; "**" matches any number of directories.
+	// Exclude leaves matching pages out.
+	TestFiles []string `toml:"testFiles,omitempty" yaml:"testFiles,omitempty"`
+	Exclude   []string `toml:"exclude,omitempty" yaml:"exclude,omitempty"`
+	// EnvFiles are loaded in order, later files overriding earlier ones,
+	// into the environment procedures run with. Variables set in the
+	// process environment win, and missing files are skipped.
+	EnvFiles []string `toml:"envFiles,omitempty" yaml:"envFiles,omitempty"`
+	// SnootyConfig is the snooty.toml to read constants and composable
+	// tutorials from, instead of the one above each page.
+	SnootyConfig string       `toml:"snootyConfig,omitempty" yaml:"snootyConfig,omitempty"`
+	IDEExecution IDEExecution `toml:"ideExecution,omitempty" yaml:"ideExecution,omitempty"`
+	// Timeout bounds each action, like --timeout.
+	Timeout Duration `toml:"timeout,omitzero" yaml:"timeout,omitempty"`
+	// Executors change how code examples run, by language.
+	Executors map[string]Executor `toml:"executors,omitempty" yaml:"executors,omitempty"`
+	Cleanup   Cleanup             `toml:"cleanup,omitempty" yaml:"cleanup,omitempty"`
+	// Reporters are used when --reporter is not given.
+	Reporters []Reporter `toml:"reporters,omitempty" yaml:"reporters,omitempty"`
+	Verbose   *bool      `toml:"verbose,omitempty" yaml:"verbose,omitempty"`
+	// Root stops Discover from looking for configuration files in the
+	// directories above this one.
+	Root bool `toml:"root,omitempty" yaml:"root,omitempty"`
+
+	// Path is the file the configuration was read from. It is empty for
+	// a configuration Merge returns, whose Sources map each setting it
+	// has, by key, to the file that set it.
+	Path    string            `toml:"-" yaml:"-"`
+	Sources map[string]string `toml:"-" yaml:"-"`
+}
+
+// IDEExecution is how code that a page says to run "from your IDE" runs.
+type IDEExecution struct {
+	// Commands override the default IDE command of a language. {filename},
+	// {basename} and {className} are filled in.
+	Commands map[string]string `toml:"commands,omitempty" yaml:"commands,omitempty"`
+	// Skip reports IDE actions as skipped instead of running them.
+	Skip *bool `toml:"skip,omitempty" yaml:"skip,omitempty"`
+}
+
+// Executor changes how the code examples of a language run.
+type Executor struct {
+	// Command replaces the command inline examples run with, such as
+	// "python3.12 {filename}".
+	Command string `toml:"command,omitempty" yaml:"command,omitempty"`
+	// Timeout bounds the language's actions instead of Config.Timeout.
+	Timeout Duration `toml:"timeout,omitzero" yaml:"timeout,omitempty"`
+	// Env is added to the environment of the language's actions.
+	Env map[string]string `toml:"env,omitempty" yaml:"env,omitempty"`
+}
+
+// Cleanup is what is removed after a procedure.
+type Cleanup struct {
+	// Enabled false leaves everything in place, like --no-cleanup.
+	Enabled *bool `toml:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// KeepArtifacts is when to keep a procedure's sandbox, like
+	// --keep-artifacts: failure, always or never.
+	KeepArtifacts string `toml:"keepArtifacts,omitempty" yaml:"keepArtifacts,omitempty"`
+	// DatabasePattern and CollectionPattern are regular expressions for
+	// the names of the databases and collections that procedures create
+	// and that are dropped afterwards. The default is "^proctest_".
+	DatabasePattern   string `toml:"databasePattern,omitempty" yaml:"databasePattern,omitempty"`
+	CollectionPattern string `toml:"collectionPattern,omitempty" yaml:"collectionPattern,omitempty"`
+}
+
+// Reporter is a reporter to use, like --reporter type=output.
+type Reporter struct {
+	Type string `toml:"type" yaml:"type"`
+	// Output is the file to write to. Empty writes to stdout.
+	Output string `toml:"output,omitempty" yaml:"output,omitempty"`
+}
+
+// Duration is a duration written as a string such as "30s" or "5m".
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: use a number with a unit, such as 30s or 5m", text)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Find returns the configuration file in dir, or "" when there is none.
+// It is an error for dir to have more than one.
+func Find(dir string) (string, error) {
+	var found []string
+	for _, name := range Files {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			found = append(found, p)
+		}
+	}
+	if len(found) > 1 {
+		return "", fmt.Errorf("%s and %s are both configuration files; keep one", found[0], found[1])
+	}
+	if len(found) == 0 {
+		return "", nil
+	}
+	return found[0], nil
+}
+
+// Load reads and validates the configuration file at path, as TOML or
+// YAML by its extension.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c *Config
+	switch ext := filepath.Ext(path); ext {
+	case ".toml":
+		c, err = ParseTOML(data)
+	case ".yaml", ".yml":
+		c, err = ParseYAML(data)
+	default:
+		return nil, fmt.Errorf("%s: configuration files are .toml or .yaml, not %s", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	c.Path = path
+	return c, nil
+}
+
+// ParseTOML reads and validates a TOML configuration. Keys the schema
+// does not have are errors, so that a misspelled "envFile" does not go
+// unnoticed.
+func ParseTOML(data []byte) (*Config, error) {
+	var c Config
+	md, err := toml.Decode(string(data), &c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	var errs []error
+	for _, key := range md.Undecoded() {
+		errs = append(errs, fmt.Errorf("unknown key %s", key))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ParseYAML reads and validates a YAML configuration. Keys the schema
+// does not have are errors.
+func ParseYAML(data []byte) (*Config, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	var c Config
+	if len(doc.Content) == 0 {
+		return &c, nil
+	}
+	if errs := unknownKeys(doc.Content[0], reflect.TypeOf(c), ""); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if err := doc.Decode(&c); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// unknownKeys returns an error for each key of the YAML mappings in n
+// that t, the type n decodes into, has no field for.
+func unknownKeys(n *yaml.Node, t reflect.Type, prefix string) []error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var errs []error
+	switch {
+	case n.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for i, item := range n.Content {
+			errs = append(errs, unknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", prefix, i))...)
+		}
+	case n.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			errs = append(errs, unknownKeys(n.Content[i+1], t.Elem(), join(prefix, n.Content[i].Value))...)
+		}
+	case n.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			field, ok := fieldByKey(t, key.Value)
+			if !ok {
+				errs = append(errs, fmt.Errorf("line %d: unknown key %s", key.Line, join(prefix, key.Value)))
+				continue
+			}
+			errs = append(errs, unknownKeys(n.Content[i+1], field.Type, join(prefix, key.Value))...)
+		}
+	}
+	return errs
+}
+
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name, _, _ := strings.Cut(f.Tag.Get("yaml"), ","); name == key && name != "-" {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// KeepArtifacts values.
+var keepValues = []string{"failure", "always", "never"}
+
+// Validate checks the configuration against Schema, and that patterns
+// and languages can be used. It reports every problem it finds.
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	for key, patterns := range map[string][]string{"testFiles": c.TestFiles, "exclude": c.Exclude} {
+		for _, p := range patterns {
+			if err := checkPattern(p); err != nil {
+				add("%s: %v", key, err)
+			}
+		}
+	}
+	for _, f := range c.EnvFiles {
+		if strings.TrimSpace(f) == "" {
+			add("envFiles: file names cannot be empty")
+		}
+	}
+	for lang, command := range c.IDEExecution.Commands {
+		if strings.TrimSpace(command) == "" {
+			add("ideExecution.commands.%s: command cannot be empty", lang)
+		}
+		if !knownLanguage(lang) {
+			add("ideExecution.commands.%s: unknown language", lang)
+		}
+	}
+	if c.Timeout < 0 {
+		add("timeout cannot be negative")
+	}
+	for lang, e := range c.Executors {
+		if !knownLanguage(lang) {
+			add("executors.%s: unknown language", lang)
+		}
+		if e.Timeout < 0 {
+			add("executors.%s.timeout cannot be negative", lang)
+		}
+	}
+	if k := c.Cleanup.KeepArtifacts; k != "" && !slices.Contains(keepValues, k) {
+		add("cleanup.keepArtifacts %q: use failure, always or never", k)
+	}
+	for key, p := range map[string]string{"cleanup.databasePattern": c.Cleanup.DatabasePattern, "cleanup.collectionPattern": c.Cleanup.CollectionPattern} {
+		if _, err := regexp.Compile(p); err != nil {
+			add("%s: %v", key, err)
+		}
+	}
+	for i, r := range c.Reporters {
+		if strings.TrimSpace(r.Type) == "" {
+			add("reporters[%d]: type is required", i)
+		}
+	}
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
+
+// knownLanguage reports whether lang is a language code examples are
+// written in, by any of its names.
+func knownLanguage(lang string) bool {
+	return common.GetNormalizedLanguageFromString(lang) != common.Undefined
+}
+
+// Language returns the normalized name of lang, as the executors key
+// their languages.
+func Language(lang string) string {
+	return common.GetNormalizedLanguageFromString(lang)
+}
+
+func checkPattern(p string) error {
+	if strings.TrimSpace(p) == "" {
+		return errors.New("patterns cannot be empty")
+	}
+	for _, part := range strings.Split(filepath.ToSlash(p), "/") {
+		if _, err := path.Match(part, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// Dir returns the directory paths in the configuration are relative to.
+func (c *Config) Dir() string {
+	if c.Path == "" {
+		return "."
+	}
+	return filepath.Dir(c.Path)
+}
+
+// Resolve returns p relative to the configuration's directory.
+func (c *Config) Resolve(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(c.Dir(), p)
+}
+
+// CleanupEnabled reports whether cleanup is on, as it is by default.
+func (c *Config) CleanupEnabled() bool {
+	return c.Cleanup.Enabled == nil || *c.Cleanup.Enabled
+}
+
+// EncodeTOML writes c as TOML.
+func EncodeTOML(c *Config) ([]byte, error) {
+	var b bytes.Buffer
+	enc := toml.NewEncoder(&b)
+	enc.Indent = ""
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// EncodeYAML writes c as YAML.
+func EncodeYAML(c *Config) ([]byte, error) {
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), enc.Close()
+}
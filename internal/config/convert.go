@@ -0,0 +1,761 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Convert migrates a .proctest.js to a Config. It reads the object
+// literal that module.exports, or export default, is set to, without
+// running any JavaScript. Settings that cannot be converted, such as
+// hooks and other functions, are left out and described in the notes it
+// returns.
+func Convert(src []byte) (*Config, []string, error) {
+	js := string(src)
+	start := exportsRE.FindStringIndex(js)
+	if start == nil {
+		return nil, nil, errors.New("no module.exports = { ... } or export default { ... } found")
+	}
+	p := &jsParser{src: js, pos: start[1]}
+	p.skipSpace()
+	if p.peek() != '{' {
+		return nil, nil, errors.New("module.exports is not an object literal")
+	}
+	v, err := p.value()
+	if err != nil {
+		return nil, nil, err
+	}
+	cv := &converter{}
+	c := cv.config(v.(*jsObject))
+	return c, cv.notes, nil
+}
+
+var exportsRE = regexp.MustCompile(`(?:module\.exports|export\s+default)\s*=?\s*`)
+
+// jsObject is an object literal, with its keys in order. Spreads and
+// computed keys, which cannot be read without running the file, are kept
+// as text in unread.
+type jsObject struct {
+	keys   []string
+	values map[string]any
+	unread []string
+}
+
+// jsRegexp is a regular expression literal.
+type jsRegexp struct {
+	source, flags string
+}
+
+// jsExpression is anything other than a literal, such as a function.
+type jsExpression struct {
+	text string
+}
+
+// jsParser reads JavaScript literals: objects, arrays, strings, numbers,
+// booleans, null and regular expressions.
+type jsParser struct {
+	src string
+	pos int
+}
+
+func (p *jsParser) errorf(format string, args ...any) error {
+	line := strings.Count(p.src[:p.pos], "\n") + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *jsParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *jsParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], "//"):
+			if i := strings.IndexByte(p.src[p.pos:], '\n'); i >= 0 {
+				p.pos += i + 1
+			} else {
+				p.pos = len(p.src)
+			}
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			if i := strings.Index(p.src[p.pos+2:], "*/"); i >= 0 {
+				p.pos += i + 4
+			} else {
+				p.pos = len(p.src)
+			}
+		case unicode.IsSpace(rune(p.src[p.pos])):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// value reads a value. A value that is not a literal is read as a
+// jsExpression up to the comma or bracket that ends it.
+func (p *jsParser) value() (any, error) {
+	p.skipSpace()
+	start := p.pos
+	var v any
+	var err error
+	switch c := p.peek(); {
+	case c == '{':
+		v, err = p.object()
+	case c == '[':
+		v, err = p.array()
+	case c == '"' || c == '\'':
+		v, err = p.str()
+	case c == '`':
+		v, err = p.template()
+	case c == '/':
+		v, err = p.regexp()
+	case c == '-' || c == '.' || c >= '0' && c <= '9':
+		v, err = p.number()
+	default:
+		switch word := p.word(); word {
+		case "true", "false":
+			v = word == "true"
+		case "null", "undefined":
+			v = nil
+		default:
+			p.pos = start
+			return p.expression(start)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); !p.atEnd() {
+		// A literal followed by more, such as 30 * 1000.
+		return p.expression(start)
+	}
+	return v, nil
+}
+
+// atEnd reports whether the next character ends a value.
+func (p *jsParser) atEnd() bool {
+	c := p.peek()
+	return c == ',' || c == '}' || c == ']' || c == ';' || c == 0
+}
+
+func (p *jsParser) word() string {
+	start := p.pos
+	for p.pos < len(p.src) && (isIdent(p.src[p.pos])) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (p *jsParser) object() (any, error) {
+	p.pos++ // {
+	obj := &jsObject{values: map[string]any{}}
+	for {
+		p.skipSpace()
+		if p.peek() == '}' {
+			p.pos++
+			return obj, nil
+		}
+		var key string
+		switch c := p.peek(); {
+		case c == '"' || c == '\'':
+			s, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		case isIdent(c):
+			key = p.word()
+			if p.skipSpace(); key == "async" && isIdent(p.peek()) {
+				key = p.word()
+			}
+		default:
+			// Computed keys and spreads.
+			e, err := p.expression(p.pos)
+			if err != nil {
+				return nil, err
+			}
+			obj.unread = append(obj.unread, e.(*jsExpression).text)
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		p.skipSpace()
+		var v any
+		var err error
+		switch p.peek() {
+		case ':':
+			p.pos++
+			v, err = p.value()
+		case '(':
+			// A method: beforeAll(context) { ... }.
+			v, err = p.expression(p.pos)
+		default:
+			return nil, p.errorf("expected : after %s", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := obj.values[key]; !dup {
+			obj.keys = append(obj.keys, key)
+		}
+		obj.values[key] = v
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// next moves past the comma after an object entry or array element.
+func (p *jsParser) next() error {
+	p.skipSpace()
+	switch p.peek() {
+	case ',':
+		p.pos++
+	case '}', ']':
+	default:
+		return p.errorf("expected , or the end of the object")
+	}
+	return nil
+}
+
+func (p *jsParser) array() (any, error) {
+	p.pos++ // [
+	out := []any{}
+	for {
+		p.skipSpace()
+		if p.peek() == ']' {
+			p.pos++
+			return out, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *jsParser) str() (string, error) {
+	quote := p.src[p.pos]
+	var b strings.Builder
+	for i := p.pos + 1; i < len(p.src); i++ {
+		switch c := p.src[i]; {
+		case c == quote:
+			p.pos = i + 1
+			return b.String(), nil
+		case c == '\\' && i+1 < len(p.src):
+			i++
+			switch e := p.src[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '\n':
+			default:
+				b.WriteByte(e)
+			}
+		case c == '\n':
+			return "", p.errorf("unterminated string")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// template reads a template literal without substitutions.
+func (p *jsParser) template() (any, error) {
+	start := p.pos
+	end := p.skipTemplate(p.pos)
+	if end < 0 {
+		return nil, p.errorf("unterminated template literal")
+	}
+	text := p.src[start+1 : end-1]
+	p.pos = end
+	if strings.Contains(text, "${") {
+		return &jsExpression{text: p.src[start:end]}, nil
+	}
+	return text, nil
+}
+
+func (p *jsParser) regexp() (any, error) {
+	end := p.skipRegexp(p.pos)
+	if end < 0 {
+		return nil, p.errorf("unterminated regular expression")
+	}
+	body := p.src[p.pos:end]
+	slash := strings.LastIndexByte(body, '/')
+	p.pos = end
+	return &jsRegexp{source: body[1:slash], flags: body[slash+1:]}, nil
+}
+
+func (p *jsParser) number() (any, error) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.src) && (isIdent(p.src[p.pos]) || p.src[p.pos] == '.') {
+		p.pos++
+	}
+	text := strings.ReplaceAll(p.src[start:p.pos], "_", "")
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		if i, err := strconv.ParseInt(text, 0, 64); err == nil {
+			return float64(i), nil
+		}
+		return nil, p.errorf("invalid number %s", text)
+	}
+	return n, nil
+}
+
+// expression skips to the end of the value that starts at start, past
+// brackets, strings, comments and regular expressions, and returns its
+// text.
+func (p *jsParser) expression(start int) (any, error) {
+	depth := 0
+	last := byte('(')
+	for i := start; i < len(p.src); {
+		c := p.src[i]
+		switch {
+		case strings.HasPrefix(p.src[i:], "//"), strings.HasPrefix(p.src[i:], "/*"):
+			p.pos = i
+			p.skipSpace()
+			i = p.pos
+			continue
+		case c == '"' || c == '\'':
+			p.pos = i
+			if _, err := p.str(); err != nil {
+				return nil, err
+			}
+			i = p.pos
+		case c == '`':
+			if i = p.skipTemplate(i); i < 0 {
+				return nil, p.errorf("unterminated template literal")
+			}
+		case c == '/' && strings.IndexByte("(,=:[!&|?{};+-*%<>~^", last) >= 0:
+			if i = p.skipRegexp(i); i < 0 {
+				return nil, p.errorf("unterminated regular expression")
+			}
+		case c == '(' || c == '[' || c == '{':
+			depth++
+			i++
+		case c == ')' || c == ']' || c == '}':
+			if depth == 0 {
+				p.pos = i
+				return &jsExpression{text: strings.TrimSpace(p.src[start:i])}, nil
+			}
+			depth--
+			i++
+		case (c == ',' || c == ';') && depth == 0:
+			p.pos = i
+			return &jsExpression{text: strings.TrimSpace(p.src[start:i])}, nil
+		default:
+			i++
+		}
+		if !unicode.IsSpace(rune(c)) {
+			last = c
+		}
+	}
+	return nil, p.errorf("unexpected end of file")
+}
+
+// skipTemplate returns the end of the template literal at i, or -1.
+func (p *jsParser) skipTemplate(i int) int {
+	depth := 0
+	for i++; i < len(p.src); i++ {
+		switch c := p.src[i]; {
+		case c == '\\':
+			i++
+		case c == '`' && depth == 0:
+			return i + 1
+		case c == '$' && depth == 0 && i+1 < len(p.src) && p.src[i+1] == '{':
+			depth++
+			i++
+		case c == '{' && depth > 0:
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		}
+	}
+	return -1
+}
+
+// skipRegexp returns the end of the regular expression literal at i,
+// flags included, or -1.
+func (p *jsParser) skipRegexp(i int) int {
+	class := false
+	for i++; i < len(p.src); i++ {
+		switch c := p.src[i]; {
+		case c == '\\':
+			i++
+		case c == '[':
+			class = true
+		case c == ']':
+			class = false
+		case c == '\n':
+			return -1
+		case c == '/' && !class:
+			for i++; i < len(p.src) && isIdent(p.src[i]); i++ {
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// converter maps the settings of a .proctest.js to a Config and notes
+// what it leaves out.
+type converter struct {
+	notes []string
+}
+
+func (cv *converter) note(format string, args ...any) {
+	cv.notes = append(cv.notes, fmt.Sprintf(format, args...))
+}
+
+func (cv *converter) config(obj *jsObject) *Config {
+	c := &Config{}
+	cv.unread("", obj)
+	for _, key := range obj.keys {
+		v := obj.values[key]
+		switch key {
+		case "testFiles", "testMatch":
+			c.TestFiles = append(c.TestFiles, cv.strings(key, v)...)
+		case "exclude", "testIgnore":
+			c.Exclude = append(c.Exclude, cv.strings(key, v)...)
+		case "envFiles":
+			c.EnvFiles = cv.strings(key, v)
+		case "snootyConfig":
+			c.SnootyConfig = cv.string(key, v)
+		case "ideExecution":
+			cv.ideExecution(c, cv.object(key, v))
+		case "timeout":
+			c.Timeout = cv.duration(key, v)
+		case "executors":
+			cv.executors(c, cv.object(key, v))
+		case "cleanup":
+			cv.cleanup(c, cv.object(key, v))
+		case "reporters":
+			cv.reporters(c, v)
+		case "verbose":
+			c.Verbose = cv.optionalBool(key, v)
+		case "hooks":
+			cv.note("hooks: proctest runs no JavaScript; run setup and teardown in CI before and after proctest instead")
+		case "ui":
+			cv.note("ui: navigation mappings are functions and user values are placeholders; set placeholder values in an env file instead")
+		default:
+			cv.note("%s: not a proctest setting", key)
+		}
+	}
+	return c
+}
+
+func (cv *converter) ideExecution(c *Config, obj *jsObject) {
+	if obj == nil {
+		return
+	}
+	for _, key := range obj.keys {
+		v := obj.values[key]
+		switch key {
+		case "commands":
+			commands := cv.object("ideExecution.commands", v)
+			if commands == nil {
+				continue
+			}
+			c.IDEExecution.Commands = map[string]string{}
+			for _, lang := range commands.keys {
+				if !knownLanguage(lang) {
+					cv.note("ideExecution.commands.%s: unknown language", lang)
+					continue
+				}
+				if cmd := cv.string("ideExecution.commands."+lang, commands.values[lang]); cmd != "" {
+					c.IDEExecution.Commands[lang] = cmd
+				}
+			}
+		case "skip":
+			c.IDEExecution.Skip = cv.optionalBool("ideExecution.skip", v)
+		default:
+			cv.note("ideExecution.%s: not a proctest setting", key)
+		}
+	}
+}
+
+func (cv *converter) executors(c *Config, obj *jsObject) {
+	if obj == nil {
+		return
+	}
+	for _, lang := range obj.keys {
+		name := "executors." + lang
+		settings := cv.object(name, obj.values[lang])
+		if settings == nil {
+			continue
+		}
+		if !knownLanguage(lang) {
+			cv.note("%s: unknown language", name)
+			continue
+		}
+		var e Executor
+		for _, key := range settings.keys {
+			v := settings.values[key]
+			switch key {
+			case "runtime":
+				if runtime := cv.string(name+".runtime", v); runtime != "" {
+					e.Command = runtime + " {filename}"
+				}
+			case "command":
+				e.Command = cv.string(name+".command", v)
+			case "timeout":
+				e.Timeout = cv.duration(name+".timeout", v)
+			case "env":
+				env := cv.object(name+".env", v)
+				if env == nil {
+					continue
+				}
+				e.Env = map[string]string{}
+				for _, k := range env.keys {
+					e.Env[k] = cv.scalar(name+".env."+k, env.values[k])
+				}
+			case "version":
+				cv.note("%s.version: check runtime versions with the page's prerequisites instead", name)
+			default:
+				cv.note("%s.%s: not a proctest setting", name, key)
+			}
+		}
+		if c.Executors == nil {
+			c.Executors = map[string]Executor{}
+		}
+		c.Executors[lang] = e
+	}
+}
+
+func (cv *converter) cleanup(c *Config, obj *jsObject) {
+	if obj == nil {
+		return
+	}
+	for _, key := range obj.keys {
+		name := "cleanup." + key
+		v := obj.values[key]
+		if key == "enabled" {
+			c.Cleanup.Enabled = cv.optionalBool(name, v)
+			continue
+		}
+		settings := cv.object(name, v)
+		if settings == nil {
+			continue
+		}
+		switch key {
+		case "workingDirectories":
+			enabled, keepOnFailure := true, true
+			if v, ok := settings.values["enabled"]; ok {
+				enabled = cv.bool(name+".enabled", v)
+			}
+			if v, ok := settings.values["keepOnFailure"]; ok {
+				keepOnFailure = cv.bool(name+".keepOnFailure", v)
+			}
+			switch {
+			case !enabled:
+				c.Cleanup.KeepArtifacts = "always"
+			case keepOnFailure:
+				c.Cleanup.KeepArtifacts = "failure"
+			default:
+				c.Cleanup.KeepArtifacts = "never"
+			}
+		case "databases", "collections":
+			for _, k := range settings.keys {
+				switch k {
+				case "pattern":
+					pattern := cv.pattern(name+".pattern", settings.values[k])
+					if key == "databases" {
+						c.Cleanup.DatabasePattern = pattern
+					} else {
+						c.Cleanup.CollectionPattern = pattern
+					}
+				case "enabled":
+					if !cv.bool(name+".enabled", settings.values[k]) {
+						cv.note("%s.enabled: %s cannot be kept on their own; set cleanup.enabled to false to keep everything", name, key)
+					}
+				case "onFailure":
+					cv.note("%s.onFailure: a cleanup that fails is always reported as a warning", name)
+				default:
+					cv.note("%s.%s: not a proctest setting", name, k)
+				}
+			}
+		default:
+			cv.note("%s: not a proctest setting", name)
+		}
+	}
+}
+
+func (cv *converter) reporters(c *Config, v any) {
+	list, ok := v.([]any)
+	if !ok {
+		cv.note("reporters: not a list")
+		return
+	}
+	for i, item := range list {
+		name := fmt.Sprintf("reporters[%d]", i)
+		var r Reporter
+		switch item := item.(type) {
+		case string:
+			r.Type = item
+		case *jsObject:
+			cv.unread(name, item)
+			r.Type = cv.string(name+".type", item.values["type"])
+			if opts, ok := item.values["options"].(*jsObject); ok {
+				for _, k := range opts.keys {
+					if k == "outputFile" || k == "output" {
+						r.Output = cv.string(name+".options."+k, opts.values[k])
+					} else {
+						cv.note("%s.options.%s: not a proctest setting", name, k)
+					}
+				}
+			}
+		default:
+			cv.note("%s: not a reporter", name)
+			continue
+		}
+		if r.Type != "" {
+			c.Reporters = append(c.Reporters, r)
+		}
+	}
+}
+
+// object returns v as an object, noting that it is not one.
+func (cv *converter) object(name string, v any) *jsObject {
+	if obj, ok := v.(*jsObject); ok {
+		cv.unread(name, obj)
+		return obj
+	}
+	cv.unconverted(name, v, "an object")
+	return nil
+}
+
+// unread notes the spreads and computed keys of the object name, whose
+// settings are left out.
+func (cv *converter) unread(name string, obj *jsObject) {
+	for _, text := range obj.unread {
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[:i] + " ..."
+		}
+		if name == "" {
+			cv.note("%s: not a literal setting; set what it sets by hand", text)
+		} else {
+			cv.note("%s: %s is not a literal setting; set what it sets by hand", name, text)
+		}
+	}
+}
+
+func (cv *converter) string(name string, v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	cv.unconverted(name, v, "a string")
+	return ""
+}
+
+func (cv *converter) strings(name string, v any) []string {
+	if s, ok := v.(string); ok {
+		return []string{s}
+	}
+	list, ok := v.([]any)
+	if !ok {
+		cv.unconverted(name, v, "a list of strings")
+		return nil
+	}
+	var out []string
+	for i, item := range list {
+		if s := cv.string(fmt.Sprintf("%s[%d]", name, i), item); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (cv *converter) bool(name string, v any) bool {
+	b := cv.optionalBool(name, v)
+	return b != nil && *b
+}
+
+// optionalBool is bool for the settings that are left unset, rather
+// than false, when v is not a boolean.
+func (cv *converter) optionalBool(name string, v any) *bool {
+	if b, ok := v.(bool); ok {
+		return &b
+	}
+	cv.unconverted(name, v, "true or false")
+	return nil
+}
+
+// scalar returns a string, number or boolean as a string.
+func (cv *converter) scalar(name string, v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	cv.unconverted(name, v, "a string")
+	return ""
+}
+
+// duration reads milliseconds, as .proctest.js has them.
+func (cv *converter) duration(name string, v any) Duration {
+	if ms, ok := v.(float64); ok && ms >= 0 {
+		return Duration(time.Duration(ms * float64(time.Millisecond)))
+	}
+	cv.unconverted(name, v, "a number of milliseconds")
+	return 0
+}
+
+// pattern reads a regular expression literal or a string. Go regular
+// expressions take JavaScript's i, m and s flags inline.
+func (cv *converter) pattern(name string, v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case *jsRegexp:
+		var flags string
+		for _, f := range v.flags {
+			if strings.ContainsRune("ims", f) {
+				flags += string(f)
+			}
+		}
+		if flags != "" {
+			return "(?" + flags + ")" + v.source
+		}
+		return v.source
+	}
+	cv.unconverted(name, v, "a regular expression")
+	return ""
+}
+
+func (cv *converter) unconverted(name string, v any, want string) {
+	if e, ok := v.(*jsExpression); ok {
+		text := e.text
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[:i] + " ..."
+		}
+		cv.note("%s: %s is not a literal; set it by hand", name, text)
+		return
+	}
+	cv.note("%s: not %s", name, want)
+}
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestConvertExample(t *testing.T) {
+	src, err := os.ReadFile("../../.proctest.example.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, notes, err := Convert(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{
+		TestFiles:    []string{"content/**/*.txt", "content/**/*.rst"},
+		Exclude:      []string{"**/node_modules/**", "**/.git/**"},
+		EnvFiles:     []string{".env", ".env.local"},
+		SnootyConfig: "snooty.toml",
+		IDEExecution: IDEExecution{
+			Commands: map[string]string{
+				"java":   "gradle run",
+				"cpp":    "./build/bin/{basename}",
+				"python": "python3 {filename}",
+				"rust":   "cargo run --bin {basename}",
+			},
+			Skip: ptr(false),
+		},
+		Timeout: Duration(30 * time.Second),
+		Executors: map[string]Executor{
+			"javascript": {Command: "node {filename}", Timeout: Duration(10 * time.Second), Env: map[string]string{"NODE_ENV": "test"}},
+			"python":     {Command: "python3 {filename}", Timeout: Duration(15 * time.Second)},
+		},
+		Cleanup: Cleanup{
+			KeepArtifacts:     "failure",
+			DatabasePattern:   "^proctest_",
+			CollectionPattern: "^test_",
+		},
+		Reporters: []Reporter{{Type: "human"}, {Type: "json", Output: "test-results.json"}},
+		Verbose:   ptr(false),
+	}
+	equal(t, "converted example", c, want)
+	equal(t, "notes", notes, []string{
+		"executors.javascript.version: check runtime versions with the page's prerequisites instead",
+		"cleanup.databases.onFailure: a cleanup that fails is always reported as a warning",
+		"hooks: proctest runs no JavaScript; run setup and teardown in CI before and after proctest instead",
+	})
+
+	// The converted file has to load back as the same configuration, in
+	// either format.
+	for _, format := range []struct {
+		name   string
+		encode func(*Config) ([]byte, error)
+	}{
+		{".proctest.toml", EncodeTOML},
+		{".proctest.yaml", EncodeYAML},
+	} {
+		t.Run(format.name, func(t *testing.T) {
+			data, err := format.encode(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), format.name)
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := Load(path)
+			if err != nil {
+				t.Fatalf("%v\n%s", err, data)
+			}
+			loaded.Path = ""
+			equal(t, "loaded", loaded, want)
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		want      *Config
+		wantNotes []string
+	}{
+		{
+			name: "comments",
+			src: `// proctest settings
+/* block
+   comment */
+module.exports = {
+  // the pages
+  testFiles: [ /* first */ 'source/**/*.txt', // a comment after
+  ],
+  snootyConfig: 'https://example.com/snooty.toml', /* not a comment: // */
+};`,
+			want: &Config{TestFiles: []string{"source/**/*.txt"}, SnootyConfig: "https://example.com/snooty.toml"},
+		},
+		{
+			name: "trailing commas",
+			src:  `module.exports = {envFiles: ['.env', '.env.local',], verbose: true,};`,
+			want: &Config{EnvFiles: []string{".env", ".env.local"}, Verbose: ptr(true)},
+		},
+		{
+			name: "export default",
+			src:  `export default { timeout: 45000 }`,
+			want: &Config{Timeout: Duration(45 * time.Second)},
+		},
+		{
+			name: "quoted keys, escapes and a lone string",
+			src:  `module.exports = {"testFiles": "source/a.txt", 'snootyConfig': "dir\\snooty \"main\".toml"}`,
+			want: &Config{TestFiles: []string{"source/a.txt"}, SnootyConfig: `dir\snooty "main".toml`},
+		},
+		{
+			name: "template strings",
+			src:  "module.exports = {snootyConfig: `snooty.toml`, envFiles: [`.env`, `${process.env.HOME}/.env`]}",
+			want: &Config{SnootyConfig: "snooty.toml", EnvFiles: []string{".env"}},
+			wantNotes: []string{
+				"envFiles[1]: `${process.env.HOME}/.env` is not a literal; set it by hand",
+			},
+		},
+		{
+			name: "nested objects and arrays",
+			src: `module.exports = {
+  executors: {
+    python: {runtime: 'python3.12', timeout: 1_500, env: {DEBUG: 1, STRICT: true, MODE: 'test'}},
+  },
+  cleanup: {
+    enabled: true,
+    workingDirectories: {keepOnFailure: false},
+    databases: {pattern: /^test_/i},
+    collections: {pattern: '^tmp_'},
+  },
+  reporters: ['human', {type: 'junit', options: {output: 'junit.xml'}}],
+}`,
+			want: &Config{
+				Executors: map[string]Executor{"python": {
+					Command: "python3.12 {filename}",
+					Timeout: Duration(1500 * time.Millisecond),
+					Env:     map[string]string{"DEBUG": "1", "STRICT": "true", "MODE": "test"},
+				}},
+				Cleanup: Cleanup{
+					Enabled:           ptr(true),
+					KeepArtifacts:     "never",
+					DatabasePattern:   "(?i)^test_",
+					CollectionPattern: "^tmp_",
+				},
+				Reporters: []Reporter{{Type: "human"}, {Type: "junit", Output: "junit.xml"}},
+			},
+		},
+		{
+			name: "working directories kept",
+			src:  `module.exports = {cleanup: {workingDirectories: {enabled: false}}}`,
+			want: &Config{Cleanup: Cleanup{KeepArtifacts: "always"}},
+		},
+		{
+			name: "expressions",
+			src: `const base = require('./base');
+module.exports = {
+  timeout: 30 * 1000,
+  testFiles: process.env.FILES.split(','),
+  verbose: !!process.env.CI,
+  ideExecution: {commands: {python: process.platform === 'win32' ? 'py {filename}' : 'python3 {filename}'}},
+}`,
+			want: &Config{IDEExecution: IDEExecution{Commands: map[string]string{}}},
+			wantNotes: []string{
+				"timeout: 30 * 1000 is not a literal; set it by hand",
+				"testFiles: process.env.FILES.split(',') is not a literal; set it by hand",
+				"verbose: !!process.env.CI is not a literal; set it by hand",
+				"ideExecution.commands.python: process.platform === 'win32' ? 'py {filename}' : 'python3 {filename}' is not a literal; set it by hand",
+			},
+		},
+		{
+			name: "spreads and computed keys",
+			src: `module.exports = {
+  ...base,
+  executors: {[lang]: {timeout: 1000}, ...more},
+  envFiles: ['.env'],
+}`,
+			want: &Config{EnvFiles: []string{".env"}},
+			wantNotes: []string{
+				"...base: not a literal setting; set what it sets by hand",
+				"executors: [lang]: {timeout: 1000} is not a literal setting; set what it sets by hand",
+				"executors: ...more is not a literal setting; set what it sets by hand",
+			},
+		},
+		{
+			name: "functions and unknown settings",
+			src: `module.exports = {
+  hooks: {beforeAll: async () => { await setup(); }},
+  ui: {navigate(page) { return page; }},
+  parallel: 4,
+  ideExecution: {commands: {cobol: 'cobc {filename}'}, retries: 2},
+  executors: {python: {version: '>=3.10', shell: 'bash'}},
+  cleanup: {databases: {enabled: false, drop: true}, caches: {}},
+  reporters: [{type: 'json', options: {pretty: true}}, 42],
+}`,
+			want: &Config{
+				IDEExecution: IDEExecution{Commands: map[string]string{}},
+				Executors:    map[string]Executor{"python": {}},
+				Reporters:    []Reporter{{Type: "json"}},
+			},
+			wantNotes: []string{
+				"hooks: proctest runs no JavaScript; run setup and teardown in CI before and after proctest instead",
+				"ui: navigation mappings are functions and user values are placeholders; set placeholder values in an env file instead",
+				"parallel: not a proctest setting",
+				"ideExecution.commands.cobol: unknown language",
+				"ideExecution.retries: not a proctest setting",
+				"executors.python.version: check runtime versions with the page's prerequisites instead",
+				"executors.python.shell: not a proctest setting",
+				"cleanup.databases.enabled: databases cannot be kept on their own; set cleanup.enabled to false to keep everything",
+				"cleanup.databases.drop: not a proctest setting",
+				"cleanup.caches: not a proctest setting",
+				"reporters[0].options.pretty: not a proctest setting",
+				"reporters[1]: not a reporter",
+			},
+		},
+		{
+			name: "values of the wrong type",
+			src:  `module.exports = {envFiles: {local: '.env'}, timeout: '30s', verbose: 'yes', reporters: 'human'}`,
+			want: &Config{},
+			wantNotes: []string{
+				"envFiles: not a list of strings",
+				"timeout: not a number of milliseconds",
+				"verbose: not true or false",
+				"reporters: not a list",
+			},
+		},
+		{
+			name: "missing comma",
+			src:  `module.exports = {timeout: 1000 verbose: true}`,
+			want: &Config{},
+			wantNotes: []string{
+				"timeout: 1000 verbose: true is not a literal; set it by hand",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, notes, err := Convert([]byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			equal(t, "config", c, tt.want)
+			equal(t, "notes", notes, tt.wantNotes)
+		})
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"no exports", `const config = {timeout: 1000};`, "no module.exports"},
+		{"not an object", `module.exports = require('./base');`, "not an object literal"},
+		{"unterminated string", "module.exports = {\n  envFiles: ['.env],\n}", "line 2: unterminated string"},
+		{"unterminated template", "module.exports = {snootyConfig: `snooty.toml}", "unterminated template literal"},
+		{"missing colon", "module.exports = {\n  timeout 1000\n}", "line 2: expected : after timeout"},
+		{"unclosed object", `module.exports = {timeout: 1000, executors: {python: {}`, "expected , or the end of the object"},
+		{"unclosed expression", `module.exports = {timeout: parse('30s'`, "unexpected end of file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Convert([]byte(tt.src))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Convert() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
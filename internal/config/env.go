@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environ returns environ, KEY=value pairs such as os.Environ(), with
+// the variables of the configuration's env files added under it: a
+// variable environ sets keeps its value.
+func (c *Config) Environ(environ []string) ([]string, error) {
+	set := map[string]bool{}
+	for _, kv := range environ {
+		k, _, _ := strings.Cut(kv, "=")
+		set[k] = true
+	}
+	var fromFiles []string
+	for _, name := range c.EnvFiles {
+		vars, err := ReadEnvFile(c.Resolve(name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range vars {
+			if k, _, _ := strings.Cut(kv, "="); !set[k] {
+				fromFiles = append(fromFiles, kv)
+			}
+		}
+	}
+	// Later entries win, so the files go first and the later of them
+	// override the earlier.
+	return append(fromFiles, environ...), nil
+}
+
+// ReadEnvFile reads a .env file: KEY=value lines, optionally preceded by
+// "export", with # comments. Values can be quoted; double-quoted values
+// understand \n and the other Go escapes.
+func ReadEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var vars []string
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%s:%d: want KEY=value", path, n)
+		}
+		value, err := envValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		vars = append(vars, key+"="+value)
+	}
+	return vars, sc.Err()
+}
+
+func envValue(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, `"`):
+		end := strings.LastIndex(v, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return strconv.Unquote(v[:end+1])
+	case strings.HasPrefix(v, "'"):
+		end := strings.LastIndex(v, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return v[1:end], nil
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return v, nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Match reports whether name, a slash-separated path, matches pattern.
+// Patterns are path.Match patterns in which a "**" segment matches any
+// number of directories.
+func Match(pattern, name string) bool {
+	return matchParts(strings.Split(path.Clean(pattern), "/"), strings.Split(path.Clean(name), "/"))
+}
+
+func matchParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchParts(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// Pages returns the files that match TestFiles and not Exclude, sorted.
+// Patterns are matched against absolute paths, so that those a merged
+// configuration has from files in different directories apply together.
+func (c *Config) Pages() ([]string, error) {
+	base, err := filepath.Abs(c.Dir())
+	if err != nil {
+		return nil, err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	seen := map[string]bool{}
+	for _, pattern := range c.TestFiles {
+		pattern = absPattern(base, pattern)
+		root := filepath.FromSlash(staticPrefix(pattern))
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if p == root && errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			name := filepath.ToSlash(p)
+			if c.excluded(base, name) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.IsDir() && Match(pattern, name) && !seen[p] {
+				seen[p] = true
+				if rel, err := filepath.Rel(wd, p); err == nil {
+					p = rel
+				}
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// excluded reports whether name, an absolute path, matches Exclude. As
+// "**" also matches no directories, "**/node_modules/**" excludes the
+// node_modules directory itself, which is then not walked.
+func (c *Config) excluded(base, name string) bool {
+	for _, pattern := range c.Exclude {
+		if Match(absPattern(base, pattern), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// absPattern returns pattern as an absolute, slash-separated pattern,
+// relative to base if it is not absolute already.
+func absPattern(base, pattern string) string {
+	if filepath.IsAbs(pattern) {
+		return filepath.ToSlash(pattern)
+	}
+	return path.Join(filepath.ToSlash(base), filepath.ToSlash(pattern))
+}
+
+// staticPrefix returns the directories at the start of pattern that have
+// no wildcards, or ".".
+func staticPrefix(pattern string) string {
+	parts := strings.Split(path.Clean(filepath.ToSlash(pattern)), "/")
+	var prefix []string
+	for _, part := range parts[:len(parts)-1] {
+		if strings.ContainsAny(part, "*?[\\") {
+			break
+		}
+		prefix = append(prefix, part)
+	}
+	switch {
+	case len(prefix) == 0:
+		return "."
+	case len(prefix) == 1 && prefix[0] == "":
+		return "/"
+	}
+	return strings.Join(prefix, "/")
+}
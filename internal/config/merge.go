@@ -0,0 +1,231 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Discover returns the configuration files that apply to dir, from the
+// repository root, the nearest directory above dir with a .git, down to
+// dir itself. A file with root set ends the search: the directories above
+// it are not looked in. Paths are relative to the current directory when
+// they can be.
+func Discover(dir string) ([]*Config, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	var layers []*Config
+	for d := abs; ; d = filepath.Dir(d) {
+		rel := d
+		if r, err := filepath.Rel(wd, d); err == nil {
+			rel = r
+		}
+		path, err := Find(rel)
+		if err != nil {
+			return nil, err
+		}
+		if path != "" {
+			c, err := Load(path)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, c)
+			if c.Root {
+				break
+			}
+		}
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil || filepath.Dir(d) == d {
+			break
+		}
+	}
+	slices.Reverse(layers)
+	return layers, nil
+}
+
+// Merge returns the configuration that layers make together, each
+// overriding those before it. A setting a layer has replaces the value
+// before it, lists such as testFiles and reporters included, except that
+// ideExecution.commands and executors are merged one language at a time,
+// and the fields and env variables of an executor one at a time.
+//
+// Paths in the result are relative to the current directory rather than
+// to the file that set them.
+func Merge(layers ...*Config) *Config {
+	m := &Config{Sources: map[string]string{}}
+	for _, c := range layers {
+		set := func(key string) { m.Sources[key] = c.Path }
+		if c.TestFiles != nil {
+			m.TestFiles = c.resolveAll(c.TestFiles)
+			set("testFiles")
+		}
+		if c.Exclude != nil {
+			m.Exclude = c.resolveAll(c.Exclude)
+			set("exclude")
+		}
+		if c.EnvFiles != nil {
+			m.EnvFiles = c.resolveAll(c.EnvFiles)
+			set("envFiles")
+		}
+		if c.SnootyConfig != "" {
+			m.SnootyConfig = c.Resolve(c.SnootyConfig)
+			set("snootyConfig")
+		}
+		for lang, command := range c.IDEExecution.Commands {
+			if m.IDEExecution.Commands == nil {
+				m.IDEExecution.Commands = map[string]string{}
+			}
+			lang = Language(lang)
+			m.IDEExecution.Commands[lang] = command
+			set("ideExecution.commands." + lang)
+		}
+		if c.IDEExecution.Skip != nil {
+			m.IDEExecution.Skip = c.IDEExecution.Skip
+			set("ideExecution.skip")
+		}
+		if c.Timeout != 0 {
+			m.Timeout = c.Timeout
+			set("timeout")
+		}
+		for lang, e := range c.Executors {
+			if m.Executors == nil {
+				m.Executors = map[string]Executor{}
+			}
+			lang = Language(lang)
+			key := "executors." + lang
+			me := m.Executors[lang]
+			if e.Command != "" {
+				me.Command = e.Command
+				set(key + ".command")
+			}
+			if e.Timeout != 0 {
+				me.Timeout = e.Timeout
+				set(key + ".timeout")
+			}
+			for k, v := range e.Env {
+				if me.Env == nil {
+					me.Env = map[string]string{}
+				}
+				me.Env[k] = v
+				set(key + ".env." + k)
+			}
+			m.Executors[lang] = me
+		}
+		if c.Cleanup.Enabled != nil {
+			m.Cleanup.Enabled = c.Cleanup.Enabled
+			set("cleanup.enabled")
+		}
+		if c.Cleanup.KeepArtifacts != "" {
+			m.Cleanup.KeepArtifacts = c.Cleanup.KeepArtifacts
+			set("cleanup.keepArtifacts")
+		}
+		if c.Cleanup.DatabasePattern != "" {
+			m.Cleanup.DatabasePattern = c.Cleanup.DatabasePattern
+			set("cleanup.databasePattern")
+		}
+		if c.Cleanup.CollectionPattern != "" {
+			m.Cleanup.CollectionPattern = c.Cleanup.CollectionPattern
+			set("cleanup.collectionPattern")
+		}
+		if c.Reporters != nil {
+			m.Reporters = []Reporter{}
+			for _, r := range c.Reporters {
+				r.Output = c.Resolve(r.Output)
+				m.Reporters = append(m.Reporters, r)
+			}
+			set("reporters")
+		}
+		if c.Verbose != nil {
+			m.Verbose = c.Verbose
+			set("verbose")
+		}
+	}
+	return m
+}
+
+// resolveAll returns paths, or patterns, relative to the configuration's
+// directory.
+func (c *Config) resolveAll(paths []string) []string {
+	out := []string{}
+	for _, p := range paths {
+		out = append(out, filepath.ToSlash(c.Resolve(p)))
+	}
+	return out
+}
+
+// Setting is a setting of a merged configuration and the file that set
+// it.
+type Setting struct {
+	Key    string `json:"key"`
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+}
+
+// Settings returns the settings of a configuration Merge returned, sorted
+// by key. Lists are []string, durations strings such as "30s", and
+// reporters are written the way --reporter takes them.
+func (c *Config) Settings() []Setting {
+	var out []Setting
+	for key, source := range c.Sources {
+		out = append(out, Setting{Key: key, Value: c.value(key), Source: source})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+func (c *Config) value(key string) any {
+	switch key {
+	case "testFiles":
+		return c.TestFiles
+	case "exclude":
+		return c.Exclude
+	case "envFiles":
+		return c.EnvFiles
+	case "snootyConfig":
+		return c.SnootyConfig
+	case "ideExecution.skip":
+		return *c.IDEExecution.Skip
+	case "timeout":
+		return time.Duration(c.Timeout).String()
+	case "cleanup.enabled":
+		return *c.Cleanup.Enabled
+	case "cleanup.keepArtifacts":
+		return c.Cleanup.KeepArtifacts
+	case "cleanup.databasePattern":
+		return c.Cleanup.DatabasePattern
+	case "cleanup.collectionPattern":
+		return c.Cleanup.CollectionPattern
+	case "reporters":
+		reporters := []string{}
+		for _, r := range c.Reporters {
+			if r.Output == "" {
+				reporters = append(reporters, r.Type)
+			} else {
+				reporters = append(reporters, r.Type+"="+r.Output)
+			}
+		}
+		return reporters
+	case "verbose":
+		return *c.Verbose
+	}
+	if lang, ok := strings.CutPrefix(key, "ideExecution.commands."); ok {
+		return c.IDEExecution.Commands[lang]
+	}
+	parts := strings.SplitN(key, ".", 4)
+	e := c.Executors[parts[1]]
+	switch parts[2] {
+	case "command":
+		return e.Command
+	case "timeout":
+		return time.Duration(e.Timeout).String()
+	}
+	return e.Env[parts[3]]
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// layer parses a TOML configuration as if it were read from path.
+func layer(t *testing.T, path, text string) *Config {
+	t.Helper()
+	c, err := ParseTOML([]byte(text))
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	c.Path = path
+	return c
+}
+
+func TestMerge(t *testing.T) {
+	root := `
+testFiles = ["source/**/*.txt"]
+envFiles = [".env"]
+timeout = "30s"
+verbose = true
+
+[ideExecution.commands]
+python = "python3 {filename}"
+js = "node {filename}"
+
+[executors.python]
+command = "python3.12 {filename}"
+env = { PYTHONWARNINGS = "ignore", LOG = "info" }
+
+[cleanup]
+databasePattern = "^test_"
+
+[[reporters]]
+type = "junit"
+output = "results.xml"
+`
+	app := `
+envFiles = ["app.env"]
+timeout = "2m"
+
+[ideExecution.commands]
+py = "uv run {filename}"
+
+[executors.py]
+timeout = "5m"
+env = { LOG = "debug" }
+
+[cleanup]
+keepArtifacts = "always"
+`
+	empty := `
+testFiles = []
+`
+	tests := []struct {
+		name   string
+		layers []*Config
+		check  func(t *testing.T, m *Config)
+	}{
+		{
+			name:   "nearer file wins",
+			layers: []*Config{layer(t, "repo/.proctest.toml", root), layer(t, "repo/app/.proctest.toml", app)},
+			check: func(t *testing.T, m *Config) {
+				equal(t, "testFiles", m.TestFiles, []string{"repo/source/**/*.txt"})
+				equal(t, "envFiles", m.EnvFiles, []string{"repo/app/app.env"})
+				equal(t, "timeout", time.Duration(m.Timeout), 2*time.Minute)
+				equal(t, "verbose", *m.Verbose, true)
+				equal(t, "cleanup", m.Cleanup, Cleanup{DatabasePattern: "^test_", KeepArtifacts: "always"})
+				equal(t, "reporters", m.Reporters, []Reporter{{Type: "junit", Output: "repo/results.xml"}})
+			},
+		},
+		{
+			name:   "commands and executors merge by language",
+			layers: []*Config{layer(t, "repo/.proctest.toml", root), layer(t, "repo/app/.proctest.toml", app)},
+			check: func(t *testing.T, m *Config) {
+				equal(t, "ideExecution.commands", m.IDEExecution.Commands, map[string]string{
+					"python":     "uv run {filename}",
+					"javascript": "node {filename}",
+				})
+				equal(t, "executors", m.Executors, map[string]Executor{"python": {
+					Command: "python3.12 {filename}",
+					Timeout: Duration(5 * time.Minute),
+					Env:     map[string]string{"PYTHONWARNINGS": "ignore", "LOG": "debug"},
+				}})
+			},
+		},
+		{
+			name:   "sources",
+			layers: []*Config{layer(t, "repo/.proctest.toml", root), layer(t, "repo/app/.proctest.toml", app)},
+			check: func(t *testing.T, m *Config) {
+				for key, want := range map[string]string{
+					"testFiles":                        "repo/.proctest.toml",
+					"envFiles":                         "repo/app/.proctest.toml",
+					"timeout":                          "repo/app/.proctest.toml",
+					"ideExecution.commands.python":     "repo/app/.proctest.toml",
+					"ideExecution.commands.javascript": "repo/.proctest.toml",
+					"executors.python.command":         "repo/.proctest.toml",
+					"executors.python.timeout":         "repo/app/.proctest.toml",
+					"executors.python.env.LOG":         "repo/app/.proctest.toml",
+					"cleanup.databasePattern":          "repo/.proctest.toml",
+					"cleanup.keepArtifacts":            "repo/app/.proctest.toml",
+				} {
+					equal(t, "source of "+key, m.Sources[key], want)
+				}
+				if _, ok := m.Sources["exclude"]; ok {
+					t.Error("exclude has a source, but no file sets it")
+				}
+			},
+		},
+		{
+			name:   "an empty list replaces the list before it",
+			layers: []*Config{layer(t, "repo/.proctest.toml", root), layer(t, "repo/app/.proctest.toml", empty)},
+			check: func(t *testing.T, m *Config) {
+				equal(t, "testFiles", m.TestFiles, []string{})
+				equal(t, "source of testFiles", m.Sources["testFiles"], "repo/app/.proctest.toml")
+			},
+		},
+		{
+			name: "no layers",
+			check: func(t *testing.T, m *Config) {
+				equal(t, "merged", *m, Config{Sources: map[string]string{}})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, Merge(tt.layers...))
+		})
+	}
+}
+
+func equal[T any](t *testing.T, what string, got, want T) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s = %#v, want %#v", what, got, want)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	m := Merge(
+		layer(t, "repo/.proctest.toml", "timeout = \"90s\"\nverbose = false\n[[reporters]]\ntype = \"human\"\n[[reporters]]\ntype = \"json\"\noutput = \"out.json\"\n"),
+		layer(t, "repo/app/.proctest.toml", "[executors.go]\ntimeout = \"1m\"\nenv = { CGO_ENABLED = \"0\" }\n"),
+	)
+	want := []Setting{
+		{"executors.go.env.CGO_ENABLED", "0", "repo/app/.proctest.toml"},
+		{"executors.go.timeout", "1m0s", "repo/app/.proctest.toml"},
+		{"reporters", []string{"human", "json=repo/out.json"}, "repo/.proctest.toml"},
+		{"timeout", "1m30s", "repo/.proctest.toml"},
+		{"verbose", false, "repo/.proctest.toml"},
+	}
+	equal(t, "Settings()", m.Settings(), want)
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		dir   string
+		want  []string
+	}{
+		{
+			name: "root down to the page's directory",
+			files: map[string]string{
+				".git/HEAD":                 "ref: refs/heads/main\n",
+				".proctest.toml":            "",
+				"docs/.proctest.yaml":       "",
+				"docs/app/.proctest.toml":   "",
+				"docs/app/source/page.txt":  "",
+				"docs/other/.proctest.toml": "",
+			},
+			dir:  "docs/app/source",
+			want: []string{".proctest.toml", "docs/.proctest.yaml", "docs/app/.proctest.toml"},
+		},
+		{
+			name: "root stops the search",
+			files: map[string]string{
+				".git/HEAD":               "ref: refs/heads/main\n",
+				".proctest.toml":          "",
+				"docs/.proctest.toml":     "root = true\n",
+				"docs/app/.proctest.toml": "",
+			},
+			dir:  "docs/app",
+			want: []string{"docs/.proctest.toml", "docs/app/.proctest.toml"},
+		},
+		{
+			name: "nothing above the repository",
+			files: map[string]string{
+				"outside/.proctest.toml":      "",
+				"outside/repo/.git/HEAD":      "ref: refs/heads/main\n",
+				"outside/repo/.proctest.toml": "",
+			},
+			dir:  "outside/repo",
+			want: []string{"outside/repo/.proctest.toml"},
+		},
+		{
+			name: "no files",
+			files: map[string]string{
+				".git/HEAD": "ref: refs/heads/main\n",
+			},
+			dir: ".",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			for name, content := range tt.files {
+				if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			layers, err := Discover(tt.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range layers {
+				got = append(got, filepath.ToSlash(c.Path))
+			}
+			equal(t, "Discover("+tt.dir+")", got, tt.want)
+		})
+	}
+}
+
+func TestDiscoverTwoFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, name := range []string{".git", ".proctest.toml", ".proctest.yaml"} {
+		if err := os.WriteFile(name, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Discover("."); err == nil {
+		t.Error("Discover succeeded with both .proctest.toml and .proctest.yaml")
+	}
+}
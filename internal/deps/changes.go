@@ -0,0 +1,355 @@
+package deps
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/snooty"
+)
+
+// Changes are the changes in the working tree, committed or not, since
+// the commit where it branched from a git ref.
+type Changes struct {
+	// Base is the commit the working tree is compared with.
+	Base string
+	// Files are the changed files, by the path nodes use for them.
+	Files map[string]*FileChange
+	// nodes are the changed extract entries and constants.
+	nodes map[string]bool
+	// projects are the roots of the projects whose snooty.toml changed
+	// in a way that can affect every page, such as its substitutions or
+	// composable tutorials.
+	projects []string
+	// lines caches the affected lines of each page.
+	lines map[string]pageLines
+}
+
+// FileChange is how a file changed.
+type FileChange struct {
+	// All is set for a file that was added or deleted, so that all of it
+	// changed.
+	All bool
+	// Lines are the lines of the current file that were added or
+	// changed. A deletion marks the lines on either side of it.
+	Lines []int
+}
+
+type pageLines struct {
+	lines []int
+	all   bool
+}
+
+// ChangedSince compares the working tree, untracked files included,
+// with the merge base of ref and HEAD, or with ref itself when they have
+// none.
+func ChangedSince(ref string) (*Changes, error) {
+	out, err := git("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	top := strings.TrimSpace(out)
+	if _, err := git(top, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err != nil {
+		return nil, fmt.Errorf("%q is not a commit in this repository", ref)
+	}
+	base, err := git(top, "merge-base", ref, "HEAD")
+	if err != nil {
+		base = ref
+	}
+	c := &Changes{
+		Base:  strings.TrimSpace(base),
+		Files: map[string]*FileChange{},
+		nodes: map[string]bool{},
+		lines: map[string]pageLines{},
+	}
+	status, err := git(top, "diff", "--name-status", "--no-renames", "-z", c.Base, "--")
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(strings.TrimSuffix(status, "\x00"), "\x00")
+	var changed []string
+	for i := 0; i+1 < len(fields); i += 2 {
+		name := fields[i+1]
+		changed = append(changed, name)
+		c.Files[DisplayPath(filepath.Join(top, name))] = &FileChange{All: fields[i] == "A" || fields[i] == "D"}
+	}
+	untracked, err := git(top, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(untracked, "\x00") {
+		if name != "" {
+			changed = append(changed, name)
+			c.Files[DisplayPath(filepath.Join(top, name))] = &FileChange{All: true}
+		}
+	}
+	if err := c.readLines(top); err != nil {
+		return nil, err
+	}
+	for _, name := range changed {
+		switch path := filepath.Join(top, name); {
+		case filepath.Base(name) == snooty.ProjectFile:
+			if err := c.project(top, name, path); err != nil {
+				return nil, err
+			}
+		case isExtracts(name):
+			if err := c.extracts(top, name, path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// git runs git in dir and returns what it wrote, or its error message.
+func git(dir string, args ...string) (string, error) {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git: %s", msg)
+		}
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
+
+var hunkRE = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// readLines fills in the changed lines of modified files from a diff
+// without context.
+func (c *Changes) readLines(top string) error {
+	diff, err := git(top, "-c", "core.quotePath=false", "diff", "-U0", "--no-renames", "--no-ext-diff", c.Base, "--")
+	if err != nil {
+		return err
+	}
+	var file *FileChange
+	sc := bufio.NewScanner(strings.NewReader(diff))
+	sc.Buffer(nil, 16<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if name, ok := strings.CutPrefix(line, "+++ b/"); ok {
+			file = c.Files[DisplayPath(filepath.Join(top, name))]
+			continue
+		}
+		m := hunkRE.FindStringSubmatch(line)
+		if m == nil || file == nil || file.All {
+			continue
+		}
+		start, _ := strconv.Atoi(m[1])
+		count := 1
+		if m[2] != "" {
+			count, _ = strconv.Atoi(m[2])
+		}
+		if count == 0 {
+			file.Lines = append(file.Lines, max(start, 1), start+1)
+			continue
+		}
+		for n := start; n < start+count; n++ {
+			file.Lines = append(file.Lines, n)
+		}
+	}
+	return sc.Err()
+}
+
+// isExtracts reports whether name is an extracts YAML file, which the
+// docs build splits into /includes/extracts/<ref>.rst includes.
+func isExtracts(name string) bool {
+	dir, file := filepath.Split(filepath.ToSlash(name))
+	return strings.HasSuffix(dir, "includes/") && strings.HasPrefix(file, "extracts") && strings.HasSuffix(file, ".yaml")
+}
+
+// extracts marks the entries of the extracts file name whose text
+// changed, or every entry of an added or deleted file.
+func (c *Changes) extracts(top, name, path string) error {
+	old, _ := git(top, "show", c.Base+":"+name)
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	before := map[string]string{}
+	for _, e := range splitExtracts(old) {
+		before[e.ref] = strings.Join(e.text, "\n")
+	}
+	after := map[string]string{}
+	for _, e := range splitExtracts(string(current)) {
+		after[e.ref] = strings.Join(e.text, "\n")
+	}
+	file := DisplayPath(path)
+	for ref, text := range before {
+		if after[ref] != text {
+			c.nodes[file+"#"+ref] = true
+		}
+	}
+	for ref := range after {
+		if _, ok := before[ref]; !ok {
+			c.nodes[file+"#"+ref] = true
+		}
+	}
+	return nil
+}
+
+// project marks the constants of the snooty.toml name whose value
+// changed. Any other change to the file affects all of its pages.
+func (c *Changes) project(top, name, path string) error {
+	old, _ := git(top, "show", c.Base+":"+name)
+	var before, after snooty.Project
+	_, errBefore := toml.Decode(old, &before)
+	_, errAfter := toml.DecodeFile(path, &after)
+	root := filepath.Dir(path)
+	if errBefore != nil || errAfter != nil {
+		c.projects = append(c.projects, root)
+		return nil
+	}
+	file := DisplayPath(path)
+	for _, name := range slices.Concat(slices.Collect(maps.Keys(before.Constants)), slices.Collect(maps.Keys(after.Constants))) {
+		if before.Constants[name] != after.Constants[name] {
+			c.nodes[file+"#"+name] = true
+		}
+	}
+	before.Constants, after.Constants = nil, nil
+	if !reflect.DeepEqual(before, after) {
+		c.projects = append(c.projects, root)
+	}
+	return nil
+}
+
+// Changed reports whether node id of a graph changed.
+func (c *Changes) Changed(id string) bool {
+	if c.nodes[id] {
+		return true
+	}
+	_, ok := c.Files[id]
+	return ok
+}
+
+// changedNodes returns the IDs of the nodes of g that changed.
+func (c *Changes) changedNodes(g *Graph) map[string]bool {
+	ids := map[string]bool{}
+	for id := range g.Nodes {
+		if c.Changed(id) {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// PageLines returns the lines of page, a page of g, that changed or
+// lead to something that changed. all is set when the whole page is
+// affected: it is new, or its project changed.
+func (c *Changes) PageLines(g *Graph, page string) (lines []int, all bool) {
+	if pl, ok := c.lines[page]; ok {
+		return pl.lines, pl.all
+	}
+	if root, ok := snooty.Find(page); ok && slices.Contains(c.projects, root) {
+		all = true
+	}
+	if f := c.Files[page]; f != nil {
+		all = all || f.All
+		lines = append(lines, f.Lines...)
+	}
+	lines = append(lines, g.Lines(page, c.changedNodes(g))...)
+	slices.Sort(lines)
+	lines = slices.Compact(lines)
+	c.lines[page] = pageLines{lines, all}
+	return lines, all
+}
+
+// Affects reports whether the changes affect the test case of proc for
+// variant v, which is nil for a procedure without variants. The
+// procedure is affected when a line of it changed or leads to a change.
+// When every such line is in content that only some variants show, only
+// those variants are.
+func (c *Changes) Affects(g *Graph, doc *ast.Document, proc *ast.Procedure, v *ast.Variant) bool {
+	lines, all := c.PageLines(g, doc.File)
+	if all {
+		return true
+	}
+	var sels []ast.Selection
+	for _, n := range lines {
+		if !contains(proc.Location, doc.File, n) {
+			continue
+		}
+		narrow, ok := narrowest(proc, doc.File, n)
+		if !ok || v == nil {
+			return true
+		}
+		sels = append(sels, narrow...)
+	}
+	for _, sel := range sels {
+		if sel.Matches(v.Selection) {
+			return true
+		}
+	}
+	return false
+}
+
+// narrowest returns the selections of the innermost steps and actions of
+// proc at line n of page. There are several when they share the line, as
+// the content of an include does. ok is false when content shown to
+// every variant is there.
+func narrowest(proc *ast.Procedure, page string, n int) ([]ast.Selection, bool) {
+	var found []ast.Selection
+	at := func(loc ast.SourceLocation) bool { return contains(loc, page, n) }
+	for _, step := range proc.Steps {
+		if !at(step.Location) {
+			continue
+		}
+		stepSel := proc.Selection.Merge(step.Selection)
+		inner := false
+		for _, a := range step.Actions {
+			if at(a.Base().Location) {
+				found, inner = append(found, stepSel.Merge(a.Base().Selection)), true
+			}
+		}
+		for _, sub := range step.SubSteps {
+			if !at(sub.Location) {
+				continue
+			}
+			subSel := stepSel.Merge(sub.Selection)
+			subInner := false
+			for _, a := range sub.Actions {
+				if at(a.Base().Location) {
+					found, subInner = append(found, subSel.Merge(a.Base().Selection)), true
+				}
+			}
+			if !subInner {
+				found = append(found, subSel)
+			}
+			inner = true
+		}
+		if !inner {
+			found = append(found, stepSel)
+		}
+	}
+	if len(found) == 0 || slices.ContainsFunc(found, func(sel ast.Selection) bool { return len(sel) == 0 }) {
+		return nil, false
+	}
+	return found, true
+}
+
+// contains reports whether loc, followed out to the page it is included
+// in, spans line n of page.
+func contains(loc ast.SourceLocation, page string, n int) bool {
+	chain := loc.Chain()
+	outer := chain[len(chain)-1]
+	return outer.File == page && n >= outer.StartLine && n <= max(outer.EndLine, outer.StartLine)
+}
@@ -0,0 +1,253 @@
+package deps
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+)
+
+// gitRepo makes a repository with files committed on main and changes
+// to its directory for the rest of the test.
+func gitRepo(t *testing.T, files map[string]string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	run(t, "git", "init", "-q", "-b", "main")
+	run(t, "git", "config", "user.email", "test@example.com")
+	run(t, "git", "config", "user.name", "test")
+	writeFiles(t, files)
+	run(t, "git", "add", "-A")
+	run(t, "git", "commit", "-q", "-m", "base")
+}
+
+func run(t *testing.T, name string, args ...string) {
+	t.Helper()
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		t.Fatalf("%s %s: %v\n%s", name, strings.Join(args, " "), err, out)
+	}
+}
+
+// writeFiles writes files, by path, and removes those whose content is
+// "".
+func writeFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if content == "" {
+			if err := os.Remove(name); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// lines returns n numbered lines, with the lines in change replaced,
+// or left out when their replacement is "".
+func lines(n int, change map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if s, ok := change[i]; ok {
+			if s != "" {
+				b.WriteString(s + "\n")
+			}
+			continue
+		}
+		b.WriteString("line " + strconv.Itoa(i) + "\n")
+	}
+	return b.String()
+}
+
+const (
+	project = `name = "docs"
+title = "Docs"
+
+[constants]
+version = "8.0"
+driver = "6.1"
+`
+	extracts = `ref: install
+content: |
+  Install it.
+---
+ref: connect
+content: |
+  Connect to it.
+`
+)
+
+func TestChangedSince(t *testing.T) {
+	base := map[string]string{
+		"snooty.toml":                       project,
+		"source/page.txt":                   lines(8, nil),
+		"source/old.txt":                    lines(2, nil),
+		"source/includes/extracts-app.yaml": extracts,
+	}
+	tests := []struct {
+		name string
+		// commit is committed on a branch; edit is left in the working
+		// tree.
+		commit, edit map[string]string
+		wantFiles    map[string]FileChange
+		wantNodes    []string
+		wantProjects bool
+	}{
+		{
+			name:      "changed lines",
+			edit:      map[string]string{"source/page.txt": lines(8, map[int]string{3: "new three", 6: "new six"})},
+			wantFiles: map[string]FileChange{"source/page.txt": {Lines: []int{3, 6}}},
+		},
+		{
+			name:      "deleted line marks its neighbours",
+			edit:      map[string]string{"source/page.txt": lines(8, map[int]string{4: ""})},
+			wantFiles: map[string]FileChange{"source/page.txt": {Lines: []int{3, 4}}},
+		},
+		{
+			name:      "added and deleted files",
+			edit:      map[string]string{"source/new.txt": "new\n", "source/old.txt": ""},
+			wantFiles: map[string]FileChange{"source/new.txt": {All: true}, "source/old.txt": {All: true}},
+		},
+		{
+			name:      "committed changes since the branch point",
+			commit:    map[string]string{"source/page.txt": lines(8, map[int]string{1: "first"}), "source/added.txt": "added\n"},
+			edit:      map[string]string{"source/page.txt": lines(8, map[int]string{1: "first", 8: "last"})},
+			wantFiles: map[string]FileChange{"source/page.txt": {Lines: []int{1, 8}}, "source/added.txt": {All: true}},
+		},
+		{
+			name:      "changed constant",
+			edit:      map[string]string{"snooty.toml": strings.Replace(project, `"8.0"`, `"8.2"`, 1)},
+			wantFiles: map[string]FileChange{"snooty.toml": {Lines: []int{5}}},
+			wantNodes: []string{"snooty.toml#version"},
+		},
+		{
+			name:         "changed project setting",
+			edit:         map[string]string{"snooty.toml": strings.Replace(project, `"Docs"`, `"Manual"`, 1)},
+			wantFiles:    map[string]FileChange{"snooty.toml": {Lines: []int{2}}},
+			wantProjects: true,
+		},
+		{
+			name:      "changed extract",
+			edit:      map[string]string{"source/includes/extracts-app.yaml": strings.Replace(extracts, "Connect to it.", "Connect.", 1)},
+			wantFiles: map[string]FileChange{"source/includes/extracts-app.yaml": {Lines: []int{7}}},
+			wantNodes: []string{"source/includes/extracts-app.yaml#connect"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gitRepo(t, base)
+			run(t, "git", "checkout", "-q", "-b", "feature")
+			if tt.commit != nil {
+				writeFiles(t, tt.commit)
+				run(t, "git", "add", "-A")
+				run(t, "git", "commit", "-q", "-m", "feature")
+			}
+			writeFiles(t, tt.edit)
+
+			c, err := ChangedSince("main")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tt.wantFiles {
+				got := c.Files[name]
+				if got == nil {
+					t.Errorf("%s is not changed", name)
+					continue
+				}
+				if got.All != want.All || !slices.Equal(got.Lines, want.Lines) {
+					t.Errorf("%s changed %+v, want %+v", name, *got, want)
+				}
+			}
+			for name := range c.Files {
+				if _, ok := tt.wantFiles[name]; !ok {
+					t.Errorf("%s is changed, want unchanged", name)
+				}
+			}
+			for _, id := range []string{"snooty.toml#version", "snooty.toml#driver", "source/includes/extracts-app.yaml#install", "source/includes/extracts-app.yaml#connect"} {
+				if got, want := c.nodes[id], slices.Contains(tt.wantNodes, id); got != want {
+					t.Errorf("%s changed = %v, want %v", id, got, want)
+				}
+			}
+			if got := len(c.projects) > 0; got != tt.wantProjects {
+				t.Errorf("project changed = %v, want %v", got, tt.wantProjects)
+			}
+		})
+	}
+}
+
+func TestChangedSinceUnknownRef(t *testing.T) {
+	gitRepo(t, map[string]string{"a.txt": "a\n"})
+	if _, err := ChangedSince("no-such-branch"); err == nil {
+		t.Error("ChangedSince of an unknown ref succeeded")
+	}
+}
+
+func TestAffects(t *testing.T) {
+	const page = "source/page.txt"
+	loc := func(start, end int) ast.SourceLocation {
+		return ast.SourceLocation{File: page, StartLine: start, EndLine: end}
+	}
+	action := func(start, end int, sel ast.Selection) ast.Action {
+		return &ast.ShellAction{ActionBase: ast.ActionBase{Type: ast.ActionShell, Location: loc(start, end), Selection: sel}}
+	}
+	python := ast.Selection{"language": "python"}
+	node := ast.Selection{"language": "node"}
+	// The procedure is lines 3 to 14: step 1 is shown to every variant,
+	// and step 2 has an action for each language.
+	proc := &ast.Procedure{
+		Location: loc(3, 14),
+		Steps: []*ast.Step{
+			{Location: loc(4, 7), Actions: []ast.Action{action(5, 6, nil)}},
+			{Location: loc(8, 14), Actions: []ast.Action{action(9, 10, python), action(11, 12, node)}},
+		},
+	}
+	variants := []*ast.Variant{{ID: "python", Selection: python}, {ID: "node", Selection: node}}
+	tests := []struct {
+		name string
+		line int
+		want []string
+	}{
+		{"outside the procedure", 1, nil},
+		{"content every variant shows", 5, []string{"python", "node"}},
+		{"step text around the actions", 13, []string{"python", "node"}},
+		{"one variant's action", 10, []string{"python"}},
+		{"the other variant's action", 11, []string{"node"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gitRepo(t, map[string]string{page: lines(16, nil)})
+			writeFiles(t, map[string]string{page: lines(16, map[int]string{tt.line: "changed"})})
+			c, err := ChangedSince("HEAD")
+			if err != nil {
+				t.Fatal(err)
+			}
+			g, err := Build([]string{page})
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc := &ast.Document{File: page, Procedures: []*ast.Procedure{proc}}
+			var got []string
+			for _, v := range variants {
+				if c.Affects(g, doc, proc, v) {
+					got = append(got, v.ID)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("affected variants %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,539 @@
+// Package deps builds the graph of what documentation pages are made
+// of: the files they include, the code files they literalinclude, the
+// extract entries they pull from YAML, and the snooty.toml constants
+// they use. Walked backwards, the graph tells which pages a changed file
+// affects.
+//
+// The graph is read from the source text, so it includes directives
+// outside procedures and include targets that are missing.
+package deps
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/rst"
+	"github.com/dacharyc/spike-procedural-testing/internal/snooty"
+)
+
+// Kind is the kind of a node.
+type Kind string
+
+const (
+	KindPage    Kind = "page"
+	KindInclude Kind = "include"
+	// KindLiteral is a file shown by literalinclude, or by the input or
+	// output of an io-code-block.
+	KindLiteral Kind = "literalinclude"
+	// KindExtract is an entry of an extracts YAML file, which pages use
+	// by including /includes/extracts/<ref>.rst.
+	KindExtract  Kind = "extract"
+	KindConstant Kind = "constant"
+	// KindShared is a sharedinclude, which is fetched at build time from
+	// another repository.
+	KindShared Kind = "sharedinclude"
+)
+
+// Node is a page or something a page uses.
+type Node struct {
+	// ID is the file's path, relative to the current directory when it
+	// is below it, or the file and "#" and the name for an extract entry
+	// or a constant.
+	ID   string `json:"id"`
+	Kind Kind   `json:"kind"`
+	File string `json:"file"`
+	// Name is the ref of an extract entry or the name of a constant.
+	Name string `json:"name,omitempty"`
+	// Missing is set when the file or entry does not exist.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// Edge is a use of To by From, at Line of From's file.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Line int    `json:"line,omitempty"`
+}
+
+// Graph is the pages given to Build and everything they use.
+type Graph struct {
+	Nodes map[string]*Node
+	Edges []Edge
+
+	out map[string][]Edge
+	in  map[string][]Edge
+	// extracts indexes the extract entries of each source directory,
+	// and scanned holds the nodes whose uses have been added.
+	extracts map[string]map[string]*extract
+	scanned  map[string]bool
+	// sourceDirs are the source directories of the pages.
+	sourceDirs []string
+}
+
+// extract is an entry of an extracts YAML file: a YAML document with a
+// top-level ref.
+type extract struct {
+	ref  string
+	file string
+	// line is where the entry starts in file, and text its lines.
+	line int
+	text []string
+	// inherit is the ref of the entry it inherits from, if any.
+	inherit string
+}
+
+var (
+	directiveRE = regexp.MustCompile(`^\s*(?:(?:[-*+]|\d+\.|#\.|[A-Za-z]\.)\s+)?\.\.\s+(include|sharedinclude|literalinclude|input|output)::\s*(\S+)\s*$`)
+	refRE       = regexp.MustCompile(`^ref:\s*(\S+)`)
+	inheritRE   = regexp.MustCompile(`^\s+ref:\s*(\S+)`)
+)
+
+// Build scans pages and everything they use.
+func Build(pages []string) (*Graph, error) {
+	g := &Graph{
+		Nodes:    map[string]*Node{},
+		out:      map[string][]Edge{},
+		in:       map[string][]Edge{},
+		extracts: map[string]map[string]*extract{},
+		scanned:  map[string]bool{},
+	}
+	for _, page := range pages {
+		src := sources(page)
+		if !slices.Contains(g.sourceDirs, src.dir) {
+			g.sourceDirs = append(g.sourceDirs, src.dir)
+		}
+		id := g.add(&Node{Kind: KindPage, File: page})
+		if err := g.scanFile(id, page, src); err != nil {
+			return nil, err
+		}
+	}
+	for _, edges := range g.out {
+		g.Edges = append(g.Edges, edges...)
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.To < b.To
+	})
+	return g, nil
+}
+
+// source is where the references in a page resolve.
+type source struct {
+	dir     string
+	project *snooty.Project
+}
+
+func sources(page string) source {
+	project, _ := snooty.LoadFor(page)
+	if project != nil {
+		return source{dir: project.SourceDir, project: project}
+	}
+	return source{dir: rst.FindSourceDir(page)}
+}
+
+// add adds n, unless a node with its ID exists, and returns the ID.
+func (g *Graph) add(n *Node) string {
+	if n.ID == "" {
+		n.ID = DisplayPath(n.File)
+		if n.Name != "" {
+			n.ID += "#" + n.Name
+		}
+		n.File = DisplayPath(n.File)
+	}
+	if _, ok := g.Nodes[n.ID]; !ok {
+		g.Nodes[n.ID] = n
+	}
+	return n.ID
+}
+
+// link adds an edge and reports whether it is new.
+func (g *Graph) link(from, to string, line int) bool {
+	for _, e := range g.out[from] {
+		if e.To == to && e.Line == line {
+			return false
+		}
+	}
+	e := Edge{From: from, To: to, Line: line}
+	g.out[from] = append(g.out[from], e)
+	g.in[to] = append(g.in[to], e)
+	return true
+}
+
+// scanFile adds the uses in the file at path, which is node id, unless
+// they have been added already.
+func (g *Graph) scanFile(id, path string, src source) error {
+	if g.scanned[id] {
+		return nil
+	}
+	g.scanned[id] = true
+	f, err := os.Open(path)
+	if err != nil {
+		g.Nodes[id].Missing = true
+		return nil
+	}
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16<<20)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return g.scanLines(id, path, 1, lines, src)
+}
+
+// scanLines adds the uses in lines, the first of which is line first of
+// the file at path, for node id.
+func (g *Graph) scanLines(id, path string, first int, lines []string, src source) error {
+	for i, text := range lines {
+		line := first + i
+		for _, name := range snooty.ConstantRefs(text) {
+			file := ""
+			if src.project != nil {
+				file = filepath.Join(src.project.Root, snooty.ProjectFile)
+			}
+			n := &Node{Kind: KindConstant, File: file, Name: name}
+			if src.project == nil {
+				n.ID, n.Missing = "#"+name, true
+			} else if _, ok := src.project.Constants[name]; !ok {
+				n.Missing = true
+			}
+			g.link(id, g.add(n), line)
+		}
+		m := directiveRE.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		kind, ref := m[1], m[2]
+		if kind == "sharedinclude" {
+			g.link(id, g.add(&Node{ID: "sharedinclude:" + ref, Kind: KindShared, Name: ref, Missing: true}), line)
+			continue
+		}
+		target := resolve(ref, path, src.dir)
+		if kind != "include" {
+			to := g.add(&Node{Kind: KindLiteral, File: target})
+			if _, err := os.Stat(target); err != nil {
+				g.Nodes[to].Missing = true
+			}
+			g.link(id, to, line)
+			continue
+		}
+		if _, err := os.Stat(target); err != nil {
+			if err := g.generated(id, ref, target, line, src); err != nil {
+				return err
+			}
+			continue
+		}
+		to := g.add(&Node{Kind: KindInclude, File: target})
+		g.link(id, to, line)
+		if err := g.scanFile(to, target, src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generated adds the use of an include that the docs build generates
+// from YAML: /includes/extracts/<ref>.rst from an extracts file entry,
+// and /includes/steps/<name>.rst from includes/steps-<name>.yaml. Other
+// missing includes are added as missing.
+func (g *Graph) generated(id, ref, target string, line int, src source) error {
+	switch dir, file := filepath.Split(filepath.ToSlash(ref)); {
+	case strings.HasSuffix(dir, "includes/extracts/") && strings.HasSuffix(file, ".rst"):
+		return g.useExtract(id, strings.TrimSuffix(file, ".rst"), line, src)
+	case strings.HasSuffix(dir, "includes/steps/") && strings.HasSuffix(file, ".rst"):
+		yaml := filepath.Join(src.dir, "includes", "steps-"+strings.TrimSuffix(file, ".rst")+".yaml")
+		if _, err := os.Stat(yaml); err == nil {
+			to := g.add(&Node{Kind: KindInclude, File: yaml})
+			g.link(id, to, line)
+			return g.scanFile(to, yaml, src)
+		}
+	}
+	to := g.add(&Node{Kind: KindInclude, File: target, Missing: true})
+	g.link(id, to, line)
+	return nil
+}
+
+// useExtract adds the use of the extract entry ref, the entry it
+// inherits from, and what the entry itself uses.
+func (g *Graph) useExtract(id, ref string, line int, src source) error {
+	entries, err := g.extractsOf(src.dir)
+	if err != nil {
+		return err
+	}
+	e, ok := entries[ref]
+	if !ok {
+		g.link(id, g.add(&Node{ID: "extract:" + ref, Kind: KindExtract, Name: ref, Missing: true}), line)
+		return nil
+	}
+	to := g.add(&Node{Kind: KindExtract, File: e.file, Name: ref})
+	g.link(id, to, line)
+	if g.scanned[to] {
+		return nil
+	}
+	g.scanned[to] = true
+	if e.inherit != "" {
+		if err := g.useExtract(to, e.inherit, e.line, src); err != nil {
+			return err
+		}
+	}
+	return g.scanLines(to, e.file, e.line, e.text, src)
+}
+
+// extractsOf indexes the entries of the extracts YAML files in the
+// includes directory of dir by ref.
+func (g *Graph) extractsOf(dir string) (map[string]*extract, error) {
+	if entries, ok := g.extracts[dir]; ok {
+		return entries, nil
+	}
+	entries := map[string]*extract{}
+	files, err := filepath.Glob(filepath.Join(dir, "includes", "extracts*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range splitExtracts(string(data)) {
+			if _, dup := entries[e.ref]; !dup {
+				e.file = file
+				entries[e.ref] = e
+			}
+		}
+	}
+	g.extracts[dir] = entries
+	return entries, nil
+}
+
+// splitExtracts splits an extracts YAML file into its entries, which
+// are separated by "---" lines. Documents without a ref are left out.
+func splitExtracts(data string) []*extract {
+	var out []*extract
+	lines := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+	start := 0
+	flush := func(end int) {
+		e := &extract{line: start + 1, text: lines[start:end]}
+		inInherit := false
+		for _, l := range e.text {
+			if m := refRE.FindStringSubmatch(l); m != nil && e.ref == "" {
+				e.ref = m[1]
+			}
+			switch {
+			case strings.HasPrefix(l, "inherit:"):
+				inInherit = true
+			case inInherit && inheritRE.MatchString(l):
+				e.inherit = inheritRE.FindStringSubmatch(l)[1]
+			case l != "" && !strings.HasPrefix(l, " "):
+				inInherit = false
+			}
+		}
+		if e.ref != "" {
+			out = append(out, e)
+		}
+	}
+	for i, l := range lines {
+		if t := strings.TrimSpace(l); t == "---" || t == "..." {
+			flush(i)
+			start = i + 1
+		}
+	}
+	flush(len(lines))
+	return out
+}
+
+// resolve maps a reference the way rst.Loader.Resolve does.
+func resolve(ref, from, sourceDir string) string {
+	if strings.HasPrefix(ref, "/") {
+		return filepath.Join(sourceDir, filepath.FromSlash(ref))
+	}
+	return filepath.Join(filepath.Dir(from), filepath.FromSlash(ref))
+}
+
+// DisplayPath returns path relative to the current directory when it is
+// below it, as the parser writes page and source locations, and the
+// absolute path otherwise.
+func DisplayPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return abs
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return abs
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Uses returns the edges from id: what it uses directly.
+func (g *Graph) Uses(id string) []Edge {
+	return g.out[id]
+}
+
+// UsedBy returns the edges to id: what uses it directly.
+func (g *Graph) UsedBy(id string) []Edge {
+	return g.in[id]
+}
+
+// Users returns ids and the nodes that use one of them, directly or
+// through other nodes.
+func (g *Graph) Users(ids ...string) map[string]bool {
+	seen := map[string]bool{}
+	var visit func(string)
+	visit = func(n string) {
+		if seen[n] {
+			return
+		}
+		seen[n] = true
+		for _, e := range g.in[n] {
+			visit(e.From)
+		}
+	}
+	for _, id := range ids {
+		visit(id)
+	}
+	return seen
+}
+
+// Pages returns the pages that use id, directly or through other nodes,
+// sorted. A page uses itself.
+func (g *Graph) Pages(id string) []string {
+	var pages []string
+	for n := range g.Users(id) {
+		if g.Nodes[n].Kind == KindPage {
+			pages = append(pages, n)
+		}
+	}
+	sort.Strings(pages)
+	return pages
+}
+
+// Subgraph returns the graph of the nodes in keep and the edges between
+// them.
+func (g *Graph) Subgraph(keep map[string]bool) *Graph {
+	sub := &Graph{Nodes: map[string]*Node{}, out: map[string][]Edge{}, in: map[string][]Edge{}}
+	for id := range keep {
+		if n, ok := g.Nodes[id]; ok {
+			sub.Nodes[id] = n
+		}
+	}
+	for _, e := range g.Edges {
+		if sub.Nodes[e.From] != nil && sub.Nodes[e.To] != nil {
+			sub.Edges = append(sub.Edges, e)
+			sub.out[e.From] = append(sub.out[e.From], e)
+			sub.in[e.To] = append(sub.in[e.To], e)
+		}
+	}
+	return sub
+}
+
+// Find returns the IDs of the nodes that query names, sorted: a node ID,
+// a file path or the end of one such as "steps-connect.rst" or
+// "/includes/fts/create-index.go", an extract ref, or a constant as
+// "name" or "{+name+}".
+func (g *Graph) Find(query string) []string {
+	name := strings.TrimSuffix(strings.TrimPrefix(query, "{+"), "+}")
+	suffix := "/" + strings.TrimPrefix(filepath.ToSlash(query), "/")
+	var ids []string
+	for id, n := range g.Nodes {
+		switch {
+		case id == query:
+		case n.Kind == KindConstant || n.Kind == KindExtract || n.Kind == KindShared:
+			if n.Name != name {
+				continue
+			}
+		case n.File == "" || !strings.HasSuffix("/"+filepath.ToSlash(n.File), suffix):
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Orphans returns the files under the includes directories of the
+// pages' source directories that no page uses, sorted. Files that only
+// orphans use are orphans too. Extracts YAML files are used when one of
+// their entries is. Hidden files and directories are left out.
+func (g *Graph) Orphans() ([]string, error) {
+	used := map[string]bool{}
+	for _, n := range g.Nodes {
+		if !n.Missing && n.File != "" {
+			used[n.File] = true
+		}
+	}
+	var orphans []string
+	for _, dir := range g.sourceDirs {
+		root := filepath.Join(dir, "includes")
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(d.Name(), ".") && path != root {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.IsDir() && !used[DisplayPath(path)] {
+				orphans = append(orphans, DisplayPath(path))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
+
+// Lines returns the lines of page whose directives lead to one of ids,
+// directly or through other nodes.
+func (g *Graph) Lines(page string, ids map[string]bool) []int {
+	reaches := map[string]bool{}
+	var visit func(string) bool
+	visit = func(n string) bool {
+		if r, ok := reaches[n]; ok {
+			return r
+		}
+		reaches[n] = ids[n]
+		for _, e := range g.out[n] {
+			if visit(e.To) {
+				reaches[n] = true
+			}
+		}
+		return reaches[n]
+	}
+	var lines []int
+	for _, e := range g.out[page] {
+		if visit(e.To) {
+			lines = append(lines, e.Line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,132 @@
+package deps
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+// docsProject is a project whose two pages share an include with a
+// code file, and whose includes directory also has files no page uses.
+var docsProject = map[string]string{
+	"snooty.toml": project,
+	"source/index.txt": `Index
+=====
+
+.. include:: /includes/steps-connect.rst
+
+MongoDB {+version+}
+`,
+	"source/other.txt": `Other
+=====
+
+.. include:: /includes/extracts/connect.rst
+
+.. include:: /includes/steps-connect.rst
+`,
+	"source/includes/steps-connect.rst":  ".. literalinclude:: /includes/code/connect.go\n",
+	"source/includes/code/connect.go":    "package main\n",
+	"source/includes/code/old.go":        "package main\n",
+	"source/includes/extracts-app.yaml":  extracts,
+	"source/includes/unused.rst":         ".. include:: /includes/only-unused.rst\n",
+	"source/includes/only-unused.rst":    "Only unused.rst includes this.\n",
+	"source/includes/.draft.rst":         "Hidden.\n",
+	"source/includes/.cache/connect.rst": "Hidden.\n",
+}
+
+func TestFind(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeFiles(t, docsProject)
+	g, err := Build([]string{"source/index.txt", "source/other.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"connect.go", []string{"source/includes/code/connect.go"}},
+		{"/includes/code/connect.go", []string{"source/includes/code/connect.go"}},
+		{"source/includes/steps-connect.rst", []string{"source/includes/steps-connect.rst"}},
+		{"nect.go", nil},
+		{"connect", []string{"source/includes/extracts-app.yaml#connect"}},
+		{"{+version+}", []string{"snooty.toml#version"}},
+		{"version", []string{"snooty.toml#version"}},
+		{"old.go", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := g.Find(tt.query); !slices.Equal(got, tt.want) {
+				t.Errorf("Find(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsers(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeFiles(t, docsProject)
+	g, err := Build([]string{"source/index.txt", "source/other.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const code = "source/includes/code/connect.go"
+	users := slices.Sorted(maps.Keys(g.Users(code)))
+	if want := []string{code, "source/includes/steps-connect.rst", "source/index.txt", "source/other.txt"}; !slices.Equal(users, want) {
+		t.Errorf("Users = %v, want %v", users, want)
+	}
+	if got, want := g.Pages(code), []string{"source/index.txt", "source/other.txt"}; !slices.Equal(got, want) {
+		t.Errorf("Pages = %v, want %v", got, want)
+	}
+	if got := g.Pages("snooty.toml#version"); !slices.Equal(got, []string{"source/index.txt"}) {
+		t.Errorf("Pages of the constant = %v, want only the index", got)
+	}
+	if got := g.Lines("source/other.txt", map[string]bool{code: true}); !slices.Equal(got, []int{6}) {
+		t.Errorf("Lines = %v, want the include at line 6", got)
+	}
+}
+
+func TestOrphans(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages []string
+		want  []string
+	}{
+		{
+			name:  "every page",
+			pages: []string{"source/index.txt", "source/other.txt"},
+			want: []string{
+				"source/includes/code/old.go",
+				"source/includes/only-unused.rst",
+				"source/includes/unused.rst",
+			},
+		},
+		{
+			name:  "a page left out",
+			pages: []string{"source/index.txt"},
+			want: []string{
+				"source/includes/code/old.go",
+				"source/includes/extracts-app.yaml",
+				"source/includes/only-unused.rst",
+				"source/includes/unused.rst",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			writeFiles(t, docsProject)
+			g, err := Build(tt.pages)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := g.Orphans()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Orphans = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/common"
+)
+
+// runtime describes how to run a code example in one language: the file
+// it is written to and the shell command that runs that file.
+type runtime struct {
+	file    string
+	command string
+}
+
+// runtimes run inline code examples. {filename}, {basename} and
+// {className} are filled in as they are for IDE commands.
+var runtimes = map[string]runtime{
+	common.JavaScript: {"main.js", "node {filename}"},
+	common.TypeScript: {"main.ts", "npx --yes tsx {filename}"},
+	common.Python:     {"main.py", "python3 {filename}"},
+	common.Go:         {"main.go", "go run {filename}"},
+	common.PHP:        {"main.php", "php {filename}"},
+	common.Ruby:       {"main.rb", "ruby {filename}"},
+	common.Java:       {"{className}.java", "java {filename}"},
+	common.Shell:      {"main.sh", "sh {filename}"},
+	common.Bash:       {"main.sh", "bash {filename}"},
+	common.C:          {"main.c", "cc {filename} -o {basename} && ./{basename}"},
+	common.CPP:        {"main.cpp", "c++ -std=c++17 {filename} -o {basename} && ./{basename}"},
+	common.Rust:       {"main.rs", "rustc {filename} -o {basename} && ./{basename}"},
+	common.Kotlin:     {"main.kts", "kotlinc -script {filename}"},
+}
+
+// DefaultIDECommands run a file that the reader is told to run "from your
+// IDE". They follow the conventions in the specification and can be
+// overridden per language through Context.IDECommands.
+var DefaultIDECommands = map[string]string{
+	common.Java:       `mvn compile exec:java -Dexec.mainClass="{className}"`,
+	common.CSharp:     "dotnet run",
+	common.CPP:        "g++ {filename} -o {basename} && ./{basename}",
+	common.C:          "gcc {filename} -o {basename} && ./{basename}",
+	common.Python:     "python3 {filename}",
+	common.JavaScript: "node {filename}",
+	common.TypeScript: "npx --yes tsx {filename}",
+	common.Go:         "go run {filename}",
+	common.PHP:        "php {filename}",
+	common.Ruby:       "ruby {filename}",
+	common.Kotlin:     "kotlinc {filename} -include-runtime -d {basename}.jar && java -jar {basename}.jar",
+	common.Rust:       "cargo run",
+}
+
+var classNameRE = regexp.MustCompile(`(?:public\s+)?(?:class|object)\s+(\w+)`)
+
+// CodeExecutor runs code examples. Inline examples are written to a file
+// in the current directory and run with the language's runtime; IDE
+// examples run a file an earlier step wrote, using the IDE command for
+// the language. The file is left in place, so that a kept sandbox still
+// has the source that ran, and goes when the sandbox is removed.
+type CodeExecutor struct{}
+
+func (e *CodeExecutor) CanExecute(a ast.Action) bool {
+	_, ok := a.(*ast.CodeAction)
+	return ok
+}
+
+func (e *CodeExecutor) Execute(ctx context.Context, a ast.Action, ec *Context) Result {
+	act := a.(*ast.CodeAction)
+	lang := common.GetNormalizedLanguageFromString(act.Language)
+	ec = ec.forLanguage(lang)
+	if act.ExecutionMode == ast.ExecutionIDE {
+		return e.executeIDE(ctx, act, lang, ec)
+	}
+	rt, ok := runtimes[lang]
+	if !ok {
+		return skipped("no runtime is configured for %s code", act.Language)
+	}
+	if c := ec.Runtimes[lang].Command; c != "" {
+		rt.command = c
+	}
+	className := className(act.Code)
+	file := strings.ReplaceAll(rt.file, "{className}", className)
+	if err := os.MkdirAll(ec.cwd(), 0o755); err != nil {
+		return failure("%v", err)
+	}
+	path := filepath.Join(ec.cwd(), file)
+	if err := os.WriteFile(path, []byte(act.Code), 0o644); err != nil {
+		return failure("cannot write %s: %v", file, err)
+	}
+	res := runShell(ctx, interpolate(rt.command, file, className), ec)
+	res.Command = act.Code
+	return res
+}
+
+func (e *CodeExecutor) executeIDE(ctx context.Context, act *ast.CodeAction, lang string, ec *Context) Result {
+	if ec.SkipIDE {
+		return skipped("running code from an IDE is turned off")
+	}
+	tmpl, ok := ec.IDECommands[lang]
+	if !ok {
+		tmpl, ok = DefaultIDECommands[lang]
+	}
+	if !ok {
+		return failure("no IDE command for %s; configure one for the language", act.Language)
+	}
+	code := act.Code
+	if code == "" && act.FilePath != "" {
+		if b, err := os.ReadFile(ec.path(act.FilePath)); err == nil {
+			code = string(b)
+		}
+	}
+	return runShell(ctx, interpolate(tmpl, act.FilePath, className(code)), ec)
+}
+
+func className(code string) string {
+	if m := classNameRE.FindStringSubmatch(code); m != nil {
+		return m[1]
+	}
+	return "Main"
+}
+
+// interpolate fills in an IDE or runtime command template.
+func interpolate(tmpl, filename, className string) string {
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	return strings.NewReplacer(
+		"{filename}", shellQuote(filename),
+		"{basename}", shellQuote(base),
+		"{className}", className,
+	).Replace(tmpl)
+}
@@ -0,0 +1,165 @@
+// Package executor runs testable actions: shell commands, code examples,
+// CLI sessions, file operations and HTTP requests. Each action type has
+// its own executor; a Registry picks the one that handles an action.
+package executor
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/cleanup"
+)
+
+// DefaultTimeout bounds a single action.
+const DefaultTimeout = 5 * time.Minute
+
+// Context is the state an action runs in. A runner creates one per
+// procedure variant and passes it to every action in order, so that a
+// "cd" in one shell block carries over to the next.
+type Context struct {
+	// Dir is the working directory of the procedure.
+	Dir string
+	// Cwd is the current directory, which starts at Dir and follows "cd"
+	// commands in shell actions. File paths are relative to it.
+	Cwd string
+	// Env is the environment as KEY=value pairs.
+	Env     []string
+	Timeout time.Duration
+	// IDECommands overrides DefaultIDECommands by language. SkipIDE
+	// reports IDE actions as skipped instead of running them.
+	IDECommands map[string]string
+	SkipIDE     bool
+	// Runtimes change how the code examples of a language run, by
+	// language.
+	Runtimes map[string]Runtime
+	// Cleanup, when set, receives the processes that actions leave
+	// running in the background.
+	Cleanup *cleanup.Registry
+	// Output, when set, receives the output of processes line by line
+	// as they write it, with the stream, "stdout" or "stderr", it went
+	// to. It is called from other goroutines.
+	Output func(stream, line string)
+}
+
+// Getenv returns the value of an environment variable in the context.
+func (c *Context) Getenv(name string) string {
+	for i := len(c.Env) - 1; i >= 0; i-- {
+		if k, v, ok := strings.Cut(c.Env[i], "="); ok && k == name {
+			return v
+		}
+	}
+	return ""
+}
+
+// Runtime changes how the code examples of one language run.
+type Runtime struct {
+	// Command replaces the command inline examples run with. {filename},
+	// {basename} and {className} are filled in.
+	Command string
+	// Timeout, when set, bounds the language's actions instead of
+	// Context.Timeout.
+	Timeout time.Duration
+	// Env is added to the environment of the language's actions, as
+	// KEY=value pairs.
+	Env []string
+}
+
+// forLanguage returns the context the code examples of lang run in.
+func (c *Context) forLanguage(lang string) *Context {
+	rt, ok := c.Runtimes[lang]
+	if !ok || rt.Timeout == 0 && len(rt.Env) == 0 {
+		return c
+	}
+	lc := *c
+	if rt.Timeout > 0 {
+		lc.Timeout = rt.Timeout
+	}
+	lc.Env = append(slices.Clip(c.Env), rt.Env...)
+	return &lc
+}
+
+func (c *Context) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultTimeout
+}
+
+// Result is the outcome of one action.
+type Result struct {
+	Success bool `json:"success" yaml:"success"`
+	// Skipped is set when the action cannot be automated here, such as a
+	// UI interaction, and needs manual verification instead.
+	Skipped bool `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+	// Command is what actually ran, after placeholder resolution.
+	Command  string        `json:"command,omitempty" yaml:"command,omitempty"`
+	Stdout   string        `json:"stdout,omitempty" yaml:"stdout,omitempty"`
+	Stderr   string        `json:"stderr,omitempty" yaml:"stderr,omitempty"`
+	ExitCode int           `json:"exitCode" yaml:"exitCode"`
+	Duration time.Duration `json:"duration" yaml:"duration"`
+	Error    string        `json:"error,omitempty" yaml:"error,omitempty"`
+	TimedOut bool          `json:"timedOut,omitempty" yaml:"timedOut,omitempty"`
+}
+
+func failure(format string, args ...any) Result {
+	return Result{ExitCode: -1, Error: fmt.Sprintf(format, args...)}
+}
+
+func skipped(format string, args ...any) Result {
+	return Result{Success: true, Skipped: true, Error: fmt.Sprintf(format, args...)}
+}
+
+// Executor runs the actions it can handle.
+type Executor interface {
+	CanExecute(a ast.Action) bool
+	Execute(ctx context.Context, a ast.Action, ec *Context) Result
+}
+
+// Registry holds the available executors. The first one that can handle
+// an action runs it.
+type Registry struct {
+	executors []Executor
+}
+
+// NewRegistry returns a registry of the given executors.
+func NewRegistry(executors ...Executor) *Registry {
+	return &Registry{executors: executors}
+}
+
+// Default returns a registry with an executor for every action type.
+func Default() *Registry {
+	return NewRegistry(
+		&FileExecutor{},
+		&ShellExecutor{},
+		&CLIExecutor{},
+		&CodeExecutor{},
+		&APIExecutor{},
+		&DownloadExecutor{},
+		&URLExecutor{},
+		&UIExecutor{},
+	)
+}
+
+// Register adds an executor ahead of the existing ones, so it can
+// override how an action type is handled.
+func (r *Registry) Register(e Executor) {
+	r.executors = append([]Executor{e}, r.executors...)
+}
+
+// Execute runs a with the first executor that accepts it and records the
+// duration.
+func (r *Registry) Execute(ctx context.Context, a ast.Action, ec *Context) Result {
+	for _, e := range r.executors {
+		if e.CanExecute(a) {
+			start := time.Now()
+			res := e.Execute(ctx, a, ec)
+			res.Duration = time.Since(start)
+			return res
+		}
+	}
+	return skipped("no executor handles %s actions", a.Kind())
+}
@@ -0,0 +1,82 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+)
+
+// FileExecutor performs file operations relative to the current
+// directory. The preconditions are strict, so that a procedure that
+// replaces a file it never created, or creates the same file twice,
+// fails instead of silently working:
+//
+//	create   the file must not exist
+//	replace  the file must exist
+//	append   the file is created if missing
+type FileExecutor struct{}
+
+func (e *FileExecutor) CanExecute(a ast.Action) bool {
+	_, ok := a.(*ast.FileAction)
+	return ok
+}
+
+func (e *FileExecutor) Execute(ctx context.Context, a ast.Action, ec *Context) Result {
+	act := a.(*ast.FileAction)
+	path := ec.path(act.Path)
+	res := Result{Command: act.Operation + " " + act.Path}
+
+	_, err := os.Stat(path)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		res.ExitCode, res.Error = -1, err.Error()
+		return res
+	}
+	switch act.Operation {
+	case ast.FileCreate:
+		if exists {
+			res.ExitCode, res.Error = 1, act.Path+" already exists; the procedure creates it twice or an earlier command already created it"
+			return res
+		}
+	case ast.FileReplace:
+		if !exists {
+			res.ExitCode, res.Error = 1, act.Path+" does not exist; the procedure replaces a file that no earlier step creates"
+			return res
+		}
+	case ast.FileAppend:
+	default:
+		res.ExitCode, res.Error = -1, "unknown file operation "+act.Operation
+		return res
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		res.ExitCode, res.Error = -1, err.Error()
+		return res
+	}
+	content := act.Content
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if act.Operation == ast.FileAppend {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err == nil {
+		_, err = f.WriteString(content)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		res.ExitCode, res.Error = -1, err.Error()
+		return res
+	}
+	res.Success = true
+	return res
+}
@@ -0,0 +1,257 @@
+package executor
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+)
+
+// maxBody caps how much of a response body is kept in a result.
+const maxBody = 64 << 10
+
+// userAgent identifies the tool to the sites it checks.
+const userAgent = "proctest"
+
+// APIExecutor sends Atlas Administration API requests. Requests that the
+// API challenges with digest authentication are retried with
+// ATLAS_PUBLIC_KEY and ATLAS_PRIVATE_KEY, as "curl --digest" would.
+type APIExecutor struct {
+	Client *http.Client
+}
+
+func (e *APIExecutor) CanExecute(a ast.Action) bool {
+	_, ok := a.(*ast.APIAction)
+	return ok
+}
+
+func (e *APIExecutor) Execute(ctx context.Context, a ast.Action, ec *Context) Result {
+	act := a.(*ast.APIAction)
+	ctx, cancel := context.WithTimeout(ctx, ec.timeout())
+	defer cancel()
+
+	newRequest := func() (*http.Request, error) {
+		var body io.Reader
+		if act.Body != "" {
+			body = strings.NewReader(act.Body)
+		}
+		req, err := http.NewRequestWithContext(ctx, act.Method, act.Endpoint, body)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range act.Headers {
+			req.Header.Set(k, v)
+		}
+		req.Header.Set("User-Agent", userAgent)
+		return req, nil
+	}
+	req, err := newRequest()
+	if err != nil {
+		return failure("%v", err)
+	}
+	client := httpClient(e.Client)
+	resp, err := client.Do(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		user, pass := ec.Getenv("ATLAS_PUBLIC_KEY"), ec.Getenv("ATLAS_PRIVATE_KEY")
+		if strings.HasPrefix(challenge, "Digest ") && user != "" {
+			resp.Body.Close()
+			if req, err = newRequest(); err != nil {
+				return failure("%v", err)
+			}
+			req.Header.Set("Authorization", digestAuthorization(challenge, req, user, pass))
+			resp, err = client.Do(req)
+		}
+	}
+	res := Result{Command: act.Method + " " + act.Endpoint}
+	if err != nil {
+		res.ExitCode, res.Error = -1, err.Error()
+		return res
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	res.Stdout = string(body)
+	res.ExitCode = resp.StatusCode
+	if statusOK(resp.StatusCode, act.ExpectedStatus) {
+		res.Success = true
+	} else {
+		res.Error = statusError(resp.StatusCode, act.ExpectedStatus)
+	}
+	return res
+}
+
+// DownloadExecutor fetches a file into the current directory.
+type DownloadExecutor struct {
+	Client *http.Client
+}
+
+func (e *DownloadExecutor) CanExecute(a ast.Action) bool {
+	_, ok := a.(*ast.DownloadAction)
+	return ok
+}
+
+func (e *DownloadExecutor) Execute(ctx context.Context, a ast.Action, ec *Context) Result {
+	act := a.(*ast.DownloadAction)
+	ctx, cancel := context.WithTimeout(ctx, ec.timeout())
+	defer cancel()
+	method := act.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	res := Result{Command: fmt.Sprintf("%s %s -> %s", method, act.URL, act.OutputPath)}
+	req, err := http.NewRequestWithContext(ctx, method, act.URL, nil)
+	if err != nil {
+		res.ExitCode, res.Error = -1, err.Error()
+		return res
+	}
+	for k, v := range act.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := httpClient(e.Client).Do(req)
+	if err != nil {
+		res.ExitCode, res.Error = -1, err.Error()
+		return res
+	}
+	defer resp.Body.Close()
+	res.ExitCode = resp.StatusCode
+	if !statusOK(resp.StatusCode, 0) {
+		res.Error = statusError(resp.StatusCode, 0)
+		return res
+	}
+	path := ec.path(act.OutputPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	n, err := io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Stdout = fmt.Sprintf("wrote %d bytes to %s", n, act.OutputPath)
+	res.Success = true
+	return res
+}
+
+// URLExecutor checks that a link the procedure tells the reader to open
+// responds with the expected status.
+type URLExecutor struct {
+	Client *http.Client
+}
+
+func (e *URLExecutor) CanExecute(a ast.Action) bool {
+	_, ok := a.(*ast.URLAction)
+	return ok
+}
+
+func (e *URLExecutor) Execute(ctx context.Context, a ast.Action, ec *Context) Result {
+	act := a.(*ast.URLAction)
+	ctx, cancel := context.WithTimeout(ctx, ec.timeout())
+	defer cancel()
+	res := Result{Command: "GET " + act.URL}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, act.URL, nil)
+	if err != nil {
+		res.ExitCode, res.Error = -1, err.Error()
+		return res
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := httpClient(e.Client).Do(req)
+	if err != nil {
+		res.ExitCode, res.Error = -1, err.Error()
+		return res
+	}
+	resp.Body.Close()
+	res.ExitCode = resp.StatusCode
+	if statusOK(resp.StatusCode, act.ExpectedStatus) {
+		res.Success = true
+	} else {
+		res.Error = statusError(resp.StatusCode, act.ExpectedStatus)
+	}
+	return res
+}
+
+func httpClient(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return http.DefaultClient
+}
+
+// statusOK reports whether status is the expected one, or any 2xx status
+// when none is expected.
+func statusOK(status, expected int) bool {
+	if expected != 0 {
+		return status == expected
+	}
+	return status >= 200 && status < 300
+}
+
+func statusError(status, expected int) string {
+	if expected != 0 {
+		return fmt.Sprintf("HTTP %d, expected %d", status, expected)
+	}
+	return fmt.Sprintf("HTTP %d", status)
+}
+
+// digestAuthorization answers an RFC 7616 digest challenge with MD5 and
+// qop=auth, which is what the Atlas Administration API issues.
+func digestAuthorization(challenge string, req *http.Request, user, pass string) string {
+	params := map[string]string{}
+	for _, part := range splitChallenge(strings.TrimPrefix(challenge, "Digest ")) {
+		if k, v, ok := strings.Cut(part, "="); ok {
+			params[strings.TrimSpace(k)] = strings.Trim(strings.TrimSpace(v), `"`)
+		}
+	}
+	md5hex := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	cnonce := hex.EncodeToString(b)
+	uri := req.URL.RequestURI()
+	ha1 := md5hex(user + ":" + params["realm"] + ":" + pass)
+	ha2 := md5hex(req.Method + ":" + uri)
+	const nc = "00000001"
+	response := md5hex(strings.Join([]string{ha1, params["nonce"], nc, cnonce, "auth", ha2}, ":"))
+	return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", qop=auth, nc=%s, cnonce="%s", response="%s", algorithm=MD5`,
+		user, params["realm"], params["nonce"], uri, nc, cnonce, response)
+}
+
+// splitChallenge splits a challenge's comma-separated parameters,
+// ignoring commas inside quoted values.
+func splitChallenge(s string) []string {
+	var parts []string
+	var cur strings.Builder
+	quoted := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			cur.WriteRune(r)
+		case r == ',' && !quoted:
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	return append(parts, cur.String())
+}
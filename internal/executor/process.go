@@ -0,0 +1,182 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/cleanup"
+)
+
+// waitDelay is how long a timed-out process group gets to exit after it is
+// killed before its output pipes are closed.
+const waitDelay = 2 * time.Second
+
+// followInterval is how often the output of a running process is read
+// for command.output.
+const followInterval = 100 * time.Millisecond
+
+// command describes a process to run.
+type command struct {
+	name  string
+	args  []string
+	dir   string
+	env   []string
+	stdin io.Reader
+	// label names the command in cleanup reports.
+	label string
+	// cleanup receives the process group when background children are
+	// still running after the command exits.
+	cleanup *cleanup.Registry
+	// output, when set, receives the process's output line by line
+	// while it runs.
+	output func(stream, line string)
+}
+
+// run starts the process in its own process group, so that a timeout
+// kills everything it spawned, and collects its output. Output goes to
+// temp files rather than pipes: a server started with "&" keeps the
+// pipes open and would otherwise hold up the step until it exits.
+func run(ctx context.Context, c command, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stdout, err := os.CreateTemp("", "proctest-stdout-")
+	if err != nil {
+		return failure("cannot create temp file: %v", err)
+	}
+	defer os.Remove(stdout.Name())
+	defer stdout.Close()
+	stderr, err := os.CreateTemp("", "proctest-stderr-")
+	if err != nil {
+		return failure("cannot create temp file: %v", err)
+	}
+	defer os.Remove(stderr.Name())
+	defer stderr.Close()
+
+	cmd := exec.CommandContext(ctx, c.name, c.args...)
+	cmd.Dir = c.dir
+	cmd.Env = c.env
+	cmd.Stdin = c.stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
+	cmd.WaitDelay = waitDelay
+
+	stop := follow(c.output, stdout.Name(), stderr.Name())
+	err = cmd.Run()
+	stop()
+	res := Result{Stdout: readAll(stdout), Stderr: readAll(stderr)}
+	var exit *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		res.TimedOut = true
+		res.ExitCode = -1
+		res.Error = fmt.Sprintf("timed out after %s", timeout)
+	case ctx.Err() == context.Canceled:
+		res.ExitCode = -1
+		res.Error = "interrupted"
+	case errors.As(err, &exit):
+		res.ExitCode = exit.ExitCode()
+		res.Error = fmt.Sprintf("exited with status %d", res.ExitCode)
+	case err != nil:
+		res.ExitCode = -1
+		res.Error = err.Error()
+	default:
+		res.Success = true
+	}
+	if c.cleanup != nil && cmd.Process != nil && cleanup.GroupAlive(cmd.Process.Pid) {
+		label := c.label
+		if label == "" {
+			label = c.name
+		}
+		c.cleanup.ProcessGroup(cmd.Process.Pid, label)
+	}
+	return res
+}
+
+// follow reads the files a process writes its output to every
+// followInterval and passes each complete line to output, until the
+// returned function is called; that reads what is left and waits. The
+// files are opened again so that their offsets are their own.
+func follow(output func(stream, line string), stdout, stderr string) (stop func()) {
+	if output == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, f := range []struct{ stream, path string }{{"stdout", stdout}, {"stderr", stderr}} {
+		r, err := os.Open(f.path)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer r.Close()
+			t := &tail{r: r, emit: func(line string) { output(f.stream, line) }}
+			tick := time.NewTicker(followInterval)
+			defer tick.Stop()
+			for {
+				select {
+				case <-tick.C:
+					t.read(false)
+				case <-done:
+					t.read(true)
+					return
+				}
+			}
+		}()
+	}
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// tail splits what is appended to a file into lines.
+type tail struct {
+	r    io.Reader
+	buf  []byte
+	emit func(line string)
+}
+
+// read emits the complete lines written since the last read and, when
+// final, the incomplete one the file ends with.
+func (t *tail) read(final bool) {
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := t.r.Read(chunk)
+		t.buf = append(t.buf, chunk[:n]...)
+		if n == 0 || err != nil {
+			break
+		}
+	}
+	for {
+		i := bytes.IndexByte(t.buf, '\n')
+		if i < 0 {
+			break
+		}
+		t.emit(string(t.buf[:i+1]))
+		t.buf = t.buf[i+1:]
+	}
+	if final && len(t.buf) > 0 {
+		t.emit(string(t.buf))
+		t.buf = nil
+	}
+}
+
+// readAll returns what a process wrote to f so far.
+func readAll(f *os.File) string {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return ""
+	}
+	b, _ := io.ReadAll(f)
+	return string(b)
+}
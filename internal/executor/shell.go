@@ -0,0 +1,124 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+)
+
+// ShellExecutor runs shell actions with bash, or sh where bash is not
+// installed. The directory a block ends in becomes the current directory
+// of the next action, as it would in a reader's terminal.
+type ShellExecutor struct{}
+
+func (e *ShellExecutor) CanExecute(a ast.Action) bool {
+	_, ok := a.(*ast.ShellAction)
+	return ok
+}
+
+func (e *ShellExecutor) Execute(ctx context.Context, a ast.Action, ec *Context) Result {
+	return runShell(ctx, a.(*ast.ShellAction).Command, ec)
+}
+
+// runShell runs script in ec.Cwd with "set -e", so that a failing line
+// fails the block, and records the final directory.
+func runShell(ctx context.Context, script string, ec *Context) Result {
+	cwdFile, err := os.CreateTemp("", "proctest-cwd-")
+	if err != nil {
+		return failure("cannot create temp file: %v", err)
+	}
+	cwdFile.Close()
+	defer os.Remove(cwdFile.Name())
+
+	wrapped := "set -e\n" + script + "\npwd > " + shellQuote(cwdFile.Name()) + "\n"
+	res := run(ctx, command{
+		name:    shellPath(),
+		args:    []string{"-c", wrapped},
+		dir:     ec.cwd(),
+		env:     ec.Env,
+		label:   firstLine(script),
+		cleanup: ec.Cleanup,
+		output:  ec.Output,
+	}, ec.timeout())
+	res.Command = script
+	if res.Success {
+		if out, err := os.ReadFile(cwdFile.Name()); err == nil {
+			if dir := strings.TrimSpace(string(out)); dir != "" {
+				ec.Cwd = dir
+			}
+		}
+	}
+	return res
+}
+
+// firstLine returns the first line of a script, to name it in reports.
+func firstLine(script string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(script), "\n")
+	return line
+}
+
+func shellPath() string {
+	if p, err := exec.LookPath("bash"); err == nil {
+		return p
+	}
+	return "sh"
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// cwd returns the current directory, defaulting to the working directory.
+func (c *Context) cwd() string {
+	if c.Cwd != "" {
+		return c.Cwd
+	}
+	return c.Dir
+}
+
+// path resolves a path from an action against the current directory.
+func (c *Context) path(p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(c.cwd(), p)
+}
+
+// CLIExecutor runs mongosh sessions and Atlas CLI commands.
+type CLIExecutor struct{}
+
+func (e *CLIExecutor) CanExecute(a ast.Action) bool {
+	_, ok := a.(*ast.CLIAction)
+	return ok
+}
+
+func (e *CLIExecutor) Execute(ctx context.Context, a ast.Action, ec *Context) Result {
+	act := a.(*ast.CLIAction)
+	if act.Tool != ast.ToolMongosh {
+		return runShell(ctx, act.Command, ec)
+	}
+	// Feeding the commands on stdin runs them the way a reader typing
+	// into the shell would, including helpers such as "use db" that
+	// --eval does not accept.
+	uri := ec.Getenv("MONGODB_URI")
+	if uri == "" {
+		return failure("mongosh needs a connection string: set MONGODB_URI")
+	}
+	res := run(ctx, command{
+		name:    "mongosh",
+		args:    []string{uri, "--quiet"},
+		dir:     ec.cwd(),
+		env:     ec.Env,
+		stdin:   strings.NewReader(act.Command + "\n"),
+		label:   firstLine(act.Command),
+		cleanup: ec.Cleanup,
+		output:  ec.Output,
+	}, ec.timeout())
+	res.Command = act.Command
+	return res
+}
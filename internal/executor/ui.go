@@ -0,0 +1,24 @@
+package executor
+
+import (
+	"context"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+)
+
+// UIExecutor records UI interactions for manual verification. Driving a
+// browser needs navigation mappings that are not configured yet, so UI
+// actions are reported as skipped rather than failed.
+type UIExecutor struct{}
+
+func (e *UIExecutor) CanExecute(a ast.Action) bool {
+	_, ok := a.(*ast.UIAction)
+	return ok
+}
+
+func (e *UIExecutor) Execute(ctx context.Context, a ast.Action, ec *Context) Result {
+	act := a.(*ast.UIAction)
+	res := skipped("UI action needs manual verification")
+	res.Command = act.Interaction + " " + act.Target
+	return res
+}
@@ -0,0 +1,160 @@
+// Package history keeps the outcome of every test case across runs in an
+// append-only JSONL file, so that trends can be computed later: how often
+// a procedure variant passes, whether it flips between passing and
+// failing, how its steps' durations change and since when it has been
+// broken.
+//
+// Each line is one Record. Lines are only ever appended, so the file can
+// be kept as a CI cache or artifact and merged by concatenation.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/results"
+)
+
+// DefaultPath is where the history is kept, relative to the current
+// directory.
+const DefaultPath = ".proctest/history.jsonl"
+
+// Record is the outcome of one test case in one run.
+type Record struct {
+	// Run is when the run's results were written; every record of a
+	// run has the same time.
+	Run time.Time `json:"run"`
+	// Commit is the commit that was tested, when it is known.
+	Commit string `json:"commit,omitempty"`
+	// Environment is the fingerprint of the environment the run
+	// happened in.
+	Environment string `json:"environment,omitempty"`
+	// ID is the test case ID, in records written since results had one.
+	ID     string `json:"id,omitempty"`
+	File   string `json:"file"`
+	Name   string `json:"name"`
+	Owner  string `json:"owner,omitempty"`
+	Status string `json:"status"`
+	Flaky  bool   `json:"flaky,omitempty"`
+	// Duration is in milliseconds.
+	Duration int64  `json:"duration"`
+	Error    string `json:"error,omitempty"`
+	Steps    []Step `json:"steps,omitempty"`
+}
+
+// Key identifies the test case across runs.
+func (r Record) Key() string {
+	return r.File + "\x00" + r.Name
+}
+
+// Step is the outcome of a step; sub-steps are not kept.
+type Step struct {
+	ID string `json:"id,omitempty"`
+	// Number is the step number as the page shows it.
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Status string `json:"status"`
+	// Duration is in milliseconds.
+	Duration int64 `json:"duration"`
+}
+
+// Records converts a results document to one record per test case.
+func Records(doc *results.Document, commit string) []Record {
+	var out []Record
+	for _, r := range doc.Results {
+		rec := Record{
+			Run:         doc.GeneratedAt,
+			Commit:      commit,
+			Environment: doc.Environment.Fingerprint,
+			ID:          r.ID,
+			File:        r.File,
+			Name:        r.Name,
+			Owner:       r.Owner,
+			Status:      r.Status,
+			Flaky:       r.Flaky,
+			Duration:    r.Duration,
+		}
+		if r.Error != nil {
+			rec.Error = r.Error.Message
+			if r.Error.Step != "" {
+				rec.Error = fmt.Sprintf("Step %s: %s", r.Error.Step, r.Error.Message)
+			}
+		}
+		for _, st := range r.Steps {
+			rec.Steps = append(rec.Steps, Step{ID: st.ID, Number: st.Number, Title: st.Title, Status: st.Status, Duration: st.Duration})
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+// Append adds records to the history at path, creating it if needed.
+func Append(path string, records []Record) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load reads the history at path, oldest record first. A missing file is
+// an empty history.
+func Load(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []Record
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		out = append(out, r)
+	}
+	return out, sc.Err()
+}
+
+// Commit returns the commit being tested: GITHUB_SHA in GitHub Actions,
+// otherwise the HEAD of the git repository in the current directory, or
+// "" when there is none.
+func Commit() string {
+	if sha := os.Getenv("GITHUB_SHA"); sha != "" {
+		return sha
+	}
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
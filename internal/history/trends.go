@@ -0,0 +1,209 @@
+package history
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/results"
+)
+
+// Trend summarizes the history of one test case.
+type Trend struct {
+	File  string
+	Name  string
+	Owner string
+	// Runs counts every run; Passed, Failed and Skipped split it by
+	// status.
+	Runs    int
+	Passed  int
+	Failed  int
+	Skipped int
+	// Flips counts the runs whose status differs from the run before,
+	// ignoring skipped runs.
+	Flips int
+	// FlakyRuns counts the runs that passed only after retries.
+	FlakyRuns int
+	// FirstFailure is the first run that failed.
+	FirstFailure time.Time
+	// BrokenSince is the first run of the failures the test case has had
+	// since it last passed, BrokenCommit the commit that run tested and
+	// Streak the number of those failures. They are zero when the last
+	// run passed.
+	BrokenSince  time.Time
+	BrokenCommit string
+	Streak       int
+	// LastPassed is the last run that passed.
+	LastPassed time.Time
+	LastStatus string
+	LastError  string
+	// Durations are the durations of the runs that were not skipped,
+	// oldest first, in milliseconds.
+	Durations []int64
+}
+
+// PassRate is the share of the runs that were not skipped that passed.
+func (t *Trend) PassRate() float64 {
+	if t.Passed+t.Failed == 0 {
+		return 0
+	}
+	return float64(t.Passed) / float64(t.Passed+t.Failed)
+}
+
+// Flakiness is the share of the runs that were not skipped that flipped
+// status or passed only after retries. A test case that always passes or
+// always fails has none.
+func (t *Trend) Flakiness() float64 {
+	if t.Passed+t.Failed == 0 {
+		return 0
+	}
+	return float64(t.Flips+t.FlakyRuns) / float64(t.Passed+t.Failed)
+}
+
+// Broken reports whether the last run that was not skipped failed.
+func (t *Trend) Broken() bool {
+	return !t.BrokenSince.IsZero()
+}
+
+// Change is how much slower (positive) or faster (negative) the test
+// case's recent runs were than the ones before them, as a fraction.
+func (t *Trend) Change() float64 {
+	return change(t.Durations)
+}
+
+// StepTrend summarizes the durations of one step of a test case.
+type StepTrend struct {
+	File   string
+	Name   string
+	Number int
+	Title  string
+	// Durations are the durations of the runs that reached the step,
+	// oldest first, in milliseconds.
+	Durations []int64
+}
+
+// Mean is the mean duration in milliseconds.
+func (s *StepTrend) Mean() int64 {
+	return mean(s.Durations)
+}
+
+// Change is how much slower (positive) or faster (negative) the recent
+// runs were than the ones before them, as a fraction.
+func (s *StepTrend) Change() float64 {
+	return change(s.Durations)
+}
+
+// Analyze computes the trend of every test case in records, in the order
+// the test cases first appear.
+func Analyze(records []Record) []*Trend {
+	records = sorted(records)
+	var out []*Trend
+	index := map[string]*Trend{}
+	last := map[string]string{}
+	for _, r := range records {
+		t, ok := index[r.Key()]
+		if !ok {
+			t = &Trend{File: r.File, Name: r.Name}
+			index[r.Key()] = t
+			out = append(out, t)
+		}
+		t.Runs++
+		t.Owner = cmp.Or(r.Owner, t.Owner)
+		t.LastStatus = r.Status
+		switch r.Status {
+		case results.StatusSkipped:
+			t.Skipped++
+			continue
+		case results.StatusPassed:
+			t.Passed++
+			t.LastPassed = r.Run
+			t.BrokenSince, t.BrokenCommit, t.Streak, t.LastError = time.Time{}, "", 0, ""
+		case results.StatusFailed:
+			t.Failed++
+			if t.FirstFailure.IsZero() {
+				t.FirstFailure = r.Run
+			}
+			if t.BrokenSince.IsZero() {
+				t.BrokenSince, t.BrokenCommit = r.Run, r.Commit
+			}
+			t.Streak++
+			t.LastError = r.Error
+		}
+		if prev := last[r.Key()]; prev != "" && prev != r.Status {
+			t.Flips++
+		}
+		last[r.Key()] = r.Status
+		if r.Flaky {
+			t.FlakyRuns++
+		}
+		t.Durations = append(t.Durations, r.Duration)
+	}
+	return out
+}
+
+// Steps computes the duration trend of every step in records.
+func Steps(records []Record) []*StepTrend {
+	var out []*StepTrend
+	index := map[string]*StepTrend{}
+	for _, r := range sorted(records) {
+		for _, st := range r.Steps {
+			if st.Status == results.StatusSkipped {
+				continue
+			}
+			key := r.Key() + "\x00" + st.Title
+			s, ok := index[key]
+			if !ok {
+				s = &StepTrend{File: r.File, Name: r.Name, Number: st.Number, Title: st.Title}
+				index[key] = s
+				out = append(out, s)
+			}
+			s.Durations = append(s.Durations, st.Duration)
+		}
+	}
+	return out
+}
+
+// Since returns the records of runs at or after t.
+func Since(records []Record, t time.Time) []Record {
+	var out []Record
+	for _, r := range records {
+		if !r.Run.Before(t) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// sorted orders records by run, keeping the file order within a run.
+func sorted(records []Record) []Record {
+	records = slices.Clone(records)
+	slices.SortStableFunc(records, func(a, b Record) int { return a.Run.Compare(b.Run) })
+	return records
+}
+
+// recentRuns is how many of the latest runs change compares with the runs
+// before them.
+const recentRuns = 5
+
+func change(durations []int64) float64 {
+	n := min(recentRuns, len(durations)/2)
+	if n == 0 {
+		return 0
+	}
+	before := mean(durations[:len(durations)-n])
+	if before == 0 {
+		return 0
+	}
+	return float64(mean(durations[len(durations)-n:])-before) / float64(before)
+}
+
+func mean(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum int64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / int64(len(values))
+}
@@ -0,0 +1,144 @@
+// Package lint reports problems in documentation pages: the warnings the
+// parser records, patterns in procedures that make them fail when they
+// are followed literally, and the failures of a test run. Every finding
+// is a Diagnostic tied to a rule and a source location, so static and
+// runtime problems can be reported in one format.
+package lint
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+)
+
+// Severity is how serious a finding is.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityNote    Severity = "note"
+)
+
+// Rule describes one kind of finding.
+type Rule struct {
+	ID       string
+	Name     string
+	Severity Severity
+	// Description says what the rule finds, and Help how to fix it.
+	Description string
+	Help        string
+}
+
+// Rules for execution failures; the parser's rules are in ast.
+const (
+	RuleImplicitNavigation    = "implicit-navigation"
+	RuleExecutionFailed       = "execution-failed"
+	RuleUnresolvedPlaceholder = "unresolved-placeholder"
+	RuleReplayFailed          = "replay-failed"
+	RuleCleanupFailed         = "cleanup-failed"
+)
+
+// Rules lists every rule.
+var Rules = []Rule{
+	{
+		ID: ast.RuleInclude, Name: "Include not found", Severity: SeverityError,
+		Description: "An include or literalinclude could not be read, so its content is missing from the page.",
+		Help:        "Check the path. Paths that start with / are relative to the source directory.",
+	},
+	{
+		ID: ast.RuleUnknownLanguage, Name: "Unknown code language", Severity: SeverityWarning,
+		Description: "A code block's language is not one the tooling recognizes, so the block is not run as code.",
+		Help:        "Use a canonical language name such as python, javascript, shell or csharp.",
+	},
+	{
+		ID: ast.RuleDeprecatedDirective, Name: "Deprecated directive", Severity: SeverityWarning,
+		Description: "The docs toolchain has deprecated this directive.",
+		Help:        "Replace the directive; rstspec.toml lists the supported ones.",
+	},
+	{
+		ID: ast.RuleDeprecatedRole, Name: "Deprecated role", Severity: SeverityWarning,
+		Description: "The docs toolchain has deprecated this role.",
+		Help:        "Replace the role; rstspec.toml lists the supported ones.",
+	},
+	{
+		ID: RuleImplicitNavigation, Name: "Implicit directory navigation", Severity: SeverityWarning,
+		Description: "A command creates a project directory and the commands after it must run inside it, but the procedure never changes into it.",
+		Help:        "Add a cd command right after the directory is created.",
+	},
+	{
+		ID: RuleExecutionFailed, Name: "Procedure failed", Severity: SeverityError,
+		Description: "A command, request or file operation failed when the procedure was run as written.",
+		Help:        "Run the procedure with --verbose to see the command output.",
+	},
+	{
+		ID: RuleUnresolvedPlaceholder, Name: "Unresolved placeholder", Severity: SeverityError,
+		Description: "A placeholder had no value, so the step could not run.",
+		Help:        "Set the environment variable the suggestion names, or map the placeholder in the configuration.",
+	},
+	{
+		ID: RuleReplayFailed, Name: "Cassette problem", Severity: SeverityError,
+		Description: "A recorded interaction was missing or stale when the procedure was replayed.",
+		Help:        "Record the procedure again with --record.",
+	},
+	{
+		ID: RuleCleanupFailed, Name: "Cleanup failed", Severity: SeverityWarning,
+		Description: "A resource the procedure created could not be removed.",
+		Help:        "Run proctest sweep to remove resources left behind.",
+	},
+}
+
+// Lookup returns the rule with the given ID.
+func Lookup(id string) (Rule, bool) {
+	i := slices.IndexFunc(Rules, func(r Rule) bool { return r.ID == id })
+	if i < 0 {
+		return Rule{}, false
+	}
+	return Rules[i], true
+}
+
+// Diagnostic is one finding.
+type Diagnostic struct {
+	Rule     string             `json:"rule"`
+	Severity Severity           `json:"severity"`
+	Message  string             `json:"message"`
+	Location ast.SourceLocation `json:"location"`
+	// Related are other locations involved, such as the command that
+	// depends on a missing cd.
+	Related []ast.SourceLocation `json:"related,omitempty"`
+}
+
+// New returns a diagnostic with the rule's severity.
+func New(rule, msg string, loc ast.SourceLocation) Diagnostic {
+	r, _ := Lookup(rule)
+	sev := r.Severity
+	if sev == "" {
+		sev = SeverityWarning
+	}
+	return Diagnostic{Rule: rule, Severity: sev, Message: msg, Location: loc}
+}
+
+// Check returns the findings for a parsed page, ordered by location.
+func Check(doc *ast.Document) []Diagnostic {
+	var out []Diagnostic
+	for _, w := range doc.Warnings {
+		out = append(out, New(cmp.Or(w.Rule, ast.RuleInclude), w.Message, w.Location))
+	}
+	for _, proc := range doc.Procedures {
+		out = append(out, implicitNavigation(proc)...)
+	}
+	Sort(out)
+	return out
+}
+
+// Sort orders diagnostics by file and line.
+func Sort(ds []Diagnostic) {
+	slices.SortStableFunc(ds, func(a, b Diagnostic) int {
+		return cmp.Or(
+			cmp.Compare(a.Location.File, b.Location.File),
+			cmp.Compare(a.Location.StartLine, b.Location.StartLine),
+			cmp.Compare(a.Rule, b.Rule),
+		)
+	})
+}
@@ -0,0 +1,127 @@
+package lint
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+)
+
+var (
+	// createRE matches commands that create a project directory; the
+	// first group is the directory.
+	createRE = []*regexp.Regexp{
+		regexp.MustCompile(`^composer\s+create-project\s+(?:-\S+\s+)*\S+\s+(\w[\w.-]*)`),
+		regexp.MustCompile(`^(?:npm\s+(?:create|init)|yarn\s+create|pnpm\s+create)\s+(?:-\S+\s+)*\S+\s+(\w[\w.-]*)`),
+		regexp.MustCompile(`^npx\s+(?:-\S+\s+)*(?:create-\S+|@[\w-]+/create\S*)\s+(\w[\w.-]*)`),
+		regexp.MustCompile(`^rails\s+new\s+(\w[\w.-]*)`),
+		regexp.MustCompile(`^cargo\s+new\s+(\w[\w.-]*)`),
+		regexp.MustCompile(`^dotnet\s+new\s+\S+.*?\s(?:-o|--output)\s+(\w[\w.-]*)`),
+		regexp.MustCompile(`^django-admin\s+startproject\s+(\w[\w.-]*)\s*$`),
+		regexp.MustCompile(`^mkdir\s+(?:-p\s+)?(\w[\w.-]*)\s*$`),
+		regexp.MustCompile(`^git\s+clone\s+(?:-\S+\s+)*\S+\s+(\w[\w.-]*)\s*$`),
+		regexp.MustCompile(`^git\s+clone\s+(?:-\S+\s+)*\S*?(\w[\w.-]*?)(?:\.git)?/?\s*$`),
+	}
+	// projectRE matches commands that only work inside a project
+	// directory.
+	projectRE   = regexp.MustCompile(`^(?:npm\s+(?:install|i|init|run|start|test)\b|yarn\b|pnpm\s|composer\s+(?:require|install|update|init)\b|dotnet\s+(?:add|run|build|restore|new)\b|go\s+(?:mod|get|run|build)\b|cargo\s+(?:add|run|build|init)\b|pip3?\s+install\s+-r\b|python3?\s+manage\.py\b|php\s+(?:artisan|bin/console)\b|symfony\s|bin/console\b|mvn\s|\./gradlew\s|gradle\s|bundle\s|rails\s+(?:s|server|g|generate|db)\b)`)
+	cdRE        = regexp.MustCompile(`^(?:cd|pushd)\b`)
+	separatorRE = regexp.MustCompile(`&&|;`)
+)
+
+// creation is a project directory a command created.
+type creation struct {
+	dir     string
+	command string
+	loc     ast.SourceLocation
+}
+
+// implicitNavigation finds project directories that are created and
+// never changed into before commands that must run inside them: "composer
+// create-project symfony/skeleton restaurants" followed by "composer
+// require ..." without "cd restaurants".
+func implicitNavigation(proc *ast.Procedure) []Diagnostic {
+	// A nil selection is the whole procedure, when it has no variants.
+	variants := []ast.Selection{nil}
+	if len(proc.Variants) > 0 {
+		variants = variants[:0]
+		for _, v := range proc.Variants {
+			variants = append(variants, v.Selection)
+		}
+	}
+	var out []Diagnostic
+	seen := map[string]bool{}
+	for _, sel := range variants {
+		var pending *creation
+		for _, a := range shellActions(proc, sel) {
+			for _, line := range commandLines(a.Command) {
+				switch {
+				case cdRE.MatchString(line):
+					pending = nil
+				case createdDir(line) != "":
+					pending = &creation{dir: createdDir(line), command: line, loc: a.Location}
+				case pending != nil && projectRE.MatchString(line) && !strings.Contains(line, pending.dir):
+					key := pending.loc.String() + " " + pending.dir
+					if !seen[key] {
+						seen[key] = true
+						d := New(RuleImplicitNavigation, fmt.Sprintf("%q creates %s/, but %q runs without changing into it; add \"cd %s\"", pending.command, pending.dir, line, pending.dir), pending.loc)
+						d.Related = []ast.SourceLocation{a.Location}
+						out = append(out, d)
+					}
+					pending = nil
+				}
+			}
+		}
+	}
+	return out
+}
+
+// shellActions returns the shell commands of a variant in page order.
+func shellActions(proc *ast.Procedure, sel ast.Selection) []*ast.ShellAction {
+	var out []*ast.ShellAction
+	add := func(actions []ast.Action) {
+		for _, a := range actions {
+			if sh, ok := a.(*ast.ShellAction); ok && (sel == nil || sh.Selection.Matches(sel)) {
+				out = append(out, sh)
+			}
+		}
+	}
+	for _, step := range proc.Steps {
+		if sel != nil && !step.Selection.Matches(sel) {
+			continue
+		}
+		add(step.Actions)
+		for _, sub := range step.SubSteps {
+			if sel == nil || sub.Selection.Matches(sel) {
+				add(sub.Actions)
+			}
+		}
+	}
+	return out
+}
+
+// commandLines splits a shell block into its commands, without prompts.
+func commandLines(command string) []string {
+	var out []string
+	for _, line := range strings.Split(command, "\n") {
+		for _, part := range separatorRE.Split(line, -1) {
+			part = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(part), "$ "))
+			if part != "" && !strings.HasPrefix(part, "#") {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+// createdDir returns the project directory a command creates, or "".
+func createdDir(line string) string {
+	for _, re := range createRE {
+		if m := re.FindStringSubmatch(line); m != nil && m[1] != "." {
+			return path.Clean(m[1])
+		}
+	}
+	return ""
+}
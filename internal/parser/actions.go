@@ -0,0 +1,309 @@
+package parser
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/common"
+	"github.com/dacharyc/spike-procedural-testing/internal/rst"
+)
+
+// File operations inferred from prose. opPaste is "paste the following
+// code into X", which creates X unless an earlier step already did.
+const (
+	opCreate  = ast.FileCreate
+	opReplace = ast.FileReplace
+	opAppend  = ast.FileAppend
+	opPaste   = "paste"
+)
+
+var (
+	appendRE  = regexp.MustCompile(`(?i)\bappend\b|\badd\b.*\bto the end of\b`)
+	replaceRE = regexp.MustCompile(`(?i)\breplace the (entire )?(contents?|code)\b|\boverwrite\b|\bupdate the contents\b`)
+	createRE  = regexp.MustCompile(`(?i)\bcreate (a |an |the )?(new )?(\S+ )?file\b|\bcreate (a |an |the )?(new )?file (named|called)\b|\bsave the following\b|\bsave (it|this|the code) (as|in|to)\b`)
+	pasteRE   = regexp.MustCompile(`(?i)\b(paste|copy)\b.*\b(into|in|to)\b|\badd the following\b.*\b(to|into)\b.*\bfile\b|\bpopulate\b`)
+	runRE     = regexp.MustCompile(`(?i)\brun\b.*\bcommands?\b|\bin (your|a) (terminal|shell)\b|\bfrom the command line\b`)
+	ideRE     = regexp.MustCompile(`(?i)\b(from|in|using) (your|the) IDE\b`)
+	dirRE     = regexp.MustCompile("(?i)in the ``([^`]+)`` directory")
+	fileRE    = regexp.MustCompile(`^(?:[\w.@~-]+/)*[\w@~-][\w.@~-]*\.[A-Za-z0-9]{1,10}$|^\.[\w.-]+$`)
+	bareURLRE = regexp.MustCompile("https?://[^\\s<>`\"']+")
+	browseRE  = regexp.MustCompile(`(?i)\b(open|navigate to|visit|go to|browse to)\b`)
+	mongoshRE = regexp.MustCompile(`^(use \w+|show \w+|db\.|db\[|sh\.|rs\.)`)
+)
+
+// fileState tracks the file prose refers to across the steps of a
+// procedure, so "Create a file named app.go" followed by "Paste the
+// following code into the file" becomes one create action with content.
+type fileState struct {
+	// prose is the most recent prose as plain text; it decides how the
+	// next code block is used.
+	prose string
+	// current is the file the prose last referred to.
+	current string
+	// pending is a file a "create" sentence named that no code block has
+	// filled in yet.
+	pending string
+	// known holds the files created earlier in the procedure.
+	known map[string]bool
+}
+
+// flush emits an empty create action for a file the prose said to create
+// when no code block supplied its content.
+func (f *fileState) flush(actions *[]ast.Action, sel ast.Selection, loc ast.SourceLocation) {
+	if f.pending == "" {
+		return
+	}
+	*actions = append(*actions, &ast.FileAction{
+		ActionBase:  ast.ActionBase{Type: ast.ActionFile, Selection: sel, Location: loc},
+		Operation:   ast.FileCreate,
+		Path:        f.pending,
+		Language:    languageOfFile(f.pending),
+		Description: f.prose,
+	})
+	f.known[f.pending] = true
+	f.pending = ""
+}
+
+// observe records the files a sentence refers to.
+func (f *fileState) observe(plain, raw string) {
+	name := fileInProse(raw)
+	if name == "" {
+		return
+	}
+	f.current = name
+	if createRE.MatchString(plain) && !f.known[name] {
+		f.pending = name
+	}
+}
+
+// fileInProse returns the first file name written as a literal in raw,
+// joined with the directory when the sentence says "in the “dir“
+// directory".
+func fileInProse(raw string) string {
+	for _, lit := range rst.Literals(raw) {
+		if !fileRE.MatchString(lit) {
+			continue
+		}
+		if m := dirRE.FindStringSubmatch(raw); m != nil && !strings.Contains(lit, "/") {
+			return path.Join(strings.TrimSuffix(m[1], "/"), lit)
+		}
+		return lit
+	}
+	return ""
+}
+
+func fileOperation(prose string) string {
+	switch {
+	case appendRE.MatchString(prose):
+		return opAppend
+	case replaceRE.MatchString(prose):
+		return opReplace
+	case createRE.MatchString(prose):
+		return opCreate
+	case pasteRE.MatchString(prose):
+		return opPaste
+	}
+	return ""
+}
+
+func languageOfFile(name string) string {
+	return common.GetLanguageFromFilename(name)
+}
+
+// proseActions finds the actions a paragraph describes: UI interactions
+// on :guilabel: targets, links to validate, IDE runs of the current file,
+// and waits for something to finish in the background.
+func (b *builder) proseActions(n *rst.Node, sel ast.Selection) []ast.Action {
+	raw := b.project.ExpandConstants(n.Text)
+	plain := b.Plain(n.Text)
+	b.file.prose = plain
+	b.file.observe(plain, raw)
+
+	base := ast.ActionBase{Selection: sel, Location: b.Location(n)}
+	var actions []ast.Action
+	for _, m := range uiRoleRE.FindAllStringSubmatchIndex(raw, -1) {
+		label := b.Plain(raw[m[2]:m[3]])
+		verb := uiVerb(raw[:m[0]])
+		a := &ast.UIAction{ActionBase: base, Interaction: verb, Target: label, Description: plain}
+		a.Type = ast.ActionUI
+		if verb == "input" {
+			if lits := rst.Literals(raw[m[1]:]); len(lits) > 0 {
+				a.Value = lits[0]
+			} else if lits := rst.Literals(raw[:m[0]]); len(lits) > 0 {
+				a.Value = lits[len(lits)-1]
+			}
+		}
+		actions = append(actions, a)
+	}
+
+	for _, l := range rst.Links(raw) {
+		a := &ast.URLAction{ActionBase: base, URL: l.URL, Description: b.Plain(l.Text), ExpectedStatus: 200}
+		a.Type = ast.ActionURL
+		actions = append(actions, a)
+	}
+	if browseRE.MatchString(plain) {
+		for _, u := range bareURLRE.FindAllString(plain, -1) {
+			u = strings.TrimRight(u, ".,;:)")
+			a := &ast.URLAction{ActionBase: base, URL: u, Description: plain, ExpectedStatus: 200}
+			a.Type = ast.ActionURL
+			actions = append(actions, a)
+		}
+	}
+
+	if ideRE.MatchString(plain) && strings.Contains(strings.ToLower(plain), "run") && b.file.current != "" {
+		a := &ast.CodeAction{
+			ActionBase:    base,
+			Language:      languageOfFile(b.file.current),
+			ExecutionMode: ast.ExecutionIDE,
+			FilePath:      b.file.current,
+		}
+		a.Type = ast.ActionCode
+		actions = append(actions, a)
+	}
+
+	if w := b.waitAction(plain, base); w != nil {
+		if prev := b.wait; prev != nil && prev.Poll == nil && prev.Condition == ast.WaitExitCode {
+			// The prose says more about a wait the step title started.
+			prev.Condition, prev.URL, prev.Status, prev.Field, prev.Value = w.Condition, w.URL, w.Status, w.Field, w.Value
+			prev.Poll, prev.Timeout, prev.Description = w.Poll, max(prev.Timeout, w.Timeout), w.Description
+		} else {
+			b.wait = w
+			actions = append(actions, w)
+		}
+	}
+	return actions
+}
+
+var uiRoleRE = regexp.MustCompile(":guilabel:`([^`]+)`")
+
+var uiVerbs = []struct {
+	re   *regexp.Regexp
+	verb string
+}{
+	{regexp.MustCompile(`(?i)\b(click|press|tap)\b`), "click"},
+	{regexp.MustCompile(`(?i)\b(select|choose|check|uncheck|toggle|expand|open|navigate to|go to)\b`), "select"},
+	{regexp.MustCompile(`(?i)\b(enter|type|specify|fill in|input)\b`), "input"},
+}
+
+// uiVerb picks the interaction for a :guilabel: from the last verb that
+// precedes it in the same sentence. Labels without a verb are things the
+// reader should see, so they become verify actions.
+func uiVerb(before string) string {
+	if i := strings.LastIndex(before, ". "); i >= 0 {
+		before = before[i+2:]
+	}
+	verb, at := "verify", -1
+	for _, v := range uiVerbs {
+		locs := v.re.FindAllStringIndex(before, -1)
+		if len(locs) > 0 && locs[len(locs)-1][0] > at {
+			verb, at = v.verb, locs[len(locs)-1][0]
+		}
+	}
+	return verb
+}
+
+// codeActions decides what a code block is: file content, a shell or CLI
+// command, or code to run. Blocks marked :copyable: false are output and
+// produce nothing; blocks captioned with a file name that the prose does
+// not say to write are shown for reference only.
+func (b *builder) codeActions(lang, code, expected string, n *rst.Node, sel ast.Selection) []ast.Action {
+	if strings.EqualFold(n.Options["copyable"], "false") || strings.TrimSpace(code) == "" {
+		return nil
+	}
+	code = b.project.ExpandConstants(code)
+	base := ast.ActionBase{Selection: sel, Location: b.Location(n)}
+	canon := common.GetNormalizedLanguageFromString(lang)
+	unlabeled := canon == common.Undefined || canon == common.Text
+	shell := canon == common.Shell || canon == common.Bash || (unlabeled && runRE.MatchString(b.file.prose))
+
+	if !shell || !runRE.MatchString(b.file.prose) {
+		if fa := b.fileAction(code, lang, n.Options["caption"], base); fa != nil {
+			return []ast.Action{fa}
+		}
+	}
+	if fileRE.MatchString(n.Options["caption"]) {
+		return nil
+	}
+
+	switch {
+	case isMongosh(code, canon):
+		a := &ast.CLIAction{ActionBase: base, Tool: ast.ToolMongosh, Command: code, ExpectedOutput: expected, Placeholders: placeholders(code, common.JavaScript)}
+		a.Type = ast.ActionCLI
+		return b.command(a)
+	case shell:
+		return b.command(shellAction(code, expected, base))
+	case common.IsExecutableLanguage(canon):
+		a := &ast.CodeAction{ActionBase: base, Language: canon, Code: code, ExecutionMode: ast.ExecutionDirect, Placeholders: placeholders(code, canon)}
+		a.Type = ast.ActionCode
+		return []ast.Action{a}
+	}
+	return nil
+}
+
+// fileAction returns a file action when the prose before a code block
+// says to write it to a file.
+func (b *builder) fileAction(code, lang, caption string, base ast.ActionBase) ast.Action {
+	op := fileOperation(b.file.prose)
+	if op == "" {
+		return nil
+	}
+	name := ""
+	switch {
+	case fileRE.MatchString(caption):
+		name = caption
+	case b.file.pending != "":
+		name = b.file.pending
+	default:
+		name = b.file.current
+	}
+	if name == "" {
+		return nil
+	}
+	if b.file.pending != "" && path.Base(b.file.pending) == path.Base(name) {
+		b.file.pending = ""
+		if op == opPaste {
+			op = opCreate
+		}
+	}
+	if op == opPaste {
+		op = opCreate
+		if b.file.known[name] {
+			op = opReplace
+		}
+	}
+	b.file.known[name] = true
+	b.file.current = name
+
+	if lang == "" || common.GetNormalizedLanguageFromString(lang) == common.Undefined {
+		if l := languageOfFile(name); l != common.Undefined {
+			lang = l
+		}
+	}
+	a := &ast.FileAction{ActionBase: base, Operation: op, Path: name, Language: lang, Content: code, Description: b.file.prose,
+		Placeholders: placeholders(code, common.GetNormalizedLanguageFromString(lang))}
+	a.Type = ast.ActionFile
+	return a
+}
+
+// isMongosh reports whether code is a series of mongosh commands rather
+// than a program or a shell script.
+func isMongosh(code, canon string) bool {
+	switch canon {
+	case common.JavaScript, common.Shell, common.Bash, common.Undefined, common.Text:
+	default:
+		return false
+	}
+	if strings.Contains(code, "require(") || strings.Contains(code, "import ") || strings.Contains(code, "MongoClient") {
+		return false
+	}
+	for _, ln := range strings.Split(code, "\n") {
+		ln = strings.TrimSpace(ln)
+		if ln == "" || strings.HasPrefix(ln, "//") {
+			continue
+		}
+		return mongoshRE.MatchString(ln)
+	}
+	return false
+}
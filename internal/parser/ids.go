@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+)
+
+// assignIDs gives the page and everything in it an ID that is the same
+// wherever the page is parsed from and survives edits to other parts of
+// the page: the page's path in the source directory, the headings a
+// procedure is under, and ordinals within a procedure. Only procedures
+// under the same headings are told apart by position.
+func (b *builder) assignIDs(path, sourceDir string) {
+	b.doc.ID = pageID(path, sourceDir)
+	seen := map[string]bool{}
+	for _, proc := range b.doc.Procedures {
+		base := b.doc.ID + "#" + headingSlug(proc.HeadingPath)
+		id := base
+		for n := 2; seen[id]; n++ {
+			id = fmt.Sprintf("%s-%d", base, n)
+		}
+		seen[id] = true
+		proc.ID = id
+		for _, step := range proc.Steps {
+			step.ID = fmt.Sprintf("%s/%d", id, step.Number)
+			actionIDs(step.ID, step.Actions)
+			for _, sub := range step.SubSteps {
+				sub.ID = step.ID + "." + sub.Number
+				actionIDs(sub.ID, sub.Actions)
+			}
+		}
+	}
+}
+
+func actionIDs(parent string, actions []ast.Action) {
+	for i, a := range actions {
+		a.Base().ID = fmt.Sprintf("%s/%d", parent, i+1)
+		if w, ok := a.(*ast.WaitAction); ok && w.Poll != nil {
+			w.Poll.Base().ID = a.Base().ID + "/poll"
+		}
+	}
+}
+
+// pageID is path relative to sourceDir, without its extension. A page
+// outside sourceDir is identified by its file name.
+func pageID(path, sourceDir string) string {
+	abs, err := filepath.Abs(path)
+	if err == nil {
+		if rel, err := filepath.Rel(sourceDir, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		} else {
+			path = filepath.Base(abs)
+		}
+	}
+	path = filepath.ToSlash(path)
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+var nonSlugRE = regexp.MustCompile(`[^a-z0-9]+`)
+
+// headingSlug joins the slugs of a heading path with ".", which slugs do
+// not contain, so that the first "/" after "#" starts the step.
+func headingSlug(path []string) string {
+	var parts []string
+	for _, h := range path {
+		if s := strings.Trim(nonSlugRE.ReplaceAllString(strings.ToLower(h), "-"), "-"); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if len(parts) == 0 {
+		return "procedure"
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/common"
+	"github.com/dacharyc/spike-procedural-testing/internal/rst"
+)
+
+// deprecatedDirectives and deprecatedRoleRE match the directives and
+// roles that rstspec.toml marks as deprecated.
+var (
+	deprecatedDirectives = map[string]bool{
+		"admonition":                  true,
+		"caution":                     true,
+		"container":                   true,
+		"cssclass":                    true,
+		"danger":                      true,
+		"div":                         true,
+		"mongodb:drivers-index-tiles": true,
+		"only":                        true,
+		"role":                        true,
+		"tabs-pillstrip":              true,
+		"tabs-top":                    true,
+		"uriwriter":                   true,
+	}
+	deprecatedRoleRE = regexp.MustCompile(`:(command|v0\.10|v0\.9):` + "`")
+)
+
+// otherLanguages are highlighting languages the docs use that the tooling
+// recognizes but does not run.
+var otherLanguages = []string{
+	"apacheconf", "css", "dart", "diff", "docker", "dockerfile", "graphql",
+	"groovy", "html", "http", "ini", "json5", "makefile", "nginx", "none",
+	"objectivec", "perl", "powershell", "properties", "r", "scss", "sql",
+	"toml",
+}
+
+// lint records the problems in a page's markup that the rules in the
+// lint package describe: deprecated directives and roles, and code
+// languages the tooling does not recognize.
+func (b *builder) lint(nodes []*rst.Node) {
+	rst.Walk(nodes, func(n *rst.Node) bool {
+		if n.Kind == rst.Directive && deprecatedDirectives[n.Name] {
+			b.warn(ast.RuleDeprecatedDirective, fmt.Sprintf("the %s directive is deprecated", n.Name), b.Location(n))
+		}
+		if n.Text != "" {
+			for _, m := range deprecatedRoleRE.FindAllStringSubmatch(n.Text, -1) {
+				b.warn(ast.RuleDeprecatedRole, fmt.Sprintf("the :%s: role is deprecated", m[1]), b.Location(n))
+			}
+		}
+		if n.Kind != rst.Directive {
+			return true
+		}
+		lang := n.Options["language"]
+		if n.Name == "code-block" || n.Name == "code" || n.Name == "sourcecode" {
+			lang = n.Arg
+		}
+		if lang != "" && !knownLanguage(lang) {
+			msg := fmt.Sprintf("unknown language %q; the block is not run as code", lang)
+			if s := closestLanguage(lang); s != "" {
+				msg += fmt.Sprintf(" (did you mean %q?)", s)
+			}
+			b.warn(ast.RuleUnknownLanguage, msg, b.Location(n))
+		}
+		return true
+	})
+}
+
+func knownLanguage(lang string) bool {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	return common.GetNormalizedLanguageFromString(lang) != common.Undefined || slices.Contains(otherLanguages, lang)
+}
+
+// closestLanguage suggests the canonical language a misspelled one was
+// probably meant to be.
+func closestLanguage(lang string) string {
+	lang = strings.ToLower(lang)
+	best, bestDist := "", 3
+	for _, c := range common.CanonicalLanguages {
+		if c == common.Undefined || c == common.Text {
+			continue
+		}
+		if d := editDistance(lang, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
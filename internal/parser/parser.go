@@ -0,0 +1,447 @@
+// Package parser builds the document model from RST pages. It expands
+// includes, finds procedures and their steps, detects testable actions,
+// attaches prerequisites, and enumerates the page's variants.
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/prereq"
+	"github.com/dacharyc/spike-procedural-testing/internal/rst"
+	"github.com/dacharyc/spike-procedural-testing/internal/snooty"
+)
+
+// Parser parses RST pages into documents.
+type Parser struct {
+	// Project is the snooty project the pages belong to. When nil, the
+	// project is looked up for each page.
+	Project *snooty.Project
+}
+
+// New returns a parser for pages in project, which may be nil.
+func New(project *snooty.Project) *Parser {
+	return &Parser{Project: project}
+}
+
+// ParseFile parses the page at path.
+func (p *Parser) ParseFile(path string) (*ast.Document, error) {
+	project := p.Project
+	if project == nil {
+		var err error
+		if project, err = snooty.LoadFor(path); err != nil {
+			return nil, err
+		}
+	}
+	sourceDir := rst.FindSourceDir(path)
+	if project != nil {
+		sourceDir = project.SourceDir
+	}
+
+	loader := rst.NewLoader(sourceDir)
+	lines, err := loader.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	page := rst.Parse(lines)
+
+	b := &builder{
+		project:  project,
+		loader:   loader,
+		subs:     page.Substitutions,
+		tabsets:  map[*rst.Node]string{},
+		doc:      &ast.Document{File: relPath(path)},
+		procSeq:  map[*ast.Procedure]int{},
+		variants: &variantSet{},
+	}
+	b.indexTabs(page.Nodes)
+	b.tags(page.Nodes)
+	b.lint(page.Nodes)
+	b.walk(page.Nodes, nil)
+	b.finish()
+	b.assignIDs(path, sourceDir)
+	return b.doc, nil
+}
+
+// builder carries the state of one ParseFile call.
+type builder struct {
+	project *snooty.Project
+	loader  *rst.Loader
+	subs    map[string]string
+	doc     *ast.Document
+
+	// headings is the stack of enclosing section titles.
+	headings []heading
+	// composable holds the option IDs of the enclosing
+	// composable-tutorial, in the order selected-content lists values.
+	composable []string
+	// tabsets maps each tab directive to the variant dimension of its
+	// tab set.
+	tabsets map[*rst.Node]string
+
+	// seq orders procedures and prerequisite scopes by page position.
+	seq     int
+	procSeq map[*ast.Procedure]int
+	scopes  []prereqScope
+
+	variants *variantSet
+	file     fileState
+	// wait is the last wait the current step describes, and lastCommand
+	// the last command it shows; see command.
+	wait        *ast.WaitAction
+	lastCommand ast.Action
+}
+
+type heading struct {
+	level int
+	title string
+}
+
+// prereqScope is a requirements section together with the part of the
+// page it applies to: later procedures under the same parent headings.
+type prereqScope struct {
+	path []string
+	sel  ast.Selection
+	seq  int
+	node *ast.Prerequisites
+}
+
+func (b *builder) walk(nodes []*rst.Node, sel ast.Selection) {
+	skipList := -1
+	for i, n := range nodes {
+		switch n.Kind {
+		case rst.Heading:
+			title := b.Plain(n.Arg)
+			for len(b.headings) > 0 && b.headings[len(b.headings)-1].level >= n.Level {
+				b.headings = b.headings[:len(b.headings)-1]
+			}
+			parent := b.headingPath()
+			b.headings = append(b.headings, heading{level: n.Level, title: title})
+			if b.doc.Title == "" {
+				b.doc.Title = title
+			}
+			if prereq.IsHeading(title) {
+				b.addScope(title, sectionBody(nodes[i+1:], n.Level), parent, sel, n)
+			}
+		case rst.Paragraph:
+			if i+1 < len(nodes) && nodes[i+1].Kind == rst.List && prereq.IsLeadIn(b.Plain(n.Text)) {
+				b.addScope(b.Plain(n.Text), nodes[i+1:i+2], b.headingPath(), sel, n)
+				skipList = i + 1
+			}
+		case rst.List:
+			if n.Ordered && i != skipList {
+				b.listProcedure(n, sel)
+			}
+		case rst.Directive:
+			b.directive(n, sel)
+		case rst.Quote:
+			b.walk(n.Children, sel)
+		}
+	}
+}
+
+// docSkip lists directives whose content never holds procedures.
+var docSkip = map[string]bool{
+	"meta": true, "facet": true, "contents": true, "toctree": true,
+	"code-block": true, "code": true, "sourcecode": true, "literalinclude": true,
+	"io-code-block": true, "image": true, "figure": true, "default-domain": true,
+}
+
+// tags records the page's meta keywords and facet values, which reports
+// use to group and filter pages.
+func (b *builder) tags(nodes []*rst.Node) {
+	rst.Walk(nodes, func(n *rst.Node) bool {
+		var values []string
+		switch {
+		case n.Kind != rst.Directive:
+			return true
+		case n.Name == "meta":
+			values = splitList(n.Options["keywords"])
+		case n.Name == "facet":
+			values = splitList(n.Options["values"])
+		}
+		for _, v := range values {
+			if v != "" && !slices.Contains(b.doc.Tags, v) {
+				b.doc.Tags = append(b.doc.Tags, v)
+			}
+		}
+		return true
+	})
+}
+
+func (b *builder) directive(n *rst.Node, sel ast.Selection) {
+	switch {
+	case n.Name == "procedure":
+		b.procedure(n, sel)
+	case n.Name == "composable-tutorial":
+		saved := b.composable
+		b.composable = splitList(n.Options["options"])
+		b.walk(n.Children, sel)
+		b.composable = saved
+	case n.Name == "selected-content":
+		b.walk(n.Children, b.selectedContent(n, sel))
+	case isTabs(n.Name):
+		for _, tab := range n.Children {
+			if tsel, ok := b.Select(tab, sel); ok {
+				b.walk(tab.Children, tsel)
+			}
+		}
+	case docSkip[n.Name]:
+	default:
+		b.walk(n.Children, sel)
+	}
+}
+
+// sectionBody returns the nodes up to the next heading at or above level.
+func sectionBody(nodes []*rst.Node, level int) []*rst.Node {
+	for i, n := range nodes {
+		if n.Kind == rst.Heading && n.Level <= level {
+			return nodes[:i]
+		}
+		// Sections written inside selected-content or tabs end the
+		// section at this level too, even though rst nests them.
+		if n.Kind == rst.Directive && containsHeading(n.Children, level) {
+			return nodes[:i]
+		}
+	}
+	return nodes
+}
+
+func containsHeading(nodes []*rst.Node, level int) bool {
+	found := false
+	rst.Walk(nodes, func(n *rst.Node) bool {
+		if n.Kind == rst.Heading && n.Level <= level {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func (b *builder) headingPath() []string {
+	path := make([]string, len(b.headings))
+	for i, h := range b.headings {
+		path[i] = h.title
+	}
+	return path
+}
+
+// currentTitle is the title a procedure gets: its nearest heading, or the
+// page title.
+func (b *builder) currentTitle() string {
+	if len(b.headings) > 0 {
+		return b.headings[len(b.headings)-1].title
+	}
+	return b.doc.Title
+}
+
+func (b *builder) addScope(title string, body []*rst.Node, path []string, sel ast.Selection, at *rst.Node) {
+	node := prereq.Detect(title, prereq.Collect(body, b, sel), b.Location(at))
+	if node == nil {
+		return
+	}
+	b.seq++
+	b.scopes = append(b.scopes, prereqScope{path: path, sel: sel, seq: b.seq, node: node})
+}
+
+// finish attaches prerequisite scopes to the procedures they precede,
+// enumerates variants, and records loader warnings.
+func (b *builder) finish() {
+	for _, proc := range b.doc.Procedures {
+		for _, s := range b.scopes {
+			if s.seq < b.procSeq[proc] && hasPrefix(proc.HeadingPath, s.path) && compatible(s.sel, proc.Selection) {
+				proc.Prerequisites = prereq.Merge(proc.Prerequisites, s.node)
+			}
+		}
+	}
+	b.doc.Variants = b.variants.enumerate(b.project)
+	for _, proc := range b.doc.Procedures {
+		proc.Variants = b.variants.forProcedure(proc, b.doc.Variants, b.project)
+	}
+	for _, w := range b.loader.Warnings {
+		b.warn(ast.RuleInclude, w.Message, originLocation(w.Origin, nil))
+	}
+}
+
+// warn records a warning once per message and source line; a missing
+// include that several pages pull in is reported a single time.
+func (b *builder) warn(rule, msg string, loc ast.SourceLocation) {
+	for _, w := range b.doc.Warnings {
+		if w.Message == msg && w.Location.File == loc.File && w.Location.StartLine == loc.StartLine {
+			return
+		}
+	}
+	b.doc.Warnings = append(b.doc.Warnings, ast.Warning{Rule: rule, Message: msg, Location: loc})
+}
+
+func hasPrefix(path, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// compatible reports whether two selections can hold in the same variant.
+func compatible(a, b ast.Selection) bool {
+	for k, v := range a {
+		if bv, ok := b[k]; ok && bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Plain renders inline markup as plain text with the page's
+// substitutions and the project's constants applied.
+func (b *builder) Plain(raw string) string {
+	return rst.Plain(b.project.ExpandConstants(raw), b.substitution)
+}
+
+func (b *builder) substitution(name string) (string, bool) {
+	if v, ok := b.subs[name]; ok {
+		return b.project.ExpandConstants(v), true
+	}
+	if b.project != nil {
+		if v, ok := b.project.Substitutions[name]; ok {
+			return b.project.ExpandConstants(v), true
+		}
+	}
+	return "", false
+}
+
+// Location returns the source location of a node.
+func (b *builder) Location(n *rst.Node) ast.SourceLocation {
+	if n == nil || n.Start == nil {
+		return ast.SourceLocation{File: b.doc.File}
+	}
+	return originLocation(n.Start, n.End)
+}
+
+func originLocation(start, end *rst.Origin) ast.SourceLocation {
+	if start == nil {
+		return ast.SourceLocation{}
+	}
+	loc := ast.SourceLocation{File: relPath(start.File), StartLine: start.Line, EndLine: start.Line}
+	if end != nil && end.Line > start.Line {
+		loc.EndLine = end.Line
+	}
+	if start.Parent != nil {
+		parent := originLocation(start.Parent, nil)
+		loc.IncludedFrom = &parent
+	}
+	return loc
+}
+
+// Select returns the selection inside a selected-content or tab
+// directive.
+func (b *builder) Select(n *rst.Node, sel ast.Selection) (ast.Selection, bool) {
+	switch {
+	case n.Kind != rst.Directive:
+		return nil, false
+	case n.Name == "selected-content":
+		return b.selectedContent(n, sel), true
+	case n.Name == "tab":
+		key, ok := b.tabsets[n]
+		if !ok {
+			return nil, false
+		}
+		id := tabID(n)
+		b.variants.addTab(key, id, b.Plain(n.Arg), sel)
+		return sel.With(key, id), true
+	}
+	return nil, false
+}
+
+// selectedContent narrows sel by the values of a selected-content
+// directive. "None" means the content applies whatever that option is.
+func (b *builder) selectedContent(n *rst.Node, sel ast.Selection) ast.Selection {
+	out := sel.Merge(nil)
+	values := splitList(n.Options["selections"])
+	for i, v := range values {
+		if i >= len(b.composable) || v == "" || strings.EqualFold(v, "None") {
+			continue
+		}
+		out[b.composable[i]] = v
+	}
+	b.variants.addComposable(b.composable, out)
+	return out
+}
+
+// indexTabs assigns a variant dimension to every tab directive. Named tab
+// sets ("tabs-drivers" or :tabset:) share a dimension across the page so
+// that they switch together. Unnamed sets that offer the same tabs also
+// share one, keyed by their tab IDs, so repeated "Visual Editor / JSON
+// Editor" choices do not multiply the variants.
+func (b *builder) indexTabs(nodes []*rst.Node) {
+	rst.Walk(nodes, func(n *rst.Node) bool {
+		if n.Kind != rst.Directive || !isTabs(n.Name) {
+			return true
+		}
+		var tabs []*rst.Node
+		var ids []string
+		for _, c := range n.Children {
+			if c.Kind == rst.Directive && c.Name == "tab" {
+				tabs = append(tabs, c)
+				ids = append(ids, tabID(c))
+			}
+		}
+		key := n.Name
+		if ts := n.Options["tabset"]; ts != "" {
+			key = "tabs-" + ts
+		} else if n.Name == "tabs" {
+			key = "tabs-" + strings.Join(ids, "-")
+		}
+		for _, t := range tabs {
+			b.tabsets[t] = key
+		}
+		return true
+	})
+}
+
+func isTabs(name string) bool {
+	return name == "tabs" || (strings.HasPrefix(name, "tabs-") && name != "tabs-selector")
+}
+
+func tabID(n *rst.Node) string {
+	if id := n.Options["tabid"]; id != "" {
+		return id
+	}
+	return strings.ToLower(strings.Join(strings.Fields(n.Arg), "-"))
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		out = append(out, strings.TrimSpace(part))
+	}
+	if len(out) == 1 && out[0] == "" {
+		return nil
+	}
+	return out
+}
+
+// relPath shortens a path to be relative to the working directory when
+// the file is inside it.
+func relPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return abs
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+)
+
+const requirementsPage = `=======
+Connect
+=======
+
+Overview
+--------
+
+.. procedure::
+
+   .. step:: Check the shell
+
+      .. code-block:: sh
+
+         echo ready
+
+Prerequisites
+-------------
+
+- Node.js 18 or later
+- An Atlas cluster. To learn how to create one, see the Atlas documentation.
+- Set the ` + "``MONGODB_URI``" + ` environment variable to your connection string.
+
+Install
+-------
+
+.. procedure::
+
+   .. step:: Install the driver
+
+      .. code-block:: sh
+
+         npm install mongodb
+
+Run
+---
+
+Before you begin, you must have:
+
+- Python 3.9+
+
+.. procedure::
+
+   .. step:: Run the app
+
+      .. code-block:: sh
+
+         node app.js
+
+Clean Up
+--------
+
+.. procedure::
+
+   .. step:: Remove the driver
+
+      .. code-block:: sh
+
+         npm uninstall mongodb
+`
+
+// requirements lists a procedure's requirements as kind, subject and
+// version.
+func requirements(proc *ast.Procedure) []string {
+	var out []string
+	if proc.Prerequisites == nil {
+		return out
+	}
+	for _, r := range proc.Prerequisites.Requirements {
+		s := fmt.Sprintf("%s %s", r.Kind(), r.Subject())
+		if sw, ok := r.(*ast.SoftwareRequirement); ok && sw.Version != "" {
+			s += " " + sw.Version
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestParseFileDetectsRequirementSections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "connect.txt")
+	if err := os.WriteFile(path, []byte(requirementsPage), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := New(nil).ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	section := []string{"software Node.js >=18", "service MongoDB Atlas cluster", "environment MONGODB_URI"}
+	want := map[string][]string{
+		// A requirements section only applies to the procedures after it.
+		"Overview": nil,
+		"Install":  section,
+		// A lead-in paragraph adds its list to the section it is in.
+		"Run":      append(section[:len(section):len(section)], "software Python >=3.9"),
+		"Clean Up": section,
+	}
+	if len(doc.Procedures) != len(want) {
+		t.Fatalf("found %d procedures, want %d", len(doc.Procedures), len(want))
+	}
+	for _, proc := range doc.Procedures {
+		got := requirements(proc)
+		if fmt.Sprint(got) != fmt.Sprint(want[proc.Title]) {
+			t.Errorf("%s: requirements = %q, want %q", proc.Title, got, want[proc.Title])
+		}
+	}
+
+	install := doc.Procedures[1].Prerequisites
+	if install.Title != "Prerequisites" || install.Location.StartLine != 16 {
+		t.Errorf("Install: prerequisites %q at line %d, want Prerequisites at line 16", install.Title, install.Location.StartLine)
+	}
+	if r := install.Requirements[0].Base(); r.Source != "Node.js 18 or later" || r.Location.StartLine != 19 || r.Rule == "" {
+		t.Errorf("Node.js requirement: source %q at line %d, rule %q", r.Source, r.Location.StartLine, r.Rule)
+	}
+}
@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"regexp"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/common"
+)
+
+var (
+	// anglePlaceholderRE matches <name> and <name with spaces>. The name
+	// must not follow a word character, which rules out generics such as
+	// List<String>.
+	anglePlaceholderRE = regexp.MustCompile(`(?:^|[^\w<])<([A-Za-z][\w .:/-]*?)>`)
+	// anglePlaceholderSkipRE matches syntax that uses angle brackets for
+	// something other than placeholders.
+	anglePlaceholderSkipRE = regexp.MustCompile(`#include\s*$|template\s*$`)
+	constantPlaceholderRE  = regexp.MustCompile(`\{\+([\w.-]+)\+\}`)
+	bracePlaceholderRE     = regexp.MustCompile(`\{([A-Za-z][\w-]*)\}`)
+	envPlaceholderRE       = regexp.MustCompile(`\$\{?([A-Z][A-Z0-9_]+)\}?`)
+)
+
+// markupLanguages use angle brackets as syntax, so <...> is never a
+// placeholder in them.
+var markupLanguages = map[string]bool{
+	common.XML: true, "html": true, "twig": true,
+}
+
+// placeholders lists the values a reader must fill in before running
+// code: <connection-string>, unresolved {+constants+}, and for shell
+// commands {groupId}-style path parameters and $VARIABLES.
+func placeholders(code, lang string) []string {
+	var out []string
+	seen := map[string]bool{}
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	if !markupLanguages[lang] {
+		for _, m := range anglePlaceholderRE.FindAllStringSubmatchIndex(code, -1) {
+			if anglePlaceholderSkipRE.MatchString(code[:m[2]-1]) {
+				continue
+			}
+			add("<" + code[m[2]:m[3]] + ">")
+		}
+	}
+	for _, m := range constantPlaceholderRE.FindAllString(code, -1) {
+		add(m)
+	}
+	if lang == common.Shell || lang == common.Bash {
+		for _, m := range bracePlaceholderRE.FindAllString(code, -1) {
+			add(m)
+		}
+		for _, m := range envPlaceholderRE.FindAllStringSubmatch(code, -1) {
+			add("$" + m[1])
+		}
+	}
+	return out
+}
@@ -0,0 +1,285 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/prereq"
+	"github.com/dacharyc/spike-procedural-testing/internal/rst"
+)
+
+// procedure builds a procedure from a procedure directive.
+func (b *builder) procedure(n *rst.Node, sel ast.Selection) {
+	proc := b.newProcedure(n, sel)
+	proc.Style = n.Options["style"]
+	b.steps(proc, n.Children, sel)
+	if len(proc.Steps) == 0 {
+		return
+	}
+	linkWaits(proc)
+	b.addProcedure(proc)
+}
+
+// listProcedure builds a procedure from an ordered list outside any
+// procedure directive. Lists without testable actions are ordinary prose
+// and are dropped.
+func (b *builder) listProcedure(n *rst.Node, sel ast.Selection) {
+	proc := b.newProcedure(n, sel)
+	for i, item := range n.Children {
+		step := &ast.Step{Number: i + 1, Title: firstSentence(b.Plain(item.Text)), Selection: sel, Location: b.Location(item)}
+		b.file.prose = step.Title
+		b.wait, b.lastCommand = nil, nil
+		b.content(item.Children, sel, &step.Actions, &step.SubSteps)
+		b.file.flush(&step.Actions, sel, b.Location(item))
+		proc.Steps = append(proc.Steps, step)
+	}
+	if countActions(proc) == 0 {
+		return
+	}
+	linkWaits(proc)
+	b.addProcedure(proc)
+}
+
+func (b *builder) newProcedure(n *rst.Node, sel ast.Selection) *ast.Procedure {
+	b.file = fileState{known: map[string]bool{}}
+	return &ast.Procedure{
+		Title:       b.currentTitle(),
+		HeadingPath: b.headingPath(),
+		Selection:   sel,
+		Location:    b.Location(n),
+	}
+}
+
+func (b *builder) addProcedure(proc *ast.Procedure) {
+	b.seq++
+	b.procSeq[proc] = b.seq
+	b.doc.Procedures = append(b.doc.Procedures, proc)
+}
+
+// steps adds the step directives in nodes to proc. Steps can sit inside
+// selected-content or tab directives when only some variants have them.
+func (b *builder) steps(proc *ast.Procedure, nodes []*rst.Node, sel ast.Selection) {
+	for _, c := range nodes {
+		if c.Kind != rst.Directive {
+			continue
+		}
+		if c.Name == "step" {
+			proc.Steps = append(proc.Steps, b.step(proc, c, len(proc.Steps)+1, sel))
+			continue
+		}
+		if nsel, ok := b.Select(c, sel); ok {
+			b.steps(proc, c.Children, nsel)
+			continue
+		}
+		if isTabs(c.Name) {
+			for _, tab := range c.Children {
+				if tsel, ok := b.Select(tab, sel); ok {
+					b.steps(proc, tab.Children, tsel)
+				}
+			}
+		}
+	}
+}
+
+// step builds one step. A step titled like a requirements section
+// ("Prerequisites") contributes its content to the procedure's
+// prerequisites; it stays in the step list so numbering matches the page.
+func (b *builder) step(proc *ast.Procedure, n *rst.Node, number int, sel ast.Selection) *ast.Step {
+	step := &ast.Step{Number: number, Title: b.Plain(n.Arg), Selection: sel, Location: b.Location(n)}
+	if prereq.IsHeading(step.Title) {
+		node := prereq.Detect(step.Title, prereq.Collect(n.Children, b, sel), b.Location(n))
+		proc.Prerequisites = prereq.Merge(proc.Prerequisites, node)
+		return step
+	}
+	b.file.prose = step.Title
+	b.wait, b.lastCommand = nil, nil
+	// A step titled "Wait for the index to be ready" is a wait for the
+	// command its body shows.
+	if w := b.waitAction(step.Title, ast.ActionBase{Selection: sel, Location: step.Location}); w != nil {
+		b.wait = w
+		step.Actions = append(step.Actions, w)
+	}
+	b.content(n.Children, sel, &step.Actions, &step.SubSteps)
+	b.file.flush(&step.Actions, sel, step.Location)
+	return step
+}
+
+// admonitions hold asides such as example output or optional tips; code
+// inside them is not part of the procedure.
+var admonitions = map[string]bool{
+	"note": true, "tip": true, "important": true, "warning": true,
+	"caution": true, "seealso": true, "see": true, "example": true,
+	"admonition": true, "figure": true, "image": true,
+}
+
+// content collects the actions and sub-steps in the body of a step or
+// sub-step. subs is nil when sub-steps cannot nest any deeper, in which
+// case ordered lists contribute their actions to the enclosing step.
+func (b *builder) content(nodes []*rst.Node, sel ast.Selection, actions *[]ast.Action, subs *[]*ast.SubStep) {
+	for _, n := range nodes {
+		switch n.Kind {
+		case rst.Paragraph:
+			if fileOperation(b.Plain(n.Text)) == "" {
+				b.file.flush(actions, sel, b.Location(n))
+			}
+			*actions = append(*actions, b.proseActions(n, sel)...)
+		case rst.Heading:
+			b.file.flush(actions, sel, b.Location(n))
+			b.file.prose = b.Plain(n.Arg)
+		case rst.List:
+			if n.Ordered && subs != nil {
+				b.subSteps(n, sel, subs)
+				continue
+			}
+			for _, item := range n.Children {
+				b.content(item.Children, sel, actions, nil)
+			}
+		case rst.Quote:
+			b.content(n.Children, sel, actions, subs)
+		case rst.Directive:
+			b.contentDirective(n, sel, actions, subs)
+		}
+	}
+}
+
+func (b *builder) contentDirective(n *rst.Node, sel ast.Selection, actions *[]ast.Action, subs *[]*ast.SubStep) {
+	switch {
+	case admonitions[n.Name]:
+	case n.Name == "code-block" || n.Name == "code" || n.Name == "sourcecode":
+		*actions = append(*actions, b.codeActions(n.Arg, n.BodyText(), "", n, sel)...)
+	case n.Name == "literalinclude":
+		text, path, err := b.loader.ReadLiteral(n.Arg, n.Start.File, n.Options)
+		if err != nil {
+			b.warn(ast.RuleInclude, err.Error(), b.Location(n))
+			return
+		}
+		lang := n.Options["language"]
+		if lang == "" {
+			lang = languageOfFile(path)
+		}
+		*actions = append(*actions, b.codeActions(lang, text, "", n, sel)...)
+	case n.Name == "io-code-block":
+		*actions = append(*actions, b.ioCodeBlock(n, sel)...)
+	case n.Name == "procedure" && subs != nil:
+		for i, c := range n.Children {
+			if c.Kind != rst.Directive || c.Name != "step" {
+				continue
+			}
+			sub := &ast.SubStep{Number: strconv.Itoa(i + 1), Title: b.Plain(c.Arg), Selection: sel, Location: b.Location(c)}
+			b.file.prose = sub.Title
+			b.content(c.Children, sel, &sub.Actions, nil)
+			b.file.flush(&sub.Actions, sel, sub.Location)
+			*subs = append(*subs, sub)
+		}
+	case isTabs(n.Name):
+		for _, tab := range n.Children {
+			if tsel, ok := b.Select(tab, sel); ok {
+				b.content(tab.Children, tsel, actions, subs)
+			}
+		}
+	default:
+		if nsel, ok := b.Select(n, sel); ok {
+			sel = nsel
+		}
+		b.content(n.Children, sel, actions, subs)
+	}
+}
+
+// ioCodeBlock turns an io-code-block into an action whose expected output
+// is the block's output directive.
+func (b *builder) ioCodeBlock(n *rst.Node, sel ast.Selection) []ast.Action {
+	var input, output *rst.Node
+	for _, c := range n.Children {
+		if c.Kind != rst.Directive {
+			continue
+		}
+		switch c.Name {
+		case "input":
+			input = c
+		case "output":
+			output = c
+		}
+	}
+	if input == nil {
+		return nil
+	}
+	code, lang := input.BodyText(), input.Options["language"]
+	if input.Arg != "" && strings.TrimSpace(code) == "" {
+		text, path, err := b.loader.ReadLiteral(input.Arg, input.Start.File, input.Options)
+		if err != nil {
+			b.warn(ast.RuleInclude, err.Error(), b.Location(input))
+			return nil
+		}
+		code = text
+		if lang == "" {
+			lang = languageOfFile(path)
+		}
+	}
+	expected := ""
+	if output != nil {
+		expected = output.BodyText()
+		if output.Arg != "" && strings.TrimSpace(expected) == "" {
+			if text, _, err := b.loader.ReadLiteral(output.Arg, output.Start.File, output.Options); err == nil {
+				expected = text
+			}
+		}
+	}
+	return b.codeActions(lang, code, expected, input, sel)
+}
+
+// subSteps turns an ordered list into sub-steps. RST auto-enumerators
+// ("#.") continue the sequence the first item starts, so "a." followed by
+// "#." numbers the items a, b, c.
+func (b *builder) subSteps(n *rst.Node, sel ast.Selection, subs *[]*ast.SubStep) {
+	first := ""
+	if len(n.Children) > 0 {
+		first = n.Children[0].Marker
+	}
+	for i, item := range n.Children {
+		number := enumerate(first, i)
+		if item.Marker != "#" {
+			number = item.Marker
+		}
+		sub := &ast.SubStep{Number: number, Title: firstSentence(b.Plain(item.Text)), Selection: sel, Location: b.Location(item)}
+		b.content(item.Children, sel, &sub.Actions, nil)
+		b.file.flush(&sub.Actions, sel, sub.Location)
+		*subs = append(*subs, sub)
+	}
+}
+
+// enumerate returns the i-th enumerator of a list whose first item uses
+// marker first.
+func enumerate(first string, i int) string {
+	switch {
+	case len(first) == 1 && first[0] >= 'a' && first[0] <= 'z':
+		return string(rune(first[0] + byte(i)))
+	case len(first) == 1 && first[0] >= 'A' && first[0] <= 'Z':
+		return string(rune(first[0] + byte(i)))
+	}
+	start, err := strconv.Atoi(first)
+	if err != nil {
+		start = 1
+	}
+	return strconv.Itoa(start + i)
+}
+
+// firstSentence shortens item text to its first sentence for use as a
+// title.
+func firstSentence(text string) string {
+	if i := strings.Index(text, ". "); i >= 0 {
+		text = text[:i+1]
+	}
+	return strings.TrimSuffix(strings.TrimSpace(text), ":")
+}
+
+func countActions(proc *ast.Procedure) int {
+	n := 0
+	for _, s := range proc.Steps {
+		n += len(s.Actions)
+		for _, ss := range s.SubSteps {
+			n += len(ss.Actions)
+		}
+	}
+	return n
+}
@@ -0,0 +1,238 @@
+package parser
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/common"
+)
+
+// atlasAdminAPI is the base of Atlas Administration API endpoints. curl
+// commands against it become API actions.
+const atlasAdminAPI = "cloud.mongodb.com/api/atlas/"
+
+var promptRE = regexp.MustCompile(`^\s*\$ `)
+
+// shellAction classifies a shell block. Single commands get a closer
+// look: "atlas ..." is an Atlas CLI action, and curl is an API call or a
+// download depending on its target and flags.
+func shellAction(code, expected string, base ast.ActionBase) ast.Action {
+	cmd := stripPrompts(code)
+	ph := placeholders(cmd, common.Shell)
+	if single := singleCommand(cmd); single != "" {
+		args := SplitArgs(single)
+		if len(args) > 0 {
+			switch args[0] {
+			case "atlas":
+				a := &ast.CLIAction{ActionBase: base, Tool: ast.ToolAtlasCLI, Command: cmd, ExpectedOutput: expected, Placeholders: ph}
+				a.Type = ast.ActionCLI
+				return a
+			case "curl":
+				if a := curlAction(args, cmd, base, ph); a != nil {
+					return a
+				}
+			}
+		}
+	}
+	a := &ast.ShellAction{ActionBase: base, Command: cmd, ExpectedOutput: expected, Placeholders: ph}
+	a.Type = ast.ActionShell
+	return a
+}
+
+// stripPrompts removes "$ " prompts. When a block uses prompts, lines
+// without one (and that do not continue a prompted line) are output and
+// are dropped.
+func stripPrompts(code string) string {
+	lines := strings.Split(code, "\n")
+	prompted := false
+	for _, ln := range lines {
+		if promptRE.MatchString(ln) {
+			prompted = true
+			break
+		}
+	}
+	if !prompted {
+		return code
+	}
+	var out []string
+	continued := false
+	for _, ln := range lines {
+		switch {
+		case promptRE.MatchString(ln):
+			ln = promptRE.ReplaceAllString(ln, "")
+		case !continued:
+			continue
+		}
+		out = append(out, ln)
+		continued = strings.HasSuffix(strings.TrimRight(ln, " "), "\\")
+	}
+	return strings.Join(out, "\n")
+}
+
+// singleCommand joins backslash continuations and returns the command
+// when the block holds exactly one simple command, or "" otherwise.
+func singleCommand(code string) string {
+	var cmds []string
+	cur := ""
+	for _, ln := range strings.Split(code, "\n") {
+		t := strings.TrimSpace(ln)
+		if cur == "" && (t == "" || strings.HasPrefix(t, "#")) {
+			continue
+		}
+		if strings.HasSuffix(t, "\\") {
+			cur += strings.TrimSuffix(t, "\\") + " "
+			continue
+		}
+		cmds = append(cmds, cur+t)
+		cur = ""
+	}
+	if cur != "" {
+		cmds = append(cmds, cur)
+	}
+	if len(cmds) != 1 {
+		return ""
+	}
+	for _, op := range []string{"&&", "||", ";", "|"} {
+		if strings.Contains(cmds[0], op) && !quotedOnly(cmds[0], op) {
+			return ""
+		}
+	}
+	return cmds[0]
+}
+
+// quotedOnly reports whether every occurrence of op in s is inside quotes.
+func quotedOnly(s, op string) bool {
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case strings.HasPrefix(s[i:], op):
+			return false
+		}
+	}
+	return true
+}
+
+// SplitArgs splits a command line into words the way a POSIX shell does
+// for simple quoting and backslash escapes.
+func SplitArgs(s string) []string {
+	var args []string
+	var cur strings.Builder
+	var quote rune
+	inWord := false
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' {
+				escaped = true
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, cur.String())
+	}
+	return args
+}
+
+// curlValueFlags are the curl options that take a value.
+var curlValueFlags = map[string]bool{
+	"-X": true, "--request": true, "-H": true, "--header": true,
+	"-d": true, "--data": true, "--data-raw": true, "--data-binary": true, "--data-urlencode": true,
+	"-o": true, "--output": true, "-u": true, "--user": true, "-w": true, "--write-out": true,
+	"-F": true, "--form": true, "--url": true, "-A": true, "--user-agent": true,
+	"-e": true, "--referer": true, "-m": true, "--max-time": true, "--connect-timeout": true,
+	"-T": true, "--upload-file": true,
+}
+
+// curlAction turns a curl command into an API or download action. It
+// returns nil for curl commands that are neither.
+func curlAction(args []string, cmd string, base ast.ActionBase, ph []string) ast.Action {
+	var method, url, body, output string
+	remoteName := false
+	headers := map[string]string{}
+	for i := 1; i < len(args); i++ {
+		a := args[i]
+		val := ""
+		if curlValueFlags[a] && i+1 < len(args) {
+			i++
+			val = args[i]
+		} else if strings.HasPrefix(a, "--") && strings.Contains(a, "=") {
+			a, val = a[:strings.Index(a, "=")], a[strings.Index(a, "=")+1:]
+		}
+		switch a {
+		case "-X", "--request":
+			method = strings.ToUpper(val)
+		case "-H", "--header":
+			if k, v, ok := strings.Cut(val, ":"); ok {
+				headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			}
+		case "-d", "--data", "--data-raw", "--data-binary", "--data-urlencode":
+			body = val
+		case "-o", "--output":
+			output = val
+		case "-O", "--remote-name":
+			remoteName = true
+		case "--url":
+			url = val
+		default:
+			if !strings.HasPrefix(a, "-") && url == "" && val == "" {
+				url = a
+			}
+		}
+	}
+	if url == "" {
+		return nil
+	}
+	if method == "" {
+		method = "GET"
+		if body != "" {
+			method = "POST"
+		}
+	}
+	if len(headers) == 0 {
+		headers = nil
+	}
+
+	if output != "" || remoteName {
+		if output == "" {
+			output = path.Base(strings.SplitN(url, "?", 2)[0])
+		}
+		a := &ast.DownloadAction{ActionBase: base, URL: url, OutputPath: output, Method: method, Headers: headers, Command: cmd, Placeholders: ph}
+		a.Type = ast.ActionDownload
+		return a
+	}
+	if strings.Contains(url, atlasAdminAPI) {
+		a := &ast.APIAction{ActionBase: base, Method: method, Endpoint: url, Headers: headers, Body: body, Command: cmd, Placeholders: ph}
+		a.Type = ast.ActionAPI
+		return a
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package parser
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/snooty"
+)
+
+// variantSet records the selected-content and tab selections seen on a
+// page so the page's variants can be enumerated once parsing is done.
+type variantSet struct {
+	dims        []string
+	composables []ast.Selection
+	tabs        []tabUse
+}
+
+// tabUse is one tab of a tab set together with the composable selection
+// it appears under.
+type tabUse struct {
+	key, id, title string
+	within         ast.Selection
+}
+
+func (v *variantSet) addComposable(dims []string, sel ast.Selection) {
+	if len(dims) == 0 {
+		return
+	}
+	if v.dims == nil {
+		v.dims = dims
+	}
+	only := ast.Selection{}
+	for _, d := range dims {
+		if val, ok := sel[d]; ok {
+			only[d] = val
+		}
+	}
+	if len(only) == 0 {
+		return
+	}
+	for _, s := range v.composables {
+		if s.String() == only.String() {
+			return
+		}
+	}
+	v.composables = append(v.composables, only)
+}
+
+func (v *variantSet) addTab(key, id, title string, within ast.Selection) {
+	for _, t := range v.tabs {
+		if t.key == key && t.id == id && t.within.String() == within.String() {
+			return
+		}
+	}
+	if title == "" {
+		title = id
+	}
+	v.tabs = append(v.tabs, tabUse{key: key, id: id, title: title, within: within})
+}
+
+// enumerate returns the page's variants. Each distinct selected-content
+// selection is a candidate; selections that are strict subsets of another
+// are dropped, because a reader always picks a value for every option.
+// Tab sets that appear under a selection multiply it by their tabs.
+func (v *variantSet) enumerate(project *snooty.Project) []ast.Variant {
+	if len(v.composables) == 0 && len(v.tabs) == 0 {
+		return nil
+	}
+	bases := []ast.Selection{{}}
+	if len(v.composables) > 0 {
+		bases = nil
+		for _, s := range v.composables {
+			if !v.subsumed(s) {
+				bases = append(bases, s)
+			}
+		}
+	}
+
+	var variants []ast.Variant
+	for _, base := range bases {
+		combos := []ast.Selection{base}
+		for _, key := range v.tabKeys(base) {
+			var next []ast.Selection
+			for _, c := range combos {
+				for _, t := range v.tabs {
+					if t.key == key && v.composableOnly(t.within).Matches(base) {
+						next = append(next, c.With(key, t.id))
+					}
+				}
+			}
+			combos = next
+		}
+		for _, c := range combos {
+			variants = append(variants, v.variant(c, project))
+		}
+	}
+	return variants
+}
+
+// forProcedure narrows the page variants to the ones that change proc.
+// Each page variant the procedure belongs to is reduced to the dimensions
+// the procedure's steps, actions and requirements select on, and variants
+// that reduce to the same selection run once.
+func (v *variantSet) forProcedure(proc *ast.Procedure, page []ast.Variant, project *snooty.Project) []ast.Variant {
+	keys := selectionKeys(proc)
+	if len(keys) == 0 {
+		return nil
+	}
+	var out []ast.Variant
+	seen := map[string]bool{}
+	for _, pv := range page {
+		if !proc.Selection.Matches(pv.Selection) {
+			continue
+		}
+		sel := ast.Selection{}
+		for k := range keys {
+			if val, ok := pv.Selection[k]; ok {
+				sel[k] = val
+			}
+		}
+		if seen[sel.String()] {
+			continue
+		}
+		seen[sel.String()] = true
+		out = append(out, v.variant(sel, project))
+	}
+	return out
+}
+
+// selectionKeys collects the dimensions anything in proc selects on.
+func selectionKeys(proc *ast.Procedure) map[string]bool {
+	keys := map[string]bool{}
+	add := func(sel ast.Selection) {
+		for k := range sel {
+			keys[k] = true
+		}
+	}
+	add(proc.Selection)
+	if proc.Prerequisites != nil {
+		for _, r := range proc.Prerequisites.Requirements {
+			add(r.Base().Selection)
+		}
+	}
+	for _, s := range proc.Steps {
+		add(s.Selection)
+		for _, a := range s.Actions {
+			add(a.Base().Selection)
+		}
+		for _, ss := range s.SubSteps {
+			add(ss.Selection)
+			for _, a := range ss.Actions {
+				add(a.Base().Selection)
+			}
+		}
+	}
+	return keys
+}
+
+func (v *variantSet) subsumed(s ast.Selection) bool {
+	for _, o := range v.composables {
+		if len(o) > len(s) && s.Matches(o) {
+			return true
+		}
+	}
+	return false
+}
+
+// tabKeys returns the tab sets present under base, in page order.
+func (v *variantSet) tabKeys(base ast.Selection) []string {
+	var keys []string
+	seen := map[string]bool{}
+	for _, t := range v.tabs {
+		if !seen[t.key] && v.composableOnly(t.within).Matches(base) {
+			seen[t.key] = true
+			keys = append(keys, t.key)
+		}
+	}
+	return keys
+}
+
+func (v *variantSet) composableOnly(sel ast.Selection) ast.Selection {
+	out := ast.Selection{}
+	for _, d := range v.dims {
+		if val, ok := sel[d]; ok {
+			out[d] = val
+		}
+	}
+	return out
+}
+
+// variant names a selection. IDs join option values in the order the
+// composable tutorial declares them, then tab IDs; labels use the titles
+// from snooty.toml and the tabs.
+func (v *variantSet) variant(sel ast.Selection, project *snooty.Project) ast.Variant {
+	var ids, labels []string
+	for _, d := range v.dims {
+		if val, ok := sel[d]; ok {
+			ids = append(ids, val)
+			labels = append(labels, project.OptionTitle(d, val))
+		}
+	}
+	var seenTab []string
+	for _, t := range v.tabs {
+		if sel[t.key] == t.id && !slices.Contains(seenTab, t.key) {
+			seenTab = append(seenTab, t.key)
+			ids = append(ids, t.id)
+			labels = append(labels, t.title)
+		}
+	}
+	typ := ast.VariantTab
+	if len(v.dims) > 0 {
+		typ = ast.VariantComposableTutorial
+	}
+	return ast.Variant{Type: typ, ID: strings.Join(ids, "-"), Label: strings.Join(labels, " / "), Selection: sel}
+}
@@ -0,0 +1,168 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+)
+
+var (
+	// waitRE matches prose that tells the reader to wait for something
+	// that happens in the background.
+	waitRE = regexp.MustCompile(`(?i)\bwait (?:until|for)\b|\b(?:is|are) (?:still )?(?:building|being (?:created|built|deployed|provisioned|initialized))\b|\b(?:may|might|can|could) take (?:a few|several|some|a couple of|up to \d+) (?:minutes|seconds)\b`)
+	// waitFieldRE finds "the status is Active", "the Status field reads
+	// Active" and "the stateName of the cluster changes to IDLE".
+	waitFieldRE = regexp.MustCompile(`(?i)\b(status|state|stateName|phase)\b(?:\s+(?:field|column|value))?(?:\s+(?:of|for)\s+(?:the\s+|your\s+)?[\w-]+(?:\s+[\w-]+)?)?\s+(?:is|changes to|becomes|shows|reads|displays|reports|is set to)\s+["'“]?([\w-]+)`)
+	// waitReadyRE finds "until the index is ready".
+	waitReadyRE = regexp.MustCompile(`(?i)\b(?:is|are|becomes?)\s+(ready|active|available|queryable|running|idle|healthy|complete|completed)\b`)
+	// waitStatusRE finds the HTTP status a URL should respond with.
+	waitStatusRE = regexp.MustCompile(`\b([1-5]\d\d)\b`)
+	// waitTimeoutRE finds how long the page says a wait can take.
+	waitTimeoutRE = regexp.MustCompile(`(?i)\b(?:up to|about|around|approximately|(?:more|less) than)?\s*(\d+)\s+(second|minute|hour)s?\b`)
+	// indexRE tells a search or vector index from other resources.
+	indexRE = regexp.MustCompile(`(?i)\bindex(?:es)?\b`)
+
+	// readRE and writeRE decide whether a command only reports state,
+	// which makes it safe to run again and again while waiting.
+	readRE  = regexp.MustCompile(`(?i)\b(?:get|list|describe|show|find|status|watch|count|ls|cat)\w*|\$listSearchIndexes|\baggregate\b`)
+	writeRE = regexp.MustCompile(`(?i)\b(?:create|insert|update|delete|drop|remove|setup|deploy|start|kill|rm|mv)\w*|-X\s*(?:POST|PUT|PATCH|DELETE)\b`)
+)
+
+// waitAction returns the wait that a paragraph describes, or nil.
+func (b *builder) waitAction(plain string, base ast.ActionBase) *ast.WaitAction {
+	if !waitRE.MatchString(plain) {
+		return nil
+	}
+	a := &ast.WaitAction{ActionBase: base, Condition: ast.WaitExitCode, Description: plain}
+	a.Type = ast.ActionWait
+	switch {
+	case bareURLRE.MatchString(plain):
+		a.Condition = ast.WaitHTTPStatus
+		a.URL = strings.TrimRight(bareURLRE.FindString(plain), ".,;:)")
+		a.Status = 200
+		if m := waitStatusRE.FindStringSubmatch(bareURLRE.ReplaceAllString(plain, "")); m != nil {
+			a.Status, _ = strconv.Atoi(m[1])
+		}
+	case waitFieldRE.MatchString(plain):
+		// Prose that describes the states in turn ends with the one to
+		// wait for.
+		all := waitFieldRE.FindAllStringSubmatch(plain, -1)
+		m := all[len(all)-1]
+		a.Condition, a.Field, a.Value = ast.WaitField, m[1], m[2]
+	case waitReadyRE.MatchString(plain):
+		a.Condition, a.Value = ast.WaitField, waitReadyRE.FindStringSubmatch(plain)[1]
+		if indexRE.MatchString(plain) {
+			a.Field, a.Value = "status", "READY"
+		}
+	case indexRE.MatchString(plain):
+		// "The index is building": search indexes report READY when
+		// they can be queried.
+		a.Condition, a.Field, a.Value = ast.WaitField, "status", "READY"
+	}
+	if m := waitTimeoutRE.FindStringSubmatch(plain); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		unit := map[string]time.Duration{"second": time.Second, "minute": time.Minute, "hour": time.Hour}[strings.ToLower(m[2])]
+		a.Timeout = time.Duration(n) * unit
+	}
+	// "Run the command again until the status is IDLE" after the
+	// command.
+	if a.Condition != ast.WaitHTTPStatus && b.lastCommand != nil && readOnly(b.lastCommand) {
+		a.Poll = b.lastCommand
+	}
+	return a
+}
+
+// command notes a command a code block produced. A command that only
+// reports state, shown after prose that says to wait, is what the wait
+// polls rather than a command of its own; so is any command that does not
+// change anything, shown right after the prose.
+func (b *builder) command(a ast.Action) []ast.Action {
+	if !pollable(a) {
+		return []ast.Action{a}
+	}
+	if w := b.wait; w != nil && w.Poll == nil && w.Condition != ast.WaitHTTPStatus && (readOnly(a) || b.file.prose == w.Description && !writes(a)) {
+		w.Poll = a
+		return nil
+	}
+	b.lastCommand = a
+	return []ast.Action{a}
+}
+
+// linkWaits gives the waits that the page shows no command for the first
+// command of the next step, when that command only reports state: "The
+// index is building" followed by a step that lists the indexes.
+func linkWaits(proc *ast.Procedure) {
+	for i, step := range proc.Steps {
+		var next ast.Action
+		if i+1 < len(proc.Steps) {
+			next = firstCommand(proc.Steps[i+1])
+		}
+		if next == nil || !readOnly(next) {
+			continue
+		}
+		actions := step.Actions
+		for _, sub := range step.SubSteps {
+			actions = append(actions[:len(actions):len(actions)], sub.Actions...)
+		}
+		for _, a := range actions {
+			if w, ok := a.(*ast.WaitAction); ok && w.Poll == nil && w.Condition != ast.WaitHTTPStatus {
+				w.Poll = next
+			}
+		}
+	}
+}
+
+func firstCommand(step *ast.Step) ast.Action {
+	actions := step.Actions
+	if len(actions) == 0 && len(step.SubSteps) > 0 {
+		actions = step.SubSteps[0].Actions
+	}
+	for _, a := range actions {
+		if pollable(a) {
+			return a
+		}
+	}
+	return nil
+}
+
+// pollable reports whether a wait can poll a: shell and CLI commands and
+// API requests.
+func pollable(a ast.Action) bool {
+	switch a.(type) {
+	case *ast.ShellAction, *ast.CLIAction, *ast.APIAction:
+		return true
+	}
+	return false
+}
+
+// readOnly reports whether a command only reports state.
+func readOnly(a ast.Action) bool {
+	var text string
+	switch act := a.(type) {
+	case *ast.ShellAction:
+		text = act.Command
+	case *ast.CLIAction:
+		text = act.Command
+	case *ast.APIAction:
+		return act.Method == "" || act.Method == "GET"
+	default:
+		return false
+	}
+	return readRE.MatchString(text) && !writeRE.MatchString(text)
+}
+
+// writes reports whether a command looks like it changes something.
+func writes(a ast.Action) bool {
+	switch act := a.(type) {
+	case *ast.ShellAction:
+		return writeRE.MatchString(act.Command)
+	case *ast.CLIAction:
+		return writeRE.MatchString(act.Command)
+	case *ast.APIAction:
+		return act.Method != "" && act.Method != "GET"
+	}
+	return false
+}
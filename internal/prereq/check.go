@@ -0,0 +1,307 @@
+package prereq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/redact"
+)
+
+// DefaultCheckTimeout bounds a single check command. Version commands
+// return almost immediately; one that hangs is treated as not installed.
+const DefaultCheckTimeout = 15 * time.Second
+
+// Result is the outcome of checking one requirement.
+type Result struct {
+	Requirement ast.Requirement `json:"requirement" yaml:"requirement"`
+	Met         bool            `json:"met" yaml:"met"`
+	// Verified is false when the checker could not test the requirement,
+	// for example a service or an access role, and assumed it was met.
+	Verified bool   `json:"verified" yaml:"verified"`
+	Message  string `json:"message" yaml:"message"`
+	// SkipReason says precisely what is missing when Met is false.
+	SkipReason string   `json:"skipReason,omitempty" yaml:"skipReason,omitempty"`
+	Details    *Details `json:"details,omitempty" yaml:"details,omitempty"`
+}
+
+// Details records what a check found and how.
+type Details struct {
+	Found    string `json:"found,omitempty" yaml:"found,omitempty"`
+	Expected string `json:"expected,omitempty" yaml:"expected,omitempty"`
+	Command  string `json:"command,omitempty" yaml:"command,omitempty"`
+	Output   string `json:"output,omitempty" yaml:"output,omitempty"`
+}
+
+// Unmet returns the required (non-optional) requirements that were not
+// met.
+func Unmet(results []Result) []Result {
+	var out []Result
+	for _, r := range results {
+		if !r.Met && !r.Requirement.Base().Optional {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// SkipReason joins the reasons of the unmet required requirements, one
+// per line.
+func SkipReason(results []Result) string {
+	var reasons []string
+	for _, r := range Unmet(results) {
+		reasons = append(reasons, r.SkipReason)
+	}
+	return strings.Join(reasons, "\n")
+}
+
+// Checker verifies requirements against the local machine. Check command
+// output is cached, so a requirement shared by every variant of a page is
+// run once.
+type Checker struct {
+	// Env is the environment the checks see, as KEY=value pairs. When nil
+	// the process environment is used.
+	Env []string
+	// Dir is the directory configuration file paths are relative to.
+	Dir string
+	// Commands overrides the check command for a software name, for
+	// example "Python": "python --version".
+	Commands map[string]string
+	Timeout  time.Duration
+
+	mu    sync.Mutex
+	cache map[string]commandResult
+}
+
+type commandResult struct {
+	output string
+	err    error
+}
+
+// NewChecker returns a checker that uses the process environment and
+// resolves configuration paths against dir.
+func NewChecker(dir string) *Checker {
+	return &Checker{Dir: dir, Timeout: DefaultCheckTimeout}
+}
+
+// CheckAll checks the requirements of p that apply to the variant sel.
+func (c *Checker) CheckAll(ctx context.Context, p *ast.Prerequisites, sel ast.Selection) []Result {
+	if p == nil {
+		return nil
+	}
+	var results []Result
+	for _, req := range p.Requirements {
+		if req.Base().Selection.Matches(sel) {
+			results = append(results, c.Check(ctx, req))
+		}
+	}
+	return results
+}
+
+// Check checks a single requirement.
+func (c *Checker) Check(ctx context.Context, req ast.Requirement) Result {
+	switch r := req.(type) {
+	case *ast.SoftwareRequirement:
+		return c.checkSoftware(ctx, r)
+	case *ast.EnvironmentRequirement:
+		return c.checkEnvironment(r)
+	case *ast.ConfigurationRequirement:
+		return c.checkConfiguration(r)
+	case *ast.ServiceRequirement:
+		return Result{Requirement: r, Met: true, Message: fmt.Sprintf("%s is assumed to be available (services are not verified)", r.Name)}
+	}
+	return Result{Requirement: req, Met: true, Message: fmt.Sprintf("%s is not verified", req.Subject())}
+}
+
+func (c *Checker) checkSoftware(ctx context.Context, r *ast.SoftwareRequirement) Result {
+	command := r.CheckCommand
+	if override, ok := c.Commands[r.Name]; ok {
+		command = override
+	}
+	if command == "" {
+		return Result{Requirement: r, Met: true, Message: fmt.Sprintf("cannot verify %s (no check command)", r.Name)}
+	}
+	details := &Details{Command: command, Expected: r.Version}
+	res := Result{Requirement: r, Verified: true, Details: details}
+
+	output, err := c.run(ctx, command)
+	details.Output = output
+	if err != nil {
+		res.Message = fmt.Sprintf("%s is not installed", r.Name)
+		var notFound *exec.Error
+		var exit *exec.ExitError
+		switch {
+		case errors.As(err, &notFound):
+			res.SkipReason = fmt.Sprintf("%s is required but %q was not found on PATH", r.Name, strings.Fields(command)[0])
+		case errors.As(err, &exit):
+			res.SkipReason = fmt.Sprintf("%s is required but `%s` exited with status %d", r.Name, command, exit.ExitCode())
+		default:
+			res.SkipReason = fmt.Sprintf("%s is required but `%s` failed: %v", r.Name, command, err)
+		}
+		if r.InstallURL != "" {
+			res.SkipReason += ". Install from: " + r.InstallURL
+		}
+		return res
+	}
+
+	found := ExtractVersion(output)
+	details.Found = found
+	if r.Version == "" {
+		res.Met = true
+		res.Message = strings.TrimSpace(fmt.Sprintf("%s %s is installed", r.Name, found))
+		return res
+	}
+	constraint, err := ParseConstraint(r.Version)
+	if err != nil {
+		// The detector wrote a constraint the checker cannot read; report
+		// the program as present rather than skipping on our own bug.
+		res.Met = true
+		res.Message = fmt.Sprintf("%s is installed; %v", r.Name, err)
+		return res
+	}
+	v, err := ParseVersion(found)
+	if err != nil {
+		res.Message = fmt.Sprintf("%s version could not be determined", r.Name)
+		res.SkipReason = fmt.Sprintf("%s %s is required, but `%s` did not report a version", r.Name, r.Version, command)
+		return res
+	}
+	if !constraint.Check(v) {
+		res.Message = fmt.Sprintf("%s %s does not satisfy %s", r.Name, found, r.Version)
+		res.SkipReason = fmt.Sprintf("%s %s is required, but %s was found (`%s`)", r.Name, r.Version, found, command)
+		return res
+	}
+	res.Met = true
+	res.Message = fmt.Sprintf("%s %s is installed (%s)", r.Name, found, r.Version)
+	return res
+}
+
+// errCheckTimeout is the error of a check command that ran longer than
+// the checker's timeout.
+var errCheckTimeout = errors.New("timed out")
+
+// run executes a check command through the shell and returns its combined
+// output. The first word is looked up on PATH first so that a missing
+// program is reported as such rather than as shell status 127. A command
+// that was interrupted or timed out is not cached, since it says nothing
+// about the program, and the next check runs it again.
+func (c *Checker) run(ctx context.Context, command string) (string, error) {
+	c.mu.Lock()
+	if cached, ok := c.cache[command]; ok {
+		c.mu.Unlock()
+		return cached.output, cached.err
+	}
+	c.mu.Unlock()
+
+	output, err := c.exec(ctx, command)
+	if ctx.Err() != nil || errors.Is(err, errCheckTimeout) {
+		return output, err
+	}
+
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = map[string]commandResult{}
+	}
+	c.cache[command] = commandResult{output, err}
+	c.mu.Unlock()
+	return output, err
+}
+
+func (c *Checker) exec(ctx context.Context, command string) (string, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty check command")
+	}
+	if err := c.lookPath(fields[0]); err != nil {
+		return "", err
+	}
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = c.Env
+	cmd.Dir = c.Dir
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("%w after %s", errCheckTimeout, timeout)
+	}
+	return strings.TrimSpace(string(out)), err
+}
+
+// lookPath finds program on the PATH the check command runs with, which
+// is Env's when it is set rather than the process's.
+func (c *Checker) lookPath(program string) error {
+	if c.Env == nil || strings.Contains(program, "/") {
+		_, err := exec.LookPath(program)
+		return err
+	}
+	path, _ := c.lookupEnv("PATH")
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		info, err := os.Stat(filepath.Join(dir, program))
+		if err == nil && !info.IsDir() && info.Mode()&0o111 != 0 {
+			return nil
+		}
+	}
+	return &exec.Error{Name: program, Err: exec.ErrNotFound}
+}
+
+func (c *Checker) lookupEnv(name string) (string, bool) {
+	if c.Env == nil {
+		return os.LookupEnv(name)
+	}
+	for i := len(c.Env) - 1; i >= 0; i-- {
+		if k, v, ok := strings.Cut(c.Env[i], "="); ok && k == name {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func (c *Checker) checkEnvironment(r *ast.EnvironmentRequirement) Result {
+	res := Result{Requirement: r, Verified: true}
+	value, ok := c.lookupEnv(r.Variable)
+	if !ok || value == "" {
+		res.Message = fmt.Sprintf("environment variable %s is not set", r.Variable)
+		res.SkipReason = fmt.Sprintf("Set %s in your environment or .env file", r.Variable)
+		if r.Example != "" {
+			res.SkipReason += ". Example: " + r.Example
+		}
+		return res
+	}
+	res.Met = true
+	res.Message = fmt.Sprintf("%s is set", r.Variable)
+	res.Details = &Details{Found: redact.Partial(value)}
+	return res
+}
+
+func (c *Checker) checkConfiguration(r *ast.ConfigurationRequirement) Result {
+	if r.Path == "" {
+		return Result{Requirement: r, Met: true, Message: fmt.Sprintf("%s is assumed to be configured (not verified)", r.Name)}
+	}
+	path := r.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.Dir, path)
+	}
+	res := Result{Requirement: r, Verified: true, Details: &Details{Expected: path}}
+	if _, err := os.Stat(path); err != nil {
+		res.Message = fmt.Sprintf("%s does not exist", r.Path)
+		res.SkipReason = fmt.Sprintf("configuration file %s is required but %s does not exist", r.Path, path)
+		return res
+	}
+	res.Met = true
+	res.Message = fmt.Sprintf("%s exists", r.Path)
+	res.Details.Found = path
+	return res
+}
@@ -0,0 +1,97 @@
+package prereq
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+)
+
+// tool writes an executable named mytool to dir that runs script.
+func tool(t *testing.T, dir, script string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "mytool"), []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mytool(version string) *ast.SoftwareRequirement {
+	return &ast.SoftwareRequirement{Name: "mytool", Version: version, CheckCommand: "mytool --version"}
+}
+
+func TestCheckSoftwareUsesTheEnvPATH(t *testing.T) {
+	bin := t.TempDir()
+	tool(t, bin, "echo mytool 1.4.2")
+	tests := []struct {
+		name    string
+		env     []string
+		req     *ast.SoftwareRequirement
+		wantMet bool
+	}{
+		{"on the env PATH", []string{"PATH=" + bin}, mytool(">=1.4"), true},
+		{"later PATH wins", []string{"PATH=/nonexistent", "PATH=" + bin}, mytool(""), true},
+		{"version too old", []string{"PATH=" + bin}, mytool(">=2"), false},
+		{"not on the env PATH", []string{"PATH=" + t.TempDir()}, mytool(""), false},
+		{"no PATH", []string{"HOME=/"}, mytool(""), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker("")
+			c.Env = tt.env
+			res := c.Check(context.Background(), tt.req)
+			if res.Met != tt.wantMet {
+				t.Errorf("Met = %v, want %v: %s; %s", res.Met, tt.wantMet, res.Message, res.SkipReason)
+			}
+		})
+	}
+}
+
+func TestCheckDoesNotCacheInterruptedChecks(t *testing.T) {
+	tests := []struct {
+		name  string
+		first func(c *Checker) context.Context
+	}{
+		{"timed out", func(c *Checker) context.Context {
+			c.Timeout = 50 * time.Millisecond
+			return context.Background()
+		}},
+		{"cancelled", func(*Checker) context.Context {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin := t.TempDir()
+			tool(t, bin, "exec sleep 1")
+			c := NewChecker("")
+			c.Env = []string{"PATH=" + bin + ":/usr/bin:/bin"}
+			if res := c.Check(tt.first(c), mytool("")); res.Met {
+				t.Fatalf("the first check was met: %s", res.Message)
+			}
+			tool(t, bin, "echo mytool 1.0.0")
+			c.Timeout = DefaultCheckTimeout
+			if res := c.Check(context.Background(), mytool("")); !res.Met {
+				t.Errorf("the check after it was not met: %s", res.SkipReason)
+			}
+		})
+	}
+}
+
+func TestCheckCachesResults(t *testing.T) {
+	bin := t.TempDir()
+	tool(t, bin, "echo mytool 1.0.0")
+	c := NewChecker("")
+	c.Env = []string{"PATH=" + bin}
+	if res := c.Check(context.Background(), mytool("1.0")); !res.Met {
+		t.Fatalf("the first check was not met: %s", res.SkipReason)
+	}
+	tool(t, bin, "echo mytool 2.0.0")
+	if res := c.Check(context.Background(), mytool("1.0")); !res.Met {
+		t.Errorf("the second check ran the command again: %s", res.Message)
+	}
+}
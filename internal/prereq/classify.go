@@ -0,0 +1,295 @@
+package prereq
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/rst"
+)
+
+// Software is an entry in the catalog of programs the detector recognizes.
+type Software struct {
+	Name       string
+	Pattern    *regexp.Regexp
+	Check      string
+	InstallURL string
+}
+
+// Catalog lists the programs the detector recognizes, with the command
+// that reports each one's version. More specific entries come first so
+// that "MongoDB PHP extension" wins over "PHP".
+var Catalog = []Software{
+	{"MongoDB PHP extension", regexp.MustCompile(`(?i)\bMongoDB (PHP )?extension\b`), "php --ri mongodb", "https://www.php.net/manual/en/mongodb.installation.php"},
+	{"Symfony CLI", regexp.MustCompile(`\bSymfony CLI\b`), "symfony version", "https://symfony.com/download"},
+	{"Atlas CLI", regexp.MustCompile(`\bAtlas CLI\b`), "atlas --version", "https://www.mongodb.com/docs/atlas/cli/current/install-atlas-cli/"},
+	{"mongosh", regexp.MustCompile(`\bmongosh\b|\bMongoDB Shell\b`), "mongosh --version", "https://www.mongodb.com/try/download/shell"},
+	{"MongoDB Compass", regexp.MustCompile(`\bCompass\b`), "", "https://www.mongodb.com/try/download/compass"},
+	{"MongoDB Database Tools", regexp.MustCompile(`\bDatabase Tools\b|\bmongo(dump|restore|import|export)\b`), "mongodump --version", "https://www.mongodb.com/try/download/database-tools"},
+	{"MongoDB Server", regexp.MustCompile(`\bmongod\b|\bMongoDB (Server|Community( Edition| Server)?|Enterprise( Server)?)\b`), "mongod --version", "https://www.mongodb.com/try/download/community"},
+	{"PHP", regexp.MustCompile(`\bPHP\b`), "php --version", "https://www.php.net/downloads"},
+	{"Composer", regexp.MustCompile(`\bComposer\b`), "composer --version", "https://getcomposer.org/download/"},
+	{"Node.js", regexp.MustCompile(`(?i)\bnode\.?js\b`), "node --version", "https://nodejs.org/en/download"},
+	{"npm", regexp.MustCompile(`\bnpm\b`), "npm --version", "https://docs.npmjs.com/downloading-and-installing-node-js-and-npm"},
+	{"Python", regexp.MustCompile(`\bPython3?\b`), "python3 --version", "https://www.python.org/downloads/"},
+	{"pip", regexp.MustCompile(`\bpip3?\b`), "pip3 --version", "https://pip.pypa.io/en/stable/installation/"},
+	{"Maven", regexp.MustCompile(`\bMaven\b`), "mvn --version", "https://maven.apache.org/install.html"},
+	{"Gradle", regexp.MustCompile(`\bGradle\b`), "gradle --version", "https://gradle.org/install/"},
+	{"Java", regexp.MustCompile(`\bJava Development Kit\b|\bJDK\b|\bJava\b`), "java -version", "https://www.oracle.com/java/technologies/downloads/"},
+	{"Kotlin", regexp.MustCompile(`\bKotlin\b`), "kotlin -version", "https://kotlinlang.org/docs/command-line.html"},
+	{"Go", regexp.MustCompile(`\bGolang\b|\bGo\b(\s+(v?\d|version|toolchain|installation|compiler|programming language))`), "go version", "https://go.dev/dl/"},
+	{".NET", regexp.MustCompile(`\.NET\b|\bdotnet\b`), "dotnet --version", "https://dotnet.microsoft.com/download"},
+	{"Ruby", regexp.MustCompile(`\bRuby\b`), "ruby --version", "https://www.ruby-lang.org/en/downloads/"},
+	{"Rust", regexp.MustCompile(`\bRust\b|\bCargo\b`), "rustc --version", "https://www.rust-lang.org/tools/install"},
+	{"CMake", regexp.MustCompile(`\bCMake\b`), "cmake --version", "https://cmake.org/download/"},
+	{"GCC", regexp.MustCompile(`\bGCC\b|\bgcc\b|\bC compiler\b`), "gcc --version", "https://gcc.gnu.org/install/"},
+	{"Git", regexp.MustCompile(`\bGit\b|\bgit\b`), "git --version", "https://git-scm.com/downloads"},
+	{"Docker", regexp.MustCompile(`\bDocker\b`), "docker --version", "https://docs.docker.com/get-docker/"},
+	{"curl", regexp.MustCompile(`\bcURL\b|\bcurl\b`), "curl --version", "https://curl.se/download.html"},
+}
+
+// service is a rule that recognizes an external service.
+type service struct {
+	name     string
+	pattern  *regexp.Regexp
+	setupURL string
+}
+
+var services = []service{
+	{"MongoDB Atlas account", regexp.MustCompile(`(?i)\bAtlas (account|organization|project)\b|\bMongoDB account\b`), "https://www.mongodb.com/cloud/atlas/register"},
+	{"MongoDB Atlas cluster", regexp.MustCompile(`(?i)\b(Atlas |MongoDB )?(cluster|deployment)\b`), "https://www.mongodb.com/docs/atlas/tutorial/deploy-free-tier-cluster/"},
+	{"Sample data", regexp.MustCompile(`(?i)\bsample (data|dataset)s?\b`), "https://www.mongodb.com/docs/atlas/sample-data/"},
+}
+
+// configuration is a rule that recognizes a setting or access grant.
+type configuration struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+var configurations = []configuration{
+	{"Atlas API key", regexp.MustCompile(`(?i)\b(programmatic )?API keys?\b|\bservice account\b`)},
+	{"Database user", regexp.MustCompile(`(?i)\bdatabase user\b`)},
+	{"IP access list", regexp.MustCompile(`(?i)\bIP access list\b|\bnetwork access\b`)},
+	{"User roles", regexp.MustCompile(`(?i)\broles?\b|\bprivileges?\b|\bpermissions?\b`)},
+}
+
+var (
+	roleNameRE   = regexp.MustCompile(`\b(Organization Owner|Project Owner|Project Data Access Admin|Project Data Access Read/Write|Project Data Access Read Only|Project Search Index Editor|Project Read Only|readWriteAnyDatabase|readWrite|dbAdmin|atlasAdmin)\b`)
+	envVarRE     = regexp.MustCompile(`\$\{?([A-Z][A-Z0-9_]{2,})\}?|\b([A-Z][A-Z0-9]*_[A-Z0-9_]+)\b`)
+	envContextRE = regexp.MustCompile(`(?i)\benvironment variables?\b|\bexport\b|\.env\b`)
+	envExampleRE = regexp.MustCompile(`=\s*["']?([^"'\s]+)`)
+	configFileRE = regexp.MustCompile(`(?i)^[\w./~-]+\.(toml|ya?ml|json|ini|conf|cfg|env|properties|xml)$|^\.env(\.\w+)?$`)
+	optionalRE   = regexp.MustCompile(`(?i)\b(optional(ly)?|if you (want|prefer|plan|choose)|recommended)\b`)
+	connStringRE = regexp.MustCompile(`(?i)\bconnection string\b|\bconnection URI\b`)
+)
+
+// versionWindow is how far past a software name a version may appear.
+const versionWindow = 32
+
+// Classify turns a candidate sentence into zero or more requirements.
+func Classify(c Candidate) []ast.Requirement {
+	text := c.Text
+	optional := optionalRE.MatchString(text)
+	base := func(t ast.RequirementType, rule string) ast.RequirementBase {
+		return ast.RequirementBase{
+			Type:        t,
+			Description: text,
+			Optional:    optional,
+			Selection:   c.Selection,
+			Source:      text,
+			Rule:        rule,
+			Location:    c.Location,
+		}
+	}
+	links := rst.Links(c.Raw)
+
+	var reqs []ast.Requirement
+	for _, m := range matchSoftware(text) {
+		sw := m.software
+		rule := fmt.Sprintf("software: %q matches the known-software catalog entry %q", text[m.start:m.end], sw.Name)
+		version, vrule := versionAfter(text[m.end:])
+		if vrule != "" {
+			rule += "; " + vrule
+		}
+		install := sw.InstallURL
+		for _, l := range links {
+			if sw.Pattern.MatchString(l.Text) {
+				install = l.URL
+				break
+			}
+		}
+		reqs = append(reqs, &ast.SoftwareRequirement{
+			RequirementBase: base(ast.RequirementSoftware, rule),
+			Name:            sw.Name,
+			Version:         version,
+			CheckCommand:    sw.Check,
+			InstallURL:      install,
+		})
+	}
+
+	reqs = append(reqs, environmentVariables(c)...)
+	if connStringRE.MatchString(text) {
+		reqs = append(reqs, &ast.EnvironmentRequirement{
+			RequirementBase: base(ast.RequirementEnvironment, "environment: a connection string is supplied through MONGODB_URI"),
+			Variable:        "MONGODB_URI",
+			Example:         "mongodb+srv://<user>:<password>@<cluster>.mongodb.net/",
+		})
+	}
+
+	for _, s := range services {
+		if m := s.pattern.FindString(text); m != "" {
+			setup := s.setupURL
+			for _, l := range links {
+				if s.pattern.MatchString(l.Text) {
+					setup = l.URL
+					break
+				}
+			}
+			reqs = append(reqs, &ast.ServiceRequirement{
+				RequirementBase: base(ast.RequirementService, fmt.Sprintf("service: %q names an external service", m)),
+				Name:            s.name,
+				SetupURL:        setup,
+			})
+		}
+	}
+
+	for _, lit := range rst.Literals(c.Raw) {
+		if configFileRE.MatchString(lit) {
+			reqs = append(reqs, &ast.ConfigurationRequirement{
+				RequirementBase: base(ast.RequirementConfiguration, fmt.Sprintf("configuration: %q is a configuration file path", lit)),
+				Name:            lit,
+				Path:            lit,
+			})
+		}
+	}
+	for _, cfg := range configurations {
+		m := cfg.pattern.FindString(text)
+		if m == "" {
+			continue
+		}
+		name := cfg.name
+		if cfg.name == "User roles" {
+			if roles := roleNameRE.FindAllString(text, -1); len(roles) > 0 {
+				name = strings.Join(uniqueStrings(roles), ", ")
+			}
+		}
+		reqs = append(reqs, &ast.ConfigurationRequirement{
+			RequirementBase: base(ast.RequirementConfiguration, fmt.Sprintf("configuration: %q describes required access or settings", m)),
+			Name:            name,
+		})
+		break
+	}
+	return reqs
+}
+
+type softwareMatch struct {
+	software   Software
+	start, end int
+}
+
+// matchSoftware finds catalog entries in text, earliest first, without
+// letting two entries claim overlapping text.
+func matchSoftware(text string) []softwareMatch {
+	var matches []softwareMatch
+	taken := make([]bool, len(text))
+	for _, sw := range Catalog {
+		for _, loc := range sw.Pattern.FindAllStringIndex(text, -1) {
+			overlap := false
+			for i := loc[0]; i < loc[1]; i++ {
+				if taken[i] {
+					overlap = true
+					break
+				}
+			}
+			if overlap {
+				continue
+			}
+			for i := loc[0]; i < loc[1]; i++ {
+				taken[i] = true
+			}
+			// The Go pattern includes the word that follows "Go" to tell it
+			// apart from the verb; keep the version text for versionAfter.
+			end := loc[1]
+			if sw.Name == "Go" {
+				end = loc[0] + len(strings.Fields(text[loc[0]:loc[1]])[0])
+			}
+			matches = append(matches, softwareMatch{software: sw, start: loc[0], end: end})
+			break
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+	return matches
+}
+
+// versionAfter extracts a version constraint from the text immediately
+// following a software name. It stops at the first clause boundary so that
+// "Atlas CLI, with a cluster running MongoDB 7.0+" does not give the CLI
+// the cluster's version.
+func versionAfter(rest string) (string, string) {
+	if len(rest) > versionWindow {
+		rest = rest[:versionWindow]
+	}
+	if i := strings.IndexAny(rest, ",;:()"); i >= 0 {
+		rest = rest[:i]
+	}
+	if i := strings.Index(rest, " and "); i >= 0 {
+		rest = rest[:i]
+	}
+	return ParseVersionText(rest)
+}
+
+// environmentVariables finds upper-case variable names in a candidate.
+// Bare identifiers only count when the sentence talks about environment
+// variables; $NAME references always count.
+func environmentVariables(c Candidate) []ast.Requirement {
+	var out []ast.Requirement
+	seen := map[string]bool{}
+	for _, m := range envVarRE.FindAllStringSubmatch(c.Text, -1) {
+		name, rule := m[1], "environment: $"+m[1]+" is a shell variable reference"
+		if name == "" {
+			if !envContextRE.MatchString(c.Text) {
+				continue
+			}
+			name, rule = m[2], fmt.Sprintf("environment: %q is an upper-case identifier in a sentence about environment variables", m[2])
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		example := ""
+		if i := strings.Index(c.Text, name); i >= 0 {
+			if em := envExampleRE.FindStringSubmatch(c.Text[i+len(name):]); em != nil && strings.HasPrefix(strings.TrimSpace(c.Text[i+len(name):]), "=") {
+				example = em[1]
+			}
+		}
+		out = append(out, &ast.EnvironmentRequirement{
+			RequirementBase: ast.RequirementBase{
+				Type:        ast.RequirementEnvironment,
+				Description: c.Text,
+				Optional:    optionalRE.MatchString(c.Text),
+				Selection:   c.Selection,
+				Source:      c.Text,
+				Rule:        rule,
+				Location:    c.Location,
+			},
+			Variable: name,
+			Example:  example,
+		})
+	}
+	return out
+}
+
+func uniqueStrings(in []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,216 @@
+// Package prereq finds the requirements a procedure depends on, such as
+// "You must have a PHP 8.1+ installation" or "an Atlas cluster", and
+// checks whether the local machine meets them.
+package prereq
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/rst"
+)
+
+// headingRE matches section and step titles that introduce requirements.
+var headingRE = regexp.MustCompile(`(?i)^\s*(prerequisites?|requirements?|required access|before you (begin|start)|what you('ll| will)? need|set ?up)\s*:?\s*$`)
+
+// leadInRE matches a paragraph that introduces a list of requirements
+// inside an ordinary section, such as "Before you begin, you must have:".
+var leadInRE = regexp.MustCompile(`(?i)^(before you (begin|start)|to complete this (tutorial|guide|procedure|quick start)|you (must|will) (have|need)|you need|prerequisites?|requirements?)\b.*:$`)
+
+// IsHeading reports whether a section or step title introduces a list of
+// requirements.
+func IsHeading(title string) bool {
+	return headingRE.MatchString(title)
+}
+
+// IsLeadIn reports whether a paragraph introduces a list of requirements.
+func IsLeadIn(text string) bool {
+	return leadInRE.MatchString(strings.TrimSpace(text))
+}
+
+// Candidate is a sentence or list entry that may state a requirement.
+type Candidate struct {
+	// Text is the sentence as plain text.
+	Text string
+	// Raw is the sentence with its inline markup, used to find links and
+	// literals.
+	Raw       string
+	Selection ast.Selection
+	Location  ast.SourceLocation
+}
+
+// Renderer supplies the page context the detector needs: substitution and
+// constant expansion, source locations, and variant selections. The
+// parser implements it.
+type Renderer interface {
+	// Plain renders inline markup as plain text.
+	Plain(raw string) string
+	// Location returns the source location of a node.
+	Location(n *rst.Node) ast.SourceLocation
+	// Select returns the selection that applies inside n when n is a
+	// selected-content or tab directive. It returns false for any other
+	// node.
+	Select(n *rst.Node, sel ast.Selection) (ast.Selection, bool)
+}
+
+// skipDirectives hold content that never states a requirement.
+var skipDirectives = map[string]bool{
+	"code-block": true, "code": true, "sourcecode": true, "literalinclude": true,
+	"io-code-block": true, "input": true, "output": true, "image": true,
+	"figure": true, "seealso": true, "see": true, "tip": true, "meta": true,
+	"facet": true, "contents": true,
+}
+
+// Collect gathers candidate sentences from the content of a requirements
+// section. List entries and table rows become one candidate each;
+// paragraphs are split into sentences.
+func Collect(nodes []*rst.Node, r Renderer, sel ast.Selection) []Candidate {
+	var out []Candidate
+	for _, n := range nodes {
+		switch n.Kind {
+		case rst.Paragraph:
+			loc := r.Location(n)
+			for _, s := range splitSentences(n.Text) {
+				out = append(out, Candidate{Text: r.Plain(s), Raw: s, Selection: sel, Location: loc})
+			}
+		case rst.List:
+			for _, item := range n.Children {
+				out = append(out, collectItem(item, r, sel)...)
+			}
+		case rst.Directive:
+			if skipDirectives[n.Name] {
+				continue
+			}
+			if n.Name == "list-table" {
+				out = append(out, collectTable(n, r, sel)...)
+				continue
+			}
+			csel := sel
+			if s, ok := r.Select(n, sel); ok {
+				csel = s
+			}
+			out = append(out, Collect(n.Children, r, csel)...)
+		case rst.Quote, rst.Item:
+			out = append(out, Collect(n.Children, r, sel)...)
+		}
+	}
+	return out
+}
+
+// collectItem treats the first paragraph of a list item as one candidate
+// and collects the rest of the item's content normally.
+func collectItem(item *rst.Node, r Renderer, sel ast.Selection) []Candidate {
+	var out []Candidate
+	rest := item.Children
+	if len(rest) > 0 && rest[0].Kind == rst.Paragraph {
+		p := rest[0]
+		out = append(out, Candidate{Text: r.Plain(p.Text), Raw: p.Text, Selection: sel, Location: r.Location(p)})
+		rest = rest[1:]
+	}
+	return append(out, Collect(rest, r, sel)...)
+}
+
+// collectTable turns each list-table row into a candidate whose text is
+// the row's cells joined with " - ", skipping header rows.
+func collectTable(table *rst.Node, r Renderer, sel ast.Selection) []Candidate {
+	header, _ := strconv.Atoi(table.Options["header-rows"])
+	var out []Candidate
+	for _, list := range table.Children {
+		if list.Kind != rst.List {
+			continue
+		}
+		for i, row := range list.Children {
+			if i < header {
+				continue
+			}
+			var cells []string
+			for _, cl := range row.Children {
+				if cl.Kind != rst.List {
+					continue
+				}
+				for _, cell := range cl.Children {
+					var parts []string
+					rst.Walk(cell.Children, func(n *rst.Node) bool {
+						if n.Kind == rst.Paragraph {
+							parts = append(parts, n.Text)
+						}
+						return true
+					})
+					cells = append(cells, strings.Join(parts, " "))
+				}
+			}
+			if len(cells) == 0 {
+				continue
+			}
+			raw := strings.Join(cells, " - ")
+			out = append(out, Candidate{Text: r.Plain(raw), Raw: raw, Selection: sel, Location: r.Location(row)})
+		}
+	}
+	return out
+}
+
+var sentenceEndRE = regexp.MustCompile(`([.!?])\s+([A-Z:{|` + "`" + `])`)
+
+// splitSentences splits a paragraph at sentence boundaries. It is
+// deliberately simple: a period followed by whitespace and a capital
+// letter or markup ends a sentence.
+func splitSentences(text string) []string {
+	marked := sentenceEndRE.ReplaceAllString(text, "$1\x00$2")
+	var out []string
+	for _, s := range strings.Split(marked, "\x00") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Detect classifies the candidates of a requirements section and returns
+// the resulting node. It returns nil when no candidate states a
+// requirement.
+func Detect(title string, candidates []Candidate, loc ast.SourceLocation) *ast.Prerequisites {
+	node := &ast.Prerequisites{Title: title, Location: loc}
+	for _, c := range candidates {
+		for _, req := range Classify(c) {
+			if !covered(node.Requirements, req) {
+				node.Requirements = append(node.Requirements, req)
+			}
+		}
+	}
+	if len(node.Requirements) == 0 {
+		return nil
+	}
+	return node
+}
+
+// Merge appends the requirements of src that dst does not already have.
+func Merge(dst, src *ast.Prerequisites) *ast.Prerequisites {
+	if src == nil {
+		return dst
+	}
+	if dst == nil {
+		cp := *src
+		cp.Requirements = append([]ast.Requirement(nil), src.Requirements...)
+		return &cp
+	}
+	for _, r := range src.Requirements {
+		if !covered(dst.Requirements, r) {
+			dst.Requirements = append(dst.Requirements, r)
+		}
+	}
+	return dst
+}
+
+// covered reports whether reqs already states r: the same subject of the
+// same kind under r's selection or a broader one.
+func covered(reqs []ast.Requirement, r ast.Requirement) bool {
+	for _, o := range reqs {
+		if o.Kind() == r.Kind() && strings.EqualFold(o.Subject(), r.Subject()) &&
+			o.Base().Selection.Matches(r.Base().Selection) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,235 @@
+package prereq
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a dotted version number. Only the parts that were written
+// are significant: "8.1" has two parts, so the bare constraint "8.1"
+// accepts 8.1.0 through 8.1.x.
+type Version struct {
+	Parts      []int
+	Prerelease string
+}
+
+var (
+	versionStringRE = regexp.MustCompile(`^v?(\d+)(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+	// versionInOutputRE finds the first dotted version in the output of a
+	// check command: "PHP 8.3.6 (cli)", "go version go1.22.3", "v18.19.0".
+	versionInOutputRE = regexp.MustCompile(`(?:^|[^\d.])v?(\d+\.\d+(?:\.\d+)?(?:-[0-9A-Za-z.]+)?)`)
+	// bareNumberRE is the fallback for tools that print a single number.
+	bareNumberRE = regexp.MustCompile(`(?:^|\s)v?(\d+)(?:\s|$)`)
+)
+
+// ParseVersion parses "1", "1.2", "v1.2.3" or "1.2.3-rc1". Wildcard parts
+// ("18.x") end the version, so "18.x" is the same as "18".
+func ParseVersion(s string) (Version, error) {
+	m := versionStringRE.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+	var v Version
+	for _, p := range m[1:4] {
+		if p == "" || p == "x" || p == "X" || p == "*" {
+			break
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: %w", s, err)
+		}
+		v.Parts = append(v.Parts, n)
+	}
+	v.Prerelease = m[4]
+	return v, nil
+}
+
+// ExtractVersion returns the first version number in the output of a
+// version command, or "" when there is none.
+func ExtractVersion(output string) string {
+	if m := versionInOutputRE.FindStringSubmatch(output); m != nil {
+		return m[1]
+	}
+	if m := bareNumberRE.FindStringSubmatch(output); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func (v Version) String() string {
+	parts := make([]string, len(v.Parts))
+	for i, p := range v.Parts {
+		parts[i] = strconv.Itoa(p)
+	}
+	s := strings.Join(parts, ".")
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// part returns the i-th part, treating missing parts as zero.
+func (v Version) part(i int) int {
+	if i < len(v.Parts) {
+		return v.Parts[i]
+	}
+	return 0
+}
+
+// Compare returns -1, 0 or 1. Missing parts count as zero, and a
+// prerelease sorts before the release it precedes.
+func (v Version) Compare(o Version) int {
+	for i := 0; i < 3; i++ {
+		switch a, b := v.part(i), o.part(i); {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	}
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	case v.Prerelease < o.Prerelease:
+		return -1
+	}
+	return 1
+}
+
+// bump returns the smallest version above every version that starts with
+// the first n parts of v: bump(8.1.2, 2) is 8.2.0.
+func (v Version) bump(n int) Version {
+	out := Version{Parts: make([]int, n)}
+	for i := 0; i < n; i++ {
+		out.Parts[i] = v.part(i)
+	}
+	out.Parts[n-1]++
+	return out
+}
+
+// comparator is one bound of a constraint.
+type comparator struct {
+	op string
+	v  Version
+}
+
+func (c comparator) matches(v Version) bool {
+	cmp := v.Compare(c.v)
+	switch c.op {
+	case ">=":
+		return cmp >= 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	case "<":
+		return cmp < 0
+	}
+	return cmp == 0
+}
+
+// Constraint is a parsed version constraint: alternatives separated by
+// "||", each a set of bounds that must all hold.
+type Constraint struct {
+	raw  string
+	sets [][]comparator
+}
+
+var comparatorRE = regexp.MustCompile(`^(>=|<=|>|<|=|\^|~)?\s*(\S+)$`)
+
+// ParseConstraint parses the constraints the detector produces and the
+// common npm/Composer forms: ">=8.1", "<3", "^18", "~1.2", "8.1" (any
+// 8.1.x), "18.x", ">=1.20 <2" and ">=1.20, <2", and "^7 || ^8".
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{raw: strings.TrimSpace(s)}
+	for _, alt := range strings.Split(s, "||") {
+		fields := strings.Fields(strings.ReplaceAll(alt, ",", " "))
+		// Rejoin ">= 8" style operators that are separated from their
+		// version by a space.
+		var terms []string
+		for i := 0; i < len(fields); i++ {
+			if strings.Trim(fields[i], "<>=^~") == "" && i+1 < len(fields) {
+				terms = append(terms, fields[i]+fields[i+1])
+				i++
+				continue
+			}
+			terms = append(terms, fields[i])
+		}
+		if len(terms) == 0 {
+			return Constraint{}, fmt.Errorf("empty version constraint %q", s)
+		}
+		var set []comparator
+		for _, t := range terms {
+			cs, err := parseComparator(t)
+			if err != nil {
+				return Constraint{}, fmt.Errorf("version constraint %q: %w", s, err)
+			}
+			set = append(set, cs...)
+		}
+		c.sets = append(c.sets, set)
+	}
+	return c, nil
+}
+
+func parseComparator(t string) ([]comparator, error) {
+	m := comparatorRE.FindStringSubmatch(t)
+	if m == nil {
+		return nil, fmt.Errorf("invalid term %q", t)
+	}
+	if m[1] == "" && (m[2] == "*" || strings.EqualFold(m[2], "x")) {
+		// "*" or "x" accepts anything.
+		return []comparator{{">=", Version{Parts: []int{0}}}}, nil
+	}
+	v, err := ParseVersion(m[2])
+	if err != nil {
+		return nil, err
+	}
+	switch m[1] {
+	case "", "=":
+		if len(v.Parts) == 3 || v.Prerelease != "" {
+			return []comparator{{"=", v}}, nil
+		}
+		return []comparator{{">=", v}, {"<", v.bump(len(v.Parts))}}, nil
+	case "^":
+		// ^ allows changes that do not modify the first non-zero part.
+		n := 1
+		for n < len(v.Parts) && v.part(n-1) == 0 {
+			n++
+		}
+		return []comparator{{">=", v}, {"<", v.bump(n)}}, nil
+	case "~":
+		// ~ allows patch changes when a minor version is given, and minor
+		// changes otherwise.
+		n := len(v.Parts)
+		if n > 2 {
+			n = 2
+		}
+		return []comparator{{">=", v}, {"<", v.bump(n)}}, nil
+	}
+	return []comparator{{m[1], v}}, nil
+}
+
+// Check reports whether v satisfies the constraint.
+func (c Constraint) Check(v Version) bool {
+	for _, set := range c.sets {
+		ok := true
+		for _, cmp := range set {
+			if !cmp.matches(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Constraint) String() string { return c.raw }
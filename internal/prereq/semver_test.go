@@ -0,0 +1,114 @@
+package prereq
+
+import "testing"
+
+func TestConstraintCheck(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{">=8.1", "8.1.0", true},
+		{">=8.1", "8.0.30", false},
+		{">8", "8.0.1", true},
+		{"<3", "2.99", true},
+		{"<3", "3.0.0", false},
+		{"<=3.1", "3.1.0", true},
+		{"8.1", "8.1.27", true},
+		{"8.1", "8.2.0", false},
+		{"=1.2.3", "1.2.3", true},
+		{"1.2.3", "1.2.4", false},
+		{"18.x", "18.19.0", true},
+		{"18.x", "19.0.0", false},
+		{"^18", "18.20.1", true},
+		{"^18", "19.0.0", false},
+		{"^1.2", "1.9.0", true},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"~1.2", "1.2.9", true},
+		{"~1.2", "1.3.0", false},
+		{"~1", "1.9.0", true},
+		{">=1.20 <2", "1.22.3", true},
+		{">=1.20 <2", "2.0.0", false},
+		{">=1.20, <2", "1.19.0", false},
+		{">= 8", "8.0.0", true},
+		{"< 8", "8.0.0", false},
+		{"^7 || ^8", "8.3.6", true},
+		{"^7 || ^8", "9.0.0", false},
+		{"*", "0.0.1", true},
+		{"*", "123.4.5", true},
+		{"x", "1.0.0", true},
+		{"X", "1.0.0", true},
+		{"^7 || *", "9.0.0", true},
+		{">=18", "18.0.0-rc1", false},
+		{">=18.0.0-rc1", "18.0.0-rc2", true},
+	}
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q): %v", tt.constraint, err)
+			continue
+		}
+		v, err := ParseVersion(tt.version)
+		if err != nil {
+			t.Errorf("ParseVersion(%q): %v", tt.version, err)
+			continue
+		}
+		if got := c.Check(v); got != tt.want {
+			t.Errorf("%q.Check(%s) = %v, want %v", tt.constraint, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestParseConstraintErrors(t *testing.T) {
+	for _, s := range []string{"", "||", ">=", "abc", ">=x.1", "^*"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("ParseConstraint(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"1", "1"},
+		{"1.2", "1.2"},
+		{"v1.2.3", "1.2.3"},
+		{"1.2.3-rc1", "1.2.3-rc1"},
+		{"1.2.3+build.5", "1.2.3"},
+		{"18.x", "18"},
+		{"1.*.3", "1"},
+	}
+	for _, tt := range tests {
+		v, err := ParseVersion(tt.in)
+		if err != nil {
+			t.Errorf("ParseVersion(%q): %v", tt.in, err)
+			continue
+		}
+		if got := v.String(); got != tt.want {
+			t.Errorf("ParseVersion(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExtractVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"PHP 8.3.6 (cli) (built: Apr 15 2024)", "8.3.6"},
+		{"go version go1.22.3 linux/amd64", "1.22.3"},
+		{"v18.19.0", "18.19.0"},
+		{"Python 3.12.1", "3.12.1"},
+		{"mongosh 2.2.5-rc0", "2.2.5-rc0"},
+		{"17\n", "17"},
+		{"no version here", ""},
+	}
+	for _, tt := range tests {
+		if got := ExtractVersion(tt.output); got != tt.want {
+			t.Errorf("ExtractVersion(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package prereq
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const versionNumber = `v?(\d+(?:\.\d+){0,2})`
+
+var (
+	versionOpRE      = regexp.MustCompile(`(?i)^\s*(?:version\s+)?(>=|<=|>|<|\^|~|=)\s*` + versionNumber)
+	versionPlusRE    = regexp.MustCompile(`(?i)^\s*(?:version\s+)?` + versionNumber + `\s*\+`)
+	versionLaterRE   = regexp.MustCompile(`(?i)^\s*(?:version\s+)?` + versionNumber + `\s+or\s+(later|higher|newer|greater|above)`)
+	versionEarlierRE = regexp.MustCompile(`(?i)^\s*(?:version\s+)?` + versionNumber + `\s+or\s+(earlier|lower|older|below)`)
+	versionAtLeastRE = regexp.MustCompile(`(?i)^\s*(?:version\s+)?(?:at least|minimum(?: of)?)\s+(?:version\s+)?` + versionNumber)
+	versionBareRE    = regexp.MustCompile(`(?i)^\s*(?:version\s+)?` + versionNumber + `\b`)
+)
+
+// ParseVersionText reads a version constraint at the start of s, such as
+// ">=8.0", "^18.0.0", "8.1+", "18 or later", or a bare "8.2.0". It returns
+// the constraint in the form the checker evaluates and a description of
+// the rule that matched, or two empty strings when s does not start with
+// a version. A bare version is an exact requirement at the precision it
+// was written with.
+func ParseVersionText(s string) (string, string) {
+	if m := versionOpRE.FindStringSubmatch(s); m != nil {
+		return m[1] + m[2], fmt.Sprintf("version: %q is an explicit constraint", m[1]+m[2])
+	}
+	if m := versionLaterRE.FindStringSubmatch(s); m != nil {
+		return ">=" + m[1], fmt.Sprintf("version: %q means >=%s", clause(m[0]), m[1])
+	}
+	if m := versionEarlierRE.FindStringSubmatch(s); m != nil {
+		return "<=" + m[1], fmt.Sprintf("version: %q means <=%s", clause(m[0]), m[1])
+	}
+	if m := versionPlusRE.FindStringSubmatch(s); m != nil {
+		return ">=" + m[1], fmt.Sprintf("version: %q means >=%s", clause(m[0]), m[1])
+	}
+	if m := versionAtLeastRE.FindStringSubmatch(s); m != nil {
+		return ">=" + m[1], fmt.Sprintf("version: %q means >=%s", clause(m[0]), m[1])
+	}
+	if m := versionBareRE.FindStringSubmatch(s); m != nil {
+		return m[1], fmt.Sprintf("version: bare %q is an exact requirement", m[1])
+	}
+	return "", ""
+}
+
+// clause collapses the whitespace in a matched phrase for rule messages.
+func clause(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,375 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// File is a registry together with the text it was read from. Its
+// changes only rewrite the entries they touch, so that the rest of the
+// file keeps its order and formatting and diffs stay small.
+type File struct {
+	*Registry
+	path string
+	data []byte
+	// spans are where each entry of Tests is in data, and close is
+	// where the "]" that ends the tests array is.
+	spans [][2]int
+	close int
+}
+
+// Open reads and validates the registry at path for changing it.
+func Open(path string) (*File, error) {
+	reg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{Registry: reg, path: path, data: data}
+	if err := f.scan(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Path returns the file's path.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Save writes the file back.
+func (f *File) Save() error {
+	return os.WriteFile(f.path, f.data, 0o644)
+}
+
+// Add appends e to the tests, indented like the entries before it.
+func (f *File) Add(e *Entry) error {
+	if f.Find(e.ID) != nil {
+		return fmt.Errorf("the registry already has an entry %q", e.ID)
+	}
+	indent, step := f.indentation()
+	text := formatEntry(e, indent, step)
+	var insert string
+	at := f.close
+	if n := len(f.spans); n > 0 {
+		at = f.spans[n-1][1]
+		insert = ",\n" + indent + text
+	} else {
+		// Replace whatever is between "[" and "]".
+		open := bytes.LastIndexByte(f.data[:f.close], '[')
+		f.data = append(f.data[:open+1], f.data[f.close:]...)
+		at = open + 1
+		insert = "\n" + indent + text + "\n" + lineIndent(f.data, at)
+	}
+	f.data = splice(f.data, at, at, insert)
+	f.Tests = append(f.Tests, e)
+	return f.scan()
+}
+
+// Remove deletes the entry with the given ID, with the comma and line
+// break that separate it from its neighbours.
+func (f *File) Remove(id string) error {
+	i := f.index(id)
+	if i < 0 {
+		return fmt.Errorf("the registry has no entry %q", id)
+	}
+	start, end := f.spans[i][0], f.spans[i][1]
+	switch {
+	case i > 0:
+		start = f.spans[i-1][1]
+	case len(f.spans) > 1:
+		end = f.spans[1][0]
+	default:
+		start = bytes.LastIndexByte(f.data[:start], '[') + 1
+		end = f.close
+	}
+	f.data = splice(f.data, start, end, "")
+	f.Tests = append(f.Tests[:i:i], f.Tests[i+1:]...)
+	return f.scan()
+}
+
+// Update changes the entry with e's ID to e. Only the members whose
+// values changed are rewritten, added or removed; the rest of the entry
+// keeps its text, order and formatting.
+func (f *File) Update(e *Entry) error {
+	i := f.index(e.ID)
+	if i < 0 {
+		return fmt.Errorf("the registry has no entry %q", e.ID)
+	}
+	start, end := f.spans[i][0], f.spans[i][1]
+	ms, err := members(f.data, start, end)
+	if err != nil {
+		return fmt.Errorf("entry %q: %w", e.ID, err)
+	}
+	_, step := f.indentation()
+	indent := lineIndent(f.data, start)
+	inline := !bytes.ContainsRune(f.data[start:end], '\n')
+	old := entryFields(f.Tests[i], indent, step, inline)
+	// Edit from the end of the entry back, so that the offsets of the
+	// members before an edit stay valid.
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	var added []string
+	for n, fd := range entryFields(e, indent, step, inline) {
+		if fd.value == old[n].value {
+			continue
+		}
+		k := slices.IndexFunc(ms, func(m member) bool { return m.key == fd.key })
+		switch {
+		case k < 0:
+			added = append(added, fmt.Sprintf("%q: %s", fd.key, fd.value))
+		case fd.value != "":
+			edits = append(edits, edit{ms[k].value, ms[k].end, fd.value})
+		case k > 0:
+			edits = append(edits, edit{ms[k-1].end, ms[k].end, ""})
+		default:
+			edits = append(edits, edit{ms[k].start, ms[k+1].start, ""})
+		}
+	}
+	if len(added) > 0 {
+		last := ms[len(ms)-1]
+		sep := ",\n" + indent + step
+		if inline {
+			sep = ", "
+		}
+		if len(ms) > 1 {
+			sep = string(f.data[ms[len(ms)-2].end:last.start])
+		}
+		edits = append(edits, edit{last.end, last.end, sep + strings.Join(added, sep)})
+	}
+	slices.SortFunc(edits, func(a, b edit) int { return b.start - a.start })
+	for _, ed := range edits {
+		f.data = splice(f.data, ed.start, ed.end, ed.text)
+	}
+	f.Tests[i] = e
+	return f.scan()
+}
+
+// member is where a member of a JSON object is in the file: its key
+// starts at start, and its value runs from value to end.
+type member struct {
+	key               string
+	start, value, end int
+}
+
+// members returns the members of the JSON object at data[start:end].
+func members(data []byte, start, end int) ([]member, error) {
+	obj := data[start:end]
+	dec := json.NewDecoder(bytes.NewReader(obj))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, errors.New("not a JSON object")
+	}
+	var out []member
+	for dec.More() {
+		keyStart := skipSpace(obj, int(dec.InputOffset()))
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := t.(string)
+		colon := int(dec.InputOffset()) + bytes.IndexByte(obj[dec.InputOffset():], ':')
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+		out = append(out, member{
+			key:   key,
+			start: start + keyStart,
+			value: start + skipSpace(obj, colon+1),
+			end:   start + int(dec.InputOffset()),
+		})
+	}
+	return out, nil
+}
+
+// Find returns the entry with the given ID, or nil.
+func (f *File) Find(id string) *Entry {
+	if i := f.index(id); i >= 0 {
+		return f.Tests[i]
+	}
+	return nil
+}
+
+func (f *File) index(id string) int {
+	for i, e := range f.Tests {
+		if e.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// scan finds where the entries and the end of the tests array are.
+func (f *File) scan() error {
+	dec := json.NewDecoder(bytes.NewReader(f.data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return errors.New("registry is not a JSON object")
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key != "tests" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+		if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+			return errors.New("tests is not an array")
+		}
+		f.spans = f.spans[:0]
+		for dec.More() {
+			start := skipSpace(f.data, int(dec.InputOffset()))
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			f.spans = append(f.spans, [2]int{start, int(dec.InputOffset())})
+		}
+		f.close = skipSpace(f.data, int(dec.InputOffset()))
+		if len(f.spans) != len(f.Tests) {
+			return errors.New("tests changed while they were scanned")
+		}
+		return nil
+	}
+	return errors.New("registry has no tests array")
+}
+
+// indentation returns the indentation of an entry and the step each
+// level below it is indented by. They come from the file's first entry
+// when it spans lines, and otherwise from how far "tests" is indented,
+// or two spaces per level when it is not.
+func (f *File) indentation() (indent, step string) {
+	indent, step = "    ", "  "
+	if tests := bytes.Index(f.data, []byte(`"tests"`)); tests >= 0 {
+		if ws := lineIndent(f.data, tests); ws != "" {
+			step = ws
+		}
+		indent = lineIndent(f.data, tests) + step
+	}
+	if len(f.spans) == 0 {
+		return indent, step
+	}
+	first := f.data[f.spans[0][0]:f.spans[0][1]]
+	indent = lineIndent(f.data, f.spans[0][0])
+	if nl := bytes.IndexByte(first, '\n'); nl >= 0 {
+		inner := lineIndent(first, nl+1)
+		if strings.HasPrefix(inner, indent) && len(inner) > len(indent) {
+			step = inner[len(indent):]
+		}
+	}
+	return indent, step
+}
+
+// lineIndent returns the spaces and tabs that start the line at offset.
+func lineIndent(data []byte, offset int) string {
+	start := bytes.LastIndexByte(data[:offset], '\n') + 1
+	end := start
+	for end < len(data) && (data[end] == ' ' || data[end] == '\t') {
+		end++
+	}
+	return string(data[start:end])
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && strings.IndexByte(" \t\r\n,", data[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+func splice(data []byte, start, end int, insert string) []byte {
+	out := make([]byte, 0, len(data)-(end-start)+len(insert))
+	out = append(out, data[:start]...)
+	out = append(out, insert...)
+	return append(out, data[end:]...)
+}
+
+// formatEntry writes e as a JSON object whose first line is not
+// indented and whose other lines are indented by indent plus step per
+// level. Lists of strings stay on one line, as they are usually written
+// by hand.
+func formatEntry(e *Entry, indent, step string) string {
+	var lines []string
+	for _, fd := range entryFields(e, indent, step, false) {
+		if fd.value != "" {
+			lines = append(lines, fmt.Sprintf("%s%s%q: %s", indent, step, fd.key, fd.value))
+		}
+	}
+	return "{\n" + strings.Join(lines, ",\n") + "\n" + indent + "}"
+}
+
+// entryField is a member of an entry and its value as JSON, or "" when
+// the entry leaves it out.
+type entryField struct {
+	key, value string
+}
+
+// entryFields returns every member an entry can have, in the order
+// formatEntry writes them. The skip object is written on one line when
+// inline is set, and otherwise on lines of its own, indented like
+// formatEntry indents.
+func entryFields(e *Entry, indent, step string, inline bool) []entryField {
+	fields := []entryField{
+		{"id", jsonString(e.ID)},
+		{"path", jsonString(e.Path)},
+		{"owner", jsonString(e.Owner)},
+		{"addedDate", jsonString(e.AddedDate)},
+		{"variants", ""},
+		{"tags", ""},
+		{"notes", ""},
+		{"skip", ""},
+	}
+	if len(e.Variants) > 0 {
+		fields[4].value = jsonList(e.Variants)
+	}
+	if len(e.Tags) > 0 {
+		fields[5].value = jsonList(e.Tags)
+	}
+	if e.Notes != "" {
+		fields[6].value = jsonString(e.Notes)
+	}
+	if e.Skip != nil {
+		skip := []string{`"reason": ` + jsonString(e.Skip.Reason)}
+		if e.Skip.SkipUntil != "" {
+			skip = append(skip, `"skipUntil": `+jsonString(e.Skip.SkipUntil))
+		}
+		if inline {
+			fields[7].value = "{" + strings.Join(skip, ", ") + "}"
+		} else {
+			inner := indent + step + step
+			fields[7].value = "{\n" + inner + strings.Join(skip, ",\n"+inner) + "\n" + indent + step + "}"
+		}
+	}
+	return fields
+}
+
+func jsonString(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func jsonList(ss []string) string {
+	quoted := make([]string, len(ss))
+	for i, s := range ss {
+		quoted[i] = jsonString(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
@@ -0,0 +1,279 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openText writes text to a registry file and opens it.
+func openText(t *testing.T, text string) *File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test-registry.json")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// update returns an edit that changes a copy of an entry with change and
+// passes it to Update, the way the registry commands do.
+func update(id string, change func(e *Entry)) func(f *File) error {
+	return func(f *File) error {
+		cp := *f.Find(id)
+		change(&cp)
+		return f.Update(&cp)
+	}
+}
+
+func TestFileEdits(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		edit func(f *File) error
+		want string
+	}{
+		{
+			name: "remove a one-line skip",
+			text: `{
+  "version": "1.0",
+  "tests": [
+    {"id": "symfony", "path": "source/symfony.txt", "owner": "drivers", "addedDate": "2025-01-01",
+     "skip": {"reason": "flaky", "skipUntil": "2025-01-01"}},
+    {"id": "gone", "path": "source/gone.txt", "owner": "drivers", "addedDate": "2025-01-01"}
+  ]
+}
+`,
+			edit: update("symfony", func(e *Entry) { e.Skip = nil }),
+			want: `{
+  "version": "1.0",
+  "tests": [
+    {"id": "symfony", "path": "source/symfony.txt", "owner": "drivers", "addedDate": "2025-01-01"},
+    {"id": "gone", "path": "source/gone.txt", "owner": "drivers", "addedDate": "2025-01-01"}
+  ]
+}
+`,
+		},
+		{
+			name: "remove a skip and keep the order of the other keys",
+			text: `{
+	"version": "1.0",
+	"tests": [
+		{
+			"path": "source/a.txt",
+			"id": "a",
+			"skip": {
+				"reason": "flaky"
+			},
+			"owner": "docs",
+			"addedDate": "2025-01-01"
+		}
+	]
+}
+`,
+			edit: update("a", func(e *Entry) { e.Skip = nil }),
+			want: `{
+	"version": "1.0",
+	"tests": [
+		{
+			"path": "source/a.txt",
+			"id": "a",
+			"owner": "docs",
+			"addedDate": "2025-01-01"
+		}
+	]
+}
+`,
+		},
+		{
+			name: "remove the first member",
+			text: `{"version": "1.0", "tests": [{"notes": "old", "id": "a", "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01"}]}`,
+			edit: update("a", func(e *Entry) { e.Notes = "" }),
+			want: `{"version": "1.0", "tests": [{"id": "a", "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01"}]}`,
+		},
+		{
+			name: "prune a variant in place",
+			text: `{
+  "version": "1.0",
+  "tests": [
+    {
+      "id": "a",
+      "variants": ["python", "node",   "go"],
+      "path": "a.txt",
+      "owner": "docs",
+      "addedDate": "2025-01-01",
+      "tags": [ "smoke" ]
+    }
+  ]
+}
+`,
+			edit: update("a", func(e *Entry) { e.Variants = []string{"python", "go"} }),
+			want: `{
+  "version": "1.0",
+  "tests": [
+    {
+      "id": "a",
+      "variants": ["python", "go"],
+      "path": "a.txt",
+      "owner": "docs",
+      "addedDate": "2025-01-01",
+      "tags": [ "smoke" ]
+    }
+  ]
+}
+`,
+		},
+		{
+			name: "add a member after the last",
+			text: `{
+  "version": "1.0",
+  "tests": [
+    {
+      "id": "a",
+      "path": "a.txt",
+      "owner": "docs",
+      "addedDate": "2025-01-01"
+    }
+  ]
+}
+`,
+			edit: update("a", func(e *Entry) { e.Skip = &Skip{Reason: "outage", SkipUntil: "2025-02-01"} }),
+			want: `{
+  "version": "1.0",
+  "tests": [
+    {
+      "id": "a",
+      "path": "a.txt",
+      "owner": "docs",
+      "addedDate": "2025-01-01",
+      "skip": {
+        "reason": "outage",
+        "skipUntil": "2025-02-01"
+      }
+    }
+  ]
+}
+`,
+		},
+		{
+			name: "add a member to a one-line entry",
+			text: `{"version": "1.0", "tests": [{"id": "a", "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01"}]}`,
+			edit: update("a", func(e *Entry) { e.Skip = &Skip{Reason: "outage"} }),
+			want: `{"version": "1.0", "tests": [{"id": "a", "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01", "skip": {"reason": "outage"}}]}`,
+		},
+		{
+			name: "update with no change",
+			text: `{"version": "1.0", "tests": [{"id": "a",   "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01", "variants": ["x"]}]}`,
+			edit: update("a", func(*Entry) {}),
+			want: `{"version": "1.0", "tests": [{"id": "a",   "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01", "variants": ["x"]}]}`,
+		},
+		{
+			name: "remove a middle entry",
+			text: `{
+  "version": "1.0",
+  "tests": [
+    {"id": "a", "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01"},
+    {"id": "b", "path": "b.txt", "owner": "docs", "addedDate": "2025-01-01"},
+    {"id": "c", "path": "c.txt", "owner": "docs", "addedDate": "2025-01-01"}
+  ]
+}
+`,
+			edit: func(f *File) error { return f.Remove("b") },
+			want: `{
+  "version": "1.0",
+  "tests": [
+    {"id": "a", "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01"},
+    {"id": "c", "path": "c.txt", "owner": "docs", "addedDate": "2025-01-01"}
+  ]
+}
+`,
+		},
+		{
+			name: "remove the first entry",
+			text: `{"version": "1.0", "tests": [{"id": "a", "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01"}, {"id": "b", "path": "b.txt", "owner": "docs", "addedDate": "2025-01-01"}]}`,
+			edit: func(f *File) error { return f.Remove("a") },
+			want: `{"version": "1.0", "tests": [{"id": "b", "path": "b.txt", "owner": "docs", "addedDate": "2025-01-01"}]}`,
+		},
+		{
+			name: "remove the only entry",
+			text: `{"version": "1.0", "tests": [
+  {"id": "a", "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01"}
+]}`,
+			edit: func(f *File) error { return f.Remove("a") },
+			want: `{"version": "1.0", "tests": []}`,
+		},
+		{
+			name: "add an entry",
+			text: `{
+    "version": "1.0",
+    "tests": [
+        {"id": "a", "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01"}
+    ]
+}
+`,
+			edit: func(f *File) error {
+				return f.Add(&Entry{ID: "b", Path: "b.txt", Owner: "docs", AddedDate: "2025-03-01", Variants: []string{"python"}})
+			},
+			want: `{
+    "version": "1.0",
+    "tests": [
+        {"id": "a", "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01"},
+        {
+            "id": "b",
+            "path": "b.txt",
+            "owner": "docs",
+            "addedDate": "2025-03-01",
+            "variants": ["python"]
+        }
+    ]
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := openText(t, tt.text)
+			if err := tt.edit(f); err != nil {
+				t.Fatal(err)
+			}
+			if got := string(f.data); got != tt.want {
+				t.Errorf("file after the edit:\n%s\nwant:\n%s", got, tt.want)
+			}
+			// The edited text has to read back as the entries the File
+			// now holds.
+			reg, err := Parse(f.data)
+			if err != nil {
+				t.Fatalf("edited file does not parse: %v", err)
+			}
+			if len(reg.Tests) != len(f.Tests) {
+				t.Fatalf("edited file has %d entries, File has %d", len(reg.Tests), len(f.Tests))
+			}
+			for i, e := range reg.Tests {
+				if got, want := formatEntry(e, "", "  "), formatEntry(f.Tests[i], "", "  "); got != want {
+					t.Errorf("entry %d reads back as\n%s\nwant\n%s", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFileErrors(t *testing.T) {
+	text := `{"version": "1.0", "tests": [{"id": "a", "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01"}]}`
+	f := openText(t, text)
+	if err := f.Add(&Entry{ID: "a", Path: "b.txt", Owner: "docs", AddedDate: "2025-01-01"}); err == nil {
+		t.Error("Add of an existing ID succeeded")
+	}
+	if err := f.Remove("missing"); err == nil {
+		t.Error("Remove of a missing ID succeeded")
+	}
+	if err := f.Update(&Entry{ID: "missing"}); err == nil {
+		t.Error("Update of a missing ID succeeded")
+	}
+	if string(f.data) != text {
+		t.Errorf("failed edits changed the file:\n%s", f.data)
+	}
+}
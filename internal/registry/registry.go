@@ -0,0 +1,400 @@
+// Package registry reads the test registry: the curated list of pages
+// that CI runs, with the team that owns each, the variants to test, tags
+// to select them by and temporary skips.
+//
+// The registry is a JSON file, usually test-registry.json, that Schema
+// describes. Paths in it are relative to the root of the repository the
+// registry is in.
+package registry
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+// Schema is the JSON Schema (draft 2020-12) of Registry.
+//
+//go:embed schema.json
+var Schema []byte
+
+// Version is the registry version this package writes. Registries with
+// the same major version can be read.
+const Version = "1.0"
+
+// DateFormat is how dates are written in the registry.
+const DateFormat = "2006-01-02"
+
+// Registry is a test registry file.
+type Registry struct {
+	Version     string   `json:"version"`
+	Description string   `json:"description,omitempty"`
+	Tests       []*Entry `json:"tests"`
+
+	// Root is the directory entry paths are relative to.
+	Root string `json:"-"`
+}
+
+// Entry is a page the registry runs.
+type Entry struct {
+	ID   string `json:"id"`
+	Path string `json:"path"`
+	// Owner is the team or person responsible for the page's procedures.
+	Owner     string `json:"owner"`
+	AddedDate string `json:"addedDate"`
+	// Variants select the variants to test, as runner.VariantMatches
+	// reads them. Empty tests every variant. Procedures without variants
+	// are always tested.
+	Variants []string `json:"variants,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Notes    string   `json:"notes,omitempty"`
+	Skip     *Skip    `json:"skip,omitempty"`
+}
+
+// Skip turns an entry off for now.
+type Skip struct {
+	Reason string `json:"reason"`
+	// SkipUntil is the date from which the entry runs again. Empty skips
+	// it until the skip is removed.
+	SkipUntil string `json:"skipUntil,omitempty"`
+}
+
+// Load reads and validates the registry at path. Its root is the
+// repository the file is in, or the file's directory outside one.
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	reg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	reg.Root = repositoryRoot(filepath.Dir(path))
+	return reg, nil
+}
+
+// Parse reads and validates a registry. Fields the schema does not have
+// are errors, so that a misspelled "skipUntil" does not go unnoticed.
+func Parse(data []byte) (*Registry, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var reg Registry
+	if err := dec.Decode(&reg); err != nil {
+		return nil, fmt.Errorf("invalid registry: %w", err)
+	}
+	if err := reg.Validate(); err != nil {
+		return nil, err
+	}
+	return &reg, nil
+}
+
+// Validate checks the registry against Schema, and that entry IDs are
+// unique. It reports every problem it finds.
+func (r *Registry) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	switch {
+	case r.Version == "":
+		add("registry must have a version")
+	case major(r.Version) != major(Version):
+		add("registry version %q is not supported; want %s.x", r.Version, major(Version))
+	}
+	if r.Tests == nil {
+		add("registry must have a tests array")
+	}
+	seen := map[string]bool{}
+	for i, e := range r.Tests {
+		name := fmt.Sprintf("tests[%d]", i)
+		if e == nil {
+			add("%s: entry must be an object", name)
+			continue
+		}
+		if e.ID != "" {
+			name += " (" + e.ID + ")"
+		}
+		for _, f := range []struct{ key, value string }{{"id", e.ID}, {"path", e.Path}, {"owner", e.Owner}, {"addedDate", e.AddedDate}} {
+			if strings.TrimSpace(f.value) == "" {
+				add("%s: %s is required", name, f.key)
+			}
+		}
+		if e.ID != "" {
+			if seen[e.ID] {
+				add("%s: duplicate test ID %q", name, e.ID)
+			}
+			seen[e.ID] = true
+		}
+		switch clean := path.Clean(filepath.ToSlash(e.Path)); {
+		case filepath.IsAbs(e.Path):
+			add("%s: path %q must be relative to the repository root", name, e.Path)
+		case clean == ".." || strings.HasPrefix(clean, "../"):
+			add("%s: path %q is outside the repository", name, e.Path)
+		}
+		if e.AddedDate != "" && !validDate(e.AddedDate) {
+			add("%s: addedDate %q is not a date like 2024-01-15", name, e.AddedDate)
+		}
+		for _, list := range []struct {
+			key    string
+			values []string
+		}{{"variants", e.Variants}, {"tags", e.Tags}} {
+			for j, v := range list.values {
+				switch {
+				case strings.TrimSpace(v) == "":
+					add("%s: %s[%d] is empty", name, list.key, j)
+				case slices.Index(list.values, v) < j:
+					add("%s: %s lists %q twice", name, list.key, v)
+				}
+			}
+		}
+		for _, v := range e.Variants {
+			if _, _, err := runner.ParseVariantSelection(v); err != nil {
+				add("%s: %v", name, err)
+			}
+		}
+		if e.Skip != nil {
+			if strings.TrimSpace(e.Skip.Reason) == "" {
+				add("%s: skip.reason is required", name)
+			}
+			if e.Skip.SkipUntil != "" && !validDate(e.Skip.SkipUntil) {
+				add("%s: skip.skipUntil %q is not a date like 2024-03-01", name, e.Skip.SkipUntil)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validDate(s string) bool {
+	_, err := time.Parse(DateFormat, s)
+	return err == nil
+}
+
+func major(v string) string {
+	m, _, _ := strings.Cut(v, ".")
+	return m
+}
+
+// Select returns the entries that have any of tags, when tags are
+// given, and belong to owner, when it is given, in registry order.
+func (r *Registry) Select(tags []string, owner string) []*Entry {
+	var out []*Entry
+	for _, e := range r.Tests {
+		if len(tags) > 0 && !slices.ContainsFunc(tags, func(t string) bool { return slices.Contains(e.Tags, t) }) {
+			continue
+		}
+		if owner != "" && e.Owner != owner {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// Path returns where the page of e is, relative to the current directory
+// when it can be.
+func (r *Registry) Path(e *Entry) string {
+	path := filepath.Join(r.Root, filepath.FromSlash(e.Path))
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil {
+			return rel
+		}
+	}
+	return path
+}
+
+// SkipReason returns why e is skipped on the date of now, or "" when it
+// is not: it has no skip, or its skipUntil date has come.
+func (e *Entry) SkipReason(now time.Time) string {
+	if e.Skip == nil {
+		return ""
+	}
+	if e.Skip.SkipUntil == "" {
+		return "skipped in the test registry: " + e.Skip.Reason
+	}
+	if !e.Expired(now) {
+		return fmt.Sprintf("skipped in the test registry until %s: %s", e.Skip.SkipUntil, e.Skip.Reason)
+	}
+	return ""
+}
+
+// Expired reports whether e has a skip whose skipUntil date has come on
+// the date of now.
+func (e *Entry) Expired(now time.Time) bool {
+	if e.Skip == nil || e.Skip.SkipUntil == "" {
+		return false
+	}
+	// Dates written as YYYY-MM-DD compare in order as strings.
+	return validDate(e.Skip.SkipUntil) && now.Format(DateFormat) >= e.Skip.SkipUntil
+}
+
+// MissingVariants returns the variants e lists that no procedure of doc
+// has.
+func (e *Entry) MissingVariants(doc *ast.Document) []string {
+	var missing []string
+	for _, spec := range e.Variants {
+		found := false
+		for _, j := range runner.Jobs(doc) {
+			if runner.VariantMatches(spec, j.Variant) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, spec)
+		}
+	}
+	return missing
+}
+
+// Jobs returns the test cases e selects in doc, with e's owner, tags
+// and, on the date of now, skip: every procedure without variants and
+// the variants of the others that e lists, or all of them when it lists
+// none.
+func (e *Entry) Jobs(doc *ast.Document, now time.Time) []runner.Job {
+	var out []runner.Job
+	for _, j := range runner.Jobs(doc) {
+		if j.Variant != nil && len(e.Variants) > 0 && !slices.ContainsFunc(e.Variants, func(spec string) bool { return runner.VariantMatches(spec, j.Variant) }) {
+			continue
+		}
+		j.Owner, j.Tags, j.SkipReason = e.Owner, e.Tags, e.SkipReason(now)
+		out = append(out, j)
+	}
+	return out
+}
+
+// Problem is something wrong with the page of a registry entry.
+type Problem struct {
+	Entry *Entry
+	// Missing is set when the page does not exist.
+	Missing bool
+	// Variants are the variants the entry lists that the page does not
+	// have.
+	Variants []string
+	// Err is set when the page cannot be parsed.
+	Err error
+}
+
+func (p Problem) Error() string {
+	switch {
+	case p.Missing:
+		return fmt.Sprintf("registry entry %s: page %s does not exist", p.Entry.ID, p.Entry.Path)
+	case p.Err != nil:
+		return fmt.Sprintf("registry entry %s: %v", p.Entry.ID, p.Err)
+	}
+	return fmt.Sprintf("registry entry %s: %s has no variant %s", p.Entry.ID, p.Entry.Path, strings.Join(quoteAll(p.Variants), ", "))
+}
+
+// Check parses the page of each entry with parse and checks it against
+// the entry: that it exists and has every variant the entry lists. The
+// documents are in the order of entries, nil where a page could not be
+// read.
+func (r *Registry) Check(entries []*Entry, parse func(path string) (*ast.Document, error)) ([]*ast.Document, []Problem) {
+	docs := make([]*ast.Document, len(entries))
+	var problems []Problem
+	for i, e := range entries {
+		path := r.Path(e)
+		if _, err := os.Stat(path); err != nil {
+			problems = append(problems, Problem{Entry: e, Missing: true})
+			continue
+		}
+		doc, err := parse(path)
+		if err != nil {
+			problems = append(problems, Problem{Entry: e, Err: err})
+			continue
+		}
+		if missing := e.MissingVariants(doc); len(missing) > 0 {
+			problems = append(problems, Problem{Entry: e, Variants: missing})
+		}
+		docs[i] = doc
+	}
+	return docs, problems
+}
+
+// Pages is Check with the problems as one error.
+func (r *Registry) Pages(entries []*Entry, parse func(path string) (*ast.Document, error)) ([]*ast.Document, error) {
+	docs, problems := r.Check(entries, parse)
+	errs := make([]error, len(problems))
+	for i, p := range problems {
+		errs[i] = p
+	}
+	return docs, errors.Join(errs...)
+}
+
+// Moved looks for where the missing page of e went: the one file under
+// Root with the same name, as a path relative to Root. It returns ""
+// when there is none or several.
+func (r *Registry) Moved(e *Entry) string {
+	name := filepath.Base(filepath.FromSlash(e.Path))
+	var found []string
+	filepath.WalkDir(r.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != r.Root && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() == name {
+			if rel, err := filepath.Rel(r.Root, path); err == nil {
+				found = append(found, filepath.ToSlash(rel))
+			}
+		}
+		return nil
+	})
+	if len(found) != 1 {
+		return ""
+	}
+	return found[0]
+}
+
+// RelativePath returns path, relative to the current directory, as an
+// entry path: relative to Root, with forward slashes.
+func (r *Registry) RelativePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	root, err := filepath.Abs(r.Root)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the repository the registry is in", path)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func quoteAll(ss []string) []string {
+	out := make([]string, len(ss))
+	for i, s := range ss {
+		out[i] = fmt.Sprintf("%q", s)
+	}
+	return out
+}
+
+// repositoryRoot returns the top of the git repository dir is in, or
+// dir itself when it is in none.
+func repositoryRoot(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel").Output()
+	if root := strings.TrimSpace(string(out)); err == nil && root != "" {
+		return root
+	}
+	return dir
+}
@@ -0,0 +1,146 @@
+package registry
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeRegistry writes text to test-registry.json in a new directory and
+// returns its path.
+func writeRegistry(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test-registry.json")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// want are the problems the error has to list.
+		want []string
+	}{
+		{
+			name: "missing version",
+			text: `{"tests": []}`,
+			want: []string{"registry must have a version"},
+		},
+		{
+			name: "another major version",
+			text: `{"version": "2.0", "tests": []}`,
+			want: []string{`registry version "2.0" is not supported; want 1.x`},
+		},
+		{
+			name: "missing tests",
+			text: `{"version": "1.0"}`,
+			want: []string{"registry must have a tests array"},
+		},
+		{
+			name: "unknown top-level key",
+			text: `{"version": "1.0", "tests": [], "owners": {}}`,
+			want: []string{`unknown field "owners"`},
+		},
+		{
+			name: "unknown entry key",
+			text: `{"version": "1.0", "tests": [{"id": "a", "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01", "tag": ["x"]}]}`,
+			want: []string{`unknown field "tag"`},
+		},
+		{
+			name: "misspelled skipUntil",
+			text: `{"version": "1.0", "tests": [{"id": "a", "path": "a.txt", "owner": "docs", "addedDate": "2025-01-01", "skip": {"reason": "flaky", "skip_until": "2025-03-01"}}]}`,
+			want: []string{`unknown field "skip_until"`},
+		},
+		{
+			name: "not JSON",
+			text: `{"version": "1.0", "tests": [}`,
+			want: []string{"invalid registry"},
+		},
+		{
+			name: "bad paths",
+			text: `{"version": "1.0", "tests": [
+  {"id": "abs", "path": "/docs/source/a.txt", "owner": "docs", "addedDate": "2025-01-01"},
+  {"id": "up", "path": "../other-repo/source/a.txt", "owner": "docs", "addedDate": "2025-01-01"},
+  {"id": "hidden", "path": "source/../../a.txt", "owner": "docs", "addedDate": "2025-01-01"},
+  {"id": "empty", "path": " ", "owner": "docs", "addedDate": "2025-01-01"}
+]}`,
+			want: []string{
+				`tests[0] (abs): path "/docs/source/a.txt" must be relative to the repository root`,
+				`tests[1] (up): path "../other-repo/source/a.txt" is outside the repository`,
+				`tests[2] (hidden): path "source/../../a.txt" is outside the repository`,
+				"tests[3] (empty): path is required",
+			},
+		},
+		{
+			name: "every problem of the entries",
+			text: `{"version": "1.0", "tests": [
+  {"id": "a", "path": "a.txt", "addedDate": "15/01/2025", "tags": ["x", "x", ""], "skip": {"reason": "", "skipUntil": "soon"}},
+  {"id": "a", "path": "b.txt", "owner": "docs", "addedDate": "2025-01-01", "variants": ["language="]},
+  null
+]}`,
+			want: []string{
+				"tests[0] (a): owner is required",
+				`tests[0] (a): addedDate "15/01/2025" is not a date like 2024-01-15`,
+				`tests[0] (a): tags lists "x" twice`,
+				"tests[0] (a): tags[2] is empty",
+				"tests[0] (a): skip.reason is required",
+				`tests[0] (a): skip.skipUntil "soon" is not a date like 2024-03-01`,
+				`tests[1] (a): duplicate test ID "a"`,
+				"tests[1] (a): ",
+				"tests[2]: entry must be an object",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeRegistry(t, tt.text)
+			reg, err := Load(path)
+			if err == nil {
+				t.Fatalf("Load() = %+v, want an error", reg)
+			}
+			if !strings.HasPrefix(err.Error(), path+": ") {
+				t.Errorf("error %q does not name the file", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error does not contain %q:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadRoot(t *testing.T) {
+	repo := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", repo).CombinedOutput(); err != nil {
+		t.Skipf("git init: %v: %s", err, out)
+	}
+	dir := filepath.Join(repo, "ci")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	text := `{"version": "1.3", "tests": [{"id": "a", "path": "source/a.txt", "owner": "docs", "addedDate": "2025-01-01", "skip": {"reason": "flaky"}}]}`
+	if err := os.WriteFile(filepath.Join(dir, "test-registry.json"), []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reg, err := Load(filepath.Join(dir, "test-registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.Root != repo {
+		t.Errorf("Root = %s, want the repository %s", reg.Root, repo)
+	}
+
+	outside := writeRegistry(t, text)
+	if reg, err = Load(outside); err != nil {
+		t.Fatal(err)
+	}
+	if reg.Root != filepath.Dir(outside) {
+		t.Errorf("Root = %s outside a repository, want the registry's directory", reg.Root)
+	}
+}
@@ -0,0 +1,111 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/redact"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+	"github.com/dacharyc/spike-procedural-testing/results"
+)
+
+// NDJSON writes the event stream the results package describes, one JSON
+// object per line, as the run progresses. The stream is written from
+// events, so Runner.OnEvent has to be set to its Event method; Summary
+// ends it with run-end.
+type NDJSON struct {
+	// Total is the number of test cases in the run, reported on
+	// run-start.
+	Total int
+	// Redactor hides secrets in commands and output.
+	Redactor *redact.Redactor
+
+	w  io.Writer
+	mu sync.Mutex
+	// started is set once run-start is written.
+	started bool
+	// err is the first write that failed; Summary returns it.
+	err error
+}
+
+// NewNDJSON returns an event stream reporter that writes to w.
+func NewNDJSON(w io.Writer) *NDJSON {
+	return &NDJSON{w: w}
+}
+
+// Event writes e to the stream. It is safe to call from several
+// goroutines.
+func (n *NDJSON) Event(e runner.Event) {
+	c := converter{red: n.Redactor, lines: map[string][]string{}}
+	tc := &runner.ProcedureResult{Procedure: e.Procedure, Variant: e.Variant}
+	out := results.Event{Time: e.Time.UTC(), ID: tc.ID(), File: e.File, Name: tc.Name()}
+	switch e.Type {
+	case runner.EventProcedureStarted:
+		out.Type = results.EventProcedureStart
+	case runner.EventStepStarted:
+		out.Type = results.EventStepStart
+		out.Step, out.StepTitle = e.Step, e.StepTitle
+	case runner.EventOutput:
+		out.Type = results.EventActionOutput
+		loc := location(e.Action.Base().Location)
+		out.Step, out.Action, out.Stream, out.Output = e.Step, &loc, e.Stream, c.redact(e.Output)
+	case runner.EventStepFinished:
+		out.Type = results.EventStepEnd
+		out.Step, out.StepTitle = e.Step, e.StepTitle
+		out.Status, out.Duration, out.Error = status(e.Success), e.Duration.Milliseconds(), c.error(e.Error)
+	case runner.EventCleanup:
+		out.Type = results.EventCleanup
+		cl := c.cleanup(*e.Cleanup)
+		out.Cleanup = &cl
+	case runner.EventProcedureFinished:
+		out.Type = results.EventProcedureEnd
+		r := c.result(e.Result)
+		out.Name, out.Result = r.Name, &r
+	default:
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.write(out)
+}
+
+func (n *NDJSON) Procedure(r *runner.ProcedureResult) error {
+	return nil
+}
+
+func (n *NDJSON) Summary(s *runner.Summary) error {
+	sum := summary(s)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.write(results.Event{Type: results.EventRunEnd, Time: time.Now().UTC(), Summary: &sum})
+	return n.err
+}
+
+// write writes e as one line, after run-start if that has not been
+// written yet. A line is a single write so that it is never split, and
+// "<" and "&" are left unescaped since the stream is not HTML.
+func (n *NDJSON) write(e results.Event) {
+	if !n.started {
+		n.started = true
+		n.write(results.Event{
+			Type:    results.EventRunStart,
+			Time:    e.Time,
+			Version: results.EventsVersion,
+			Tool:    &results.Tool{Name: "proctest", Version: Version()},
+			Total:   n.Total,
+		})
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(e)
+	if err == nil {
+		_, err = n.w.Write(buf.Bytes())
+	}
+	if err != nil && n.err == nil {
+		n.err = err
+	}
+}
@@ -0,0 +1,271 @@
+package report
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/redact"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+	"github.com/dacharyc/spike-procedural-testing/results"
+)
+
+// HTML writes a self-contained HTML report once the run ends. The report
+// is rendered from the results document, so WriteHTML can also render
+// one from an archived results file.
+type HTML struct {
+	// Redactor hides secrets in commands and output.
+	Redactor *redact.Redactor
+
+	w io.Writer
+}
+
+// NewHTML returns an HTML reporter that writes to w.
+func NewHTML(w io.Writer) *HTML {
+	return &HTML{w: w}
+}
+
+func (h *HTML) Procedure(r *runner.ProcedureResult) error {
+	return nil
+}
+
+func (h *HTML) Summary(s *runner.Summary) error {
+	return WriteHTML(h.w, Document(s, h.Redactor))
+}
+
+//go:embed html.tmpl
+var htmlTemplate string
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"millis": millis,
+	"diff":   lineDiff,
+	"join":   strings.Join,
+	"data":   dataList,
+	"types":  actionTypes,
+	"text":   xmlSafe,
+	"dedent": dedent,
+	"where":  where,
+}).Parse(htmlTemplate))
+
+// where formats loc as the line of the page it is on, followed by the
+// line of the included file when it comes from one.
+func where(loc results.Location) string {
+	page := loc.Outermost()
+	s := fmt.Sprintf("%s:%d", page.File, page.StartLine)
+	if loc.IncludedFrom != nil {
+		s += fmt.Sprintf(", in the included %s:%d", loc.File, loc.StartLine)
+	}
+	return s
+}
+
+// htmlPage is a page of the report: the procedures of one file.
+type htmlPage struct {
+	File       string
+	Procedures []*htmlProcedure
+}
+
+// htmlProcedure is a procedure and the test cases of its variants.
+type htmlProcedure struct {
+	Title       string
+	HeadingPath []string
+	Location    results.Location
+	Results     []results.Result
+}
+
+// Status is failed when any variant failed, skipped when every variant
+// was skipped, and passed otherwise.
+func (p *htmlProcedure) Status() string {
+	skipped := 0
+	for _, r := range p.Results {
+		switch r.Status {
+		case results.StatusFailed:
+			return results.StatusFailed
+		case results.StatusSkipped:
+			skipped++
+		}
+	}
+	if skipped == len(p.Results) {
+		return results.StatusSkipped
+	}
+	return results.StatusPassed
+}
+
+// htmlFilters are the values the report's filters offer.
+type htmlFilters struct {
+	Owners      []string
+	Tags        []string
+	Statuses    []string
+	ActionTypes []string
+}
+
+// WriteHTML renders doc as an HTML page with no external assets.
+func WriteHTML(w io.Writer, doc *results.Document) error {
+	var pages []*htmlPage
+	var f htmlFilters
+	for _, r := range doc.Results {
+		i := slices.IndexFunc(pages, func(p *htmlPage) bool { return p.File == r.File })
+		if i < 0 {
+			i = len(pages)
+			pages = append(pages, &htmlPage{File: r.File})
+		}
+		page := pages[i]
+		j := slices.IndexFunc(page.Procedures, func(p *htmlProcedure) bool {
+			return p.Title == r.Procedure.Title && p.Location.File == r.Procedure.Location.File && p.Location.StartLine == r.Procedure.Location.StartLine
+		})
+		if j < 0 {
+			j = len(page.Procedures)
+			page.Procedures = append(page.Procedures, &htmlProcedure{Title: r.Procedure.Title, HeadingPath: r.Procedure.HeadingPath, Location: r.Procedure.Location})
+		}
+		page.Procedures[j].Results = append(page.Procedures[j].Results, r)
+
+		if r.Owner != "" {
+			f.Owners = append(f.Owners, r.Owner)
+		}
+		f.Tags = append(f.Tags, r.Tags...)
+		f.Statuses = append(f.Statuses, r.Status)
+		f.ActionTypes = append(f.ActionTypes, actionTypes(r)...)
+	}
+	for _, values := range []*[]string{&f.Owners, &f.Tags, &f.Statuses, &f.ActionTypes} {
+		slices.Sort(*values)
+		*values = slices.Compact(*values)
+	}
+	return htmlReport.Execute(w, struct {
+		Doc     *results.Document
+		Pages   []*htmlPage
+		Filters htmlFilters
+	}{doc, pages, f})
+}
+
+// actionTypes returns the types of the actions a test case ran.
+func actionTypes(r results.Result) []string {
+	var out []string
+	add := func(actions []results.Action) {
+		for _, a := range actions {
+			if !slices.Contains(out, a.Type) {
+				out = append(out, a.Type)
+			}
+		}
+	}
+	for _, st := range r.Steps {
+		add(st.Actions)
+		for _, sub := range st.SubSteps {
+			add(sub.Actions)
+		}
+	}
+	return out
+}
+
+// dataList joins values for a data attribute the filter script splits on
+// newlines.
+func dataList(values []string) string {
+	return strings.Join(values, "\n")
+}
+
+// dedent removes the indentation that every line of s shares.
+func dedent(s string) string {
+	lines := strings.Split(s, "\n")
+	indent := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		n := len(l) - len(strings.TrimLeft(l, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i, l := range lines {
+		if len(l) >= indent && indent > 0 {
+			lines[i] = l[indent:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func millis(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	if d < time.Second {
+		return fmt.Sprintf("%dms", ms)
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+// diffLine is a line of a diff: Op is " " for a line both sides share,
+// "-" for a line only the expected output has and "+" for one only the
+// actual output has.
+type diffLine struct {
+	Op   string
+	Text string
+}
+
+// Class is the CSS class of the line.
+func (l diffLine) Class() string {
+	switch l.Op {
+	case "-":
+		return "removed"
+	case "+":
+		return "added"
+	}
+	return "same"
+}
+
+// maxDiffCells bounds the work lineDiff does; longer outputs are shown
+// as a removal followed by an addition.
+const maxDiffCells = 1 << 20
+
+// lineDiff compares the expected and actual output line by line.
+func lineDiff(expected, actual string) []diffLine {
+	a := strings.Split(strings.TrimRight(expected, "\n"), "\n")
+	b := strings.Split(strings.TrimRight(actual, "\n"), "\n")
+	var out []diffLine
+	if len(a)*len(b) > maxDiffCells {
+		for _, l := range a {
+			out = append(out, diffLine{"-", l})
+		}
+		for _, l := range b {
+			out = append(out, diffLine{"+", l})
+		}
+		return out
+	}
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, diffLine{" ", a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, diffLine{"-", a[i]})
+			i++
+		default:
+			out = append(out, diffLine{"+", b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, diffLine{"-", a[i]})
+	}
+	for ; j < len(b); j++ {
+		out = append(out, diffLine{"+", b[j]})
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dacharyc/spike-procedural-testing/results"
+)
+
+// includedFailure is a run whose only test case failed on line 4 of an
+// included file that line 18 of the page includes.
+func includedFailure() *results.Document {
+	page := results.Location{File: "source/tutorial/install.txt", StartLine: 18, EndLine: 18}
+	return &results.Document{
+		Results: []results.Result{{
+			File:   page.File,
+			Name:   "Install the driver",
+			Status: results.StatusFailed,
+			Procedure: results.Procedure{
+				Title:    "Install the driver",
+				Location: results.Location{File: "source/includes/steps-install.rst", StartLine: 1, EndLine: 20, IncludedFrom: &page},
+			},
+			Steps: []results.Step{},
+			Error: &results.Error{
+				Type:     "execute",
+				Message:  "exit status 1",
+				Location: results.Location{File: "source/includes/steps-install.rst", StartLine: 4, EndLine: 6, IncludedFrom: &page},
+			},
+		}},
+		Summary: results.Summary{Total: 1, Failed: 1},
+	}
+}
+
+func TestHTMLLocatesFailuresOnThePage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, includedFailure()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`<span class="muted">line 18</span>`,
+		`<div class="muted">source/tutorial/install.txt:18, in the included source/includes/steps-install.rst:4</div>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report does not contain %q", want)
+		}
+	}
+}
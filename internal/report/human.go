@@ -0,0 +1,411 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/cleanup"
+	"github.com/dacharyc/spike-procedural-testing/internal/redact"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+	"github.com/dacharyc/spike-procedural-testing/internal/sandbox"
+)
+
+// Verbosity selects how much the human reporter prints.
+type Verbosity int
+
+const (
+	// Quiet prints failures and the summary only.
+	Quiet Verbosity = iota - 1
+	// Normal prints every procedure with the details of failures.
+	Normal
+	// Verbose adds every step and longer command output.
+	Verbose
+)
+
+// Human writes the plain-text report described in the usage guide.
+// Variants are grouped under their procedure, and a failure shows the
+// command that failed, the end of its output and where it is in the
+// source, through any includes.
+type Human struct {
+	Verbosity Verbosity
+	// Color turns on ANSI colors.
+	Color bool
+	// Live keeps a progress line at the bottom of the output while
+	// procedures run. It is only for terminals.
+	Live bool
+	// Total is how many procedures the run has, for the progress line.
+	Total int
+	// Redactor hides secrets in the commands and output shown for
+	// failures.
+	Redactor *redact.Redactor
+
+	w     io.Writer
+	mu    sync.Mutex
+	file  string
+	group string
+	progress
+}
+
+// NewHuman returns a human-readable reporter that writes to w.
+func NewHuman(w io.Writer) *Human {
+	return &Human{w: w}
+}
+
+var statusMarks = map[runner.Status]string{
+	runner.StatusPassed:  "✓",
+	runner.StatusFailed:  "✗",
+	runner.StatusSkipped: "⊘",
+}
+
+// outputLines is how much of a failed command's output is shown.
+var outputLines = map[Verbosity]int{Quiet: 10, Normal: 10, Verbose: 40}
+
+func (h *Human) Procedure(r *runner.ProcedureResult) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.Verbosity == Quiet && r.Status() != runner.StatusFailed {
+		return h.redraw()
+	}
+	st := style{h.Color}
+
+	var b strings.Builder
+	if r.File != h.file {
+		h.file, h.group = r.File, ""
+		fmt.Fprintf(&b, "Testing: %s\n\n", st.bold(r.File))
+	}
+	prefix, name := "", r.Name()
+	if r.Variant != nil {
+		if r.Procedure.ID != h.group {
+			h.group = r.Procedure.ID
+			fmt.Fprintf(&b, "%s %s\n", st.bold(r.Procedure.Title), st.dim("("+plural(len(r.Procedure.Variants), "variant")+")"))
+		}
+		prefix, name = "  ", r.Variant.Label
+		if name == "" {
+			name = r.Variant.ID
+		}
+	} else {
+		h.group = ""
+	}
+	for _, line := range strings.SplitAfter(h.procedure(r, name, st), "\n") {
+		if strings.TrimSpace(line) != "" {
+			b.WriteString(prefix)
+		}
+		b.WriteString(line)
+	}
+	h.clear()
+	if _, err := io.WriteString(h.w, b.String()); err != nil {
+		return err
+	}
+	return h.redraw()
+}
+
+// procedure formats one result, with its details indented by two spaces.
+func (h *Human) procedure(r *runner.ProcedureResult, name string, st style) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s: %s\n", st.status(r.Status(), statusMarks[r.Status()]), st.status(r.Status(), strings.ToUpper(string(r.Status()))), name)
+
+	if len(r.PrerequisiteChecks) > 0 {
+		b.WriteString("  Prerequisites:\n")
+		for _, c := range r.PrerequisiteChecks {
+			mark := st.green("✓")
+			switch {
+			case !c.Met && c.Requirement.Base().Optional:
+				mark = st.yellow("!")
+			case !c.Met:
+				mark = st.red("✗")
+			case !c.Verified:
+				mark = st.yellow("?")
+			}
+			fmt.Fprintf(&b, "    %s %s\n", mark, c.Message)
+		}
+		if r.PrerequisitesIgnored {
+			b.WriteString("    (unmet prerequisites ignored)\n")
+		}
+	}
+	if r.Skipped {
+		b.WriteString("  Skip reason:\n")
+		for _, line := range strings.Split(r.SkipReason, "\n") {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	} else {
+		passed := 0
+		for _, s := range r.Steps {
+			if s.Success {
+				passed++
+			}
+		}
+		// A failed step ends the run, so the steps after it are counted
+		// as not run.
+		fmt.Fprintf(&b, "  Steps: %d/%d passed", passed, max(r.PlannedSteps, len(r.Steps)))
+		if notRun := r.PlannedSteps - len(r.Steps); notRun > 0 {
+			fmt.Fprintf(&b, ", %d not run", notRun)
+		}
+		b.WriteString("\n")
+		if h.Verbosity == Verbose {
+			b.WriteString(steps(r, st))
+		}
+	}
+	if waits := waits(r, st); len(waits) > 0 {
+		b.WriteString("  Waits:\n")
+		for _, w := range waits {
+			fmt.Fprintf(&b, "    %s\n", w)
+		}
+	}
+	if flaky := flakySteps(r); len(flaky) > 0 {
+		b.WriteString("  Flaky (passed after a retry):\n")
+		for _, f := range flaky {
+			fmt.Fprintf(&b, "    %s %s\n", st.yellow("~"), f)
+		}
+	}
+	if r.Error != nil {
+		b.WriteString(h.failure(r, st))
+	}
+	if failed := cleanup.Failed(r.Cleanup); len(failed) > 0 {
+		b.WriteString("  Cleanup warnings:\n")
+		for _, c := range failed {
+			fmt.Fprintf(&b, "    %s %s: %s\n", st.yellow("!"), c.Description, c.Error)
+		}
+	}
+	if len(r.Cleanup) > 0 && r.Cleanup[0].Skipped {
+		b.WriteString("  Cleanup skipped, left in place:\n")
+		for _, c := range r.Cleanup {
+			fmt.Fprintf(&b, "    - %s\n", c.Description)
+		}
+	}
+	if r.Artifacts != "" {
+		fmt.Fprintf(&b, "  Artifacts: %s\n", relative(r.Artifacts))
+	}
+	fmt.Fprintf(&b, "  Duration: %s\n\n", st.dim(r.Duration.Round(100*time.Millisecond).String()))
+	return b.String()
+}
+
+// failure describes the error of a failed procedure: the step, the
+// message, the command that ran and the end of its output, and the
+// source location with the includes that led to it.
+func (h *Human) failure(r *runner.ProcedureResult, st style) string {
+	var b strings.Builder
+	e := r.Error
+	title := e.Context.StepTitle
+	if e.Context.SubStepNumber != "" {
+		title = subStepTitle(r, e.Context)
+	}
+	fmt.Fprintf(&b, "  %s %s\n", st.red("Error in Step "+e.Context.Step()+":"), title)
+	fmt.Fprintf(&b, "    %s\n", h.redact(e.Message))
+	if fa := r.FailedAction(); fa != nil && fa.Execution.Command != "" && !fa.Replayed {
+		lines := strings.Split(strings.TrimRight(h.redact(fa.Execution.Command), "\n"), "\n")
+		for i, line := range lines {
+			if i == 10 {
+				fmt.Fprintf(&b, "      %s\n", st.dim(fmt.Sprintf("… %d more lines", len(lines)-i)))
+				break
+			}
+			mark := "$"
+			if i > 0 {
+				mark = ">"
+			}
+			fmt.Fprintf(&b, "    %s %s\n", st.dim(mark), line)
+		}
+		label, out := "stderr", fa.Execution.Stderr
+		if strings.TrimSpace(out) == "" {
+			label, out = "stdout", fa.Execution.Stdout
+		}
+		if tail, total := tailLines(h.redact(out), outputLines[h.Verbosity]); len(tail) > 0 {
+			if len(tail) < total {
+				label += fmt.Sprintf(" (last %d of %d lines)", len(tail), total)
+			}
+			fmt.Fprintf(&b, "    %s:\n", label)
+			for _, line := range tail {
+				fmt.Fprintf(&b, "      %s %s\n", st.dim("|"), line)
+			}
+		}
+	}
+	for i, loc := range e.Location.Chain() {
+		loc.File = relative(loc.File)
+		if i == 0 {
+			fmt.Fprintf(&b, "    at %s\n", st.cyan(loc.String()))
+		} else {
+			fmt.Fprintf(&b, "      included from %s\n", st.cyan(loc.String()))
+		}
+	}
+	for _, s := range e.Suggestions {
+		fmt.Fprintf(&b, "    Suggestion: %s\n", s)
+	}
+	return b.String()
+}
+
+func (h *Human) redact(s string) string {
+	if h.Redactor == nil {
+		return s
+	}
+	return h.Redactor.String(s)
+}
+
+func (h *Human) Summary(s *runner.Summary) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clear()
+	h.Live = false
+	st := style{h.Color}
+
+	var b strings.Builder
+	bases := map[string]bool{}
+	variants := false
+	for _, r := range s.Results {
+		bases[r.Procedure.ID] = true
+		variants = variants || r.Variant != nil
+	}
+	tested := plural(s.TotalProcedures, "procedure") + " tested"
+	if variants {
+		tested += fmt.Sprintf(" (from %s with variants)", plural(len(bases), "base procedure"))
+	}
+	passed := fmt.Sprintf("%d passed", s.PassedProcedures)
+	if s.FlakyProcedures > 0 {
+		passed += fmt.Sprintf(" (%d flaky)", s.FlakyProcedures)
+	}
+	failed := fmt.Sprintf("%d failed", s.FailedProcedures)
+	if s.PassedProcedures > 0 {
+		passed = st.green(passed)
+	}
+	if s.FailedProcedures > 0 {
+		failed = st.red(failed)
+	}
+	fmt.Fprintf(&b, "Summary:\n  %s\n  %s, %s, %d skipped\n  Total duration: %s\n",
+		tested, passed, failed, s.SkippedProcedures, s.TotalDuration.Round(100*time.Millisecond))
+	var kept []*runner.ProcedureResult
+	for i := range s.Results {
+		if s.Results[i].Artifacts != "" {
+			kept = append(kept, &s.Results[i])
+		}
+	}
+	if len(kept) > 0 {
+		b.WriteString("\nKept sandboxes (run the command to re-enter one):\n")
+		for _, r := range kept {
+			fmt.Fprintf(&b, "  %s\n    sh %s\n", r.Name(), filepath.Join(relative(r.Artifacts), sandbox.EnterScript))
+		}
+	}
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+// steps lists every step and sub-step with its status and duration.
+func steps(r *runner.ProcedureResult, st style) string {
+	var b strings.Builder
+	mark := func(ok bool) string {
+		if ok {
+			return st.green("✓")
+		}
+		return st.red("✗")
+	}
+	for _, s := range r.Steps {
+		step := runner.ErrorContext{StepNumber: s.Step.Number}
+		fmt.Fprintf(&b, "    %s Step %s: %s %s\n", mark(s.Success), step.Step(), s.Step.Title, st.dim(s.Duration.Round(100*time.Millisecond).String()))
+		for _, sub := range s.SubSteps {
+			step.SubStepNumber = sub.SubStep.Number
+			fmt.Fprintf(&b, "      %s Step %s: %s %s\n", mark(sub.Success), step.Step(), sub.SubStep.Title, st.dim(sub.Duration.Round(100*time.Millisecond).String()))
+		}
+	}
+	return b.String()
+}
+
+// subStepTitle returns the title of the sub-step an error happened in.
+func subStepTitle(r *runner.ProcedureResult, c runner.ErrorContext) string {
+	for _, s := range r.Steps {
+		if s.Step.Number != c.StepNumber {
+			continue
+		}
+		for _, sub := range s.SubSteps {
+			if sub.SubStep.Number == c.SubStepNumber {
+				return sub.SubStep.Title
+			}
+		}
+	}
+	return c.StepTitle
+}
+
+// tailLines returns up to n last non-empty lines of s and how many
+// lines s has.
+func tailLines(s string, n int) ([]string, int) {
+	s = strings.TrimRight(s, "\n")
+	if strings.TrimSpace(s) == "" {
+		return nil, 0
+	}
+	lines := strings.Split(s, "\n")
+	if len(lines) > n {
+		return lines[len(lines)-n:], len(lines)
+	}
+	return lines, len(lines)
+}
+
+// flakySteps describes the actions of passed steps that needed retries.
+func flakySteps(r *runner.ProcedureResult) []string {
+	var out []string
+	eachAction(r, func(step string, a runner.ActionResult) {
+		if a.Flaky() {
+			out = append(out, fmt.Sprintf("Step %s: %s action passed on attempt %d", step, a.Action.Kind(), a.Attempts))
+		}
+	})
+	return out
+}
+
+// waits describes each wait with its polls and how long it took.
+func waits(r *runner.ProcedureResult, st style) []string {
+	var out []string
+	eachAction(r, func(step string, a runner.ActionResult) {
+		w, ok := a.Action.(*ast.WaitAction)
+		if !ok {
+			return
+		}
+		total := a.Execution.Duration.Round(100 * time.Millisecond)
+		polls := plural(len(a.Polls), "poll")
+		switch {
+		case a.Execution.Skipped:
+			out = append(out, fmt.Sprintf("%s Step %s: until %s (%s)", st.yellow("?"), step, w.Target(), a.Execution.Error))
+		case a.Status() == runner.StatusPassed:
+			out = append(out, fmt.Sprintf("%s Step %s: until %s, %s, %s", st.green("✓"), step, w.Target(), polls, total))
+		default:
+			out = append(out, fmt.Sprintf("%s Step %s: until %s, %s, %s", st.red("✗"), step, w.Target(), polls, total))
+		}
+	})
+	return out
+}
+
+// eachAction calls fn for every action result of r with its step number.
+func eachAction(r *runner.ProcedureResult, fn func(step string, a runner.ActionResult)) {
+	for _, s := range r.Steps {
+		step := runner.ErrorContext{StepNumber: s.Step.Number}
+		for _, a := range s.Actions {
+			fn(step.Step(), a)
+		}
+		for _, sub := range s.SubSteps {
+			step.SubStepNumber = sub.SubStep.Number
+			for _, a := range sub.Actions {
+				fn(step.Step(), a)
+			}
+		}
+	}
+}
+
+// plural formats a count of things.
+func plural(n int, thing string) string {
+	if n == 1 {
+		return "1 " + thing
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
+
+// relative shortens a path under the current directory.
+func relative(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,350 @@
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/cleanup"
+	"github.com/dacharyc/spike-procedural-testing/internal/redact"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+	"github.com/dacharyc/spike-procedural-testing/results"
+)
+
+// JSON writes the results document once the run ends. Its format is
+// described by the results package.
+type JSON struct {
+	// Redactor hides secrets in commands and output.
+	Redactor *redact.Redactor
+
+	w io.Writer
+}
+
+// NewJSON returns a JSON reporter that writes to w.
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{w: w}
+}
+
+func (j *JSON) Procedure(r *runner.ProcedureResult) error {
+	return nil
+}
+
+func (j *JSON) Summary(s *runner.Summary) error {
+	data, err := json.MarshalIndent(Document(s, j.Redactor), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = j.w.Write(append(data, '\n'))
+	return err
+}
+
+// Document converts a run to the results document, redacting commands
+// and output with red when it is not nil.
+func Document(s *runner.Summary, red *redact.Redactor) *results.Document {
+	c := converter{red: red, lines: map[string][]string{}}
+	doc := &results.Document{
+		SchemaVersion: results.SchemaVersion,
+		Tool:          results.Tool{Name: "proctest", Version: Version()},
+		GeneratedAt:   time.Now().UTC(),
+		Results:       []results.Result{},
+		Summary:       summary(s),
+	}
+	for i := range s.Results {
+		doc.Results = append(doc.Results, c.result(&s.Results[i]))
+	}
+	doc.Environment = environment(s.Results)
+	return doc
+}
+
+// summary converts the totals of a run.
+func summary(s *runner.Summary) results.Summary {
+	out := results.Summary{
+		Total:    s.TotalProcedures,
+		Passed:   s.PassedProcedures,
+		Failed:   s.FailedProcedures,
+		Skipped:  s.SkippedProcedures,
+		Flaky:    s.FlakyProcedures,
+		Duration: s.TotalDuration.Milliseconds(),
+		Steps: results.StepSummary{
+			Total:  s.TotalSteps,
+			Passed: s.PassedSteps,
+			Failed: s.FailedSteps,
+			Flaky:  s.FlakySteps,
+		},
+	}
+	bases := map[string]bool{}
+	for i := range s.Results {
+		r := &s.Results[i]
+		if r.Variant != nil {
+			bases[r.Procedure.ID] = true
+			out.Variants.Variants++
+			if out.Variants.ByType == nil {
+				out.Variants.ByType = map[string]int{}
+			}
+			out.Variants.ByType[r.Variant.Type]++
+		}
+	}
+	out.Variants.BaseProcedures = len(bases)
+	return out
+}
+
+// Version returns the version proctest was built at, or "devel".
+func Version() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "devel"
+}
+
+// ciSystems maps the variables CI systems set to their names.
+var ciSystems = []struct{ env, name string }{
+	{"GITHUB_ACTIONS", "github-actions"},
+	{"GITLAB_CI", "gitlab"},
+	{"JENKINS_URL", "jenkins"},
+	{"BUILDKITE", "buildkite"},
+	{"CIRCLECI", "circleci"},
+	{"TF_BUILD", "azure-pipelines"},
+	{"CI", "unknown"},
+}
+
+// environment fingerprints the machine a run happened on: the platform,
+// the CI system, the versions of the programs the prerequisite checks
+// found and the names of the variables placeholders were filled from.
+func environment(rs []runner.ProcedureResult) results.Environment {
+	env := results.Environment{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	for _, ci := range ciSystems {
+		if os.Getenv(ci.env) != "" {
+			env.CI = ci.name
+			break
+		}
+	}
+	for i := range rs {
+		r := &rs[i]
+		for _, c := range r.PrerequisiteChecks {
+			sw, ok := c.Requirement.(*ast.SoftwareRequirement)
+			if !ok || !c.Met || c.Details == nil || c.Details.Found == "" {
+				continue
+			}
+			if env.Software == nil {
+				env.Software = map[string]string{}
+			}
+			env.Software[sw.Name] = c.Details.Found
+		}
+		eachAction(r, func(_ string, a runner.ActionResult) {
+			for _, sub := range a.Substitutions {
+				if sub.Variable != "" && !slices.Contains(env.Variables, sub.Variable) {
+					env.Variables = append(env.Variables, sub.Variable)
+				}
+			}
+		})
+	}
+	sort.Strings(env.Variables)
+	// Maps marshal with sorted keys, so equal environments hash equally.
+	data, _ := json.Marshal(env)
+	sum := sha256.Sum256(data)
+	env.Fingerprint = hex.EncodeToString(sum[:8])
+	return env
+}
+
+// converter turns runner results into their results counterparts.
+type converter struct {
+	red *redact.Redactor
+	// lines caches the source files that actions' markup is read from.
+	lines map[string][]string
+}
+
+func (c converter) redact(s string) string {
+	if c.red == nil {
+		return s
+	}
+	return c.red.String(s)
+}
+
+func (c converter) result(r *runner.ProcedureResult) results.Result {
+	out := results.Result{
+		ID:                   r.ID(),
+		File:                 r.File,
+		Name:                 r.Name(),
+		Procedure:            results.Procedure{ID: r.Procedure.ID, Title: r.Procedure.Title, HeadingPath: r.Procedure.HeadingPath, Location: location(r.Procedure.Location)},
+		Owner:                r.Owner,
+		Tags:                 r.Tags,
+		Status:               string(r.Status()),
+		Flaky:                r.Flaky,
+		SkipReason:           r.SkipReason,
+		StartedAt:            r.StartedAt,
+		Duration:             r.Duration.Milliseconds(),
+		WorkingDirectory:     r.WorkingDirectory,
+		Artifacts:            r.Artifacts,
+		Cassette:             r.Cassette,
+		PrerequisitesIgnored: r.PrerequisitesIgnored,
+		Steps:                []results.Step{},
+		Error:                c.error(r.Error),
+	}
+	if v := r.Variant; v != nil {
+		out.Variant = &results.Variant{Type: v.Type, ID: v.ID, Label: v.Label, BaseProcedure: r.Procedure.Title, Selection: v.Selection}
+	}
+	for _, p := range r.PrerequisiteChecks {
+		base := p.Requirement.Base()
+		pr := results.Prerequisite{
+			Type:        string(base.Type),
+			Subject:     p.Requirement.Subject(),
+			Description: base.Description,
+			Optional:    base.Optional,
+			Met:         p.Met,
+			Verified:    p.Verified,
+			Message:     p.Message,
+			SkipReason:  p.SkipReason,
+		}
+		if p.Details != nil {
+			pr.Found, pr.Expected = p.Details.Found, p.Details.Expected
+		}
+		out.Prerequisites = append(out.Prerequisites, pr)
+	}
+	for _, st := range r.Steps {
+		step := results.Step{
+			ID:       st.Step.ID,
+			Number:   st.Step.Number,
+			Title:    st.Step.Title,
+			Status:   status(st.Success),
+			Flaky:    st.Flaky,
+			Duration: st.Duration.Milliseconds(),
+			Location: location(st.Step.Location),
+			Actions:  c.actions(st.Actions),
+			Error:    c.error(st.Error),
+		}
+		for _, sub := range st.SubSteps {
+			step.SubSteps = append(step.SubSteps, results.SubStep{
+				ID:       sub.SubStep.ID,
+				Number:   sub.SubStep.Number,
+				Title:    sub.SubStep.Title,
+				Status:   status(sub.Success),
+				Duration: sub.Duration.Milliseconds(),
+				Location: location(sub.SubStep.Location),
+				Actions:  c.actions(sub.Actions),
+				Error:    c.error(sub.Error),
+			})
+		}
+		out.Steps = append(out.Steps, step)
+	}
+	for _, cl := range r.Cleanup {
+		out.Cleanup = append(out.Cleanup, c.cleanup(cl))
+	}
+	return out
+}
+
+func (c converter) cleanup(cl cleanup.Result) results.Cleanup {
+	st := status(cl.Success)
+	if cl.Skipped {
+		st = results.StatusSkipped
+	}
+	return results.Cleanup{
+		Kind:        string(cl.Kind),
+		Description: c.redact(cl.Description),
+		Status:      st,
+		Error:       c.redact(cl.Error),
+		Duration:    cl.Duration.Milliseconds(),
+	}
+}
+
+func (c converter) actions(as []runner.ActionResult) []results.Action {
+	out := []results.Action{}
+	for _, a := range as {
+		ex := a.Execution
+		loc := a.Action.Base().Location
+		act := results.Action{
+			ID:             a.Action.Base().ID,
+			Type:           string(a.Action.Kind()),
+			Status:         string(a.Status()),
+			Location:       location(loc),
+			RST:            c.rst(loc),
+			Command:        c.redact(ex.Command),
+			ExitCode:       ex.ExitCode,
+			Stdout:         c.redact(ex.Stdout),
+			Stderr:         c.redact(ex.Stderr),
+			Message:        c.redact(ex.Error),
+			ExpectedOutput: expectedOutput(a.Action),
+			Duration:       ex.Duration.Milliseconds(),
+			TimedOut:       ex.TimedOut,
+			Replayed:       a.Replayed,
+			Attempts:       a.Attempts,
+			Error:          c.error(a.Error),
+		}
+		for _, s := range a.Substitutions {
+			act.Placeholders = append(act.Placeholders, results.Placeholder{Placeholder: s.Placeholder, Variable: s.Variable})
+		}
+		for _, p := range a.Polls {
+			act.Polls = append(act.Polls, results.Poll{Satisfied: p.Satisfied, Observed: c.redact(p.Observed), Duration: p.Duration.Milliseconds()})
+		}
+		out = append(out, act)
+	}
+	return out
+}
+
+// rst returns the lines of markup at loc, or "" when the file cannot be
+// read.
+func (c converter) rst(loc ast.SourceLocation) string {
+	lines, ok := c.lines[loc.File]
+	if !ok {
+		if data, err := os.ReadFile(loc.File); err == nil {
+			lines = strings.Split(string(data), "\n")
+		}
+		c.lines[loc.File] = lines
+	}
+	if loc.StartLine < 1 || loc.StartLine > len(lines) {
+		return ""
+	}
+	end := min(max(loc.EndLine, loc.StartLine), len(lines))
+	return strings.Join(lines[loc.StartLine-1:end], "\n")
+}
+
+func expectedOutput(a ast.Action) string {
+	switch a := a.(type) {
+	case *ast.ShellAction:
+		return a.ExpectedOutput
+	case *ast.CLIAction:
+		return a.ExpectedOutput
+	}
+	return ""
+}
+
+func (c converter) error(e *runner.TestError) *results.Error {
+	if e == nil {
+		return nil
+	}
+	out := &results.Error{
+		Type:        e.Type,
+		Message:     c.redact(e.Message),
+		Location:    location(e.Location),
+		StepTitle:   e.Context.StepTitle,
+		Suggestions: e.Suggestions,
+	}
+	if e.Context.StepNumber > 0 {
+		out.Step = e.Context.Step()
+	}
+	return out
+}
+
+func location(l ast.SourceLocation) results.Location {
+	out := results.Location{File: l.File, StartLine: l.StartLine, EndLine: l.EndLine}
+	if l.IncludedFrom != nil {
+		from := location(*l.IncludedFrom)
+		out.IncludedFrom = &from
+	}
+	return out
+}
+
+func status(success bool) string {
+	if success {
+		return results.StatusPassed
+	}
+	return results.StatusFailed
+}
@@ -0,0 +1,148 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/cleanup"
+	"github.com/dacharyc/spike-procedural-testing/internal/executor"
+	"github.com/dacharyc/spike-procedural-testing/internal/prereq"
+	"github.com/dacharyc/spike-procedural-testing/internal/resolver"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+	"github.com/dacharyc/spike-procedural-testing/results"
+)
+
+// schemaValidator checks a decoded JSON value against the keywords
+// results/schema.json uses. Unlike JSON Schema it also reports the
+// properties an object has that the schema does not describe, so that a
+// field added to the Go types but not to the schema fails the test.
+type schemaValidator struct {
+	defs     map[string]any
+	problems []string
+}
+
+func (v *schemaValidator) validate(schema map[string]any, value any, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		def, ok := v.defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+		if !ok {
+			v.problems = append(v.problems, fmt.Sprintf("%s: unknown $ref %s", path, ref))
+			return
+		}
+		v.validate(def, value, path)
+		return
+	}
+	if typ, ok := schema["type"].(string); ok && !hasType(value, typ) {
+		v.problems = append(v.problems, fmt.Sprintf("%s: %T is not of type %s", path, value, typ))
+		return
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		v.problems = append(v.problems, fmt.Sprintf("%s: %v is not one of %v", path, value, enum))
+	}
+	if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(value.(string)) {
+		v.problems = append(v.problems, fmt.Sprintf("%s: %q does not match %s", path, value, pattern))
+	}
+	if schema["format"] == "date-time" {
+		if _, err := time.Parse(time.RFC3339Nano, value.(string)); err != nil {
+			v.problems = append(v.problems, fmt.Sprintf("%s: %v", path, err))
+		}
+	}
+	switch value := value.(type) {
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range value {
+				v.validate(items, item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case map[string]any:
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := value[name.(string)]; !ok {
+				v.problems = append(v.problems, fmt.Sprintf("%s: missing required %s", path, name))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		additional, _ := schema["additionalProperties"].(map[string]any)
+		for name, field := range value {
+			switch prop, ok := properties[name].(map[string]any); {
+			case ok:
+				v.validate(prop, field, path+"."+name)
+			case additional != nil:
+				v.validate(additional, field, path+"."+name)
+			default:
+				v.problems = append(v.problems, fmt.Sprintf("%s: %s is not in the schema", path, name))
+			}
+		}
+	}
+}
+
+func hasType(value any, typ string) bool {
+	switch value := value.(type) {
+	case string:
+		return typ == "string"
+	case bool:
+		return typ == "boolean"
+	case float64:
+		return typ == "number" || typ == "integer" && value == float64(int64(value))
+	case []any:
+		return typ == "array"
+	case map[string]any:
+		return typ == "object"
+	}
+	return false
+}
+
+func TestJSONMatchesTheSchema(t *testing.T) {
+	rs := variantResults()
+	// Give the passing variant every optional part of a result.
+	python := &rs[0]
+	python.Owner, python.Tags = "drivers", []string{"python"}
+	python.Cassette = ".proctest/cassettes/source/connect/connect-python.json"
+	python.PrerequisiteChecks = []prereq.Result{{
+		Requirement: &ast.SoftwareRequirement{RequirementBase: ast.RequirementBase{Type: ast.RequirementSoftware, Description: "Python 3.9+"}, Name: "Python", Version: ">=3.9"},
+		Met:         true, Verified: true, Message: "Python 3.12.1 is installed", Details: &prereq.Details{Found: "3.12.1", Expected: ">=3.9"},
+	}}
+	python.Cleanup = []cleanup.Result{{Kind: cleanup.KindDatabase, Description: "drop database proctest_connect", Success: true, Duration: 30 * time.Millisecond}}
+	python.Steps[1].Actions[0].Substitutions = []resolver.Substitution{{Placeholder: "<connection-string>", Variable: "MONGODB_URI", Value: "mongodb://localhost"}}
+	python.Steps[1].SubSteps = []runner.SubStepResult{{
+		SubStep: &ast.SubStep{Number: "a", Title: "Wait for the cluster"},
+		Success: true,
+		Actions: []runner.ActionResult{{
+			Action:    &ast.WaitAction{ActionBase: ast.ActionBase{Type: ast.ActionWait}},
+			Execution: executor.Result{Success: true},
+			Polls:     []runner.Poll{{Observed: "status is IDLE", Satisfied: true, Duration: time.Second}},
+		}},
+	}}
+	s := runner.Summarize(rs)
+
+	var buf bytes.Buffer
+	if err := NewJSON(&buf).Summary(&s); err != nil {
+		t.Fatal(err)
+	}
+	var schema, doc map[string]any
+	if err := json.Unmarshal(results.Schema, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	v := &schemaValidator{defs: schema["$defs"].(map[string]any)}
+	v.validate(schema, doc, "$")
+	for _, p := range v.problems {
+		t.Error(p)
+	}
+
+	read, err := results.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read.Summary; got.Total != 4 || got.Passed != 1 || got.Failed != 2 || got.Skipped != 1 {
+		t.Errorf("summary: %d total, %d passed, %d failed, %d skipped, want 4, 1, 2, 1", got.Total, got.Passed, got.Failed, got.Skipped)
+	}
+}
@@ -0,0 +1,315 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/redact"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+// DefaultJUnitOutputLimit caps the system-out and system-err of a test
+// case, in bytes.
+const DefaultJUnitOutputLimit = 64 << 10
+
+// failureLines is how much of a failed command's output a failure
+// message shows; the whole output is in system-out and system-err.
+const failureLines = 20
+
+// JUnit writes JUnit XML for CI systems such as Jenkins and GitLab. Each
+// procedure variant is a test case and each page a test suite. The XML
+// follows the schema Jenkins and GitLab read, so kept sandboxes are
+// properties of the suite, named after the test case, and GitLab
+// attachments in system-out.
+type JUnit struct {
+	// OutputLimit caps system-out and system-err in bytes; the start of
+	// longer output is dropped. Zero uses DefaultJUnitOutputLimit.
+	OutputLimit int
+	// Redactor hides secrets in commands and output.
+	Redactor *redact.Redactor
+
+	w       io.Writer
+	results []runner.ProcedureResult
+}
+
+// NewJUnit returns a JUnit reporter that writes to w once the run ends.
+func NewJUnit(w io.Writer) *JUnit {
+	return &JUnit{w: w}
+}
+
+func (j *JUnit) Procedure(r *runner.ProcedureResult) error {
+	j.results = append(j.results, *r)
+	return nil
+}
+
+func (j *JUnit) Summary(s *runner.Summary) error {
+	host, _ := os.Hostname()
+	root := junitSuites{Name: "proctest", Time: seconds(s.TotalDuration)}
+	index := map[string]int{}
+	for i := range j.results {
+		r := &j.results[i]
+		n, ok := index[r.File]
+		if !ok {
+			n = len(root.Suites)
+			index[r.File] = n
+			root.Suites = append(root.Suites, junitSuite{Name: r.File, Hostname: host, Timestamp: r.StartedAt.Format("2006-01-02T15:04:05")})
+		}
+		suite := &root.Suites[n]
+		tc := j.testCase(r)
+		suite.Cases = append(suite.Cases, tc)
+		suite.Tests++
+		suite.Time += seconds(r.Duration)
+		switch {
+		case tc.Skipped != nil:
+			suite.Skipped++
+		case tc.Failure != nil:
+			suite.Failures++
+		case tc.Error != nil:
+			suite.Errors++
+		}
+		suite.property("artifacts:"+tc.Name, r.Artifacts)
+		if r.Artifacts != "" {
+			suite.property("working-directory:"+tc.Name, r.WorkingDirectory)
+		}
+		suite.property("cassette:"+tc.Name, r.Cassette)
+	}
+	for _, suite := range root.Suites {
+		root.Tests += suite.Tests
+		root.Failures += suite.Failures
+		root.Errors += suite.Errors
+	}
+
+	if _, err := io.WriteString(j.w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(j.w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(j.w, "\n")
+	return err
+}
+
+// testCase converts one procedure variant.
+func (j *JUnit) testCase(r *runner.ProcedureResult) junitCase {
+	tc := junitCase{
+		Name:      r.Name(),
+		Classname: classname(r.File),
+		Time:      seconds(r.Duration),
+	}
+	if r.Skipped {
+		tc.Skipped = &junitSkipped{Message: xmlSafe(strings.ReplaceAll(r.SkipReason, "\n", "; "))}
+		tc.SystemOut = j.output(r.SkipReason)
+		return tc
+	}
+
+	var out, errOut strings.Builder
+	eachAction(r, func(step string, a runner.ActionResult) {
+		if a.Execution.Stdout != "" {
+			fmt.Fprintf(&out, "--- Step %s: %s\n%s\n", step, a.Action.Kind(), strings.TrimRight(a.Execution.Stdout, "\n"))
+		}
+		if a.Execution.Stderr != "" {
+			fmt.Fprintf(&errOut, "--- Step %s: %s\n%s\n", step, a.Action.Kind(), strings.TrimRight(a.Execution.Stderr, "\n"))
+		}
+	})
+	if r.Artifacts != "" {
+		// GitLab links attachments named this way from the test report.
+		fmt.Fprintf(&out, "[[ATTACHMENT|%s]]\n", absolute(r.Artifacts))
+	}
+	tc.SystemOut = j.output(out.String())
+	tc.SystemErr = j.output(errOut.String())
+
+	if r.Error == nil {
+		return tc
+	}
+	e := r.Error
+	var body strings.Builder
+	fmt.Fprintf(&body, "Step %s: %s\n", e.Context.Step(), subStepTitle(r, e.Context))
+	fmt.Fprintf(&body, "%s\n", e.Message)
+	if fa := r.FailedAction(); fa != nil && fa.Execution.Command != "" {
+		fmt.Fprintf(&body, "Command: %s\n", fa.Execution.Command)
+		if fa.Execution.ExitCode > 0 {
+			fmt.Fprintf(&body, "Exit code: %d\n", fa.Execution.ExitCode)
+		}
+		output := fa.Execution.Stderr
+		if strings.TrimSpace(output) == "" {
+			output = fa.Execution.Stdout
+		}
+		if lines, _ := tailLines(output, failureLines); len(lines) > 0 {
+			fmt.Fprintf(&body, "Output:\n%s\n", strings.Join(lines, "\n"))
+		}
+	}
+	for i, loc := range e.Location.Chain() {
+		if i == 0 {
+			fmt.Fprintf(&body, "at %s\n", loc)
+		} else {
+			fmt.Fprintf(&body, "included from %s\n", loc)
+		}
+	}
+	for _, s := range e.Suggestions {
+		fmt.Fprintf(&body, "Suggestion: %s\n", s)
+	}
+	problem := &junitProblem{
+		Message: xmlSafe(j.redact(fmt.Sprintf("Step %s: %s", e.Context.Step(), e.Message))),
+		Type:    e.Type,
+		Text:    xmlSafe(j.redact(body.String())),
+	}
+	// Execution failures are what the test checks; anything else means
+	// the test could not run properly.
+	if e.Type == runner.ErrorExecute {
+		tc.Failure = problem
+	} else {
+		tc.Error = problem
+	}
+	return tc
+}
+
+// output redacts command output and keeps the end of it within the
+// limit.
+func (j *JUnit) output(s string) *junitOutput {
+	if s == "" {
+		return nil
+	}
+	s = xmlSafe(j.redact(s))
+	limit := j.OutputLimit
+	if limit <= 0 {
+		limit = DefaultJUnitOutputLimit
+	}
+	if len(s) > limit {
+		cut := len(s) - limit
+		// Do not split a UTF-8 sequence.
+		for cut < len(s) && s[cut]&0xC0 == 0x80 {
+			cut++
+		}
+		s = fmt.Sprintf("[... %d bytes truncated ...]\n", cut) + s[cut:]
+	}
+	return &junitOutput{Text: s}
+}
+
+func (j *JUnit) redact(s string) string {
+	if j.Redactor == nil {
+		return s
+	}
+	return j.Redactor.String(s)
+}
+
+// classname turns a page path into the dotted name Jenkins groups test
+// cases by: source/tutorial/install.txt is source.tutorial.install.
+func classname(file string) string {
+	file = strings.TrimSuffix(filepath.ToSlash(filepath.Clean(file)), filepath.Ext(file))
+	file = strings.TrimLeft(strings.ReplaceAll(file, "../", ""), "./")
+	return strings.ReplaceAll(file, "/", ".")
+}
+
+// ansiRE matches terminal escape sequences, which commands print for
+// colors and progress bars.
+var ansiRE = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// xmlSafe removes terminal escape sequences and the characters XML 1.0
+// does not allow.
+func xmlSafe(s string) string {
+	s = ansiRE.ReplaceAllString(s, "")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return r
+		case r < 0x20, r == 0xFFFE, r == 0xFFFF, r == utf8.RuneError:
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func seconds(d time.Duration) junitTime {
+	return junitTime(d.Seconds())
+}
+
+func absolute(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Time     junitTime    `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       junitTime        `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr"`
+	Hostname   string           `xml:"hostname,attr"`
+	Properties *junitProperties `xml:"properties"`
+	Cases      []junitCase      `xml:"testcase"`
+}
+
+// property adds a property unless its value is empty.
+func (s *junitSuite) property(name, value string) {
+	if value == "" {
+		return
+	}
+	if s.Properties == nil {
+		s.Properties = &junitProperties{}
+	}
+	s.Properties.Properties = append(s.Properties.Properties, junitProperty{Name: name, Value: value})
+}
+
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      junitTime     `xml:"time,attr"`
+	Skipped   *junitSkipped `xml:"skipped"`
+	Error     *junitProblem `xml:"error"`
+	Failure   *junitProblem `xml:"failure"`
+	SystemOut *junitOutput  `xml:"system-out"`
+	SystemErr *junitOutput  `xml:"system-err"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+// junitTime is a duration in seconds with millisecond precision.
+type junitTime float64
+
+func (t junitTime) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	return xml.Attr{Name: name, Value: fmt.Sprintf("%.3f", float64(t))}, nil
+}
@@ -0,0 +1,146 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/executor"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+// variantResults is a run of a page with a procedure in three language
+// variants, which passed, failed and were skipped, and of a second page
+// whose procedure has no variants and could not run.
+func variantResults() []runner.ProcedureResult {
+	start := time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC)
+	connect := &ast.Procedure{
+		ID:       "connect#connect",
+		Title:    "Connect",
+		Location: ast.SourceLocation{File: "source/connect.txt", StartLine: 12, EndLine: 40},
+	}
+	install := &ast.Step{Number: 1, Title: "Install the driver"}
+	run := &ast.Step{Number: 2, Title: "Run the app"}
+	variant := func(id, label string) *ast.Variant {
+		return &ast.Variant{Type: "tab", ID: id, Label: label, Selection: ast.Selection{"drivers": id}}
+	}
+	command := func(cmd string) ast.Action {
+		return &ast.ShellAction{ActionBase: ast.ActionBase{Type: ast.ActionShell, Location: ast.SourceLocation{File: "source/connect.txt", StartLine: 30, EndLine: 30}}, Command: cmd}
+	}
+	passed := func(cmd, stdout string) runner.ActionResult {
+		return runner.ActionResult{Action: command(cmd), Execution: executor.Result{Success: true, Command: cmd, Stdout: stdout}}
+	}
+	failure := &runner.TestError{
+		Type:     runner.ErrorExecute,
+		Message:  "command exited with code 1",
+		Location: ast.SourceLocation{File: "source/connect.txt", StartLine: 30, EndLine: 30},
+		Context:  runner.ErrorContext{ProcedureTitle: "Connect", StepNumber: 2, StepTitle: "Run the app"},
+	}
+	return []runner.ProcedureResult{
+		{
+			File: "source/connect.txt", Procedure: connect, Variant: variant("python", "Python"),
+			StartedAt: start, Duration: 1500 * time.Millisecond, Success: true, PlannedSteps: 2,
+			Steps: []runner.StepResult{
+				{Step: install, Success: true, Actions: []runner.ActionResult{passed("pip install pymongo", "Successfully installed pymongo\n")}},
+				{Step: run, Success: true, Actions: []runner.ActionResult{passed("python3 app.py", "Connected\n")}},
+			},
+		},
+		{
+			File: "source/connect.txt", Procedure: connect, Variant: variant("nodejs", "Node.js"),
+			StartedAt: start, Duration: 2 * time.Second, PlannedSteps: 2,
+			Steps: []runner.StepResult{
+				{Step: install, Success: true, Actions: []runner.ActionResult{passed("npm install mongodb", "added 1 package\n")}},
+				{Step: run, Actions: []runner.ActionResult{{
+					Action:    command("node app.js"),
+					Execution: executor.Result{Command: "node app.js", ExitCode: 1, Stderr: "MongoServerSelectionError\n"},
+					Error:     failure,
+				}}, Error: failure},
+			},
+			Error: failure,
+		},
+		{
+			File: "source/connect.txt", Procedure: connect, Variant: variant("go", "Go"),
+			StartedAt: start, Skipped: true, SkipReason: "Go is not installed", Steps: []runner.StepResult{},
+		},
+		{
+			File: "source/seed.txt",
+			Procedure: &ast.Procedure{
+				ID:       "seed#seed-the-database",
+				Title:    "Seed the Database",
+				Location: ast.SourceLocation{File: "source/seed.txt", StartLine: 8, EndLine: 20},
+			},
+			StartedAt: start, PlannedSteps: 1,
+			Steps: []runner.StepResult{},
+			Error: &runner.TestError{
+				Type:     runner.ErrorResolve,
+				Message:  "unresolved placeholders: <connection-string>",
+				Location: ast.SourceLocation{File: "source/seed.txt", StartLine: 14, EndLine: 14},
+				Context:  runner.ErrorContext{ProcedureTitle: "Seed the Database", StepNumber: 1, StepTitle: "Connect"},
+			},
+		},
+	}
+}
+
+func TestJUnitTestCasePerVariant(t *testing.T) {
+	rs := variantResults()
+	var buf bytes.Buffer
+	j := NewJUnit(&buf)
+	for i := range rs {
+		if err := j.Procedure(&rs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := runner.Summarize(rs)
+	if err := j.Summary(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	var root junitSuites
+	if err := xml.Unmarshal(buf.Bytes(), &root); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+	if root.Tests != 4 || root.Failures != 1 || root.Errors != 1 {
+		t.Errorf("testsuites: %d tests, %d failures, %d errors, want 4, 1, 1", root.Tests, root.Failures, root.Errors)
+	}
+	if len(root.Suites) != 2 {
+		t.Fatalf("%d test suites, want one per page", len(root.Suites))
+	}
+
+	connect := root.Suites[0]
+	if connect.Name != "source/connect.txt" || connect.Tests != 3 || connect.Failures != 1 || connect.Skipped != 1 || connect.Errors != 0 {
+		t.Errorf("suite %s: %d tests, %d failures, %d skipped, %d errors, want 3, 1, 1, 0", connect.Name, connect.Tests, connect.Failures, connect.Skipped, connect.Errors)
+	}
+	var names []string
+	for _, tc := range connect.Cases {
+		names = append(names, tc.Name)
+		if tc.Classname != "source.connect" {
+			t.Errorf("%s: classname %q, want source.connect", tc.Name, tc.Classname)
+		}
+	}
+	if want := []string{"Connect (Python)", "Connect (Node.js)", "Connect (Go)"}; strings.Join(names, ", ") != strings.Join(want, ", ") {
+		t.Errorf("test cases %q, want %q", names, want)
+	}
+
+	python, node, golang := connect.Cases[0], connect.Cases[1], connect.Cases[2]
+	if python.Failure != nil || python.Error != nil || python.Skipped != nil {
+		t.Errorf("Python: failure %v, error %v, skipped %v", python.Failure, python.Error, python.Skipped)
+	}
+	if python.SystemOut == nil || !strings.Contains(python.SystemOut.Text, "--- Step 2: shell\nConnected") {
+		t.Errorf("Python: system-out %v", python.SystemOut)
+	}
+	if f := node.Failure; f == nil || f.Type != runner.ErrorExecute || f.Message != "Step 2: command exited with code 1" ||
+		!strings.Contains(f.Text, "Command: node app.js\nExit code: 1\nOutput:\nMongoServerSelectionError") {
+		t.Errorf("Node.js: failure %+v", node.Failure)
+	}
+	if golang.Skipped == nil || golang.Skipped.Message != "Go is not installed" {
+		t.Errorf("Go: skipped %+v", golang.Skipped)
+	}
+
+	seed := root.Suites[1].Cases[0]
+	if seed.Name != "Seed the Database" || seed.Error == nil || seed.Error.Type != runner.ErrorResolve || seed.Failure != nil {
+		t.Errorf("Seed the Database: error %+v, failure %+v; a procedure that could not run is an error", seed.Error, seed.Failure)
+	}
+}
@@ -0,0 +1,354 @@
+package report
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/redact"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+	"github.com/dacharyc/spike-procedural-testing/results"
+)
+
+// DefaultMarkdownLimit caps a Markdown summary below the 65,536
+// characters GitHub allows in a comment.
+const DefaultMarkdownLimit = 60000
+
+// Markdown writes a compact summary for CI job summaries and pull request
+// comments: the totals, what started or stopped failing, a table per
+// owner and the details of each failure, linked to the RST lines.
+type Markdown struct {
+	// Previous is an earlier run to compare with. When it is set, the
+	// summary reports only what changed.
+	Previous *results.Document
+	// Limit caps the summary in bytes; failure details that do not fit
+	// are left out. Zero uses DefaultMarkdownLimit.
+	Limit int
+	// LinkBase is the URL that file paths are appended to for links, such
+	// as "https://github.com/org/repo/blob/<sha>/". Without it, locations
+	// are not links.
+	LinkBase string
+	// Redactor hides secrets in commands and output.
+	Redactor *redact.Redactor
+
+	w io.Writer
+}
+
+// NewMarkdown returns a Markdown reporter that writes to w, linking to
+// the commit under test when it runs in GitHub Actions.
+func NewMarkdown(w io.Writer) *Markdown {
+	return &Markdown{LinkBase: GitHubLinkBase(), w: w}
+}
+
+func (m *Markdown) Procedure(r *runner.ProcedureResult) error {
+	return nil
+}
+
+func (m *Markdown) Summary(s *runner.Summary) error {
+	return m.Write(Document(s, m.Redactor))
+}
+
+// GitHubLinkBase returns the URL of the files of the commit a GitHub
+// Actions job runs on, or "" outside GitHub Actions.
+func GitHubLinkBase() string {
+	server, repo, sha := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_SHA")
+	if server == "" || repo == "" || sha == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/blob/%s/", server, repo, sha)
+}
+
+// markdownOutputLines is how much of a failed command's output a failure
+// shows.
+const markdownOutputLines = 15
+
+// Write renders the summary of doc.
+func (m *Markdown) Write(doc *results.Document) error {
+	limit := cmp.Or(m.Limit, DefaultMarkdownLimit)
+	var b strings.Builder
+	var failed, newly, still, fixed []*results.Result
+	for i := range doc.Results {
+		if doc.Results[i].Status == results.StatusFailed {
+			failed = append(failed, &doc.Results[i])
+		}
+	}
+	if m.Previous != nil {
+		before := map[string]*results.Result{}
+		for i := range m.Previous.Results {
+			r := &m.Previous.Results[i]
+			before[resultKey(r)] = r
+		}
+		for i := range doc.Results {
+			r := &doc.Results[i]
+			prev := before[resultKey(r)]
+			switch {
+			case r.Status == results.StatusFailed && prev != nil && prev.Status == results.StatusFailed:
+				still = append(still, r)
+			case r.Status == results.StatusFailed:
+				newly = append(newly, r)
+			case r.Status == results.StatusPassed && prev != nil && prev.Status == results.StatusFailed:
+				fixed = append(fixed, r)
+			}
+		}
+	}
+
+	s := doc.Summary
+	icon := "✅"
+	if s.Failed > 0 {
+		icon = "❌"
+	}
+	fmt.Fprintf(&b, "## %s Procedure tests: %d failed, %d passed, %d skipped\n\n", icon, s.Failed, s.Passed, s.Skipped)
+	b.WriteString("| Test cases | Passed | Failed | Skipped | Flaky | Duration |\n|---:|---:|---:|---:|---:|---:|\n")
+	if p := m.Previous; p != nil {
+		ps := p.Summary
+		fmt.Fprintf(&b, "| %d%s | %d%s | %d%s | %d%s | %d%s | %s |\n\n",
+			s.Total, delta(s.Total, ps.Total), s.Passed, delta(s.Passed, ps.Passed), s.Failed, delta(s.Failed, ps.Failed),
+			s.Skipped, delta(s.Skipped, ps.Skipped), s.Flaky, delta(s.Flaky, ps.Flaky), millis(s.Duration))
+	} else {
+		fmt.Fprintf(&b, "| %d | %d | %d | %d | %d | %s |\n\n", s.Total, s.Passed, s.Failed, s.Skipped, s.Flaky, millis(s.Duration))
+	}
+
+	// The details of each failure are written while they fit; the rest
+	// are counted in a note, which the footer reserves room for.
+	footer := "\n_Some failures are not shown. See the full results for every failure._\n"
+	budget := limit - len(footer)
+	details := failed
+	if m.Previous != nil {
+		if len(newly)+len(fixed)+len(still) == 0 {
+			b.WriteString("No test case changed status since the previous run.\n")
+		}
+		m.list(&b, "Newly failing", newly, budget)
+		m.list(&b, "Fixed", fixed, budget)
+		if len(still) > 0 {
+			fmt.Fprintf(&b, "%s still failing, as in the previous run.\n\n", plural(len(still), "test case"))
+		}
+		owners(&b, slices.Concat(newly, fixed), budget)
+		details = newly
+	} else {
+		m.list(&b, "Failing", failed, budget)
+		var all []*results.Result
+		for i := range doc.Results {
+			all = append(all, &doc.Results[i])
+		}
+		owners(&b, all, budget)
+	}
+
+	truncated := false
+	for i, r := range details {
+		d := m.details(r)
+		if i == 0 {
+			d = "### Failure details\n\n" + d
+		}
+		if b.Len()+len(d) > budget {
+			truncated = true
+			break
+		}
+		b.WriteString(d)
+	}
+	if truncated || b.Len() > budget {
+		b.WriteString(footer)
+	}
+	out := b.String()
+	if len(out) > limit {
+		out = truncate(out, limit-len(footer)-len(closeDetails)) + footer
+	}
+	_, err := io.WriteString(m.w, out)
+	return err
+}
+
+// list writes a section listing test cases, as many as fit in budget.
+func (m *Markdown) list(b *strings.Builder, title string, rs []*results.Result, budget int) {
+	if len(rs) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "### %s (%d)\n\n", title, len(rs))
+	for i, r := range rs {
+		line := fmt.Sprintf("- %s %s", m.link(r.Procedure.Location.Outermost()), escape(r.Name))
+		if r.Error != nil && r.Status == results.StatusFailed {
+			line += ": " + escape(failureMessage(r.Error))
+		}
+		line += "\n"
+		if b.Len()+len(line) > budget {
+			fmt.Fprintf(b, "- …and %d more\n", len(rs)-i)
+			break
+		}
+		b.WriteString(line)
+	}
+	b.WriteString("\n")
+}
+
+// owners writes a table of the test cases each owner is responsible for,
+// when any test case has an owner.
+func owners(b *strings.Builder, rs []*results.Result, budget int) {
+	if !slices.ContainsFunc(rs, func(r *results.Result) bool { return r.Owner != "" }) {
+		return
+	}
+	type counts struct{ passed, failed, skipped int }
+	byOwner := map[string]*counts{}
+	var names []string
+	for _, r := range rs {
+		owner := cmp.Or(r.Owner, "(no owner)")
+		c, ok := byOwner[owner]
+		if !ok {
+			c = &counts{}
+			byOwner[owner] = c
+			names = append(names, owner)
+		}
+		switch r.Status {
+		case results.StatusPassed:
+			c.passed++
+		case results.StatusFailed:
+			c.failed++
+		default:
+			c.skipped++
+		}
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(cmp.Compare(byOwner[b].failed, byOwner[a].failed), cmp.Compare(a, b))
+	})
+	var t strings.Builder
+	t.WriteString("### By owner\n\n| Owner | Passed | Failed | Skipped |\n|---|---:|---:|---:|\n")
+	for _, n := range names {
+		c := byOwner[n]
+		fmt.Fprintf(&t, "| %s | %d | %d | %d |\n", escape(n), c.passed, c.failed, c.skipped)
+	}
+	t.WriteString("\n")
+	if b.Len()+t.Len() <= budget {
+		b.WriteString(t.String())
+	}
+}
+
+// details renders a collapsible section with a failure's message, the
+// command that failed and the end of its output.
+func (m *Markdown) details(r *results.Result) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<details>\n<summary>❌ %s</summary>\n\n", html.EscapeString(r.Name))
+	if e := r.Error; e != nil {
+		fmt.Fprintf(&b, "%s: %s\n", m.link(e.Location.Outermost()), escape(failureMessage(e)))
+		if e.Location.IncludedFrom != nil {
+			fmt.Fprintf(&b, "in the included %s\n", m.link(e.Location))
+		}
+		for _, s := range e.Suggestions {
+			fmt.Fprintf(&b, "- %s\n", escape(s))
+		}
+	}
+	if a := failedAction(r); a != nil {
+		if a.Command != "" {
+			fmt.Fprintf(&b, "\n%s\n", codeBlock(firstLines(a.Command, 10)))
+		}
+		output := strings.TrimRight(a.Stdout+a.Stderr, "\n")
+		if lines, total := tailLines(output, markdownOutputLines); len(lines) > 0 {
+			label := "Output"
+			if total > len(lines) {
+				label = fmt.Sprintf("Output (last %d of %d lines)", len(lines), total)
+			}
+			fmt.Fprintf(&b, "\n%s:\n\n%s\n", label, codeBlock(xmlSafe(strings.Join(lines, "\n"))))
+		}
+	}
+	if r.Artifacts != "" {
+		fmt.Fprintf(&b, "\nSandbox kept at `%s`\n", r.Artifacts)
+	}
+	b.WriteString("\n</details>\n\n")
+	return b.String()
+}
+
+// failedAction returns the action that failed a test case, or nil.
+func failedAction(r *results.Result) *results.Action {
+	var found *results.Action
+	find := func(actions []results.Action) {
+		for i := range actions {
+			if found == nil && actions[i].Status == results.StatusFailed {
+				found = &actions[i]
+			}
+		}
+	}
+	for _, st := range r.Steps {
+		find(st.Actions)
+		for _, sub := range st.SubSteps {
+			find(sub.Actions)
+		}
+	}
+	return found
+}
+
+func failureMessage(e *results.Error) string {
+	if e.Step != "" {
+		return fmt.Sprintf("Step %s: %s", e.Step, e.Message)
+	}
+	return e.Message
+}
+
+// resultKey identifies a test case across runs.
+func resultKey(r *results.Result) string {
+	return r.File + "\x00" + r.Name
+}
+
+// link renders a location as file:line, linked to its lines when the
+// summary has a link base.
+func (m *Markdown) link(loc results.Location) string {
+	text := fmt.Sprintf("`%s:%d`", loc.File, loc.StartLine)
+	if m.LinkBase == "" || loc.File == "" || filepath.IsAbs(loc.File) {
+		return text
+	}
+	u := m.LinkBase + (&url.URL{Path: filepath.ToSlash(loc.File)}).EscapedPath()
+	if loc.StartLine > 0 {
+		u += fmt.Sprintf("#L%d", loc.StartLine)
+		if loc.EndLine > loc.StartLine {
+			u += fmt.Sprintf("-L%d", loc.EndLine)
+		}
+	}
+	return fmt.Sprintf("[%s](%s)", text, u)
+}
+
+func delta(now, before int) string {
+	if now == before {
+		return ""
+	}
+	return fmt.Sprintf(" (%+d)", now-before)
+}
+
+// escape keeps text on one line of a list or table and stops it from
+// being read as markup.
+func escape(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "<", "&lt;", ">", "&gt;", "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`).Replace(s)
+}
+
+// codeBlock fences s with more backticks than it contains in a row.
+func codeBlock(s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	return fence + "\n" + s + "\n" + fence
+}
+
+const closeDetails = "\n</details>\n"
+
+// truncate cuts s to at most n bytes at a line boundary; the caller
+// leaves room for closing an open details element.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		s = s[:i+1]
+	}
+	if strings.Count(s, "<details>") > strings.Count(s, "</details>") {
+		s += closeDetails
+	}
+	return s
+}
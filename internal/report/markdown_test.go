@@ -0,0 +1,25 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownLocatesFailuresOnThePage(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMarkdown(&buf)
+	m.LinkBase = "https://github.com/org/docs/blob/main/"
+	if err := m.Write(includedFailure()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"- [`source/tutorial/install.txt:18`](https://github.com/org/docs/blob/main/source/tutorial/install.txt#L18) Install the driver",
+		"[`source/tutorial/install.txt:18`](https://github.com/org/docs/blob/main/source/tutorial/install.txt#L18): exit status 1\nin the included [`source/includes/steps-install.rst:4`](https://github.com/org/docs/blob/main/source/includes/steps-install.rst#L4-L6)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary does not contain %q:\n%s", want, out)
+		}
+	}
+}
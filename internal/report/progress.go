@@ -0,0 +1,103 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+// progressWidth bounds the progress line so that it never wraps, which
+// would stop it from being redrawn in place.
+const progressWidth = 78
+
+// progress is the state behind the live progress line.
+type progress struct {
+	done    int
+	running []*running
+	// shown is set while a progress line is on screen.
+	shown bool
+}
+
+// running is a procedure variant that has started and not finished.
+type running struct {
+	proc    *ast.Procedure
+	variant *ast.Variant
+	name    string
+	step    string
+}
+
+// Event updates the live progress line. Runner.OnEvent can be set to it.
+func (h *Human) Event(e runner.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.Live {
+		return
+	}
+	switch e.Type {
+	case runner.EventProcedureStarted:
+		r := runner.ProcedureResult{Procedure: e.Procedure, Variant: e.Variant}
+		h.running = append(h.running, &running{proc: e.Procedure, variant: e.Variant, name: r.Name()})
+	case runner.EventStepStarted:
+		if j := h.job(e.Procedure, e.Variant); j != nil {
+			j.step = e.Step
+		}
+	case runner.EventProcedureFinished:
+		h.done++
+		for i, j := range h.running {
+			if j.proc == e.Procedure && j.variant == e.Variant {
+				h.running = append(h.running[:i], h.running[i+1:]...)
+				break
+			}
+		}
+	}
+	h.redraw()
+}
+
+func (h *Human) job(proc *ast.Procedure, variant *ast.Variant) *running {
+	for _, j := range h.running {
+		if j.proc == proc && j.variant == variant {
+			return j
+		}
+	}
+	return nil
+}
+
+// clear removes the progress line so that a report can be written in its
+// place.
+func (h *Human) clear() {
+	if h.shown {
+		io.WriteString(h.w, "\r\x1b[2K")
+		h.shown = false
+	}
+}
+
+// redraw writes the progress line: how many procedures are done and
+// which step the running ones are on.
+func (h *Human) redraw() error {
+	if !h.Live {
+		return nil
+	}
+	h.clear()
+	if len(h.running) == 0 {
+		return nil
+	}
+	line := fmt.Sprintf("[%d/%d] ", h.done, h.Total)
+	var parts []string
+	for _, j := range h.running {
+		part := j.name
+		if j.step != "" {
+			part += " · step " + j.step
+		}
+		parts = append(parts, part)
+	}
+	line += strings.Join(parts, ", ")
+	if r := []rune(line); len(r) > progressWidth {
+		line = string(r[:progressWidth-1]) + "…"
+	}
+	h.shown = true
+	_, err := io.WriteString(h.w, style{h.Color}.dim(line))
+	return err
+}
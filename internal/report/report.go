@@ -0,0 +1,15 @@
+// Package report writes run results. Every reporter receives each
+// procedure result as it completes and the summary at the end.
+package report
+
+import (
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+// Reporter writes results in one output format.
+type Reporter interface {
+	// Procedure reports one completed test case.
+	Procedure(r *runner.ProcedureResult) error
+	// Summary reports the totals once the run is complete.
+	Summary(s *runner.Summary) error
+}
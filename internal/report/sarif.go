@@ -0,0 +1,259 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/lint"
+	"github.com/dacharyc/spike-procedural-testing/internal/redact"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+// SARIF writes findings as SARIF 2.1.0, which code scanning tools such as
+// GitHub's show as annotations on pull requests. It reports the lint
+// diagnostics it is given and the failures of the run, each at the RST
+// lines it comes from.
+type SARIF struct {
+	// Diagnostics are the static findings for the pages that were run.
+	Diagnostics []lint.Diagnostic
+	// Redactor hides secrets in messages.
+	Redactor *redact.Redactor
+
+	w io.Writer
+}
+
+// NewSARIF returns a SARIF reporter that writes to w once the run ends.
+func NewSARIF(w io.Writer) *SARIF {
+	return &SARIF{w: w}
+}
+
+func (s *SARIF) Procedure(r *runner.ProcedureResult) error {
+	s.Diagnostics = append(s.Diagnostics, Failures(r, s.Redactor)...)
+	return nil
+}
+
+func (s *SARIF) Summary(*runner.Summary) error {
+	return WriteSARIF(s.w, s.Diagnostics)
+}
+
+// Failures returns the diagnostics for a procedure's failure and its
+// failed cleanups.
+func Failures(r *runner.ProcedureResult, red *redact.Redactor) []lint.Diagnostic {
+	clean := func(s string) string {
+		if red == nil {
+			return s
+		}
+		return red.String(s)
+	}
+	var out []lint.Diagnostic
+	if e := r.Error; e != nil {
+		rule := lint.RuleExecutionFailed
+		switch e.Type {
+		case runner.ErrorResolve:
+			rule = lint.RuleUnresolvedPlaceholder
+		case runner.ErrorReplay:
+			rule = lint.RuleReplayFailed
+		case runner.ErrorCleanup:
+			rule = lint.RuleCleanupFailed
+		}
+		msg := r.Name() + ": "
+		if e.Context.StepNumber > 0 {
+			msg += fmt.Sprintf("Step %s: ", e.Context.Step())
+		}
+		msg += e.Message
+		if fa := r.FailedAction(); fa != nil && fa.Execution.Command != "" {
+			msg += "\nCommand: " + firstLines(fa.Execution.Command, 3)
+		}
+		for _, sug := range e.Suggestions {
+			msg += "\nSuggestion: " + sug
+		}
+		loc := e.Location
+		if loc.File == "" {
+			loc = r.Procedure.Location
+		}
+		out = append(out, lint.New(rule, clean(msg), loc))
+	}
+	for _, c := range r.Cleanup {
+		if !c.Success && !c.Skipped {
+			out = append(out, lint.New(lint.RuleCleanupFailed, clean(fmt.Sprintf("%s: could not remove %s: %s", r.Name(), c.Description, c.Error)), r.Procedure.Location))
+		}
+	}
+	return out
+}
+
+// WriteSARIF writes diagnostics as a SARIF log.
+func WriteSARIF(w io.Writer, diags []lint.Diagnostic) error {
+	diags = slices.Clone(diags)
+	lint.Sort(diags)
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "proctest",
+			Version:        Version(),
+			InformationURI: "https://github.com/dacharyc/spike-procedural-testing",
+		}},
+		Results: []sarifResult{},
+	}
+	index := map[string]int{}
+	for _, r := range lint.Rules {
+		index[r.ID] = len(run.Tool.Driver.Rules)
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:                   r.ID,
+			Name:                 ruleName(r.Name),
+			ShortDescription:     sarifMessage{Text: r.Name},
+			FullDescription:      sarifMessage{Text: r.Description},
+			Help:                 sarifMessage{Text: r.Help},
+			DefaultConfiguration: sarifConfiguration{Level: level(r.Severity)},
+		})
+	}
+	for _, d := range diags {
+		res := sarifResult{
+			RuleID:    d.Rule,
+			Level:     level(d.Severity),
+			Message:   sarifMessage{Text: d.Message},
+			Locations: []sarifLocation{physical(d.Location, "")},
+		}
+		if i, ok := index[d.Rule]; ok {
+			res.RuleIndex = &i
+		}
+		// A finding in an include also points at the pages that include it.
+		for i, loc := range d.Location.Chain()[1:] {
+			res.RelatedLocations = append(res.RelatedLocations, physical(loc, "included from here"))
+			res.RelatedLocations[i].ID = i + 1
+		}
+		for _, loc := range d.Related {
+			l := physical(loc, "")
+			l.ID = len(res.RelatedLocations) + 1
+			res.RelatedLocations = append(res.RelatedLocations, l)
+		}
+		run.Results = append(run.Results, res)
+	}
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(log)
+}
+
+func level(s lint.Severity) string {
+	switch s {
+	case lint.SeverityError:
+		return "error"
+	case lint.SeverityNote:
+		return "note"
+	}
+	return "warning"
+}
+
+// ruleName turns "Include not found" into the IncludeNotFound form SARIF
+// uses for rule names.
+func ruleName(name string) string {
+	var b strings.Builder
+	for _, w := range strings.Fields(name) {
+		b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+	return b.String()
+}
+
+// physical locates lines of a source file. Paths are relative to the
+// directory proctest ran in, which for code scanning is the repository
+// root.
+func physical(loc ast.SourceLocation, msg string) sarifLocation {
+	uri := (&url.URL{Path: filepath.ToSlash(loc.File)}).String()
+	if filepath.IsAbs(loc.File) {
+		uri = (&url.URL{Scheme: "file", Path: filepath.ToSlash(loc.File)}).String()
+	}
+	l := sarifLocation{PhysicalLocation: sarifPhysical{ArtifactLocation: sarifArtifact{URI: uri}}}
+	if loc.StartLine > 0 {
+		l.PhysicalLocation.Region = &sarifRegion{StartLine: loc.StartLine, EndLine: max(loc.EndLine, loc.StartLine)}
+	}
+	if msg != "" {
+		l.Message = &sarifMessage{Text: msg}
+	}
+	return l
+}
+
+func firstLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		return strings.Join(lines[:n], "\n") + "\n..."
+	}
+	return strings.Join(lines, "\n")
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	FullDescription      sarifMessage       `json:"fullDescription"`
+	Help                 sarifMessage       `json:"help"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	RuleIndex        *int            `json:"ruleIndex,omitempty"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               int           `json:"id,omitempty"`
+	PhysicalLocation sarifPhysical `json:"physicalLocation"`
+	Message          *sarifMessage `json:"message,omitempty"`
+}
+
+type sarifPhysical struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           *sarifRegion  `json:"region,omitempty"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine,omitempty"`
+}
@@ -0,0 +1,122 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/lint"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+func TestSARIFLocationsAndRules(t *testing.T) {
+	page := ast.SourceLocation{File: "source/tutorial/symfony.txt", StartLine: 18, EndLine: 18}
+	var buf bytes.Buffer
+	s := NewSARIF(&buf)
+	s.Diagnostics = []lint.Diagnostic{
+		lint.New(ast.RuleUnknownLanguage, `unknown language "pyhton"`, ast.SourceLocation{File: "source/includes/steps-install.rst", StartLine: 12, EndLine: 14, IncludedFrom: &page}),
+		{
+			Rule: lint.RuleImplicitNavigation, Severity: lint.SeverityWarning, Message: "composer require runs outside restaurants/",
+			Location: ast.SourceLocation{File: "source/tutorial/symfony.txt", StartLine: 40, EndLine: 42},
+			Related:  []ast.SourceLocation{{File: "source/tutorial/symfony.txt", StartLine: 50, EndLine: 50}},
+		},
+		lint.New("not-a-rule", "a finding of a rule proctest does not list", ast.SourceLocation{File: "/tmp/page.txt"}),
+	}
+	rs := variantResults()
+	for i := range rs {
+		if err := s.Procedure(&rs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sum := runner.Summarize(rs)
+	if err := s.Summary(&sum); err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("SARIF %s with %d runs", log.Version, len(log.Runs))
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != len(lint.Rules) {
+		t.Errorf("%d rules, want %d", len(run.Tool.Driver.Rules), len(lint.Rules))
+	}
+	byRule := map[string]sarifResult{}
+	for _, res := range run.Results {
+		byRule[res.RuleID] = res
+		if res.RuleIndex == nil {
+			continue
+		}
+		rule := run.Tool.Driver.Rules[*res.RuleIndex]
+		if rule.ID != res.RuleID {
+			t.Errorf("%s: ruleIndex %d is rule %s", res.RuleID, *res.RuleIndex, rule.ID)
+		}
+		if rule.DefaultConfiguration.Level != res.Level {
+			t.Errorf("%s: level %s, rule level %s", res.RuleID, res.Level, rule.DefaultConfiguration.Level)
+		}
+	}
+	if len(run.Results) != 5 {
+		t.Errorf("%d results, want the 3 diagnostics and the 2 failures", len(run.Results))
+	}
+
+	// where formats a location as uri:start-end.
+	where := func(l sarifLocation) string {
+		s := l.PhysicalLocation.ArtifactLocation.URI
+		if r := l.PhysicalLocation.Region; r != nil {
+			s += fmt.Sprintf(":%d-%d", r.StartLine, r.EndLine)
+		}
+		return s
+	}
+	tests := []struct {
+		rule      string
+		level     string
+		location  string
+		related   []string
+		inMessage string
+	}{
+		{ast.RuleUnknownLanguage, "warning", "source/includes/steps-install.rst:12-14", []string{"source/tutorial/symfony.txt:18-18 included from here"}, "pyhton"},
+		{lint.RuleImplicitNavigation, "warning", "source/tutorial/symfony.txt:40-42", []string{"source/tutorial/symfony.txt:50-50"}, "restaurants/"},
+		{lint.RuleExecutionFailed, "error", "source/connect.txt:30-30", nil, "Connect (Node.js): Step 2: command exited with code 1\nCommand: node app.js"},
+		{lint.RuleUnresolvedPlaceholder, "error", "source/seed.txt:14-14", nil, "Seed the Database: Step 1: unresolved placeholders"},
+		{"not-a-rule", "warning", "file:///tmp/page.txt", nil, "does not list"},
+	}
+	for _, tt := range tests {
+		res, ok := byRule[tt.rule]
+		if !ok {
+			t.Errorf("no %s result", tt.rule)
+			continue
+		}
+		if res.Level != tt.level {
+			t.Errorf("%s: level %s, want %s", tt.rule, res.Level, tt.level)
+		}
+		if len(res.Locations) != 1 || where(res.Locations[0]) != tt.location {
+			t.Errorf("%s: locations %+v, want %s", tt.rule, res.Locations, tt.location)
+		}
+		var related []string
+		for i, l := range res.RelatedLocations {
+			if l.ID != i+1 {
+				t.Errorf("%s: related location %d has id %d", tt.rule, i, l.ID)
+			}
+			r := where(l)
+			if l.Message != nil {
+				r += " " + l.Message.Text
+			}
+			related = append(related, r)
+		}
+		if strings.Join(related, "; ") != strings.Join(tt.related, "; ") {
+			t.Errorf("%s: related locations %q, want %q", tt.rule, related, tt.related)
+		}
+		if !strings.Contains(res.Message.Text, tt.inMessage) {
+			t.Errorf("%s: message %q does not contain %q", tt.rule, res.Message.Text, tt.inMessage)
+		}
+		if (res.RuleIndex != nil) != (tt.rule != "not-a-rule") {
+			t.Errorf("%s: ruleIndex %v", tt.rule, res.RuleIndex)
+		}
+	}
+}
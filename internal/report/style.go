@@ -0,0 +1,51 @@
+package report
+
+import (
+	"os"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+// style colors terminal output when it is enabled.
+type style struct {
+	enabled bool
+}
+
+func (s style) wrap(code, text string) string {
+	if !s.enabled || text == "" {
+		return text
+	}
+	return "\x1b[" + code + "m" + text + "\x1b[0m"
+}
+
+func (s style) bold(text string) string   { return s.wrap("1", text) }
+func (s style) dim(text string) string    { return s.wrap("2", text) }
+func (s style) red(text string) string    { return s.wrap("31", text) }
+func (s style) green(text string) string  { return s.wrap("32", text) }
+func (s style) yellow(text string) string { return s.wrap("33", text) }
+func (s style) cyan(text string) string   { return s.wrap("36", text) }
+
+func (s style) status(status runner.Status, text string) string {
+	switch status {
+	case runner.StatusPassed:
+		return s.green(text)
+	case runner.StatusFailed:
+		return s.red(text)
+	}
+	return s.yellow(text)
+}
+
+// IsTerminal reports whether f is a terminal rather than a file or pipe.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// UseColor decides whether output to f is colored: never when NO_COLOR
+// is set (see https://no-color.org), otherwise when f is a terminal.
+func UseColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return IsTerminal(f) && os.Getenv("TERM") != "dumb"
+}
@@ -0,0 +1,211 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/redact"
+	"github.com/dacharyc/spike-procedural-testing/internal/runner"
+)
+
+// TAP writes TAP version 14 as results come in. A procedure without
+// variants is a test point. A procedure with variants is a subtest with a
+// test point for each variant, which consumers show nested under the
+// procedure's own test point. Failures carry a YAML diagnostic block and
+// skipped test cases a SKIP directive.
+type TAP struct {
+	// Redactor hides secrets in commands and output.
+	Redactor *redact.Redactor
+
+	w io.Writer
+	// n counts the top-level test points written.
+	n int
+	// variants are the results of the procedure whose variants are
+	// coming in. Results arrive in order, so they are adjacent.
+	variants []runner.ProcedureResult
+	// started is set once the version line is written.
+	started bool
+}
+
+// NewTAP returns a TAP reporter that writes to w.
+func NewTAP(w io.Writer) *TAP {
+	return &TAP{w: w}
+}
+
+func (t *TAP) Procedure(r *runner.ProcedureResult) error {
+	var b strings.Builder
+	if !t.started {
+		t.started = true
+		b.WriteString("TAP version 14\n")
+	}
+	if len(t.variants) > 0 && (r.Variant == nil || t.variants[0].Procedure != r.Procedure) {
+		t.subtest(&b)
+	}
+	if r.Variant != nil {
+		t.variants = append(t.variants, *r)
+	} else {
+		t.n++
+		t.point(&b, "", t.n, r, r.Name())
+	}
+	_, err := io.WriteString(t.w, b.String())
+	return err
+}
+
+func (t *TAP) Summary(*runner.Summary) error {
+	var b strings.Builder
+	if !t.started {
+		t.started = true
+		b.WriteString("TAP version 14\n")
+	}
+	t.subtest(&b)
+	if t.n == 0 {
+		b.WriteString("1..0 # SKIP no procedures to test\n")
+	} else {
+		fmt.Fprintf(&b, "1..%d\n", t.n)
+	}
+	_, err := io.WriteString(t.w, b.String())
+	return err
+}
+
+// subtest writes the variants collected so far as a subtest, followed by
+// the test point of their procedure, which fails if any variant failed
+// and is skipped if every variant was.
+func (t *TAP) subtest(b *strings.Builder) {
+	if len(t.variants) == 0 {
+		return
+	}
+	proc := t.variants[0].Procedure
+	fmt.Fprintf(b, "# Subtest: %s\n", proc.Title)
+	failed, skipped := false, 0
+	for i := range t.variants {
+		r := &t.variants[i]
+		t.point(b, "    ", i+1, r, r.Variant.Label)
+		switch r.Status() {
+		case runner.StatusFailed:
+			failed = true
+		case runner.StatusSkipped:
+			skipped++
+		}
+	}
+	fmt.Fprintf(b, "    1..%d\n", len(t.variants))
+	t.n++
+	line := fmt.Sprintf("%d - %s", t.n, tapEscape(proc.Title))
+	switch {
+	case failed:
+		line = "not ok " + line
+	case skipped == len(t.variants):
+		line = "ok " + line + " # SKIP every variant was skipped"
+	default:
+		line = "ok " + line
+	}
+	b.WriteString(line + "\n")
+	t.variants = nil
+}
+
+// point writes the test point of one test case, numbered n, with the
+// YAML block of its failure.
+func (t *TAP) point(b *strings.Builder, indent string, n int, r *runner.ProcedureResult, desc string) {
+	line := fmt.Sprintf("%d - %s", n, tapEscape(desc))
+	switch r.Status() {
+	case runner.StatusSkipped:
+		fmt.Fprintf(b, "%sok %s # SKIP %s\n", indent, line, tapEscape(oneLine(r.SkipReason)))
+		return
+	case runner.StatusPassed:
+		fmt.Fprintf(b, "%sok %s\n", indent, line)
+		if r.Flaky {
+			fmt.Fprintf(b, "%s# passed after retries\n", indent)
+		}
+		return
+	}
+	fmt.Fprintf(b, "%snot ok %s\n", indent, line)
+	t.diagnostic(b, indent+"  ", r)
+}
+
+// diagnostic writes the YAML block that describes why r failed.
+func (t *TAP) diagnostic(b *strings.Builder, indent string, r *runner.ProcedureResult) {
+	clean := func(s string) string {
+		if t.Redactor != nil {
+			s = t.Redactor.String(s)
+		}
+		return xmlSafe(s)
+	}
+	field := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(b, "%s%s: %s\n", indent, key, yamlString(value, indent+"  "))
+		}
+	}
+	fmt.Fprintf(b, "%s---\n", indent)
+	field("file", r.File)
+	if e := r.Error; e != nil {
+		field("message", clean(e.Message))
+		field("type", e.Type)
+		if e.Context.StepNumber > 0 {
+			field("step", e.Context.Step())
+			field("stepTitle", e.Context.StepTitle)
+		}
+		if e.Location.StartLine > 0 {
+			fmt.Fprintf(b, "%sat:\n", indent)
+			fmt.Fprintf(b, "%s  file: %s\n", indent, yamlString(e.Location.File, indent+"    "))
+			fmt.Fprintf(b, "%s  line: %d\n", indent, e.Location.StartLine)
+		}
+	}
+	fmt.Fprintf(b, "%sseverity: fail\n", indent)
+	if a := r.FailedAction(); a != nil {
+		field("command", clean(a.Execution.Command))
+		if a.Execution.ExitCode != 0 {
+			fmt.Fprintf(b, "%sexitCode: %d\n", indent, a.Execution.ExitCode)
+		}
+		for _, out := range []struct{ key, text string }{{"stdout", a.Execution.Stdout}, {"stderr", a.Execution.Stderr}} {
+			if lines, total := tailLines(clean(out.text), failureLines); len(lines) > 0 {
+				if total > len(lines) {
+					lines = append([]string{fmt.Sprintf("... %d earlier lines", total-len(lines))}, lines...)
+				}
+				field(out.key, strings.Join(lines, "\n"))
+			}
+		}
+	}
+	fmt.Fprintf(b, "%sduration_ms: %d\n", indent, r.Duration.Milliseconds())
+	fmt.Fprintf(b, "%s...\n", indent)
+}
+
+// yamlString formats s as a YAML scalar: a literal block indented by
+// indent when it has several lines, otherwise a double-quoted string,
+// which JSON's quoting is valid for.
+func yamlString(s, indent string) string {
+	if strings.Contains(s, "\n") && !strings.HasPrefix(s, " ") && !strings.HasPrefix(s, "\t") {
+		lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+		var b strings.Builder
+		b.WriteString("|-")
+		for _, l := range lines {
+			b.WriteString("\n")
+			if l != "" {
+				b.WriteString(indent + l)
+			}
+		}
+		return b.String()
+	}
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// tapEscape escapes the characters that would end a description: "#"
+// starts a directive.
+func tapEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "#", `\#`).Replace(s)
+}
+
+// oneLine joins the non-empty lines of s with semicolons.
+func oneLine(s string) string {
+	var lines []string
+	for _, l := range strings.Split(s, "\n") {
+		if l = strings.Join(strings.Fields(l), " "); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return strings.Join(lines, "; ")
+}
@@ -0,0 +1,215 @@
+// Package resolver fills in the placeholders the parser finds in testable
+// actions (<connection-string>, {+api-key+}, {groupId}, $MONGODB_URI) from
+// the environment.
+package resolver
+
+import (
+	"maps"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// aliases maps normalized placeholder names to the environment variables
+// the docs team conventionally uses for them (see env.template in the
+// usage guide).
+var aliases = map[string][]string{
+	"connectionstring": {"MONGODB_URI"},
+	"connectionuri":    {"MONGODB_URI"},
+	"uri":              {"MONGODB_URI"},
+	"mongodburi":       {"MONGODB_URI"},
+	"groupid":          {"ATLAS_PROJECT_ID"},
+	"projectid":        {"ATLAS_PROJECT_ID"},
+	"clustername":      {"ATLAS_CLUSTER_NAME"},
+	"publickey":        {"ATLAS_PUBLIC_KEY"},
+	"privatekey":       {"ATLAS_PRIVATE_KEY"},
+	"apikey":           {"ATLAS_PUBLIC_KEY"},
+}
+
+// prefixes are stripped from environment variable names when matching
+// them against placeholder names, so <cluster-name> finds
+// ATLAS_CLUSTER_NAME.
+var prefixes = []string{"ATLAS_", "MONGODB_", "PROCTEST_"}
+
+// Resolver looks placeholders up in an environment.
+type Resolver struct {
+	env map[string]string
+}
+
+// New returns a resolver over env, a list of KEY=value pairs. Later
+// entries win, as they do for exec.Cmd.
+func New(env []string) *Resolver {
+	r := &Resolver{env: map[string]string{}}
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			r.env[k] = v
+		}
+	}
+	return r
+}
+
+// With returns a resolver over r's environment extended with env.
+func (r *Resolver) With(env []string) *Resolver {
+	out := &Resolver{env: maps.Clone(r.env)}
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			out.env[k] = v
+		}
+	}
+	return out
+}
+
+// FromProcess returns a resolver over the process environment.
+func FromProcess() *Resolver {
+	return New(os.Environ())
+}
+
+var (
+	nonAlnumRE = regexp.MustCompile(`[^a-z0-9]`)
+	nonEnvRE   = regexp.MustCompile(`[^A-Z0-9]+`)
+)
+
+// Name returns the bare name of a placeholder: "connection-string" for
+// <connection-string>, {+connection-string+}, {connection-string} or
+// $CONNECTION_STRING.
+func Name(placeholder string) string {
+	p := strings.TrimSpace(placeholder)
+	switch {
+	case strings.HasPrefix(p, "{+") && strings.HasSuffix(p, "+}"):
+		return p[2 : len(p)-2]
+	case strings.HasPrefix(p, "<") && strings.HasSuffix(p, ">"),
+		strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}"):
+		return p[1 : len(p)-1]
+	case strings.HasPrefix(p, "${") && strings.HasSuffix(p, "}"):
+		return p[2 : len(p)-1]
+	case strings.HasPrefix(p, "$"):
+		return p[1:]
+	}
+	return p
+}
+
+func normalize(name string) string {
+	return nonAlnumRE.ReplaceAllString(strings.ToLower(name), "")
+}
+
+// EnvName returns the environment variable name a placeholder maps to by
+// convention: <connection-string> is CONNECTION_STRING.
+func EnvName(placeholder string) string {
+	name := Name(placeholder)
+	// Split camelCase so that {groupId} becomes GROUP_ID.
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			prev := name[i-1]
+			if prev >= 'a' && prev <= 'z' {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(r)
+	}
+	s := strings.ToUpper(b.String())
+	s = nonEnvRE.ReplaceAllString(s, "_")
+	return strings.Trim(s, "_")
+}
+
+// Resolve returns the value for a placeholder and the environment
+// variable it came from. Lookups try, in order: the exact variable name
+// ($VAR), the conventional name (CONNECTION_STRING), the team aliases
+// (MONGODB_URI), and finally any variable whose name matches once
+// ATLAS_/MONGODB_ prefixes and punctuation are ignored.
+func (r *Resolver) Resolve(placeholder string) (value, variable string, ok bool) {
+	if strings.HasPrefix(placeholder, "$") {
+		name := Name(placeholder)
+		v, ok := r.env[name]
+		return v, name, ok && v != ""
+	}
+	for _, name := range r.candidates(placeholder) {
+		if v, ok := r.env[name]; ok && v != "" {
+			return v, name, true
+		}
+	}
+	want := normalize(Name(placeholder))
+	for _, name := range r.names() {
+		if normalize(name) == want || normalize(trimPrefix(name)) == want {
+			if v := r.env[name]; v != "" {
+				return v, name, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func (r *Resolver) candidates(placeholder string) []string {
+	conv := EnvName(placeholder)
+	out := []string{conv}
+	for _, p := range prefixes {
+		out = append(out, p+conv)
+	}
+	out = append(out, aliases[normalize(Name(placeholder))]...)
+	return out
+}
+
+func trimPrefix(name string) string {
+	for _, p := range prefixes {
+		if strings.HasPrefix(name, p) {
+			return name[len(p):]
+		}
+	}
+	return name
+}
+
+func (r *Resolver) names() []string {
+	names := make([]string, 0, len(r.env))
+	for k := range r.env {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Suggestions lists the variables a reader would most likely set for an
+// unresolved placeholder: the conventional name, its ATLAS_, MONGODB_
+// and PROCTEST_ forms, and the team aliases. Variables that happen to be
+// set are not looked at, so that the names of unrelated secrets do not
+// end up in reports.
+func (r *Resolver) Suggestions(placeholder string) []string {
+	out := r.candidates(placeholder)
+	seen := map[string]bool{}
+	var uniq []string
+	for _, s := range out {
+		if s != "" && !seen[s] {
+			seen[s] = true
+			uniq = append(uniq, s)
+		}
+	}
+	return uniq
+}
+
+// Substitution is one placeholder filled in by Apply.
+type Substitution struct {
+	Placeholder string `json:"placeholder" yaml:"placeholder"`
+	Variable    string `json:"variable" yaml:"variable"`
+	Value       string `json:"-" yaml:"-"`
+}
+
+// Apply replaces every placeholder in text with its value. Shell
+// variables ($VAR) are left for the shell to expand; they only need to be
+// set. It returns the substitutions made and the placeholders that could
+// not be resolved.
+func (r *Resolver) Apply(text string, placeholders []string) (string, []Substitution, []string) {
+	var subs []Substitution
+	var unresolved []string
+	for _, p := range placeholders {
+		value, variable, ok := r.Resolve(p)
+		if !ok {
+			unresolved = append(unresolved, p)
+			continue
+		}
+		subs = append(subs, Substitution{Placeholder: p, Variable: variable, Value: value})
+		if !strings.HasPrefix(p, "$") {
+			text = strings.ReplaceAll(text, p, value)
+		}
+	}
+	return text, subs, unresolved
+}
@@ -0,0 +1,409 @@
+package rst
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Kind identifies the type of a block node.
+type Kind int
+
+const (
+	Heading Kind = iota + 1
+	Directive
+	Paragraph
+	List
+	Item
+	Quote
+	LiteralBlock
+)
+
+// Node is one block of an RST document. Headings are kept flat in the
+// order they appear; their nesting is given by Level.
+type Node struct {
+	Kind Kind
+	// Name is the directive name, such as "procedure" or "code-block".
+	Name string
+	// Arg is the directive argument or the heading title.
+	Arg     string
+	Options map[string]string
+	// Text is the paragraph text with lines joined by spaces. For list
+	// items it is the text of the item's first paragraph.
+	Text string
+	// Marker is the list item enumerator without punctuation ("1", "a",
+	// "#") or the bullet character.
+	Marker string
+	// Ordered is set on enumerated lists.
+	Ordered bool
+	// Level is the heading level, starting at 1.
+	Level int
+	// Body holds the raw content of literal directives and literal blocks.
+	Body     []Line
+	Children []*Node
+	// Start and End are the first and last lines of the node in the file
+	// the node starts in.
+	Start, End *Origin
+}
+
+// Document is a parsed page.
+type Document struct {
+	Nodes []*Node
+	// Substitutions holds |name| definitions made on the page.
+	Substitutions map[string]string
+}
+
+// literalDirectives keep their content as raw text instead of parsing it.
+var literalDirectives = map[string]bool{
+	"code-block":     true,
+	"code":           true,
+	"sourcecode":     true,
+	"literalinclude": true,
+	"input":          true,
+	"output":         true,
+}
+
+var (
+	directiveRE    = regexp.MustCompile(`^\.\.\s+([\w:.+-]+)::(?:\s+(.*))?$`)
+	substitutionRE = regexp.MustCompile(`^\.\.\s+\|([^|]+)\|\s+([\w-]+)::(?:\s+(.*))?$`)
+	targetRE       = regexp.MustCompile(`^\.\.\s+_`)
+	enumeratorRE   = regexp.MustCompile(`^(\d+|[A-Za-z]|#)[.)]\s+`)
+	bulletRE       = regexp.MustCompile(`^[-*+•]\s+`)
+	dirOptionRE    = regexp.MustCompile(`^:([\w-]+):(?:\s+(.*))?$`)
+)
+
+type blockParser struct {
+	styles []string
+	subs   map[string]string
+}
+
+// Parse splits expanded lines into blocks.
+func Parse(lines []Line) *Document {
+	p := &blockParser{subs: map[string]string{}}
+	return &Document{Nodes: p.blocks(lines), Substitutions: p.subs}
+}
+
+func (p *blockParser) blocks(lines []Line) []*Node {
+	var nodes []*Node
+	i := 0
+	for i < len(lines) {
+		t := lines[i].Text
+		if isBlank(t) {
+			i++
+			continue
+		}
+
+		if indentOf(t) > 0 {
+			j := indentedEnd(lines, i)
+			n := &Node{Kind: Quote, Children: p.blocks(dedent(lines[i:j], -1))}
+			n.span(lines[i:j])
+			nodes = append(nodes, n)
+			i = j
+			continue
+		}
+
+		if n, j := p.heading(lines, i); j > i {
+			if n != nil {
+				nodes = append(nodes, n)
+			}
+			i = j
+			continue
+		}
+
+		if strings.HasPrefix(t, "..") && (len(t) == 2 || t[2] == ' ') {
+			j := indentedEnd(lines, i+1)
+			if n := p.explicit(lines[i:j]); n != nil {
+				nodes = append(nodes, n)
+			}
+			i = j
+			continue
+		}
+
+		if _, _, ok := listMarker(t); ok {
+			n, j := p.list(lines, i)
+			nodes = append(nodes, n)
+			i = j
+			continue
+		}
+
+		j := i + 1
+		for j < len(lines) && !isBlank(lines[j].Text) && indentOf(lines[j].Text) == 0 {
+			j++
+		}
+		n := &Node{Kind: Paragraph, Text: joinText(lines[i:j])}
+		n.span(lines[i:j])
+		nodes = append(nodes, n)
+
+		if strings.HasSuffix(n.Text, "::") {
+			n.Text = strings.TrimSuffix(n.Text, ":")
+			if strings.HasSuffix(n.Text, " :") || n.Text == ":" {
+				n.Text = strings.TrimSpace(strings.TrimSuffix(n.Text, ":"))
+			}
+			k := j
+			for k < len(lines) && isBlank(lines[k].Text) {
+				k++
+			}
+			if k < len(lines) && indentOf(lines[k].Text) > 0 {
+				end := indentedEnd(lines, k)
+				lit := &Node{Kind: LiteralBlock, Body: dedent(lines[k:end], -1)}
+				lit.span(lines[k:end])
+				nodes = append(nodes, lit)
+				j = end
+			}
+		}
+		i = j
+	}
+	return nodes
+}
+
+// heading recognizes section titles with an underline or an overline and
+// underline. It returns the index after the heading, or i when the lines
+// at i are not a heading. A bare adornment line is a transition and is
+// consumed without producing a node.
+func (p *blockParser) heading(lines []Line, i int) (*Node, int) {
+	t := strings.TrimRight(lines[i].Text, " ")
+	if isAdornment(t) {
+		if i+2 < len(lines) && !isBlank(lines[i+1].Text) && strings.TrimRight(lines[i+2].Text, " ") == t {
+			n := &Node{Kind: Heading, Arg: strings.TrimSpace(lines[i+1].Text), Level: p.level("o" + t[:1])}
+			n.span(lines[i : i+3])
+			return n, i + 3
+		}
+		if i+1 >= len(lines) || isBlank(lines[i+1].Text) {
+			return nil, i + 1
+		}
+		return nil, i
+	}
+	if i+1 < len(lines) {
+		u := strings.TrimRight(lines[i+1].Text, " ")
+		if isAdornment(u) && indentOf(u) == 0 && len(u) >= 3 {
+			n := &Node{Kind: Heading, Arg: strings.TrimSpace(t), Level: p.level(u[:1])}
+			n.span(lines[i : i+2])
+			return n, i + 2
+		}
+	}
+	return nil, i
+}
+
+// adornmentChars are the punctuation characters RST allows in section
+// title underlines and overlines.
+const adornmentChars = "=-~^\"'`#*+<>:_."
+
+// isAdornment reports whether t is a line of at least three identical
+// adornment characters.
+func isAdornment(t string) bool {
+	t = strings.TrimRight(t, " ")
+	if len(t) < 3 || !strings.ContainsRune(adornmentChars, rune(t[0])) {
+		return false
+	}
+	return strings.Count(t, t[:1]) == len(t)
+}
+
+func (p *blockParser) level(style string) int {
+	for i, s := range p.styles {
+		if s == style {
+			return i + 1
+		}
+	}
+	p.styles = append(p.styles, style)
+	return len(p.styles)
+}
+
+// explicit parses an explicit markup block: a directive, a substitution
+// definition, a hyperlink target, or a comment. Only directives produce a
+// node.
+func (p *blockParser) explicit(lines []Line) *Node {
+	t := lines[0].Text
+	if targetRE.MatchString(t) {
+		return nil
+	}
+	if m := substitutionRE.FindStringSubmatch(t); m != nil {
+		if m[2] == "replace" {
+			val := m[3]
+			for _, ln := range lines[1:] {
+				val += " " + strings.TrimSpace(ln.Text)
+			}
+			p.subs[m[1]] = strings.TrimSpace(val)
+		}
+		return nil
+	}
+	m := directiveRE.FindStringSubmatch(t)
+	if m == nil {
+		return nil
+	}
+
+	n := &Node{Kind: Directive, Name: strings.ToLower(m[1]), Arg: strings.TrimSpace(m[2]), Options: map[string]string{}}
+	n.span(lines)
+	rest := dedent(lines[1:], -1)
+	k := 0
+	if n.Arg != "" {
+		for k < len(rest) && !isBlank(rest[k].Text) && !dirOptionRE.MatchString(rest[k].Text) {
+			n.Arg += " " + strings.TrimSpace(rest[k].Text)
+			k++
+		}
+	}
+	for k < len(rest) && dirOptionRE.MatchString(rest[k].Text) {
+		om := dirOptionRE.FindStringSubmatch(rest[k].Text)
+		val := strings.TrimSpace(om[2])
+		k++
+		for k < len(rest) && !isBlank(rest[k].Text) && indentOf(rest[k].Text) > 0 && !dirOptionRE.MatchString(strings.TrimSpace(rest[k].Text)) {
+			val += " " + strings.TrimSpace(rest[k].Text)
+			k++
+		}
+		n.Options[om[1]] = val
+	}
+	content := rest[k:]
+	if literalDirectives[n.Name] {
+		n.Body = trimBlankLines(content)
+	} else {
+		n.Children = p.blocks(content)
+	}
+	return n
+}
+
+// list parses consecutive items of the same list type starting at i.
+func (p *blockParser) list(lines []Line, i int) (*Node, int) {
+	first, _, _ := listMarker(lines[i].Text)
+	list := &Node{Kind: List, Ordered: isEnumerator(first)}
+	start := i
+	last := i
+	for i < len(lines) {
+		t := lines[i].Text
+		if isBlank(t) {
+			i++
+			continue
+		}
+		marker, width, ok := listMarker(t)
+		if !ok || indentOf(t) != 0 || isEnumerator(marker) != list.Ordered {
+			break
+		}
+		j := indentedEnd(lines, i+1)
+		item := make([]Line, 0, j-i)
+		item = append(item, Line{Text: strings.Repeat(" ", width) + t[width:], Origin: lines[i].Origin})
+		item = append(item, lines[i+1:j]...)
+		n := &Node{Kind: Item, Marker: marker, Children: p.blocks(dedent(item, width))}
+		n.span(lines[i:j])
+		for _, c := range n.Children {
+			if c.Kind == Paragraph {
+				n.Text = c.Text
+				break
+			}
+		}
+		list.Children = append(list.Children, n)
+		last = j
+		i = j
+	}
+	list.span(lines[start:last])
+	return list, last
+}
+
+// listMarker returns the enumerator or bullet that starts t and the width
+// of the marker including the following whitespace.
+func listMarker(t string) (string, int, bool) {
+	if m := enumeratorRE.FindString(t); m != "" {
+		return strings.TrimRight(strings.TrimSpace(m), ".)"), len(m), true
+	}
+	if m := bulletRE.FindString(t); m != "" {
+		return strings.TrimSpace(m), len(m), true
+	}
+	return "", 0, false
+}
+
+func isEnumerator(marker string) bool {
+	return marker != "-" && marker != "*" && marker != "+" && marker != "•"
+}
+
+// indentedEnd returns the index after the indented block that starts at
+// i, excluding trailing blank lines.
+func indentedEnd(lines []Line, i int) int {
+	j := i
+	for j < len(lines) && (isBlank(lines[j].Text) || indentOf(lines[j].Text) > 0) {
+		j++
+	}
+	for j > i && isBlank(lines[j-1].Text) {
+		j--
+	}
+	return j
+}
+
+// dedent removes up to n leading spaces from every line, or the common
+// indentation of the non-blank lines when n is negative.
+func dedent(lines []Line, n int) []Line {
+	if n < 0 {
+		for _, ln := range lines {
+			if isBlank(ln.Text) {
+				continue
+			}
+			if ind := indentOf(ln.Text); n < 0 || ind < n {
+				n = ind
+			}
+		}
+	}
+	out := make([]Line, len(lines))
+	for i, ln := range lines {
+		cut := n
+		if ind := indentOf(ln.Text); ind < cut {
+			cut = ind
+		}
+		if cut > 0 {
+			ln.Text = ln.Text[cut:]
+		}
+		out[i] = ln
+	}
+	return out
+}
+
+func trimBlankLines(lines []Line) []Line {
+	for len(lines) > 0 && isBlank(lines[0].Text) {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && isBlank(lines[len(lines)-1].Text) {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func joinText(lines []Line) string {
+	parts := make([]string, 0, len(lines))
+	for _, ln := range lines {
+		if s := strings.TrimSpace(ln.Text); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// span records the first line of the node and the last non-blank line
+// that comes from the same file and include site.
+func (n *Node) span(lines []Line) {
+	if len(lines) == 0 {
+		return
+	}
+	n.Start = lines[0].Origin
+	n.End = n.Start
+	for _, ln := range lines[1:] {
+		if isBlank(ln.Text) || ln.Origin == nil || n.Start == nil {
+			continue
+		}
+		if ln.Origin.File == n.Start.File && ln.Origin.Parent == n.Start.Parent {
+			n.End = ln.Origin
+		}
+	}
+}
+
+// BodyText returns the literal body of the node as a string.
+func (n *Node) BodyText() string {
+	parts := make([]string, len(n.Body))
+	for i, ln := range n.Body {
+		parts[i] = strings.TrimRight(ln.Text, " ")
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Walk calls fn for every node in the tree rooted at nodes, depth first.
+// Returning false from fn skips the node's children.
+func Walk(nodes []*Node, fn func(*Node) bool) {
+	for _, n := range nodes {
+		if fn(n) {
+			Walk(n.Children, fn)
+		}
+	}
+}
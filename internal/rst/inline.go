@@ -0,0 +1,103 @@
+package rst
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Link is an external hyperlink written with `text <url>`_ syntax.
+type Link struct {
+	Text string
+	URL  string
+}
+
+var (
+	roleRE            = regexp.MustCompile("(:[\\w:.-]+:)`([^`]*)`")
+	refRE             = regexp.MustCompile("`([^`<]*?)\\s*<([^>`]+)>`__?")
+	literalRE         = regexp.MustCompile("``([^`]+)``")
+	strongRE          = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	emphasisRE        = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+	substitutionRefRE = regexp.MustCompile(`\|([\w][\w .-]*)\|`)
+	roleTargetRE      = regexp.MustCompile(`^(.*?)\s*<[^>]+>$`)
+)
+
+// Plain renders inline markup as plain text. Substitution references are
+// resolved with subst; unresolved references keep their name.
+func Plain(s string, subst func(name string) (string, bool)) string {
+	for i := 0; i < 3 && strings.Contains(s, "|"); i++ {
+		s = substitutionRefRE.ReplaceAllStringFunc(s, func(m string) string {
+			name := m[1 : len(m)-1]
+			if subst != nil {
+				if v, ok := subst(name); ok {
+					return v
+				}
+			}
+			return name
+		})
+	}
+	s = roleRE.ReplaceAllStringFunc(s, func(m string) string {
+		return roleText(roleRE.FindStringSubmatch(m)[2])
+	})
+	s = refRE.ReplaceAllStringFunc(s, func(m string) string {
+		sm := refRE.FindStringSubmatch(m)
+		if sm[1] == "" {
+			return sm[2]
+		}
+		return sm[1]
+	})
+	s = literalRE.ReplaceAllString(s, "$1")
+	s = strongRE.ReplaceAllString(s, "$1")
+	s = emphasisRE.ReplaceAllString(s, "$1")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// roleText returns the display text of a role such as
+// :ref:`Title <target>` or :binary:`~bin.mongosh`.
+func roleText(content string) string {
+	if m := roleTargetRE.FindStringSubmatch(content); m != nil {
+		if m[1] != "" {
+			return m[1]
+		}
+		content = strings.Trim(content, "<>")
+	}
+	content = strings.TrimPrefix(content, "!")
+	if strings.HasPrefix(content, "~") {
+		content = content[1:]
+		if i := strings.LastIndex(content, "."); i >= 0 {
+			content = content[i+1:]
+		}
+	}
+	return content
+}
+
+// Links returns the external hyperlinks in s.
+func Links(s string) []Link {
+	var links []Link
+	for _, m := range refRE.FindAllStringSubmatch(s, -1) {
+		if strings.HasPrefix(m[2], "http://") || strings.HasPrefix(m[2], "https://") {
+			links = append(links, Link{Text: strings.TrimSpace(m[1]), URL: m[2]})
+		}
+	}
+	return links
+}
+
+// RoleTexts returns the display text of every use of the named role in
+// s, for example every :guilabel:.
+func RoleTexts(s, role string) []string {
+	var out []string
+	for _, m := range roleRE.FindAllStringSubmatch(s, -1) {
+		if m[1] == ":"+role+":" {
+			out = append(out, roleText(m[2]))
+		}
+	}
+	return out
+}
+
+// Literals returns the text of every “literal“ in s.
+func Literals(s string) []string {
+	var out []string
+	for _, m := range literalRE.FindAllStringSubmatch(s, -1) {
+		out = append(out, m[1])
+	}
+	return out
+}
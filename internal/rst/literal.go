@@ -0,0 +1,117 @@
+package rst
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ReadLiteral reads the file referenced by a literalinclude directive and
+// applies its :start-after:, :end-before:, :lines:, and :dedent: options.
+// It returns the selected text and the resolved path.
+func (l *Loader) ReadLiteral(ref, from string, opts map[string]string) (string, string, error) {
+	path := l.Resolve(ref, from)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", path, fmt.Errorf("literalinclude %s not found", ref)
+	}
+	if l.seen == nil {
+		l.seen = map[string]bool{}
+	}
+	if !l.seen[path] {
+		l.seen[path] = true
+		l.Files = append(l.Files, path)
+	}
+
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"), "\n")
+	if spec := opts["lines"]; spec != "" {
+		lines = selectLines(lines, spec)
+	}
+	if marker := opts["start-after"]; marker != "" {
+		for i, ln := range lines {
+			if strings.Contains(ln, marker) {
+				lines = lines[i+1:]
+				break
+			}
+		}
+	}
+	if marker := opts["end-before"]; marker != "" {
+		for i, ln := range lines {
+			if strings.Contains(ln, marker) {
+				lines = lines[:i]
+				break
+			}
+		}
+	}
+	if d, ok := opts["dedent"]; ok {
+		n, err := strconv.Atoi(strings.TrimSpace(d))
+		if err != nil {
+			n = -1
+		}
+		lines = dedentText(lines, n)
+	}
+	return strings.Join(trimBlankText(lines), "\n"), path, nil
+}
+
+// selectLines applies a :lines: option such as "1-5,8,10-".
+func selectLines(lines []string, spec string) []string {
+	var out []string
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			lo, hi = part[:i], part[i+1:]
+		}
+		start, err := strconv.Atoi(lo)
+		if err != nil || start < 1 {
+			start = 1
+		}
+		end, err := strconv.Atoi(hi)
+		if err != nil || end > len(lines) {
+			end = len(lines)
+		}
+		for i := start; i <= end; i++ {
+			out = append(out, lines[i-1])
+		}
+	}
+	return out
+}
+
+// dedentText removes n leading spaces from every line, or the common
+// indentation when n is negative.
+func dedentText(lines []string, n int) []string {
+	if n < 0 {
+		n = -1
+		for _, ln := range lines {
+			if isBlank(ln) {
+				continue
+			}
+			if ind := indentOf(ln); n < 0 || ind < n {
+				n = ind
+			}
+		}
+	}
+	out := make([]string, len(lines))
+	for i, ln := range lines {
+		cut := n
+		if ind := indentOf(ln); ind < cut {
+			cut = ind
+		}
+		if cut > 0 {
+			ln = ln[cut:]
+		}
+		out[i] = ln
+	}
+	return out
+}
+
+func trimBlankText(lines []string) []string {
+	for len(lines) > 0 && isBlank(lines[0]) {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && isBlank(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
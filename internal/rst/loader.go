@@ -0,0 +1,221 @@
+// Package rst reads reStructuredText pages the way the docs build sees
+// them: include directives are expanded inline, every line remembers the
+// file and include chain it came from, and the expanded text is split
+// into a tree of blocks.
+package rst
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxIncludeDepth guards against runaway include nesting.
+const maxIncludeDepth = 25
+
+// Origin records where a line came from. Parent is the origin of the
+// include directive that pulled the line's file into the page, if any.
+type Origin struct {
+	File   string
+	Line   int
+	Parent *Origin
+}
+
+// Chain returns the origin followed by every include site above it.
+func (o *Origin) Chain() []*Origin {
+	var chain []*Origin
+	for p := o; p != nil; p = p.Parent {
+		chain = append(chain, p)
+	}
+	return chain
+}
+
+// Line is one line of expanded source.
+type Line struct {
+	Text   string
+	Origin *Origin
+}
+
+// Warning is a non-fatal problem found while loading or parsing.
+type Warning struct {
+	Message string
+	Origin  *Origin
+}
+
+// Loader expands a page and its includes into a flat list of lines.
+type Loader struct {
+	// SourceDir is the directory that absolute include paths such as
+	// "/includes/steps.rst" resolve against.
+	SourceDir string
+	// Warnings collects includes that could not be resolved.
+	Warnings []Warning
+	// Files lists every file read, in the order first read.
+	Files []string
+
+	seen map[string]bool
+}
+
+// NewLoader returns a loader that resolves absolute include paths against
+// sourceDir.
+func NewLoader(sourceDir string) *Loader {
+	return &Loader{SourceDir: sourceDir, seen: map[string]bool{}}
+}
+
+// FindSourceDir guesses the source directory for a page that is not part
+// of a snooty project: the nearest ancestor directory named "source", or
+// the page's own directory.
+func FindSourceDir(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Dir(path)
+	}
+	for dir := filepath.Dir(abs); ; {
+		if filepath.Base(dir) == "source" {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return filepath.Dir(abs)
+		}
+		dir = parent
+	}
+}
+
+var (
+	includeRE = regexp.MustCompile(`^(\s*)((?:[-*+]|\d+\.|#\.|[A-Za-z]\.)\s+)?\.\.\s+(include|sharedinclude)::\s*(\S+)\s*$`)
+	optionRE  = regexp.MustCompile(`^\s*:([\w-]+):(?:\s+(.*))?$`)
+)
+
+// Load reads the page at path and expands its includes.
+func (l *Loader) Load(path string) ([]Line, error) {
+	return l.load(path, nil, 0)
+}
+
+func (l *Loader) load(path string, parent *Origin, depth int) ([]Line, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if l.seen == nil {
+		l.seen = map[string]bool{}
+	}
+	if !l.seen[path] {
+		l.seen[path] = true
+		l.Files = append(l.Files, path)
+	}
+
+	raw := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if len(raw) > 0 && raw[len(raw)-1] == "" {
+		raw = raw[:len(raw)-1]
+	}
+
+	var out []Line
+	for i := 0; i < len(raw); i++ {
+		text := strings.ReplaceAll(raw[i], "\t", "        ")
+		origin := &Origin{File: path, Line: i + 1, Parent: parent}
+		m := includeRE.FindStringSubmatch(text)
+		if m == nil {
+			out = append(out, Line{Text: text, Origin: origin})
+			continue
+		}
+		indent, marker, kind, ref := m[1], m[2], m[3], m[4]
+
+		opts := map[string]string{}
+		end := i + 1
+		for end < len(raw) && indentOf(raw[end]) > len(indent) && optionRE.MatchString(raw[end]) {
+			om := optionRE.FindStringSubmatch(raw[end])
+			opts[om[1]] = strings.TrimSpace(om[2])
+			end++
+		}
+
+		included, err := l.include(kind, ref, path, origin, depth)
+		if err != nil {
+			l.Warnings = append(l.Warnings, Warning{Message: err.Error(), Origin: origin})
+			for k := i; k < end; k++ {
+				out = append(out, Line{Text: raw[k], Origin: &Origin{File: path, Line: k + 1, Parent: parent}})
+			}
+			i = end - 1
+			continue
+		}
+		included = sliceLines(included, opts["start-after"], opts["end-before"])
+
+		prefix := indent + marker
+		pad := indent + strings.Repeat(" ", len(marker))
+		first := true
+		for _, ln := range included {
+			if isBlank(ln.Text) {
+				out = append(out, Line{Origin: ln.Origin})
+				continue
+			}
+			if first {
+				ln.Text = prefix + ln.Text
+				first = false
+			} else {
+				ln.Text = pad + ln.Text
+			}
+			out = append(out, ln)
+		}
+		i = end - 1
+	}
+	return out, nil
+}
+
+func (l *Loader) include(kind, ref, from string, origin *Origin, depth int) ([]Line, error) {
+	if kind == "sharedinclude" {
+		return nil, fmt.Errorf("shared include %s is fetched at build time and was not expanded", ref)
+	}
+	if depth >= maxIncludeDepth {
+		return nil, fmt.Errorf("include %s exceeds the maximum include depth of %d", ref, maxIncludeDepth)
+	}
+	target := l.Resolve(ref, from)
+	for p := origin; p != nil; p = p.Parent {
+		if p.File == target {
+			return nil, fmt.Errorf("include cycle: %s includes itself", ref)
+		}
+	}
+	if _, err := os.Stat(target); err != nil {
+		return nil, fmt.Errorf("include %s not found", ref)
+	}
+	return l.load(target, origin, depth+1)
+}
+
+// Resolve maps an include or literalinclude reference to a file path.
+// Absolute references resolve against the source directory; relative ones
+// against the including file.
+func (l *Loader) Resolve(ref, from string) string {
+	if strings.HasPrefix(ref, "/") {
+		return filepath.Join(l.SourceDir, filepath.FromSlash(ref))
+	}
+	return filepath.Join(filepath.Dir(from), filepath.FromSlash(ref))
+}
+
+// sliceLines applies include :start-after: and :end-before: options.
+func sliceLines(lines []Line, startAfter, endBefore string) []Line {
+	if startAfter != "" {
+		for i, ln := range lines {
+			if strings.Contains(ln.Text, startAfter) {
+				lines = lines[i+1:]
+				break
+			}
+		}
+	}
+	if endBefore != "" {
+		for i, ln := range lines {
+			if strings.Contains(ln.Text, endBefore) {
+				lines = lines[:i]
+				break
+			}
+		}
+	}
+	return lines
+}
+
+func isBlank(s string) bool {
+	return strings.TrimSpace(s) == ""
+}
+
+func indentOf(s string) int {
+	return len(s) - len(strings.TrimLeft(s, " "))
+}
@@ -0,0 +1,250 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/cassette"
+	"github.com/dacharyc/spike-procedural-testing/internal/executor"
+	"github.com/dacharyc/spike-procedural-testing/internal/prereq"
+)
+
+// cassettePath returns where the cassette of a procedure variant lives.
+func (r *Runner) cassettePath(file string, proc *ast.Procedure, variant *ast.Variant) string {
+	return cassette.Path(r.Options.CassetteDir, file, procedureID(proc, variant))
+}
+
+// openCassette starts a new cassette when recording and loads the
+// existing one when replaying. A procedure that was never recorded gets
+// an empty cassette, so that each of its external actions reports what
+// is missing.
+func (r *Runner) openCassette(pr *procedureRun, doc *ast.Document, variant *ast.Variant, res *ProcedureResult) error {
+	path := r.cassettePath(doc.File, pr.proc, variant)
+	label := ""
+	if variant != nil {
+		label = variant.Label
+	}
+	switch r.Options.Cassettes {
+	case cassette.ModeRecord:
+		pr.tape = cassette.New(path, doc.File, pr.proc.Title, label)
+	case cassette.ModeReplay:
+		tape, err := cassette.Load(path)
+		if errors.Is(err, cassette.ErrNotRecorded) {
+			tape = cassette.New(path, doc.File, pr.proc.Title, label)
+		} else if err != nil {
+			return err
+		}
+		pr.tape = tape
+	default:
+		return nil
+	}
+	res.Cassette = path
+	return nil
+}
+
+// closeCassette saves a recording. Only a passing run of every step and
+// action is saved: the recording of a failed run, or of one that Filter
+// cut down, would replace a good cassette with one that misses actions.
+func (r *Runner) closeCassette(pr *procedureRun, res *ProcedureResult) {
+	if r.Options.Cassettes != cassette.ModeRecord || pr.tape == nil {
+		return
+	}
+	if !res.Success || r.Options.Filter.partial(pr.proc, pr.sel) {
+		res.Cassette = ""
+		return
+	}
+	if err := pr.tape.Save(); err != nil {
+		res.Success = false
+		res.Error = &TestError{Type: ErrorReplay, Message: fmt.Sprintf("cannot save cassette: %v", err), Location: pr.proc.Location}
+	}
+}
+
+// recordAction adds a successful external action to the cassette, with
+// secrets redacted.
+func (r *Runner) recordAction(pr *procedureRun, a, resolved ast.Action, key string, exec executor.Result) error {
+	i := &cassette.Interaction{
+		Key:         key,
+		Type:        a.Kind(),
+		Fingerprint: cassette.Fingerprint(a),
+		Command:     r.Redactor.String(exec.Command),
+		Success:     exec.Success,
+		ExitCode:    exec.ExitCode,
+		Error:       r.Redactor.String(exec.Error),
+		Stdout:      cassette.NewOutput(r.Redactor.String(exec.Stdout)),
+		Stderr:      cassette.NewOutput(r.Redactor.String(exec.Stderr)),
+	}
+	if d, ok := resolved.(*ast.DownloadAction); ok {
+		blob, err := cassette.StoreBlob(r.Options.CassetteDir, pr.path(d.OutputPath), d.OutputPath)
+		if err != nil {
+			return err
+		}
+		i.File = blob
+	}
+	pr.tape.Add(i)
+	return nil
+}
+
+// replayAction serves an external action from the cassette. Placeholders
+// are not resolved, so a replay needs no credentials.
+func (r *Runner) replayAction(pr *procedureRun, a ast.Action, key string, errCtx ErrorContext) ActionResult {
+	ar := ActionResult{Action: a, Replayed: true}
+	fail := func(msg string) ActionResult {
+		ar.Execution = executor.Result{ExitCode: -1, Error: msg}
+		ar.Error = &TestError{Type: ErrorReplay, Message: msg, Location: a.Base().Location, Context: errCtx,
+			Suggestions: []string{"record the procedure again with --record"}}
+		return ar
+	}
+	i, ok := pr.tape.Lookup(key)
+	if !ok {
+		return fail(fmt.Sprintf("nothing was recorded for this %s action (%s in %s)", a.Kind(), key, pr.tape.Path()))
+	}
+	if why := i.Stale(a); why != "" {
+		return fail(fmt.Sprintf("the recording of this %s action is stale: %s", a.Kind(), why))
+	}
+	ar.Execution = executor.Result{
+		Success:  i.Success,
+		Command:  i.Command,
+		Stdout:   i.Stdout.String(),
+		Stderr:   i.Stderr.String(),
+		ExitCode: i.ExitCode,
+		Error:    i.Error,
+	}
+	if i.File != nil {
+		if err := cassette.RestoreBlob(r.Options.CassetteDir, i.File, pr.path(i.File.Path)); err != nil {
+			return fail(err.Error())
+		}
+	}
+	if !ar.Execution.Success {
+		ar.Error = &TestError{Type: ErrorExecute, Message: executionMessage(a, ar.Execution), Location: a.Base().Location, Context: errCtx}
+	}
+	return ar
+}
+
+// path resolves a path from an action against the current directory.
+func (pr *procedureRun) path(p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(pr.ec.Cwd, p)
+}
+
+// waiveCredentials marks environment requirements as met when a replay
+// does not need them: the cassette answers the external actions, but the
+// other actions of the variant still run live. A requirement stays unmet
+// when a live action mentions its variable, or when any live action has a
+// placeholder the environment cannot fill, as that may be the credential.
+func (r *Runner) waiveCredentials(results []prereq.Result, proc *ast.Procedure, sel ast.Selection) {
+	var live []ast.Action
+	unresolved := false
+	walkProcedure(proc, sel, func(a ast.Action, key string) {
+		if key != "" || a.Kind() == ast.ActionWait || !r.Options.Filter.RunsAction(a) {
+			return
+		}
+		live = append(live, a)
+		for _, p := range ast.Placeholders(a) {
+			if _, _, ok := r.Resolver.Resolve(p); !ok {
+				unresolved = true
+			}
+		}
+	})
+	if unresolved {
+		return
+	}
+	for i := range results {
+		req, ok := results[i].Requirement.(*ast.EnvironmentRequirement)
+		if !ok || results[i].Met || slices.ContainsFunc(live, func(a ast.Action) bool { return mentions(a, req.Variable) }) {
+			continue
+		}
+		results[i].Met = true
+		results[i].Message += " (not needed when replaying)"
+		results[i].SkipReason = ""
+	}
+}
+
+// mentions reports whether the code, command or file content of a names
+// the environment variable v.
+func mentions(a ast.Action, v string) bool {
+	var text string
+	switch a := a.(type) {
+	case *ast.CodeAction:
+		text = a.Code
+	case *ast.ShellAction:
+		text = a.Command
+	case *ast.FileAction:
+		text = a.Content
+	}
+	return v != "" && strings.Contains(text, v)
+}
+
+// CassetteStatus is the state of one procedure variant's cassette.
+type CassetteStatus struct {
+	Procedure *ast.Procedure
+	Variant   *ast.Variant
+	Path      string
+	// Problems describe actions with no recording or a stale one, and
+	// recordings no action uses any more. A current cassette has none.
+	Problems []string
+}
+
+// CheckCassettes compares the cassettes of doc's procedures with the
+// page as it is now, without running anything. Procedures without
+// external actions are left out.
+func (r *Runner) CheckCassettes(doc *ast.Document) ([]CassetteStatus, error) {
+	var statuses []CassetteStatus
+	check := func(proc *ast.Procedure, variant *ast.Variant) error {
+		sel := ast.Selection{}
+		if variant != nil {
+			sel = variant.Selection
+		}
+		st := CassetteStatus{Procedure: proc, Variant: variant, Path: r.cassettePath(doc.File, proc, variant)}
+		tape, err := cassette.Load(st.Path)
+		if errors.Is(err, cassette.ErrNotRecorded) {
+			tape = nil
+		} else if err != nil {
+			return err
+		}
+		used := map[string]bool{}
+		external := false
+		walkProcedure(proc, sel, func(a ast.Action, key string) {
+			if key == "" {
+				return
+			}
+			external = true
+			used[key] = true
+			if tape == nil {
+				return
+			}
+			i, ok := tape.Lookup(key)
+			switch {
+			case !ok:
+				st.Problems = append(st.Problems, fmt.Sprintf("%s: %s action at %s was never recorded", key, a.Kind(), a.Base().Location))
+			case i.Stale(a) != "":
+				st.Problems = append(st.Problems, fmt.Sprintf("%s: %s", key, i.Stale(a)))
+			}
+		})
+		if !external {
+			return nil
+		}
+		if tape == nil {
+			st.Problems = append(st.Problems, "no cassette has been recorded")
+		} else {
+			for _, i := range tape.Interactions {
+				if !used[i.Key] {
+					st.Problems = append(st.Problems, fmt.Sprintf("%s: recorded %s action is no longer on the page", i.Key, i.Type))
+				}
+			}
+		}
+		statuses = append(statuses, st)
+		return nil
+	}
+	for _, job := range Jobs(doc) {
+		if err := check(job.Procedure, job.Variant); err != nil {
+			return statuses, err
+		}
+	}
+	return statuses, nil
+}
@@ -0,0 +1,167 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/cassette"
+	"github.com/dacharyc/spike-procedural-testing/internal/executor"
+)
+
+const apiKey = "ATLAS_PRIVATE_API_KEY=8f2d1c0b-secret"
+
+// clusterProcedure creates a cluster with the Atlas CLI in step 1, which
+// is recorded, and runs live in step 2. It needs ATLAS_PRIVATE_API_KEY.
+func clusterProcedure(create string, live ast.Action) *ast.Procedure {
+	return &ast.Procedure{
+		Title: "Create a Cluster",
+		Prerequisites: &ast.Prerequisites{Requirements: []ast.Requirement{
+			&ast.EnvironmentRequirement{RequirementBase: ast.RequirementBase{Type: ast.RequirementEnvironment}, Variable: "ATLAS_PRIVATE_API_KEY"},
+		}},
+		Steps: []*ast.Step{
+			{Number: 1, Title: "Create the cluster", Actions: []ast.Action{
+				&ast.CLIAction{ActionBase: ast.ActionBase{Type: ast.ActionCLI}, Tool: "atlas", Command: create},
+			}},
+			{Number: 2, Title: "Check the connection", Actions: []ast.Action{live}},
+		},
+	}
+}
+
+// cassetteRunner returns a runner that records to or replays from dir,
+// with the actions that run live answered by s.
+func cassetteRunner(t *testing.T, s *scripted, mode cassette.Mode, dir string, env ...string) *Runner {
+	return scriptedRunner(s, Options{
+		Env:           append([]string{"PATH=" + os.Getenv("PATH")}, env...),
+		RunsDir:       t.TempDir(),
+		KeepArtifacts: KeepNever,
+		Cassettes:     mode,
+		CassetteDir:   dir,
+	})
+}
+
+func created() *scripted {
+	return &scripted{results: []executor.Result{{Success: true, Command: "atlas clusters create Test --key 8f2d1c0b-secret", Stdout: "Cluster 'Test' created\n"}}}
+}
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	doc := &ast.Document{File: "source/create-cluster.txt"}
+	proc := clusterProcedure("atlas clusters create Test", shell("echo ready"))
+
+	rec := created()
+	res := cassetteRunner(t, rec, cassette.ModeRecord, dir, apiKey).RunProcedure(context.Background(), doc, proc, nil)
+	if !res.Success || res.Cassette == "" {
+		t.Fatalf("recording: success %v, cassette %q: %v", res.Success, res.Cassette, res.Error)
+	}
+	tape, err := cassette.Load(res.Cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tape.Interactions) != 1 || tape.Interactions[0].Key != "1/1" {
+		t.Fatalf("recorded %d interactions, want the CLI action as 1/1", len(tape.Interactions))
+	}
+	if cmd := tape.Interactions[0].Command; strings.Contains(cmd, "8f2d1c0b-secret") {
+		t.Errorf("the cassette has the API key: %s", cmd)
+	}
+
+	// The replay has no API key: the cassette answers the CLI action and
+	// the live step does not need the key.
+	live := &scripted{results: []executor.Result{{Success: true}}}
+	res = cassetteRunner(t, live, cassette.ModeReplay, dir).RunProcedure(context.Background(), doc, proc, nil)
+	if !res.Success {
+		t.Fatalf("replay failed: skipped %v (%s): %v", res.Skipped, res.SkipReason, res.Error)
+	}
+	if live.calls != 1 {
+		t.Errorf("the replay ran %d actions, want only the live one", live.calls)
+	}
+	if ar := res.Steps[0].Actions[0]; !ar.Replayed || ar.Execution.Stdout != "Cluster 'Test' created\n" {
+		t.Errorf("CLI action replayed %v with output %q", ar.Replayed, ar.Execution.Stdout)
+	}
+	if msg := res.PrerequisiteChecks[0].Message; !strings.Contains(msg, "not needed when replaying") {
+		t.Errorf("prerequisite check: %s", msg)
+	}
+
+	// A replay of a page whose command changed is stale.
+	changed := clusterProcedure("atlas clusters create Test --tier M10", shell("echo ready"))
+	res = cassetteRunner(t, &scripted{results: []executor.Result{{Success: true}}}, cassette.ModeReplay, dir).RunProcedure(context.Background(), doc, changed, nil)
+	if res.Success || res.Error == nil || !strings.Contains(res.Error.Message, "stale") {
+		t.Errorf("replay of a changed command: success %v, error %v", res.Success, res.Error)
+	}
+}
+
+func TestCassetteReplayWaivesCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		live        ast.Action
+		wantSkipped bool
+	}{
+		{"live actions do not need the key", shell("echo ready"), false},
+		{"a live action uses the key", shell(`curl -u "$ATLAS_PRIVATE_API_KEY" https://cloud.mongodb.com/api`), true},
+		{"a live action has a placeholder with no value", &ast.ShellAction{
+			ActionBase:   ast.ActionBase{Type: ast.ActionShell},
+			Command:      "mongosh <connection-string>",
+			Placeholders: []string{"<connection-string>"},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			doc := &ast.Document{File: "source/create-cluster.txt"}
+			proc := clusterProcedure("atlas clusters create Test", tt.live)
+			tape := cassette.New(cassette.Path(dir, doc.File, "create-a-cluster"), doc.File, proc.Title, "")
+			tape.Add(&cassette.Interaction{Key: "1/1", Type: ast.ActionCLI, Fingerprint: cassette.Fingerprint(proc.Steps[0].Actions[0]), Success: true})
+			if err := tape.Save(); err != nil {
+				t.Fatal(err)
+			}
+			res := cassetteRunner(t, &scripted{results: []executor.Result{{Success: true}}}, cassette.ModeReplay, dir).RunProcedure(context.Background(), doc, proc, nil)
+			if res.Skipped != tt.wantSkipped {
+				t.Errorf("skipped = %v (%s), want %v", res.Skipped, res.SkipReason, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestCassetteNotSaved(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		live   executor.Result
+	}{
+		{"steps left out", Filter{Steps: []StepRange{{First: 1, Last: 1}}}, executor.Result{Success: true}},
+		{"action types left out", Filter{ActionTypes: []ast.ActionType{ast.ActionCLI}}, executor.Result{Success: true}},
+		{"the run failed", Filter{}, executor.Result{ExitCode: 1, Error: "exit status 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			doc := &ast.Document{File: "source/create-cluster.txt"}
+			proc := clusterProcedure("atlas clusters create Test", shell("echo ready"))
+			res := cassetteRunner(t, created(), cassette.ModeRecord, dir, apiKey).RunProcedure(context.Background(), doc, proc, nil)
+			if !res.Success {
+				t.Fatalf("the first recording failed: %v", res.Error)
+			}
+			before, err := os.ReadFile(res.Cassette)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := &scripted{results: []executor.Result{{Success: true, Stdout: "Cluster 'Other' created\n"}, tt.live}}
+			r := cassetteRunner(t, s, cassette.ModeRecord, dir, apiKey)
+			r.Options.Filter = tt.filter
+			res = r.RunProcedure(context.Background(), doc, proc, nil)
+			if res.Cassette != "" {
+				t.Errorf("the result names cassette %s", res.Cassette)
+			}
+			after, err := os.ReadFile(cassette.Path(dir, doc.File, "create-a-cluster"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(after) != string(before) {
+				t.Errorf("the recording replaced the cassette:\n%s", after)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package runner
+
+import (
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/cleanup"
+)
+
+// EventType identifies a progress event.
+type EventType string
+
+const (
+	EventProcedureStarted  EventType = "procedure-started"
+	EventStepStarted       EventType = "step-started"
+	EventOutput            EventType = "action-output"
+	EventStepFinished      EventType = "step-finished"
+	EventCleanup           EventType = "cleanup"
+	EventProcedureFinished EventType = "procedure-finished"
+)
+
+// Event reports progress while procedures run, for live output. Results
+// are reported in order by Run's emit function; events arrive as things
+// happen, from every worker at once.
+type Event struct {
+	Type      EventType
+	Time      time.Time
+	File      string
+	Procedure *ast.Procedure
+	Variant   *ast.Variant
+	// Step is the step number as the docs show it, "2" or "2.b", and
+	// StepTitle its title, on the step events. Output events carry Step
+	// only.
+	Step      string
+	StepTitle string
+	// Success, Duration and Error are the outcome of the step on
+	// EventStepFinished.
+	Success  bool
+	Duration time.Duration
+	Error    *TestError
+	// Action is the action that wrote Output to Stream, "stdout" or
+	// "stderr", on EventOutput. Output is one line, with its newline
+	// unless the process ended without one.
+	Action ast.Action
+	Stream string
+	Output string
+	// Cleanup is the outcome of a cleanup task on EventCleanup.
+	Cleanup *cleanup.Result
+	// Result is set on EventProcedureFinished.
+	Result *ProcedureResult
+}
+
+// event passes e to Runner.OnEvent, if set.
+func (r *Runner) event(e Event) {
+	if r.OnEvent == nil {
+		return
+	}
+	e.Time = time.Now()
+	r.OnEvent(e)
+}
@@ -0,0 +1,260 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+)
+
+// Filter selects the test cases of a run, and the steps and actions of
+// them that run. The zero Filter selects everything.
+type Filter struct {
+	// Grep matches the procedure title, the test case name or its ID.
+	Grep *regexp.Regexp
+	// Variants select variants by ID, label, a selection value such as
+	// "go", or a selection such as "interface=driver,language=go" that
+	// the variant's selection has to include. A test case is selected
+	// when any of them matches its variant, so procedures without
+	// variants are not.
+	Variants []string
+	// Steps are the steps to run, by number. Empty runs every step.
+	Steps []StepRange
+	// ActionTypes are the types of action to run. Empty runs every type;
+	// otherwise steps without an action of these types are left out.
+	ActionTypes []ast.ActionType
+}
+
+// StepRange is the step numbers from First to Last. Last is 0 for a
+// range that runs to the last step.
+type StepRange struct {
+	First, Last int
+}
+
+// ParseStepRanges parses step ranges written as "2", "2-4", "3-" or
+// "-2", separated by commas.
+func ParseStepRanges(s string) ([]StepRange, error) {
+	var out []StepRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+		r := StepRange{First: 1}
+		var err error
+		if from != "" {
+			r.First, err = strconv.Atoi(from)
+		}
+		switch {
+		case err != nil:
+		case !isRange:
+			r.Last = r.First
+		case to != "":
+			r.Last, err = strconv.Atoi(to)
+		}
+		if err != nil || part == "" || part == "-" || r.First < 1 || r.Last < 0 || (r.Last > 0 && r.Last < r.First) {
+			return nil, fmt.Errorf("invalid step range %q: use N, N-M, N- or -M", part)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// ParseVariantSelection parses a variant selector written as a
+// selection, "dim=value,dim=value". ok is false for a selector that is
+// an ID, label or value instead.
+func ParseVariantSelection(s string) (sel ast.Selection, ok bool, err error) {
+	if !strings.Contains(s, "=") {
+		return nil, false, nil
+	}
+	sel = ast.Selection{}
+	for _, pair := range strings.Split(s, ",") {
+		dim, value, _ := strings.Cut(pair, "=")
+		dim, value = strings.TrimSpace(dim), strings.TrimSpace(value)
+		if dim == "" || value == "" {
+			return nil, true, fmt.Errorf("invalid variant selection %q: use dimension=value pairs separated by commas", s)
+		}
+		sel[dim] = value
+	}
+	return sel, true, nil
+}
+
+// IsZero reports whether f selects everything.
+func (f Filter) IsZero() bool {
+	return f.Grep == nil && len(f.Variants) == 0 && len(f.Steps) == 0 && len(f.ActionTypes) == 0
+}
+
+// Jobs returns the jobs f selects, in order.
+func (f Filter) Jobs(jobs []Job) []Job {
+	var out []Job
+	for _, j := range jobs {
+		if f.Selects(j) {
+			out = append(out, j)
+		}
+	}
+	return out
+}
+
+// Selects reports whether f selects the test case of j. A test case
+// whose steps and actions are all filtered out is not selected.
+func (f Filter) Selects(j Job) bool {
+	if f.Grep != nil {
+		tc := ProcedureResult{Procedure: j.Procedure, Variant: j.Variant}
+		if !f.Grep.MatchString(j.Procedure.Title) && !f.Grep.MatchString(tc.Name()) && !f.Grep.MatchString(tc.ID()) {
+			return false
+		}
+	}
+	if len(f.Variants) > 0 && !f.selectsVariant(j.Variant) {
+		return false
+	}
+	if len(f.Steps) == 0 && len(f.ActionTypes) == 0 {
+		return true
+	}
+	return len(f.Plan(j)) > 0
+}
+
+func (f Filter) selectsVariant(v *ast.Variant) bool {
+	for _, spec := range f.Variants {
+		if VariantMatches(spec, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// VariantMatches reports whether the variant selector spec, as in
+// Filter.Variants, matches v. Nothing matches a nil variant.
+func VariantMatches(spec string, v *ast.Variant) bool {
+	if v == nil {
+		return false
+	}
+	if sel, ok, err := ParseVariantSelection(spec); ok {
+		return err == nil && sel.Matches(v.Selection)
+	}
+	if spec == v.ID || strings.EqualFold(spec, v.Label) {
+		return true
+	}
+	for _, value := range v.Selection {
+		if strings.EqualFold(spec, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunsStep reports whether step number n is in Steps.
+func (f Filter) RunsStep(n int) bool {
+	if len(f.Steps) == 0 {
+		return true
+	}
+	for _, r := range f.Steps {
+		if n >= r.First && (r.Last == 0 || n <= r.Last) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunsAction reports whether a is of one of ActionTypes.
+func (f Filter) RunsAction(a ast.Action) bool {
+	if len(f.ActionTypes) == 0 {
+		return true
+	}
+	for _, t := range f.ActionTypes {
+		if a.Kind() == t {
+			return true
+		}
+	}
+	return false
+}
+
+// partial reports whether f leaves out a step or an action that the
+// variant of proc with sel has.
+func (f Filter) partial(proc *ast.Procedure, sel ast.Selection) bool {
+	if len(f.Steps) == 0 && len(f.ActionTypes) == 0 {
+		return false
+	}
+	for _, step := range proc.Steps {
+		if step.Selection.Matches(sel) && !f.RunsStep(step.Number) {
+			return true
+		}
+	}
+	left := false
+	walkProcedure(proc, sel, func(a ast.Action, _ string) {
+		left = left || !f.RunsAction(a)
+	})
+	return left
+}
+
+// runsStep reports whether step runs for sel: it is in Steps and, when
+// ActionTypes are set, it or one of its sub-steps has an action to run.
+func (f Filter) runsStep(step *ast.Step, sel ast.Selection) bool {
+	if !step.Selection.Matches(sel) || !f.RunsStep(step.Number) {
+		return false
+	}
+	if len(f.ActionTypes) == 0 || f.hasAction(step.Actions, sel) {
+		return true
+	}
+	for _, sub := range step.SubSteps {
+		if f.runsSubStep(sub, sel) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Filter) runsSubStep(sub *ast.SubStep, sel ast.Selection) bool {
+	return sub.Selection.Matches(sel) && (len(f.ActionTypes) == 0 || f.hasAction(sub.Actions, sel))
+}
+
+func (f Filter) hasAction(actions []ast.Action, sel ast.Selection) bool {
+	for _, a := range actions {
+		if a.Base().Selection.Matches(sel) && f.RunsAction(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// PlannedStep is a step or sub-step that a test case would run, with
+// the actions it would run in order.
+type PlannedStep struct {
+	// Step is the step number as the page shows it, "2" or "2.b".
+	Step    string
+	Title   string
+	Actions []ast.Action
+}
+
+// Plan lists the steps and actions the test case of j runs under f,
+// leaving out what its variant does not show, without running anything.
+// It makes the same choices RunProcedure does.
+func (f Filter) Plan(j Job) []PlannedStep {
+	sel := ast.Selection{}
+	if j.Variant != nil {
+		sel = j.Variant.Selection
+	}
+	actions := func(as []ast.Action) []ast.Action {
+		var out []ast.Action
+		for _, a := range as {
+			if a.Base().Selection.Matches(sel) && f.RunsAction(a) {
+				out = append(out, a)
+			}
+		}
+		return out
+	}
+	var plan []PlannedStep
+	for _, step := range j.Procedure.Steps {
+		if !f.runsStep(step, sel) {
+			continue
+		}
+		ctx := ErrorContext{StepNumber: step.Number}
+		plan = append(plan, PlannedStep{Step: ctx.Step(), Title: step.Title, Actions: actions(step.Actions)})
+		for _, sub := range step.SubSteps {
+			if f.runsSubStep(sub, sel) {
+				ctx.SubStepNumber = sub.Number
+				plan = append(plan, PlannedStep{Step: ctx.Step(), Title: sub.Title, Actions: actions(sub.Actions)})
+			}
+		}
+	}
+	return plan
+}
@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/executor"
+	"github.com/dacharyc/spike-procedural-testing/internal/sandbox"
+)
+
+// procedureID names a procedure variant's sandbox.
+func procedureID(proc *ast.Procedure, variant *ast.Variant) string {
+	id := sandbox.Slug(proc.Title)
+	if variant != nil && variant.ID != "" {
+		id += "-" + variant.ID
+	}
+	return id
+}
+
+// manifest describes a finished procedure for its kept sandbox.
+func (r *Runner) manifest(sb *sandbox.Sandbox, ec *executor.Context, res *ProcedureResult) *sandbox.Manifest {
+	m := &sandbox.Manifest{
+		File:             res.File,
+		Procedure:        res.Procedure.Title,
+		Status:           string(res.Status()),
+		StartedAt:        res.StartedAt,
+		Duration:         res.Duration,
+		WorkingDirectory: ec.Cwd,
+		Env:              r.Redactor.Env(ec.Env),
+		Commands:         []sandbox.Command{},
+		Files:            sb.Files(),
+	}
+	if res.Variant != nil {
+		m.Variant = res.Variant.Label
+	}
+	sort.Strings(m.Env)
+	add := func(step string, actions []ActionResult) {
+		for _, ar := range actions {
+			m.Commands = append(m.Commands, sandbox.Command{
+				Step:     step,
+				Type:     string(ar.Action.Kind()),
+				Command:  r.Redactor.String(ar.Execution.Command),
+				ExitCode: ar.Execution.ExitCode,
+				Duration: ar.Execution.Duration,
+				Error:    r.Redactor.String(ar.Execution.Error),
+			})
+		}
+	}
+	for _, sr := range res.Steps {
+		step := strconv.Itoa(sr.Step.Number)
+		add(step, sr.Actions)
+		for _, ssr := range sr.SubSteps {
+			add(step+"."+ssr.SubStep.Number, ssr.Actions)
+		}
+	}
+	return m
+}
@@ -0,0 +1,253 @@
+package runner
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+)
+
+// Job is one procedure variant to run.
+type Job struct {
+	Doc       *ast.Document
+	Procedure *ast.Procedure
+	// Variant is nil for a procedure whose content is the same for every
+	// variant of the page.
+	Variant *ast.Variant
+	// Owner and Tags come from the test registry entry the job was
+	// selected by, if any. Tags are added to the page's tags.
+	Owner string
+	Tags  []string
+	// SkipReason, when set, reports the job as skipped without running
+	// it, such as for a registry entry that is skipped for now.
+	SkipReason string
+	// Runner, when set, runs the job with its own options in place of
+	// the runner that schedules it, so that pages with different
+	// configuration files share one set of workers and limits.
+	Runner *Runner
+}
+
+// Jobs expands the procedures of doc into one job per variant.
+func Jobs(doc *ast.Document) []Job {
+	var jobs []Job
+	for _, proc := range doc.Procedures {
+		if len(proc.Variants) == 0 {
+			jobs = append(jobs, Job{Doc: doc, Procedure: proc})
+			continue
+		}
+		for i := range proc.Variants {
+			jobs = append(jobs, Job{Doc: doc, Procedure: proc, Variant: &proc.Variants[i]})
+		}
+	}
+	return jobs
+}
+
+// RunDocument runs every procedure of doc, once per variant. It stops
+// starting new procedures once ctx is cancelled.
+func (r *Runner) RunDocument(ctx context.Context, doc *ast.Document) []ProcedureResult {
+	var results []ProcedureResult
+	r.Run(ctx, Jobs(doc), func(res ProcedureResult) {
+		results = append(results, res)
+	})
+	return results
+}
+
+// Run runs jobs on Options.Jobs workers and passes each result to emit
+// in the order of jobs, whatever order they finish in, so that output
+// stays readable. The steps of a job always run in order on one worker.
+//
+// A job only starts when every resource it needs has a free slot under
+// Options.Limits, and never alongside another job that uses the same
+// test database or collection; a job that has to wait does not hold up
+// the jobs behind it. Once ctx is cancelled no more jobs start, and the
+// jobs that did not run are not emitted. A job with a Runner of its own
+// is scheduled by r and run by its Runner.
+func (r *Runner) Run(ctx context.Context, jobs []Job, emit func(ProcedureResult)) {
+	workers := r.Options.Jobs
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	// AfterFunc calls its function on a goroutine of its own, so a
+	// context that is already done has to be seen here, before any
+	// worker asks for a job.
+	s := &scheduler{
+		limits:    r.Options.Limits,
+		inUse:     map[string]int{},
+		needs:     make([][]string, len(jobs)),
+		results:   make([]*ProcedureResult, len(jobs)),
+		cancelled: ctx.Err() != nil,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	for i, job := range jobs {
+		s.pending = append(s.pending, i)
+		s.needs[i] = r.runnerOf(job).resourcesOf(job)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		s.cancelled = true
+		s.mu.Unlock()
+		s.cond.Broadcast()
+	})
+	defer stop()
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i, ok := s.next()
+				if !ok {
+					return
+				}
+				job := jobs[i]
+				jr := r.runnerOf(job)
+				res := jr.runJob(ctx, job)
+				jr.event(Event{Type: EventProcedureFinished, File: job.Doc.File, Procedure: job.Procedure, Variant: job.Variant, Result: &res})
+				s.finish(i, &res, emit)
+			}
+		}()
+	}
+	wg.Wait()
+	s.flush(emit)
+}
+
+// runnerOf returns the runner that runs job: its own, or r.
+func (r *Runner) runnerOf(job Job) *Runner {
+	if job.Runner != nil {
+		return job.Runner
+	}
+	return r
+}
+
+// runJob runs job, or reports it as skipped when it has a SkipReason,
+// and adds what the job knows about its owner and tags to the result.
+func (r *Runner) runJob(ctx context.Context, job Job) ProcedureResult {
+	var res ProcedureResult
+	if job.SkipReason != "" {
+		res = ProcedureResult{File: job.Doc.File, Procedure: job.Procedure, Variant: job.Variant, Tags: job.Doc.Tags, StartedAt: time.Now(), Steps: []StepResult{}}
+		res.Skipped, res.SkipReason = true, job.SkipReason
+	} else {
+		res = r.RunProcedure(ctx, job.Doc, job.Procedure, job.Variant)
+	}
+	res.Owner = cmp.Or(job.Owner, res.Owner)
+	for _, tag := range job.Tags {
+		if !slices.Contains(res.Tags, tag) {
+			res.Tags = append(slices.Clip(res.Tags), tag)
+		}
+	}
+	return res
+}
+
+// scheduler hands jobs to workers within the resource limits.
+type scheduler struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	limits    map[string]int
+	inUse     map[string]int
+	needs     [][]string
+	pending   []int
+	cancelled bool
+	// results holds finished jobs until the ones before them have been
+	// emitted; emitted is how many have been.
+	results []*ProcedureResult
+	emitted int
+}
+
+// next waits for the first pending job whose resources are free and
+// claims them. It returns false when there is nothing left to start.
+func (s *scheduler) next() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if s.cancelled || len(s.pending) == 0 {
+			return 0, false
+		}
+		for p, i := range s.pending {
+			if s.available(s.needs[i]) {
+				s.pending = append(s.pending[:p], s.pending[p+1:]...)
+				for _, res := range s.needs[i] {
+					s.inUse[res]++
+				}
+				return i, true
+			}
+		}
+		s.cond.Wait()
+	}
+}
+
+func (s *scheduler) available(needs []string) bool {
+	for _, res := range needs {
+		if limit := s.limit(res); limit > 0 && s.inUse[res] >= limit {
+			return false
+		}
+	}
+	return true
+}
+
+// limit returns how many jobs may use a resource at once; 0 is no limit.
+// Test databases and collections are exclusive.
+func (s *scheduler) limit(res string) int {
+	if isExclusive(res) {
+		return 1
+	}
+	return s.limits[res]
+}
+
+// finish releases a job's resources and emits every result that is now
+// next in order.
+func (s *scheduler) finish(i int, res *ProcedureResult, emit func(ProcedureResult)) {
+	s.mu.Lock()
+	for _, r := range s.needs[i] {
+		s.inUse[r]--
+	}
+	s.results[i] = res
+	for s.emitted < len(s.results) && s.results[s.emitted] != nil {
+		emit(*s.results[s.emitted])
+		s.emitted++
+	}
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// flush emits the results still held back by jobs that never ran.
+func (s *scheduler) flush(emit func(ProcedureResult)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ; s.emitted < len(s.results); s.emitted++ {
+		if res := s.results[s.emitted]; res != nil {
+			emit(*res)
+		}
+	}
+}
+
+// resourcesOf returns the resources a job needs, sorted.
+func (r *Runner) resourcesOf(job Job) []string {
+	if job.SkipReason != "" {
+		return nil
+	}
+	sel := ast.Selection{}
+	if job.Variant != nil {
+		sel = job.Variant.Selection
+	}
+	set := map[string]bool{}
+	walkProcedure(job.Procedure, sel, func(a ast.Action, _ string) {
+		for _, res := range actionResources(a, r.Options.DatabasePattern, r.Options.CollectionPattern) {
+			set[res] = true
+		}
+	})
+	needs := make([]string, 0, len(set))
+	for res := range set {
+		needs = append(needs, res)
+	}
+	sort.Strings(needs)
+	return needs
+}
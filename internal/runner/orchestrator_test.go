@@ -0,0 +1,355 @@
+package runner
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/cleanup"
+	"github.com/dacharyc/spike-procedural-testing/internal/executor"
+)
+
+// testScheduler returns a scheduler for jobs that need the given
+// resources, set up the way Run sets it up.
+func testScheduler(needs [][]string, limits map[string]int) *scheduler {
+	s := &scheduler{
+		limits:  limits,
+		inUse:   map[string]int{},
+		needs:   needs,
+		results: make([]*ProcedureResult, len(needs)),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	for i := range needs {
+		s.pending = append(s.pending, i)
+	}
+	return s
+}
+
+func TestSchedulerLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		needs   [][]string
+		limits  map[string]int
+		workers int
+		// want is the most jobs that may use each resource at once.
+		want map[string]int
+	}{
+		{
+			name:    "no limits",
+			needs:   [][]string{{"local"}, {"local"}, {"local"}, {"local"}},
+			workers: 4,
+			want:    map[string]int{"local": 4},
+		},
+		{
+			name:    "class limit",
+			needs:   [][]string{{"atlas"}, {"atlas"}, {"atlas"}, {"atlas"}, {"local"}},
+			limits:  map[string]int{"atlas": 2},
+			workers: 4,
+			want:    map[string]int{"atlas": 2, "local": 1},
+		},
+		{
+			name:    "test databases are exclusive",
+			needs:   [][]string{{"database:proctest_a"}, {"database:proctest_a"}, {"database:proctest_b"}, {"database:proctest_a"}},
+			workers: 4,
+			want:    map[string]int{"database:proctest_a": 1, "database:proctest_b": 1},
+		},
+		{
+			name:    "test collections are exclusive whatever the limits",
+			needs:   [][]string{{"collection:proctest_c", "mongodb"}, {"collection:proctest_c", "mongodb"}},
+			limits:  map[string]int{"collection:proctest_c": 5},
+			workers: 2,
+			want:    map[string]int{"collection:proctest_c": 1, "mongodb": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testScheduler(tt.needs, tt.limits)
+			var mu sync.Mutex
+			running, most := map[string]int{}, map[string]int{}
+			var emitted []int
+			var wg sync.WaitGroup
+			for range tt.workers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						i, ok := s.next()
+						if !ok {
+							return
+						}
+						mu.Lock()
+						for _, res := range tt.needs[i] {
+							running[res]++
+							most[res] = max(most[res], running[res])
+						}
+						mu.Unlock()
+						time.Sleep(5 * time.Millisecond)
+						mu.Lock()
+						for _, res := range tt.needs[i] {
+							running[res]--
+						}
+						mu.Unlock()
+						s.finish(i, &ProcedureResult{File: "job", Duration: time.Duration(i)}, func(r ProcedureResult) {
+							emitted = append(emitted, int(r.Duration))
+						})
+					}
+				}()
+			}
+			wg.Wait()
+			for res, limit := range tt.want {
+				if most[res] > limit {
+					t.Errorf("%d jobs used %s at once, want at most %d", most[res], res, limit)
+				}
+			}
+			if want := []int{0, 1, 2, 3, 4}[:len(tt.needs)]; !slices.Equal(emitted, want) {
+				t.Errorf("emitted jobs %v, want %v", emitted, want)
+			}
+		})
+	}
+}
+
+func TestSchedulerSkipsWaitingJobs(t *testing.T) {
+	s := testScheduler([][]string{{"database:proctest_a"}, {"database:proctest_a"}, {"local"}}, nil)
+	var started []int
+	for range 2 {
+		i, ok := s.next()
+		if !ok {
+			t.Fatal("next returned false with jobs pending")
+		}
+		started = append(started, i)
+	}
+	if want := []int{0, 2}; !slices.Equal(started, want) {
+		t.Errorf("started %v, want %v: a job waiting for a database holds up the jobs behind it", started, want)
+	}
+	s.finish(0, &ProcedureResult{}, func(ProcedureResult) {})
+	if i, ok := s.next(); !ok || i != 1 {
+		t.Errorf("next() = %d, %v after the database was released, want 1, true", i, ok)
+	}
+}
+
+func TestSchedulerEmitsInOrder(t *testing.T) {
+	s := testScheduler(make([][]string, 4), nil)
+	var emitted []string
+	emit := func(r ProcedureResult) { emitted = append(emitted, r.File) }
+	for _, step := range []struct {
+		finish int
+		want   []string
+	}{
+		{2, nil},
+		{1, nil},
+		{0, []string{"0", "1", "2"}},
+	} {
+		s.finish(step.finish, &ProcedureResult{File: string(rune('0' + step.finish))}, emit)
+		if !slices.Equal(emitted, step.want) {
+			t.Fatalf("after job %d finished, emitted %v, want %v", step.finish, emitted, step.want)
+		}
+	}
+	// Job 3 never ran, as when the run is interrupted.
+	s.flush(emit)
+	if want := []string{"0", "1", "2"}; !slices.Equal(emitted, want) {
+		t.Errorf("after flush, emitted %v, want %v", emitted, want)
+	}
+}
+
+func TestSchedulerCancelled(t *testing.T) {
+	s := testScheduler([][]string{{"database:proctest_a"}, {"database:proctest_a"}}, nil)
+	if _, ok := s.next(); !ok {
+		t.Fatal("next returned false with jobs pending")
+	}
+	done := make(chan bool)
+	go func() {
+		_, ok := s.next()
+		done <- ok
+	}()
+	s.mu.Lock()
+	s.cancelled = true
+	s.mu.Unlock()
+	s.cond.Broadcast()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("next started a job after the run was cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("next kept waiting after the run was cancelled")
+	}
+}
+
+func TestRunSkippedJobs(t *testing.T) {
+	doc := &ast.Document{File: "page.txt"}
+	var jobs []Job
+	for _, title := range []string{"a", "b", "c", "d", "e"} {
+		jobs = append(jobs, Job{Doc: doc, Procedure: &ast.Procedure{ID: title, Title: title}, SkipReason: "skipped for now"})
+	}
+	r := New(Options{Jobs: 3})
+	var got []string
+	r.Run(context.Background(), jobs, func(res ProcedureResult) {
+		if !res.Skipped || res.SkipReason != "skipped for now" {
+			t.Errorf("%s: Skipped = %v, SkipReason = %q", res.Procedure.ID, res.Skipped, res.SkipReason)
+		}
+		got = append(got, res.Procedure.ID)
+	})
+	if want := []string{"a", "b", "c", "d", "e"}; !slices.Equal(got, want) {
+		t.Errorf("emitted %v, want %v", got, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got = nil
+	r.Run(ctx, jobs, func(res ProcedureResult) { got = append(got, res.Procedure.ID) })
+	if len(got) != 0 {
+		t.Errorf("a cancelled run emitted %v", got)
+	}
+}
+
+func TestActionResources(t *testing.T) {
+	tests := []struct {
+		name   string
+		action ast.Action
+		want   []string
+	}{
+		{
+			name:   "shell command",
+			action: &ast.ShellAction{Command: "ls -la"},
+			want:   []string{ResourceLocal},
+		},
+		{
+			name:   "mongosh session on a test database",
+			action: &ast.CLIAction{Tool: ast.ToolMongosh, Command: "use proctest_movies\ndb.reviews.find()"},
+			want:   []string{ResourceLocal, ResourceMongoDB, "database:proctest_movies"},
+		},
+		{
+			name:   "sample data is not exclusive",
+			action: &ast.CLIAction{Tool: ast.ToolMongosh, Command: "use sample_mflix"},
+			want:   []string{ResourceLocal, ResourceMongoDB},
+		},
+		{
+			name:   "test collection",
+			action: &ast.CodeAction{Language: "javascript", Code: `client.db("sample").collection("proctest_items")`},
+			want:   []string{ResourceLocal, "collection:proctest_items"},
+		},
+		{
+			name:   "cluster creation through the Admin API",
+			action: &ast.APIAction{Method: "POST", Endpoint: "/api/atlas/v2/groups/{groupId}/clusters"},
+			want:   []string{ResourceAtlas, ResourceAtlasCluster},
+		},
+		{
+			name:   "cluster creation through the Atlas CLI",
+			action: &ast.CLIAction{Tool: ast.ToolAtlasCLI, Command: "atlas clusters create myCluster --tier M10"},
+			want:   []string{ResourceLocal, ResourceAtlas, ResourceAtlasCluster},
+		},
+		{
+			name:   "download",
+			action: &ast.DownloadAction{URL: "https://example.com/data.json"},
+			want:   []string{ResourceNetwork},
+		},
+		{
+			name:   "wait that polls a command",
+			action: &ast.WaitAction{Condition: ast.WaitExitCode, Poll: &ast.ShellAction{Command: "curl -sf localhost:8080"}},
+			want:   []string{ResourceLocal},
+		},
+	}
+	pattern := cleanup.DefaultPattern
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Order and repeats do not matter: resourcesOf collects the
+			// resources of every action into a sorted set.
+			got := slices.Compact(slices.Sorted(slices.Values(actionResources(tt.action, pattern, pattern))))
+			want := slices.Sorted(slices.Values(tt.want))
+			if !slices.Equal(got, want) {
+				t.Errorf("actionResources() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestResourcesOf(t *testing.T) {
+	r := New(Options{DatabasePattern: regexp.MustCompile(`^test_`)})
+	proc := &ast.Procedure{Steps: []*ast.Step{
+		{Actions: []ast.Action{&ast.CLIAction{Tool: ast.ToolMongosh, Command: "use test_db"}}},
+		{Actions: []ast.Action{&ast.ShellAction{Command: "echo done"}}},
+	}}
+	got := r.resourcesOf(Job{Procedure: proc})
+	if want := []string{"database:test_db", ResourceLocal, ResourceMongoDB}; !slices.Equal(got, want) {
+		t.Errorf("resourcesOf() = %v, want %v", got, want)
+	}
+	if got := r.resourcesOf(Job{Procedure: proc, SkipReason: "skipped"}); len(got) != 0 {
+		t.Errorf("resourcesOf() of a skipped job = %v, want none", got)
+	}
+}
+
+// counting is an executor that counts its calls and how many of them, with
+// those of the executors it shares running with, run at once.
+type counting struct {
+	calls   int
+	running *int
+	most    *int
+	mu      *sync.Mutex
+}
+
+func (c *counting) CanExecute(ast.Action) bool { return true }
+
+func (c *counting) Execute(context.Context, ast.Action, *executor.Context) executor.Result {
+	c.mu.Lock()
+	c.calls++
+	*c.running++
+	*c.most = max(*c.most, *c.running)
+	c.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	c.mu.Lock()
+	*c.running--
+	c.mu.Unlock()
+	return executor.Result{Success: true}
+}
+
+func TestRunJobsOnTheirOwnRunners(t *testing.T) {
+	var mu sync.Mutex
+	var running, most int
+	runners := make([]*Runner, 2)
+	execs := make([]*counting, 2)
+	for i := range runners {
+		execs[i] = &counting{running: &running, most: &most, mu: &mu}
+		runners[i] = New(Options{RunsDir: t.TempDir(), KeepArtifacts: KeepNever})
+		runners[i].Executors = executor.NewRegistry(execs[i])
+	}
+	doc := &ast.Document{File: "page.txt"}
+	var jobs []Job
+	for i := range 6 {
+		proc := &ast.Procedure{ID: string(rune('a' + i)), Steps: []*ast.Step{{Number: 1, Actions: []ast.Action{shell("echo hi")}}}}
+		jobs = append(jobs, Job{Doc: doc, Procedure: proc, Runner: runners[i%2]})
+	}
+	tests := []struct {
+		name     string
+		opts     Options
+		wantMost int
+	}{
+		{"one worker for both", Options{Jobs: 1}, 1},
+		{"a class limit for both", Options{Jobs: 6, Limits: map[string]int{ResourceLocal: 2}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			running, most = 0, 0
+			execs[0].calls, execs[1].calls = 0, 0
+			var got []string
+			New(tt.opts).Run(context.Background(), jobs, func(res ProcedureResult) {
+				if !res.Success {
+					t.Errorf("%s failed: %v", res.Procedure.ID, res.Error)
+				}
+				got = append(got, res.Procedure.ID)
+			})
+			if want := []string{"a", "b", "c", "d", "e", "f"}; !slices.Equal(got, want) {
+				t.Errorf("emitted %v, want %v", got, want)
+			}
+			if execs[0].calls != 3 || execs[1].calls != 3 {
+				t.Errorf("the runners ran %d and %d jobs, want 3 each", execs[0].calls, execs[1].calls)
+			}
+			if most > tt.wantMost {
+				t.Errorf("%d jobs ran at once, want at most %d", most, tt.wantMost)
+			}
+		})
+	}
+}
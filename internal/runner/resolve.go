@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"maps"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/resolver"
+)
+
+// resolveAction returns a copy of a with its placeholders filled in, the
+// substitutions made, and the placeholders that could not be resolved.
+// The parsed action is never modified, so every variant starts from the
+// documented text.
+func resolveAction(a ast.Action, res *resolver.Resolver) (ast.Action, []resolver.Substitution, []string) {
+	var subs []resolver.Substitution
+	var unresolved []string
+	apply := func(text string, phs []string) string {
+		out, s, u := res.Apply(text, phs)
+		subs = append(subs, s...)
+		unresolved = append(unresolved, u...)
+		return out
+	}
+	// Every field of an action shares the action's placeholder list, but
+	// a placeholder must only be reported once.
+	applyQuiet := func(text string, phs []string) string {
+		out, _, _ := res.Apply(text, phs)
+		return out
+	}
+
+	switch act := a.(type) {
+	case *ast.CodeAction:
+		cp := *act
+		cp.Code = apply(act.Code, act.Placeholders)
+		return &cp, subs, unresolved
+	case *ast.ShellAction:
+		cp := *act
+		cp.Command = apply(act.Command, act.Placeholders)
+		return &cp, subs, unresolved
+	case *ast.CLIAction:
+		cp := *act
+		cp.Command = apply(act.Command, act.Placeholders)
+		return &cp, subs, unresolved
+	case *ast.APIAction:
+		cp := *act
+		cp.Endpoint = apply(act.Endpoint, act.Placeholders)
+		cp.Body = applyQuiet(act.Body, act.Placeholders)
+		cp.Command = applyQuiet(act.Command, act.Placeholders)
+		cp.Headers = maps.Clone(act.Headers)
+		for k, v := range cp.Headers {
+			cp.Headers[k] = applyQuiet(v, act.Placeholders)
+		}
+		return &cp, subs, unresolved
+	case *ast.DownloadAction:
+		cp := *act
+		cp.URL = apply(act.URL, act.Placeholders)
+		cp.OutputPath = applyQuiet(act.OutputPath, act.Placeholders)
+		cp.Command = applyQuiet(act.Command, act.Placeholders)
+		cp.Headers = maps.Clone(act.Headers)
+		for k, v := range cp.Headers {
+			cp.Headers[k] = applyQuiet(v, act.Placeholders)
+		}
+		return &cp, subs, unresolved
+	case *ast.FileAction:
+		cp := *act
+		cp.Content = apply(act.Content, act.Placeholders)
+		return &cp, subs, unresolved
+	}
+	return a, nil, nil
+}
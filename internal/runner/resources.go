@@ -0,0 +1,192 @@
+package runner
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/cleanup"
+)
+
+var (
+	// nameRE matches anything that could be a database or collection
+	// name; the configured patterns decide which ones are test data.
+	nameRE = regexp.MustCompile(`[A-Za-z_][\w-]*`)
+
+	// databaseContextRE matches the ways examples name a database rather
+	// than a collection: "use db", getSiblingDB("db"), client.db("db"),
+	// GetDatabase("db"), client["db"], --db db, and the path of a
+	// connection string.
+	databaseContextRE = regexp.MustCompile(`(?:\buse\s+|getSiblingDB\(\s*["']|\.db\(\s*["']|\.[Dd]atabase\(\s*["']|GetDatabase\(\s*"|client\[\s*["']|--db(?:=|\s+)|--database(?:=|\s+)|"?database"?\s*[:=]\s*["']|mongodb(?:\+srv)?://[^/\s"']+/)([A-Za-z_][\w-]*)`)
+
+	// useRE finds the database a mongosh session switches to.
+	useRE = regexp.MustCompile(`(?m)^\s*use\s+([\w-]+)`)
+
+	// searchIndexRE matches a mongosh createSearchIndex call and captures
+	// the collection and the rest of the call. The collection is either
+	// db.coll or db.getCollection("coll").
+	searchIndexRE = regexp.MustCompile(`db\.(?:getCollection\(\s*["']([^"']+)["']\s*\)|([\w-]+))\.createSearchIndex\(([^;]*)`)
+
+	// indexNameRE finds the index name in the arguments of
+	// createSearchIndex: either a leading string or a name field.
+	indexNameRE = regexp.MustCompile(`^\s*["']([^"']+)["']|\bname\s*:\s*["']([^"']+)["']`)
+)
+
+// Resource classes a procedure variant can need. Options.Limits caps how
+// many variants that need a class run at once.
+const (
+	// ResourceLocal is processes on this machine: shell commands, code
+	// examples and CLI sessions.
+	ResourceLocal = "local"
+	// ResourceNetwork is downloads and link checks.
+	ResourceNetwork = "network"
+	// ResourceMongoDB is the deployment in MONGODB_URI.
+	ResourceMongoDB = "mongodb"
+	// ResourceAtlas is the Atlas Administration API and the Atlas CLI.
+	ResourceAtlas = "atlas"
+	// ResourceAtlasCluster is a new Atlas cluster or deployment, which
+	// is slow to create and counts against the project's limits.
+	ResourceAtlasCluster = "atlas-cluster"
+)
+
+// ResourceClasses lists the classes Options.Limits accepts.
+var ResourceClasses = []string{ResourceLocal, ResourceNetwork, ResourceMongoDB, ResourceAtlas, ResourceAtlasCluster}
+
+// Exclusive resources are the test databases and collections a variant
+// uses. Two variants that use the same one never run at once, since one
+// would drop the other's data.
+const (
+	exclusiveDatabase   = "database:"
+	exclusiveCollection = "collection:"
+)
+
+func isExclusive(res string) bool {
+	return strings.HasPrefix(res, exclusiveDatabase) || strings.HasPrefix(res, exclusiveCollection)
+}
+
+var (
+	// createClusterCLIRE matches Atlas CLI commands that create a cluster
+	// or deployment.
+	createClusterCLIRE = regexp.MustCompile(`\batlas\s+(?:clusters\s+create|deployments\s+setup|setup|quickstart)\b`)
+	// clustersEndpointRE matches the Admin API endpoint that creates a
+	// cluster when it receives a POST.
+	clustersEndpointRE = regexp.MustCompile(`/(?:clusters|flexClusters)/?(?:\?|$)`)
+	// connectsRE matches code and commands that connect to MongoDB.
+	connectsRE = regexp.MustCompile(`mongodb(?:\+srv)?://|MONGODB_URI|<connection-string>|\{\+connection-string\+\}|\bmongosh\b`)
+)
+
+// actionResources returns the resource classes an action needs and the
+// test databases and collections it uses.
+func actionResources(a ast.Action, dbPattern, collPattern *regexp.Regexp) []string {
+	var out []string
+	switch act := a.(type) {
+	case *ast.ShellAction, *ast.CodeAction:
+		out = append(out, ResourceLocal)
+	case *ast.CLIAction:
+		out = append(out, ResourceLocal)
+		if act.Tool == ast.ToolMongosh {
+			out = append(out, ResourceMongoDB)
+		} else {
+			out = append(out, ResourceAtlas)
+		}
+	case *ast.APIAction:
+		out = append(out, ResourceAtlas)
+		if act.Method == "POST" && clustersEndpointRE.MatchString(act.Endpoint) {
+			out = append(out, ResourceAtlasCluster)
+		}
+	case *ast.DownloadAction, *ast.URLAction:
+		out = append(out, ResourceNetwork)
+	case *ast.WaitAction:
+		if act.Poll != nil {
+			return actionResources(act.Poll, dbPattern, collPattern)
+		}
+		if act.Condition == ast.WaitHTTPStatus {
+			out = append(out, ResourceNetwork)
+		}
+	}
+	text := actionText(a)
+	if createClusterCLIRE.MatchString(text) {
+		out = append(out, ResourceAtlas, ResourceAtlasCluster)
+	}
+	if connectsRE.MatchString(text) {
+		out = append(out, ResourceMongoDB)
+	}
+	databases := map[string]bool{}
+	for _, match := range databaseContextRE.FindAllStringSubmatch(text, -1) {
+		if dbPattern.MatchString(match[1]) {
+			databases[match[1]] = true
+			out = append(out, exclusiveDatabase+match[1])
+		}
+	}
+	for _, name := range nameRE.FindAllString(text, -1) {
+		if !databases[name] && collPattern.MatchString(name) {
+			out = append(out, exclusiveCollection+name)
+		}
+	}
+	return out
+}
+
+// registerResources registers cleanup for the test databases and
+// collections an action refers to. Only names that match the patterns
+// are registered, so an example that reads sample_mflix never drops it.
+func registerResources(reg *cleanup.Registry, m *cleanup.Mongo, a ast.Action, dbPattern, collPattern *regexp.Regexp) {
+	text := actionText(a)
+	if text == "" {
+		return
+	}
+	databases := map[string]bool{}
+	for _, match := range databaseContextRE.FindAllStringSubmatch(text, -1) {
+		if dbPattern.MatchString(match[1]) {
+			databases[match[1]] = true
+			reg.Database(m, match[1])
+		}
+	}
+	for _, name := range nameRE.FindAllString(text, -1) {
+		if !databases[name] && collPattern.MatchString(name) {
+			reg.Collection(m, "", name)
+		}
+	}
+}
+
+// registerSearchIndexes registers cleanup for the search indexes a
+// mongosh action created. It runs after the action succeeds, so that an
+// index that already existed, and made the create fail, is left alone.
+func registerSearchIndexes(reg *cleanup.Registry, m *cleanup.Mongo, a ast.Action) {
+	act, ok := a.(*ast.CLIAction)
+	if !ok || act.Tool != ast.ToolMongosh {
+		return
+	}
+	db := "test"
+	if match := useRE.FindStringSubmatch(act.Command); match != nil {
+		db = match[1]
+	}
+	for _, match := range searchIndexRE.FindAllStringSubmatch(act.Command, -1) {
+		coll := match[1]
+		if coll == "" {
+			coll = match[2]
+		}
+		// createSearchIndex without a name creates the index "default".
+		name := "default"
+		if n := indexNameRE.FindStringSubmatch(match[3]); n != nil {
+			name = n[1] + n[2]
+		}
+		reg.SearchIndex(m, db, coll, name)
+	}
+}
+
+// actionText returns the text of an action that can name resources.
+func actionText(a ast.Action) string {
+	switch act := a.(type) {
+	case *ast.CodeAction:
+		return act.Code
+	case *ast.ShellAction:
+		return act.Command
+	case *ast.CLIAction:
+		return act.Command
+	case *ast.APIAction:
+		return strings.Join([]string{act.Endpoint, act.Body, act.Command}, "\n")
+	case *ast.FileAction:
+		return act.Content
+	}
+	return ""
+}
@@ -0,0 +1,250 @@
+package runner
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/cleanup"
+	"github.com/dacharyc/spike-procedural-testing/internal/executor"
+	"github.com/dacharyc/spike-procedural-testing/internal/prereq"
+	"github.com/dacharyc/spike-procedural-testing/internal/resolver"
+)
+
+// Status is the outcome of a procedure, step or action.
+type Status string
+
+const (
+	StatusPassed  Status = "passed"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+)
+
+// Error types, following the specification's TestError.
+const (
+	ErrorResolve = "resolve"
+	ErrorExecute = "execute"
+	ErrorCleanup = "cleanup"
+	// ErrorReplay is a cassette that is missing, stale or cannot be
+	// written.
+	ErrorReplay = "replay"
+)
+
+// TestError describes why a procedure failed.
+type TestError struct {
+	Type        string             `json:"type" yaml:"type"`
+	Message     string             `json:"message" yaml:"message"`
+	Location    ast.SourceLocation `json:"location" yaml:"location"`
+	Context     ErrorContext       `json:"context" yaml:"context"`
+	Suggestions []string           `json:"suggestions,omitempty" yaml:"suggestions,omitempty"`
+}
+
+// ErrorContext locates an error within a procedure.
+type ErrorContext struct {
+	ProcedureTitle string `json:"procedureTitle" yaml:"procedureTitle"`
+	StepNumber     int    `json:"stepNumber,omitempty" yaml:"stepNumber,omitempty"`
+	StepTitle      string `json:"stepTitle,omitempty" yaml:"stepTitle,omitempty"`
+	SubStepNumber  string `json:"subStepNumber,omitempty" yaml:"subStepNumber,omitempty"`
+}
+
+// Step returns the step number as the docs show it: "2", or "2.b" in a
+// sub-step.
+func (c ErrorContext) Step() string {
+	step := strconv.Itoa(c.StepNumber)
+	if c.SubStepNumber != "" {
+		step += "." + c.SubStepNumber
+	}
+	return step
+}
+
+// ActionResult is the outcome of one testable action.
+type ActionResult struct {
+	Action    ast.Action      `json:"action" yaml:"action"`
+	Execution executor.Result `json:"execution" yaml:"execution"`
+	// Substitutions lists the placeholders that were filled in. Values
+	// are not kept.
+	Substitutions []resolver.Substitution `json:"substitutions,omitempty" yaml:"substitutions,omitempty"`
+	// Replayed is set when the execution came from a cassette.
+	Replayed bool `json:"replayed,omitempty" yaml:"replayed,omitempty"`
+	// Attempts is how many times the action ran, when a retry policy
+	// applied to it. Execution is the last attempt.
+	Attempts int `json:"attempts,omitempty" yaml:"attempts,omitempty"`
+	// Polls lists the checks of a wait action, in order.
+	Polls []Poll     `json:"polls,omitempty" yaml:"polls,omitempty"`
+	Error *TestError `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Flaky reports whether the action passed only after a retry.
+func (r ActionResult) Flaky() bool {
+	return r.Attempts > 1 && r.Status() == StatusPassed
+}
+
+// Status returns the action's status.
+func (r ActionResult) Status() Status {
+	switch {
+	case r.Error != nil || !r.Execution.Success:
+		return StatusFailed
+	case r.Execution.Skipped:
+		return StatusSkipped
+	}
+	return StatusPassed
+}
+
+// SubStepResult is the outcome of a lettered sub-step.
+type SubStepResult struct {
+	SubStep  *ast.SubStep   `json:"subStep" yaml:"subStep"`
+	Success  bool           `json:"success" yaml:"success"`
+	Duration time.Duration  `json:"duration" yaml:"duration"`
+	Actions  []ActionResult `json:"actionResults" yaml:"actionResults"`
+	Error    *TestError     `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// StepResult is the outcome of a step and its sub-steps.
+type StepResult struct {
+	Step     *ast.Step       `json:"step" yaml:"step"`
+	Success  bool            `json:"success" yaml:"success"`
+	Duration time.Duration   `json:"duration" yaml:"duration"`
+	Actions  []ActionResult  `json:"actionResults" yaml:"actionResults"`
+	SubSteps []SubStepResult `json:"subSteps,omitempty" yaml:"subSteps,omitempty"`
+	// Flaky is set when the step passed only because an action in it
+	// was retried.
+	Flaky bool       `json:"flaky,omitempty" yaml:"flaky,omitempty"`
+	Error *TestError `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ProcedureResult is the outcome of one test case: a procedure, or one
+// variant of it.
+type ProcedureResult struct {
+	File      string         `json:"file" yaml:"file"`
+	Procedure *ast.Procedure `json:"procedure" yaml:"procedure"`
+	Variant   *ast.Variant   `json:"variant,omitempty" yaml:"variant,omitempty"`
+	// Owner is the team responsible for the procedure, when it is known.
+	Owner string `json:"owner,omitempty" yaml:"owner,omitempty"`
+	// Tags categorize the procedure; they start with the page's tags.
+	Tags    []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Success bool     `json:"success" yaml:"success"`
+	// Skipped is set when required prerequisites were not met. A skipped
+	// procedure is neither passed nor failed.
+	Skipped            bool            `json:"skipped" yaml:"skipped"`
+	SkipReason         string          `json:"skipReason,omitempty" yaml:"skipReason,omitempty"`
+	PrerequisiteChecks []prereq.Result `json:"prerequisiteChecks,omitempty" yaml:"prerequisiteChecks,omitempty"`
+	// PrerequisitesIgnored is set when unmet prerequisites were overridden
+	// and the procedure ran anyway.
+	PrerequisitesIgnored bool      `json:"prerequisitesIgnored,omitempty" yaml:"prerequisitesIgnored,omitempty"`
+	StartedAt            time.Time `json:"startedAt" yaml:"startedAt"`
+	// WorkingDirectory is the directory the procedure's files were
+	// written to.
+	WorkingDirectory string `json:"workingDirectory,omitempty" yaml:"workingDirectory,omitempty"`
+	// Cassette is the cassette the run recorded to or replayed from.
+	Cassette string `json:"cassette,omitempty" yaml:"cassette,omitempty"`
+	// Artifacts is the sandbox kept for debugging, when it was kept.
+	Artifacts string        `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
+	Duration  time.Duration `json:"duration" yaml:"duration"`
+	Steps     []StepResult  `json:"steps" yaml:"steps"`
+	// PlannedSteps is the number of steps the variant shows and the filter
+	// selects. Steps stops at the first failed step, so it can be shorter.
+	PlannedSteps int `json:"plannedSteps" yaml:"plannedSteps"`
+	// Flaky is set when the procedure passed with flaky steps. A flaky
+	// procedure is still a passed one.
+	Flaky bool       `json:"flaky,omitempty" yaml:"flaky,omitempty"`
+	Error *TestError `json:"error,omitempty" yaml:"error,omitempty"`
+	// Cleanup lists what was removed after the procedure, newest first.
+	// A failed cleanup is reported but does not fail the procedure.
+	Cleanup []cleanup.Result `json:"cleanup,omitempty" yaml:"cleanup,omitempty"`
+}
+
+// ID identifies the test case: the procedure ID, and "@" and the variant
+// ID for a variant.
+func (r *ProcedureResult) ID() string {
+	if r.Variant != nil && r.Variant.ID != "" {
+		return r.Procedure.ID + "@" + r.Variant.ID
+	}
+	return r.Procedure.ID
+}
+
+// Name is the test case name: the procedure title with the variant label.
+func (r *ProcedureResult) Name() string {
+	if r.Variant != nil && r.Variant.Label != "" {
+		return r.Procedure.Title + " (" + r.Variant.Label + ")"
+	}
+	return r.Procedure.Title
+}
+
+// FailedAction returns the action whose error failed the procedure, or
+// nil when no action did.
+func (r *ProcedureResult) FailedAction() *ActionResult {
+	for i := range r.Steps {
+		s := &r.Steps[i]
+		for j := range s.Actions {
+			if s.Actions[j].Error != nil {
+				return &s.Actions[j]
+			}
+		}
+		for k := range s.SubSteps {
+			for j := range s.SubSteps[k].Actions {
+				if s.SubSteps[k].Actions[j].Error != nil {
+					return &s.SubSteps[k].Actions[j]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Status returns the procedure's status.
+func (r *ProcedureResult) Status() Status {
+	switch {
+	case r.Skipped:
+		return StatusSkipped
+	case r.Success:
+		return StatusPassed
+	}
+	return StatusFailed
+}
+
+// Summary totals a run.
+type Summary struct {
+	TotalProcedures   int               `json:"totalProcedures" yaml:"totalProcedures"`
+	PassedProcedures  int               `json:"passedProcedures" yaml:"passedProcedures"`
+	FailedProcedures  int               `json:"failedProcedures" yaml:"failedProcedures"`
+	SkippedProcedures int               `json:"skippedProcedures" yaml:"skippedProcedures"`
+	TotalSteps        int               `json:"totalSteps" yaml:"totalSteps"`
+	PassedSteps       int               `json:"passedSteps" yaml:"passedSteps"`
+	FailedSteps       int               `json:"failedSteps" yaml:"failedSteps"`
+	FlakyProcedures   int               `json:"flakyProcedures" yaml:"flakyProcedures"`
+	FlakySteps        int               `json:"flakySteps" yaml:"flakySteps"`
+	TotalDuration     time.Duration     `json:"totalDuration" yaml:"totalDuration"`
+	Results           []ProcedureResult `json:"results" yaml:"results"`
+}
+
+// Summarize totals results.
+func Summarize(results []ProcedureResult) Summary {
+	s := Summary{Results: results}
+	for _, r := range results {
+		s.TotalProcedures++
+		switch r.Status() {
+		case StatusPassed:
+			s.PassedProcedures++
+			if r.Flaky {
+				s.FlakyProcedures++
+			}
+		case StatusFailed:
+			s.FailedProcedures++
+		case StatusSkipped:
+			s.SkippedProcedures++
+		}
+		for _, st := range r.Steps {
+			s.TotalSteps++
+			if st.Success {
+				s.PassedSteps++
+				if st.Flaky {
+					s.FlakySteps++
+				}
+			} else {
+				s.FailedSteps++
+			}
+		}
+		s.TotalDuration += r.Duration
+	}
+	return s
+}
@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/executor"
+)
+
+// RetryPolicy retries failing actions. Some steps are only eventually
+// consistent: a search index stays PENDING for a while after it is
+// created, and listing it right away can fail. Retrying such an action
+// tells a step that needs time apart from one that is broken; the result
+// records that it passed only after a retry.
+type RetryPolicy struct {
+	// Types are the action types the policy applies to. Empty applies it
+	// to every type except file and ui actions, which do not change on a
+	// second try, and waits, which poll already.
+	Types []ast.ActionType
+	// On are patterns matched against the failure's output and error
+	// message. Empty retries any failure.
+	On []*regexp.Regexp
+	// Attempts is the total number of tries, including the first.
+	Attempts int
+	// Backoff is the wait before the first retry. It doubles with each
+	// retry, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicies wait out the eventual consistency the docs
+// describe, such as search indexes that are PENDING or BUILDING before
+// they are READY.
+var DefaultRetryPolicies = []RetryPolicy{{
+	Types:      []ast.ActionType{ast.ActionCLI, ast.ActionCode, ast.ActionAPI, ast.ActionShell},
+	On:         []*regexp.Regexp{regexp.MustCompile(`(?i)\b(?:PENDING|BUILDING|IndexNotFound|index not found|not (?:yet )?ready|NamespaceNotFound)\b`)},
+	Attempts:   5,
+	Backoff:    5 * time.Second,
+	MaxBackoff: 30 * time.Second,
+}}
+
+// matches reports whether the policy applies to a failure of a.
+func (p *RetryPolicy) matches(a ast.Action, res executor.Result) bool {
+	if res.Skipped || res.Success {
+		return false
+	}
+	if len(p.Types) == 0 {
+		switch a.Kind() {
+		case ast.ActionFile, ast.ActionUI, ast.ActionWait:
+			return false
+		}
+	} else if !slices.Contains(p.Types, a.Kind()) {
+		return false
+	}
+	if len(p.On) == 0 {
+		return true
+	}
+	output := res.Stdout + "\n" + res.Stderr + "\n" + res.Error
+	for _, re := range p.On {
+		if re.MatchString(output) {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the wait before retry n, counting from 1.
+func (p *RetryPolicy) delay(n int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < n; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return d
+}
+
+// retryPolicy returns the first policy that applies to a failure of a.
+func (r *Runner) retryPolicy(a ast.Action, res executor.Result) *RetryPolicy {
+	for i := range r.Options.Retries {
+		if p := &r.Options.Retries[i]; p.matches(a, res) {
+			return p
+		}
+	}
+	return nil
+}
+
+// execute runs an action, retrying it as the retry policies say, and
+// returns the last execution with the number of attempts it took.
+func (r *Runner) execute(ctx context.Context, a ast.Action, ec *executor.Context) (executor.Result, int) {
+	res := r.Executors.Execute(ctx, a, ec)
+	attempts := 1
+	for {
+		p := r.retryPolicy(a, res)
+		if p == nil || attempts >= p.Attempts {
+			return res, attempts
+		}
+		select {
+		case <-ctx.Done():
+			return res, attempts
+		case <-time.After(p.delay(attempts)):
+		}
+		res = r.Executors.Execute(ctx, a, ec)
+		attempts++
+	}
+}
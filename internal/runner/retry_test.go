@@ -0,0 +1,135 @@
+package runner
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/executor"
+)
+
+// scripted is an executor that returns its results in turn, repeating
+// the last one, and counts the calls.
+type scripted struct {
+	results []executor.Result
+	calls   int
+}
+
+func (s *scripted) CanExecute(ast.Action) bool { return true }
+
+func (s *scripted) Execute(context.Context, ast.Action, *executor.Context) executor.Result {
+	res := s.results[min(s.calls, len(s.results)-1)]
+	s.calls++
+	return res
+}
+
+// scriptedRunner returns a runner whose actions all run on s.
+func scriptedRunner(s *scripted, opts Options) *Runner {
+	r := New(opts)
+	r.Executors = executor.NewRegistry(s)
+	return r
+}
+
+func shell(command string) *ast.ShellAction {
+	return &ast.ShellAction{ActionBase: ast.ActionBase{Type: ast.ActionShell}, Command: command}
+}
+
+func TestRetryPolicyMatches(t *testing.T) {
+	pending := regexp.MustCompile(`PENDING`)
+	failed := executor.Result{Stderr: "index is PENDING"}
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		action ast.Action
+		result executor.Result
+		want   bool
+	}{
+		{"any failure", RetryPolicy{}, shell("x"), executor.Result{Error: "exit 1"}, true},
+		{"success", RetryPolicy{}, shell("x"), executor.Result{Success: true}, false},
+		{"skipped", RetryPolicy{}, shell("x"), executor.Result{Skipped: true}, false},
+		{"pattern in stderr", RetryPolicy{On: []*regexp.Regexp{pending}}, shell("x"), failed, true},
+		{"pattern in stdout", RetryPolicy{On: []*regexp.Regexp{pending}}, shell("x"), executor.Result{Stdout: "PENDING"}, true},
+		{"pattern in error", RetryPolicy{On: []*regexp.Regexp{pending}}, shell("x"), executor.Result{Error: "still PENDING"}, true},
+		{"pattern not found", RetryPolicy{On: []*regexp.Regexp{pending}}, shell("x"), executor.Result{Stderr: "syntax error"}, false},
+		{"listed type", RetryPolicy{Types: []ast.ActionType{ast.ActionShell}}, shell("x"), failed, true},
+		{"unlisted type", RetryPolicy{Types: []ast.ActionType{ast.ActionAPI}}, shell("x"), failed, false},
+		{"file actions by default", RetryPolicy{}, &ast.FileAction{ActionBase: ast.ActionBase{Type: ast.ActionFile}}, failed, false},
+		{"waits by default", RetryPolicy{}, &ast.WaitAction{ActionBase: ast.ActionBase{Type: ast.ActionWait}}, failed, false},
+		{"ui actions by default", RetryPolicy{}, &ast.UIAction{ActionBase: ast.ActionBase{Type: ast.ActionUI}}, failed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.matches(tt.action, tt.result); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		policy RetryPolicy
+		n      int
+		want   time.Duration
+	}{
+		{RetryPolicy{Backoff: time.Second}, 1, time.Second},
+		{RetryPolicy{Backoff: time.Second}, 2, 2 * time.Second},
+		{RetryPolicy{Backoff: time.Second}, 4, 8 * time.Second},
+		{RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}, 3, 4 * time.Second},
+		{RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}, 4, 5 * time.Second},
+		{RetryPolicy{Backoff: 5 * time.Second, MaxBackoff: 30 * time.Second}, 10, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.delay(tt.n); got != tt.want {
+			t.Errorf("delay(%d) with backoff %s and max %s = %s, want %s", tt.n, tt.policy.Backoff, tt.policy.MaxBackoff, got, tt.want)
+		}
+	}
+}
+
+func TestExecuteRetries(t *testing.T) {
+	pending := executor.Result{Stdout: "status: PENDING", ExitCode: 1}
+	broken := executor.Result{Stderr: "syntax error", ExitCode: 2}
+	ok := executor.Result{Success: true}
+	policy := RetryPolicy{
+		On:       []*regexp.Regexp{regexp.MustCompile(`PENDING`)},
+		Attempts: 3,
+		Backoff:  time.Millisecond,
+	}
+	tests := []struct {
+		name         string
+		results      []executor.Result
+		wantSuccess  bool
+		wantAttempts int
+	}{
+		{"passes first time", []executor.Result{ok}, true, 1},
+		{"passes after a retry", []executor.Result{pending, ok}, true, 2},
+		{"gives up after the attempts", []executor.Result{pending}, false, 3},
+		{"does not retry other failures", []executor.Result{broken, ok}, false, 1},
+		{"stops when the failure changes", []executor.Result{pending, broken, ok}, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &scripted{results: tt.results}
+			r := scriptedRunner(s, Options{Retries: []RetryPolicy{policy}})
+			res, attempts := r.execute(context.Background(), shell("atlas search indexes list"), &executor.Context{})
+			if res.Success != tt.wantSuccess || attempts != tt.wantAttempts {
+				t.Errorf("execute() = success %v after %d attempts, want %v after %d", res.Success, attempts, tt.wantSuccess, tt.wantAttempts)
+			}
+			if s.calls != attempts {
+				t.Errorf("the action ran %d times for %d attempts", s.calls, attempts)
+			}
+		})
+	}
+}
+
+func TestExecuteStopsRetryingWhenCancelled(t *testing.T) {
+	s := &scripted{results: []executor.Result{{Stdout: "PENDING"}}}
+	r := scriptedRunner(s, Options{Retries: []RetryPolicy{{Attempts: 5, Backoff: time.Hour}}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, attempts := r.execute(ctx, shell("x"), &executor.Context{}); attempts != 1 {
+		t.Errorf("execute() made %d attempts after the run was cancelled, want 1", attempts)
+	}
+}
@@ -0,0 +1,456 @@
+// Package runner runs the procedures of a parsed page: it expands each
+// procedure into its variants, checks prerequisites, resolves placeholders
+// and executes every step's actions in order.
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/cassette"
+	"github.com/dacharyc/spike-procedural-testing/internal/cleanup"
+	"github.com/dacharyc/spike-procedural-testing/internal/executor"
+	"github.com/dacharyc/spike-procedural-testing/internal/prereq"
+	"github.com/dacharyc/spike-procedural-testing/internal/redact"
+	"github.com/dacharyc/spike-procedural-testing/internal/resolver"
+	"github.com/dacharyc/spike-procedural-testing/internal/sandbox"
+)
+
+// Options control a run.
+type Options struct {
+	// SkipPrerequisites turns prerequisite checking off entirely.
+	SkipPrerequisites bool
+	// IgnorePrerequisites checks prerequisites and reports the results,
+	// but runs procedures whose prerequisites are not met instead of
+	// skipping them.
+	IgnorePrerequisites bool
+	// Timeout bounds each action. Zero uses executor.DefaultTimeout.
+	Timeout time.Duration
+	// Env is the environment actions run with, as KEY=value pairs. When
+	// nil the process environment is used.
+	Env []string
+	// IDECommands overrides the command used for "run it from your IDE"
+	// actions, by language. SkipIDE reports those actions as skipped.
+	IDECommands map[string]string
+	SkipIDE     bool
+	// Runtimes change how the code examples of a language run, by
+	// language.
+	Runtimes map[string]executor.Runtime
+	// NoCleanup leaves the working directory, background processes and
+	// test databases in place for debugging. They are still reported.
+	NoCleanup bool
+	// DatabasePattern and CollectionPattern select the databases and
+	// collections that procedures create for testing and that are
+	// dropped afterwards. Nil uses cleanup.DefaultPattern.
+	DatabasePattern   *regexp.Regexp
+	CollectionPattern *regexp.Regexp
+	// RunsDir is where procedure sandboxes are created. Empty uses
+	// sandbox.DefaultRunsDir.
+	RunsDir string
+	// KeepArtifacts decides which sandboxes are kept after their
+	// procedure ends. Empty keeps the sandboxes of failed procedures.
+	KeepArtifacts Keep
+	// Cassettes records external interactions to, or replays them from,
+	// cassettes in CassetteDir. Empty uses cassette.DefaultDir.
+	Cassettes   cassette.Mode
+	CassetteDir string
+	// Jobs is how many procedure variants run at once. Values below 1
+	// run them one at a time.
+	Jobs int
+	// Limits caps how many variants that need a resource class, such as
+	// ResourceAtlasCluster, run at once. Classes without a limit are
+	// bounded by Jobs alone.
+	Limits map[string]int
+	// WaitTimeout bounds a wait for a resource to be ready, unless the
+	// page says it takes longer. Zero uses DefaultWaitTimeout.
+	// WaitInterval is the time between polls; zero uses
+	// DefaultWaitInterval.
+	WaitTimeout  time.Duration
+	WaitInterval time.Duration
+	// Retries decide which failing actions are tried again. The first
+	// policy that matches a failure applies. Nil uses
+	// DefaultRetryPolicies; an empty slice turns retries off.
+	Retries []RetryPolicy
+	// Filter decides which steps and actions of a procedure run. Its
+	// Grep and Variants select test cases; Filter.Jobs applies them to
+	// the jobs of a run.
+	Filter Filter
+}
+
+// Keep decides when a procedure's sandbox is kept for debugging.
+type Keep string
+
+const (
+	KeepOnFailure Keep = "failure"
+	KeepAlways    Keep = "always"
+	KeepNever     Keep = "never"
+)
+
+// Runner runs procedures.
+type Runner struct {
+	Options   Options
+	Checker   *prereq.Checker
+	Executors *executor.Registry
+	Resolver  *resolver.Resolver
+	// Redactor hides secrets in the manifests of kept sandboxes and in
+	// cassettes.
+	Redactor *redact.Redactor
+	// OnEvent, when set, receives progress events. It is called from
+	// several goroutines when procedures run in parallel.
+	OnEvent func(Event)
+}
+
+// New returns a runner with the default executors.
+func New(opts Options) *Runner {
+	if opts.Env == nil {
+		opts.Env = os.Environ()
+	}
+	if opts.DatabasePattern == nil {
+		opts.DatabasePattern = cleanup.DefaultPattern
+	}
+	if opts.CollectionPattern == nil {
+		opts.CollectionPattern = cleanup.DefaultPattern
+	}
+	if opts.CassetteDir == "" {
+		opts.CassetteDir = cassette.DefaultDir
+	}
+	if opts.KeepArtifacts == "" {
+		opts.KeepArtifacts = KeepOnFailure
+	}
+	if opts.WaitTimeout <= 0 {
+		opts.WaitTimeout = DefaultWaitTimeout
+	}
+	if opts.WaitInterval <= 0 {
+		opts.WaitInterval = DefaultWaitInterval
+	}
+	if opts.Retries == nil {
+		opts.Retries = DefaultRetryPolicies
+	}
+	checker := prereq.NewChecker("")
+	checker.Env = opts.Env
+	return &Runner{
+		Options:   opts,
+		Checker:   checker,
+		Executors: executor.Default(),
+		Resolver:  resolver.New(opts.Env),
+		Redactor:  redact.New(opts.Env),
+	}
+}
+
+// RunProcedure runs one procedure, restricted to the content of variant
+// when it is not nil. Required prerequisites that are not met skip the
+// procedure unless Options.IgnorePrerequisites is set. The procedure runs
+// in its own sandbox, and whatever it created is cleaned up before
+// RunProcedure returns, including when ctx is cancelled.
+func (r *Runner) RunProcedure(ctx context.Context, doc *ast.Document, proc *ast.Procedure, variant *ast.Variant) (res ProcedureResult) {
+	start := time.Now()
+	res = ProcedureResult{File: doc.File, Procedure: proc, Variant: variant, Tags: doc.Tags, StartedAt: start, Steps: []StepResult{}}
+	sel := ast.Selection{}
+	if variant != nil {
+		sel = variant.Selection
+	}
+	for _, step := range proc.Steps {
+		if r.Options.Filter.runsStep(step, sel) {
+			res.PlannedSteps++
+		}
+	}
+	r.event(Event{Type: EventProcedureStarted, File: doc.File, Procedure: proc, Variant: variant})
+
+	if !r.Options.SkipPrerequisites {
+		res.PrerequisiteChecks = r.Checker.CheckAll(ctx, proc.Prerequisites, sel)
+		if r.Options.Cassettes == cassette.ModeReplay {
+			r.waiveCredentials(res.PrerequisiteChecks, proc, sel)
+		}
+		if len(prereq.Unmet(res.PrerequisiteChecks)) > 0 {
+			if !r.Options.IgnorePrerequisites {
+				res.Skipped = true
+				res.SkipReason = prereq.SkipReason(res.PrerequisiteChecks)
+				res.Duration = time.Since(start)
+				return res
+			}
+			res.PrerequisitesIgnored = true
+		}
+	}
+
+	sb, err := sandbox.New(r.Options.RunsDir, procedureID(proc, variant), start)
+	if err != nil {
+		res.Error = &TestError{Type: ErrorExecute, Message: fmt.Sprintf("cannot create working directory: %v", err), Location: proc.Location}
+		res.Duration = time.Since(start)
+		return res
+	}
+	reg := cleanup.NewRegistry()
+	ec := &executor.Context{
+		Dir:         sb.Dir,
+		Cwd:         sb.Dir,
+		Env:         sb.Environ(r.Options.Env),
+		Timeout:     r.Options.Timeout,
+		IDECommands: r.Options.IDECommands,
+		SkipIDE:     r.Options.SkipIDE,
+		Runtimes:    r.Options.Runtimes,
+		Cleanup:     reg,
+	}
+	res.WorkingDirectory = sb.Dir
+	pr := &procedureRun{
+		file:    doc.File,
+		proc:    proc,
+		variant: variant,
+		sel:     sel,
+		ec:      ec,
+		// $HOME and $TMPDIR in a command refer to the sandbox.
+		resolver: r.Resolver.With(sb.Vars(r.Options.Env)),
+	}
+	defer func() {
+		r.closeCassette(pr, &res)
+		res.Cleanup = r.cleanup(ctx, reg)
+		res.Duration = time.Since(start)
+		r.closeSandbox(ctx, sb, ec, &res)
+		for i := range res.Cleanup {
+			r.event(Event{Type: EventCleanup, File: doc.File, Procedure: proc, Variant: variant, Cleanup: &res.Cleanup[i]})
+		}
+	}()
+	if err := r.openCassette(pr, doc, variant, &res); err != nil {
+		res.Error = &TestError{Type: ErrorReplay, Message: err.Error(), Location: proc.Location}
+		return res
+	}
+
+	res.Success = true
+	for _, step := range proc.Steps {
+		if !r.Options.Filter.runsStep(step, sel) {
+			continue
+		}
+		sr := r.runStep(ctx, pr, step)
+		res.Steps = append(res.Steps, sr)
+		if !sr.Success {
+			res.Success = false
+			res.Error = sr.Error
+			break
+		}
+		res.Flaky = res.Flaky || sr.Flaky
+	}
+	return res
+}
+
+// procedureRun is the state of a procedure variant while it runs.
+type procedureRun struct {
+	file     string
+	proc     *ast.Procedure
+	variant  *ast.Variant
+	sel      ast.Selection
+	ec       *executor.Context
+	resolver *resolver.Resolver
+	// tape is the cassette being recorded or replayed, if any.
+	tape *cassette.Cassette
+}
+
+// cleanup runs the registered tasks, or skips them with NoCleanup. It
+// gets its own deadline rather than the run's context, which may already
+// be cancelled by an interrupt.
+func (r *Runner) cleanup(ctx context.Context, reg *cleanup.Registry) []cleanup.Result {
+	if r.Options.NoCleanup {
+		return reg.Skip()
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanup.DefaultTimeout)
+	defer cancel()
+	return reg.Run(ctx)
+}
+
+// closeSandbox keeps the sandbox, with a manifest and an enter script,
+// or removes it, as Options.KeepArtifacts says. With NoCleanup every
+// sandbox is kept.
+func (r *Runner) closeSandbox(ctx context.Context, sb *sandbox.Sandbox, ec *executor.Context, res *ProcedureResult) {
+	keep := r.Options.NoCleanup || r.Options.KeepArtifacts == KeepAlways ||
+		(r.Options.KeepArtifacts == KeepOnFailure && !res.Success)
+	if !keep {
+		reg := cleanup.NewRegistry()
+		reg.Directory(sb.Root)
+		res.Cleanup = append(res.Cleanup, r.cleanup(ctx, reg)...)
+		return
+	}
+	res.Artifacts = sb.Root
+	if err := sb.WriteManifest(r.manifest(sb, ec, res)); err != nil {
+		res.Cleanup = append(res.Cleanup, cleanup.Result{Kind: cleanup.KindFile, Description: "write sandbox manifest", Error: err.Error()})
+	}
+	if err := sb.WriteEnterScript(ec.Cwd, sb.Vars(r.Options.Env), res.Name()); err != nil {
+		res.Cleanup = append(res.Cleanup, cleanup.Result{Kind: cleanup.KindFile, Description: "write sandbox enter script", Error: err.Error()})
+	}
+}
+
+func (r *Runner) runStep(ctx context.Context, pr *procedureRun, step *ast.Step) StepResult {
+	start := time.Now()
+	sr := StepResult{Step: step, Success: true, Actions: []ActionResult{}}
+	errCtx := ErrorContext{ProcedureTitle: pr.proc.Title, StepNumber: step.Number, StepTitle: step.Title}
+	r.stepEvent(pr, errCtx.Step(), step.Title)
+	sr.Actions, sr.Flaky, sr.Error = r.runActions(ctx, pr, step.Actions, errCtx)
+	if sr.Error == nil {
+		for _, sub := range step.SubSteps {
+			if !r.Options.Filter.runsSubStep(sub, pr.sel) {
+				continue
+			}
+			subStart := time.Now()
+			subCtx := errCtx
+			subCtx.SubStepNumber = sub.Number
+			r.stepEvent(pr, subCtx.Step(), sub.Title)
+			ssr := SubStepResult{SubStep: sub, Success: true}
+			var flaky bool
+			ssr.Actions, flaky, ssr.Error = r.runActions(ctx, pr, sub.Actions, subCtx)
+			sr.Flaky = sr.Flaky || flaky
+			ssr.Success = ssr.Error == nil
+			ssr.Duration = time.Since(subStart)
+			r.stepFinished(pr, subCtx.Step(), sub.Title, ssr.Error, ssr.Duration)
+			sr.SubSteps = append(sr.SubSteps, ssr)
+			if !ssr.Success {
+				sr.Error = ssr.Error
+				break
+			}
+		}
+	}
+	sr.Success = sr.Error == nil
+	sr.Flaky = sr.Flaky && sr.Success
+	sr.Duration = time.Since(start)
+	r.stepFinished(pr, errCtx.Step(), step.Title, sr.Error, sr.Duration)
+	return sr
+}
+
+func (r *Runner) stepEvent(pr *procedureRun, step, title string) {
+	r.event(Event{Type: EventStepStarted, File: pr.file, Procedure: pr.proc, Variant: pr.variant, Step: step, StepTitle: title})
+}
+
+func (r *Runner) stepFinished(pr *procedureRun, step, title string, err *TestError, d time.Duration) {
+	r.event(Event{Type: EventStepFinished, File: pr.file, Procedure: pr.proc, Variant: pr.variant, Step: step, StepTitle: title, Success: err == nil, Duration: d, Error: err})
+}
+
+// outputEvents returns the executor.Context.Output that reports what
+// action a writes as EventOutput, redacted, or nil without OnEvent.
+func (r *Runner) outputEvents(pr *procedureRun, a ast.Action, errCtx ErrorContext) func(stream, line string) {
+	if r.OnEvent == nil {
+		return nil
+	}
+	step := errCtx.Step()
+	return func(stream, line string) {
+		r.event(Event{Type: EventOutput, File: pr.file, Procedure: pr.proc, Variant: pr.variant, Step: step, Action: a, Stream: stream, Output: r.Redactor.String(line)})
+	}
+}
+
+// runActions runs actions in order and stops at the first failure, which
+// it returns as the error. flaky reports whether an action passed only
+// after a retry.
+func (r *Runner) runActions(ctx context.Context, pr *procedureRun, actions []ast.Action, errCtx ErrorContext) (results []ActionResult, flaky bool, failed *TestError) {
+	results = []ActionResult{}
+	eachAction(actions, pr.sel, errCtx.Step(), func(a ast.Action, key string) bool {
+		if !r.Options.Filter.RunsAction(a) {
+			return true
+		}
+		ar := r.runAction(ctx, pr, a, key, errCtx)
+		if ar.Flaky() {
+			flaky = true
+		}
+		results = append(results, ar)
+		failed = ar.Error
+		return failed == nil
+	})
+	return results, flaky, failed
+}
+
+// walkProcedure calls fn for every action of proc that belongs to sel,
+// in order, with its cassette key.
+func walkProcedure(proc *ast.Procedure, sel ast.Selection, fn func(a ast.Action, key string)) {
+	visit := func(a ast.Action, key string) bool {
+		fn(a, key)
+		return true
+	}
+	for _, step := range proc.Steps {
+		if !step.Selection.Matches(sel) {
+			continue
+		}
+		ctx := ErrorContext{StepNumber: step.Number}
+		eachAction(step.Actions, sel, ctx.Step(), visit)
+		for _, sub := range step.SubSteps {
+			if sub.Selection.Matches(sel) {
+				ctx.SubStepNumber = sub.Number
+				eachAction(sub.Actions, sel, ctx.Step(), visit)
+			}
+		}
+	}
+}
+
+// eachAction calls fn for the actions of a step or sub-step that belong
+// to sel, with the cassette key of the recordable ones, until fn returns
+// false.
+func eachAction(actions []ast.Action, sel ast.Selection, step string, fn func(a ast.Action, key string) bool) {
+	n := 0
+	for _, a := range actions {
+		if !a.Base().Selection.Matches(sel) {
+			continue
+		}
+		key := ""
+		if cassette.Recordable(a) {
+			n++
+			key = cassette.Key(step, n)
+		}
+		if !fn(a, key) {
+			return
+		}
+	}
+}
+
+func (r *Runner) runAction(ctx context.Context, pr *procedureRun, a ast.Action, key string, errCtx ErrorContext) ActionResult {
+	if key != "" && r.Options.Cassettes == cassette.ModeReplay {
+		return r.replayAction(pr, a, key, errCtx)
+	}
+	ec := pr.ec
+	ec.Output = r.outputEvents(pr, a, errCtx)
+	if w, ok := a.(*ast.WaitAction); ok {
+		return r.wait(ctx, pr, w, errCtx)
+	}
+	resolved, subs, unresolved := resolveAction(a, pr.resolver)
+	ar := ActionResult{Action: a, Substitutions: subs}
+	if len(unresolved) > 0 {
+		unresolvedError(&ar, pr, unresolved, errCtx)
+		return ar
+	}
+	mongo := &cleanup.Mongo{URI: ec.Getenv("MONGODB_URI"), Env: ec.Env}
+	if ec.Cleanup != nil && mongo.URI != "" {
+		registerResources(ec.Cleanup, mongo, resolved, r.Options.DatabasePattern, r.Options.CollectionPattern)
+	}
+	ar.Execution, ar.Attempts = r.execute(ctx, resolved, ec)
+	if ec.Cleanup != nil && mongo.URI != "" && ar.Execution.Success {
+		registerSearchIndexes(ec.Cleanup, mongo, resolved)
+	}
+	if !ar.Execution.Success {
+		msg := executionMessage(a, ar.Execution)
+		if ar.Attempts > 1 {
+			msg += fmt.Sprintf(" (after %d attempts)", ar.Attempts)
+		}
+		ar.Error = &TestError{Type: ErrorExecute, Message: msg, Location: a.Base().Location, Context: errCtx}
+		return ar
+	}
+	if key != "" && r.Options.Cassettes == cassette.ModeRecord {
+		if err := r.recordAction(pr, a, resolved, key, ar.Execution); err != nil {
+			ar.Error = &TestError{Type: ErrorReplay, Message: fmt.Sprintf("cannot record %s action: %v", a.Kind(), err), Location: a.Base().Location, Context: errCtx}
+		}
+	}
+	return ar
+}
+
+// unresolvedError fails ar for placeholders that have no value.
+func unresolvedError(ar *ActionResult, pr *procedureRun, unresolved []string, errCtx ErrorContext) {
+	var suggestions []string
+	for _, p := range unresolved {
+		suggestions = append(suggestions, fmt.Sprintf("set %s for %s", strings.Join(pr.resolver.Suggestions(p), " or "), p))
+	}
+	ar.Execution = executor.Result{ExitCode: -1, Error: "unresolved placeholders: " + strings.Join(unresolved, ", ")}
+	ar.Error = &TestError{Type: ErrorResolve, Message: ar.Execution.Error, Location: ar.Action.Base().Location, Context: errCtx, Suggestions: suggestions}
+}
+
+func executionMessage(a ast.Action, res executor.Result) string {
+	msg := fmt.Sprintf("%s action failed", a.Kind())
+	if res.Error != "" {
+		msg += ": " + res.Error
+	}
+	return msg
+}
@@ -0,0 +1,164 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/cassette"
+	"github.com/dacharyc/spike-procedural-testing/internal/executor"
+)
+
+// Defaults for waits on asynchronous resources.
+const (
+	DefaultWaitTimeout  = 10 * time.Minute
+	DefaultWaitInterval = 5 * time.Second
+)
+
+// Poll is one check of a wait condition.
+type Poll struct {
+	Satisfied bool `json:"satisfied" yaml:"satisfied"`
+	// Observed is what the check found, such as "status is PENDING".
+	Observed string        `json:"observed" yaml:"observed"`
+	Duration time.Duration `json:"duration" yaml:"duration"`
+}
+
+// wait polls until the condition of a holds or the wait times out. The
+// result's execution is the last poll, with the duration of the whole
+// wait.
+func (r *Runner) wait(ctx context.Context, pr *procedureRun, a *ast.WaitAction, errCtx ErrorContext) (ar ActionResult) {
+	ar.Action = a
+	if r.Options.Cassettes == cassette.ModeReplay {
+		// The recorded interactions after the wait already saw the
+		// resource ready.
+		ar.Execution = executor.Result{Success: true, Skipped: true, Error: "waits are not needed when replaying"}
+		return ar
+	}
+	poll := a.Poll
+	if a.Condition == ast.WaitHTTPStatus {
+		poll = &ast.URLAction{ActionBase: ast.ActionBase{Type: ast.ActionURL, Location: a.Location}, URL: a.URL, ExpectedStatus: a.Status}
+	}
+	if poll == nil {
+		ar.Execution = executor.Result{Success: true, Skipped: true, Error: "the page shows no command that reports when this is done; verify manually"}
+		return ar
+	}
+	resolved, subs, unresolved := resolveAction(poll, pr.resolver)
+	ar.Substitutions = subs
+	if len(unresolved) > 0 {
+		unresolvedError(&ar, pr, unresolved, errCtx)
+		return ar
+	}
+
+	timeout := max(a.Timeout, r.Options.WaitTimeout)
+	start := time.Now()
+	deadline := start.Add(timeout)
+	defer func() { ar.Execution.Duration = time.Since(start) }()
+	for {
+		res := r.Executors.Execute(ctx, resolved, pr.ec)
+		ok, observed := waitSatisfied(a, res)
+		ar.Polls = append(ar.Polls, Poll{Satisfied: ok, Observed: observed, Duration: res.Duration})
+		ar.Execution = res
+		if ok {
+			ar.Execution.Success, ar.Execution.Error = true, ""
+			return ar
+		}
+		if ctx.Err() != nil || time.Now().Add(r.Options.WaitInterval).After(deadline) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(r.Options.WaitInterval):
+		}
+	}
+	ar.Execution.Success = false
+	msg := fmt.Sprintf("timed out after %s waiting until %s; last poll: %s", timeout, a.Target(), ar.Polls[len(ar.Polls)-1].Observed)
+	if ctx.Err() != nil {
+		msg = fmt.Sprintf("interrupted while waiting until %s", a.Target())
+	}
+	ar.Error = &TestError{Type: ErrorExecute, Message: msg, Location: a.Location, Context: errCtx}
+	return ar
+}
+
+// waitSatisfied checks the condition of a against one poll and describes
+// what the poll found.
+func waitSatisfied(a *ast.WaitAction, res executor.Result) (bool, string) {
+	switch a.Condition {
+	case ast.WaitHTTPStatus:
+		if res.ExitCode <= 0 {
+			return false, res.Error
+		}
+		return res.Success, fmt.Sprintf("status %d", res.ExitCode)
+	case ast.WaitField:
+		if a.Field == "" {
+			re := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(a.Value) + `\b`)
+			if re.MatchString(res.Stdout) {
+				return true, a.Value
+			}
+			return false, fmt.Sprintf("%s not in output", a.Value)
+		}
+		values := fieldValues(res.Stdout, a.Field)
+		for _, v := range values {
+			if strings.EqualFold(v, a.Value) {
+				return true, fmt.Sprintf("%s is %s", a.Field, v)
+			}
+		}
+		if len(values) == 0 {
+			if res.Error != "" {
+				return false, res.Error
+			}
+			return false, fmt.Sprintf("no %s in output", a.Field)
+		}
+		return false, fmt.Sprintf("%s is %s", a.Field, strings.Join(values, ", "))
+	}
+	if res.TimedOut {
+		return false, res.Error
+	}
+	return res.ExitCode == a.ExitCode, fmt.Sprintf("exit code %d", res.ExitCode)
+}
+
+// fieldValues returns the values of a field in command output: every
+// field of that name in JSON output, at any depth, or "field: value"
+// pairs in other output such as mongosh's.
+func fieldValues(output, field string) []string {
+	var values []string
+	text := strings.TrimSpace(output)
+	if i := strings.IndexAny(text, "[{"); i >= 0 {
+		var v any
+		if json.Unmarshal([]byte(text[i:]), &v) == nil {
+			collectField(v, field, &values)
+			sort.Strings(values)
+			return values
+		}
+	}
+	re := regexp.MustCompile(`(?i)["']?\b` + regexp.QuoteMeta(field) + `\b["']?\s*[:=]\s*["']?([\w.-]+)`)
+	for _, m := range re.FindAllStringSubmatch(output, -1) {
+		values = append(values, m[1])
+	}
+	return values
+}
+
+func collectField(v any, field string, values *[]string) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			if strings.EqualFold(k, field) {
+				switch val.(type) {
+				case map[string]any, []any:
+				default:
+					*values = append(*values, fmt.Sprint(val))
+					continue
+				}
+			}
+			collectField(val, field, values)
+		}
+	case []any:
+		for _, e := range v {
+			collectField(e, field, values)
+		}
+	}
+}
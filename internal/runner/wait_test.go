@@ -0,0 +1,247 @@
+package runner
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dacharyc/spike-procedural-testing/internal/ast"
+	"github.com/dacharyc/spike-procedural-testing/internal/cassette"
+	"github.com/dacharyc/spike-procedural-testing/internal/executor"
+	"github.com/dacharyc/spike-procedural-testing/internal/resolver"
+)
+
+func TestWaitSatisfied(t *testing.T) {
+	tests := []struct {
+		name         string
+		wait         ast.WaitAction
+		result       executor.Result
+		want         bool
+		wantObserved string
+	}{
+		{
+			name:         "exit code",
+			wait:         ast.WaitAction{Condition: ast.WaitExitCode},
+			result:       executor.Result{Success: true},
+			want:         true,
+			wantObserved: "exit code 0",
+		},
+		{
+			name:         "other exit code",
+			wait:         ast.WaitAction{Condition: ast.WaitExitCode},
+			result:       executor.Result{ExitCode: 7},
+			wantObserved: "exit code 7",
+		},
+		{
+			name:         "timed out poll",
+			wait:         ast.WaitAction{Condition: ast.WaitExitCode},
+			result:       executor.Result{TimedOut: true, Error: "timed out after 30s"},
+			wantObserved: "timed out after 30s",
+		},
+		{
+			name:         "JSON field",
+			wait:         ast.WaitAction{Condition: ast.WaitField, Field: "status", Value: "READY"},
+			result:       executor.Result{Stdout: `[{"name": "default", "status": "READY"}]`},
+			want:         true,
+			wantObserved: "status is READY",
+		},
+		{
+			name:         "JSON field in any case",
+			wait:         ast.WaitAction{Condition: ast.WaitField, Field: "stateName", Value: "IDLE"},
+			result:       executor.Result{Stdout: `{"cluster": {"stateName": "idle"}}`},
+			want:         true,
+			wantObserved: "stateName is idle",
+		},
+		{
+			name:         "JSON field not ready",
+			wait:         ast.WaitAction{Condition: ast.WaitField, Field: "status", Value: "READY"},
+			result:       executor.Result{Stdout: `[{"status": "PENDING"}, {"status": "BUILDING"}]`},
+			wantObserved: "status is BUILDING, PENDING",
+		},
+		{
+			name:         "mongosh field",
+			wait:         ast.WaitAction{Condition: ast.WaitField, Field: "queryable", Value: "true"},
+			result:       executor.Result{Stdout: "[ { name: 'default', status: 'READY', queryable: true } ]"},
+			want:         true,
+			wantObserved: "queryable is true",
+		},
+		{
+			name:         "field missing",
+			wait:         ast.WaitAction{Condition: ast.WaitField, Field: "status", Value: "READY"},
+			result:       executor.Result{Stdout: "no indexes"},
+			wantObserved: "no status in output",
+		},
+		{
+			name:         "field missing after an error",
+			wait:         ast.WaitAction{Condition: ast.WaitField, Field: "status", Value: "READY"},
+			result:       executor.Result{Error: "connection refused"},
+			wantObserved: "connection refused",
+		},
+		{
+			name:         "value in output",
+			wait:         ast.WaitAction{Condition: ast.WaitField, Value: "READY"},
+			result:       executor.Result{Stdout: "Index default is ready"},
+			want:         true,
+			wantObserved: "READY",
+		},
+		{
+			name:         "value not a whole word",
+			wait:         ast.WaitAction{Condition: ast.WaitField, Value: "READY"},
+			result:       executor.Result{Stdout: "NOT_READYYET"},
+			wantObserved: "READY not in output",
+		},
+		{
+			name:         "HTTP status",
+			wait:         ast.WaitAction{Condition: ast.WaitHTTPStatus, Status: 200},
+			result:       executor.Result{Success: true, ExitCode: 200},
+			want:         true,
+			wantObserved: "status 200",
+		},
+		{
+			name:         "HTTP request failed",
+			wait:         ast.WaitAction{Condition: ast.WaitHTTPStatus, Status: 200},
+			result:       executor.Result{ExitCode: -1, Error: "connection refused"},
+			wantObserved: "connection refused",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, observed := waitSatisfied(&tt.wait, tt.result)
+			if got != tt.want || observed != tt.wantObserved {
+				t.Errorf("waitSatisfied() = %v, %q, want %v, %q", got, observed, tt.want, tt.wantObserved)
+			}
+		})
+	}
+}
+
+func TestFieldValues(t *testing.T) {
+	tests := []struct {
+		output, field string
+		want          []string
+	}{
+		{`{"a": {"status": "READY"}, "b": [{"status": "PENDING"}]}`, "status", []string{"PENDING", "READY"}},
+		{`Index list:` + "\n" + `[{"status": "READY"}]`, "status", []string{"READY"}},
+		{`{"status": {"phase": "READY"}}`, "status", nil},
+		{`{"count": 3}`, "count", []string{"3"}},
+		{"status: READY\nname: default", "status", []string{"READY"}},
+		{`"state"="IDLE"`, "state", []string{"IDLE"}},
+		{"nothing here", "status", nil},
+	}
+	for _, tt := range tests {
+		if got := fieldValues(tt.output, tt.field); !slices.Equal(got, tt.want) {
+			t.Errorf("fieldValues(%q, %q) = %q, want %q", tt.output, tt.field, got, tt.want)
+		}
+	}
+}
+
+// waitRun returns a procedure run with no environment.
+func waitRun() *procedureRun {
+	return &procedureRun{ec: &executor.Context{}, resolver: resolver.New(nil)}
+}
+
+func TestWait(t *testing.T) {
+	pending := executor.Result{Stdout: `{"status": "PENDING"}`}
+	ready := executor.Result{Stdout: `{"status": "READY"}`}
+	tests := []struct {
+		name      string
+		results   []executor.Result
+		timeout   time.Duration
+		wantOK    bool
+		wantPolls int
+		wantError string
+	}{
+		{
+			name:      "ready at once",
+			results:   []executor.Result{ready},
+			timeout:   time.Second,
+			wantOK:    true,
+			wantPolls: 1,
+		},
+		{
+			name:      "ready after polling",
+			results:   []executor.Result{pending, pending, ready},
+			timeout:   time.Second,
+			wantOK:    true,
+			wantPolls: 3,
+		},
+		{
+			name:      "times out",
+			results:   []executor.Result{pending},
+			timeout:   20 * time.Millisecond,
+			wantError: "timed out after 20ms waiting until status is READY; last poll: status is PENDING",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &scripted{results: tt.results}
+			r := scriptedRunner(s, Options{WaitTimeout: tt.timeout, WaitInterval: time.Millisecond})
+			a := &ast.WaitAction{Condition: ast.WaitField, Poll: shell("atlas search indexes list"), Field: "status", Value: "READY"}
+			ar := r.wait(context.Background(), waitRun(), a, ErrorContext{})
+			if ar.Execution.Success != tt.wantOK {
+				t.Errorf("Success = %v, want %v", ar.Execution.Success, tt.wantOK)
+			}
+			if tt.wantPolls > 0 && len(ar.Polls) != tt.wantPolls {
+				t.Errorf("polled %d times, want %d", len(ar.Polls), tt.wantPolls)
+			}
+			if len(ar.Polls) != s.calls {
+				t.Errorf("recorded %d polls for %d runs", len(ar.Polls), s.calls)
+			}
+			switch {
+			case tt.wantError == "" && ar.Error != nil:
+				t.Errorf("unexpected error: %s", ar.Error.Message)
+			case tt.wantError != "" && (ar.Error == nil || ar.Error.Message != tt.wantError):
+				t.Errorf("error = %v, want %q", ar.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestWaitUsesTheLongerTimeout(t *testing.T) {
+	s := &scripted{results: []executor.Result{{ExitCode: 1}}}
+	r := scriptedRunner(s, Options{WaitTimeout: time.Millisecond, WaitInterval: time.Millisecond})
+	a := &ast.WaitAction{Condition: ast.WaitExitCode, Poll: shell("test -f done"), Timeout: 30 * time.Millisecond}
+	ar := r.wait(context.Background(), waitRun(), a, ErrorContext{})
+	if ar.Error == nil || !strings.HasPrefix(ar.Error.Message, "timed out after 30ms") {
+		t.Errorf("error = %v, want a timeout after the page's 30ms", ar.Error)
+	}
+}
+
+func TestWaitInterrupted(t *testing.T) {
+	s := &scripted{results: []executor.Result{{ExitCode: 1}}}
+	r := scriptedRunner(s, Options{WaitTimeout: time.Hour, WaitInterval: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a := &ast.WaitAction{Condition: ast.WaitExitCode, Poll: shell("test -f done")}
+	ar := r.wait(ctx, waitRun(), a, ErrorContext{})
+	if ar.Error == nil || !strings.HasPrefix(ar.Error.Message, "interrupted while waiting") {
+		t.Errorf("error = %v, want an interruption", ar.Error)
+	}
+	if s.calls != 1 {
+		t.Errorf("polled %d times after the run was cancelled, want 1", s.calls)
+	}
+}
+
+func TestWaitSkipped(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		wait *ast.WaitAction
+	}{
+		{"nothing to poll", Options{}, &ast.WaitAction{Condition: ast.WaitExitCode}},
+		{"replaying", Options{Cassettes: cassette.ModeReplay}, &ast.WaitAction{Condition: ast.WaitExitCode, Poll: shell("x")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &scripted{results: []executor.Result{{ExitCode: 1}}}
+			ar := scriptedRunner(s, tt.opts).wait(context.Background(), waitRun(), tt.wait, ErrorContext{})
+			if !ar.Execution.Skipped || !ar.Execution.Success || ar.Error != nil {
+				t.Errorf("execution = %+v, error = %v, want a skipped success", ar.Execution, ar.Error)
+			}
+			if s.calls != 0 {
+				t.Errorf("polled %d times, want none", s.calls)
+			}
+		})
+	}
+}
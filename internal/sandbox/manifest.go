@@ -0,0 +1,101 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Manifest records what a procedure did in its sandbox, so that a kept
+// sandbox can be understood without rerunning the procedure. Values that
+// look like secrets are redacted before it is written.
+type Manifest struct {
+	File      string        `json:"file"`
+	Procedure string        `json:"procedure"`
+	Variant   string        `json:"variant,omitempty"`
+	Status    string        `json:"status"`
+	StartedAt time.Time     `json:"startedAt"`
+	Duration  time.Duration `json:"duration"`
+	// WorkingDirectory is the directory the procedure ended in.
+	WorkingDirectory string `json:"workingDirectory"`
+	// Env is the environment the commands ran with.
+	Env      []string  `json:"env"`
+	Commands []Command `json:"commands"`
+	Files    []File    `json:"files"`
+}
+
+// Command is one action that ran.
+type Command struct {
+	// Step is the step the action belongs to, such as "2" or "2.b".
+	Step     string        `json:"step"`
+	Type     string        `json:"type"`
+	Command  string        `json:"command,omitempty"`
+	ExitCode int           `json:"exitCode"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// File is a file the procedure left in its working directory.
+type File struct {
+	// Path is relative to the working directory. Directories that
+	// package managers fill, such as node_modules, are listed once with
+	// a trailing slash instead of file by file.
+	Path string `json:"path"`
+	Size int64  `json:"size,omitempty"`
+}
+
+// maxFiles bounds the file list of a manifest.
+const maxFiles = 1000
+
+// collapsedDirs are listed without their contents.
+var collapsedDirs = map[string]bool{
+	".git":         true,
+	".gradle":      true,
+	".venv":        true,
+	"__pycache__":  true,
+	"bin":          true,
+	"node_modules": true,
+	"obj":          true,
+	"target":       true,
+	"vendor":       true,
+	"venv":         true,
+}
+
+// Files lists the files in the working directory.
+func (s *Sandbox) Files() []File {
+	files := []File{}
+	filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == s.Dir {
+			return nil
+		}
+		if len(files) >= maxFiles {
+			return fs.SkipAll
+		}
+		rel, _ := filepath.Rel(s.Dir, path)
+		if d.IsDir() {
+			if collapsedDirs[d.Name()] {
+				files = append(files, File{Path: filepath.ToSlash(rel) + "/"})
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		f := File{Path: filepath.ToSlash(rel)}
+		if info, err := d.Info(); err == nil {
+			f.Size = info.Size()
+		}
+		files = append(files, f)
+		return nil
+	})
+	return files
+}
+
+// WriteManifest writes m to the sandbox.
+func (s *Sandbox) WriteManifest(m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.Root, ManifestFile), append(data, '\n'), 0o644)
+}
@@ -0,0 +1,208 @@
+// Package sandbox creates the directory each procedure variant runs in:
+// .proctest/runs/<timestamp>-<procedure-id>/. Besides the working
+// directory it holds the home, temp and cache directories the procedure's
+// commands see, so that scaffolding tools such as composer, npm and
+// dotnet write their state there instead of into the user's home.
+//
+// A sandbox looks like this:
+//
+//	.proctest/runs/20261015-142530-create-an-index-python/
+//	  work/           the working directory; file paths are relative to it
+//	  home/           HOME
+//	  tmp/            TMPDIR
+//	  cache/          XDG_CACHE_HOME and tool caches
+//	  manifest.json   what ran, written when the procedure ends
+//	  enter.sh        starts a shell inside the sandbox
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultRunsDir is where sandboxes are created, relative to the current
+// directory.
+const DefaultRunsDir = ".proctest/runs"
+
+// ManifestFile and EnterScript are the names of the files a finished
+// sandbox contains. A sandbox without a manifest belongs to a run that
+// is still going or that crashed.
+const (
+	ManifestFile = "manifest.json"
+	EnterScript  = "enter.sh"
+)
+
+// timestampFormat sorts sandboxes by start time.
+const timestampFormat = "20060102-150405"
+
+// maxIDLen keeps directory names usable.
+const maxIDLen = 80
+
+// toolchainHomes are where version managers and toolchains live, by the
+// variable that overrides the location and the default under the real
+// home directory. They are installations, not state a procedure should
+// create, and moving HOME would hide them: rustup would find no default
+// toolchain and nvm no Node.js.
+var toolchainHomes = []struct{ name, dir string }{
+	{"RUSTUP_HOME", ".rustup"},
+	{"CARGO_HOME", ".cargo"},
+	{"NVM_DIR", ".nvm"},
+	{"PYENV_ROOT", ".pyenv"},
+	{"SDKMAN_DIR", ".sdkman"},
+	{"DOTNET_ROOT", ".dotnet"},
+}
+
+// Sandbox is the directory tree of one procedure run.
+type Sandbox struct {
+	// Root is the sandbox directory.
+	Root string
+	// Dir is the working directory.
+	Dir   string
+	Home  string
+	Tmp   string
+	Cache string
+}
+
+// New creates a sandbox in runsDir for the procedure with the given id.
+func New(runsDir, id string, start time.Time) (*Sandbox, error) {
+	if runsDir == "" {
+		runsDir = DefaultRunsDir
+	}
+	runsDir, err := filepath.Abs(runsDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(runsDir, 0o755); err != nil {
+		return nil, err
+	}
+	// Keep runs out of version control without asking users to edit
+	// their .gitignore.
+	ignore := filepath.Join(runsDir, ".gitignore")
+	if _, err := os.Stat(ignore); os.IsNotExist(err) {
+		_ = os.WriteFile(ignore, []byte("*\n"), 0o644)
+	}
+
+	// Two variants can start in the same second; MkdirTemp's suffix
+	// keeps them apart without hiding the readable part of the name.
+	root, err := os.MkdirTemp(runsDir, start.Format(timestampFormat)+"-"+Slug(id)+"-")
+	if err != nil {
+		return nil, err
+	}
+	s := &Sandbox{
+		Root:  root,
+		Dir:   filepath.Join(root, "work"),
+		Home:  filepath.Join(root, "home"),
+		Tmp:   filepath.Join(root, "tmp"),
+		Cache: filepath.Join(root, "cache"),
+	}
+	for _, dir := range []string{s.Dir, s.Home, s.Tmp, s.Cache} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			os.RemoveAll(root)
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Vars returns the variables that point tools at the sandbox, as
+// KEY=value pairs. base is the environment the sandbox replaces; it is
+// used to keep toolchains installed under the real home directory
+// reachable.
+func (s *Sandbox) Vars(base []string) []string {
+	vars := []string{
+		"HOME=" + s.Home,
+		"USERPROFILE=" + s.Home,
+		"TMPDIR=" + s.Tmp,
+		"TMP=" + s.Tmp,
+		"TEMP=" + s.Tmp,
+		"XDG_CACHE_HOME=" + s.Cache,
+		"XDG_CONFIG_HOME=" + filepath.Join(s.Home, ".config"),
+		"XDG_DATA_HOME=" + filepath.Join(s.Home, ".local", "share"),
+		"XDG_STATE_HOME=" + filepath.Join(s.Home, ".local", "state"),
+		"npm_config_cache=" + filepath.Join(s.Cache, "npm"),
+		"COMPOSER_HOME=" + filepath.Join(s.Home, ".composer"),
+		"COMPOSER_CACHE_DIR=" + filepath.Join(s.Cache, "composer"),
+		"DOTNET_CLI_HOME=" + s.Home,
+		"NUGET_PACKAGES=" + filepath.Join(s.Cache, "nuget"),
+		"PIP_CACHE_DIR=" + filepath.Join(s.Cache, "pip"),
+	}
+	home := lookup(base, "HOME")
+	if home == "" {
+		return vars
+	}
+	for _, t := range toolchainHomes {
+		if lookup(base, t.name) != "" {
+			continue
+		}
+		dir := filepath.Join(home, t.dir)
+		if _, err := os.Stat(dir); err == nil {
+			vars = append(vars, t.name+"="+dir)
+		}
+	}
+	return vars
+}
+
+// Environ returns base with the sandbox variables in place of the ones
+// they override.
+func (s *Sandbox) Environ(base []string) []string {
+	vars := s.Vars(base)
+	set := map[string]bool{}
+	for _, kv := range vars {
+		name, _, _ := strings.Cut(kv, "=")
+		set[name] = true
+	}
+	env := make([]string, 0, len(base)+len(vars))
+	for _, kv := range base {
+		if name, _, _ := strings.Cut(kv, "="); !set[name] {
+			env = append(env, kv)
+		}
+	}
+	return append(env, vars...)
+}
+
+// WriteEnterScript writes a script that starts a shell in dir, normally
+// the directory the procedure ended in, with the sandbox variables set.
+func (s *Sandbox) WriteEnterScript(dir string, vars []string, title string) error {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Starts a shell in the sandbox of %q with the environment its commands ran\n# in. Exit the shell to return.\n", title)
+	fmt.Fprintf(&b, "cd %s || exit 1\n", quote(dir))
+	for _, kv := range vars {
+		name, value, _ := strings.Cut(kv, "=")
+		fmt.Fprintf(&b, "export %s=%s\n", name, quote(value))
+	}
+	b.WriteString("exec \"${SHELL:-/bin/sh}\"\n")
+	return os.WriteFile(filepath.Join(s.Root, EnterScript), []byte(b.String()), 0o755)
+}
+
+var nonSlugRE = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slug turns a procedure title or variant ID into a directory name.
+func Slug(s string) string {
+	s = strings.Trim(nonSlugRE.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(s) > maxIDLen {
+		s = strings.TrimRight(s[:maxIDLen], "-")
+	}
+	if s == "" {
+		return "procedure"
+	}
+	return s
+}
+
+func lookup(env []string, name string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if k, v, ok := strings.Cut(env[i], "="); ok && k == name {
+			return v
+		}
+	}
+	return ""
+}
+
+// quote quotes s for a POSIX shell.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
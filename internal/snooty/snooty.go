@@ -0,0 +1,151 @@
+// Package snooty loads the snooty.toml project file that sits at the root
+// of every docs project. The parser needs its constants ({+name+}),
+// substitutions (|name|), and composable tutorial definitions.
+package snooty
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ProjectFile is the name of the project file.
+const ProjectFile = "snooty.toml"
+
+// Project is the subset of snooty.toml the parser uses.
+type Project struct {
+	// Root is the directory that contains snooty.toml.
+	Root string `toml:"-"`
+	// SourceDir is the directory that absolute include paths such as
+	// "/includes/x.rst" resolve against.
+	SourceDir string `toml:"-"`
+
+	Name          string            `toml:"name"`
+	Title         string            `toml:"title"`
+	Constants     map[string]string `toml:"constants"`
+	Substitutions map[string]string `toml:"substitutions"`
+	Composables   []Composable      `toml:"composables"`
+}
+
+// Composable is one dimension of a composable tutorial, such as
+// "language" or "interface".
+type Composable struct {
+	ID           string              `toml:"id"`
+	Title        string              `toml:"title"`
+	Default      string              `toml:"default"`
+	Options      []Option            `toml:"options"`
+	Dependencies []map[string]string `toml:"dependencies"`
+}
+
+// Option is one selectable value of a composable.
+type Option struct {
+	ID    string `toml:"id"`
+	Title string `toml:"title"`
+}
+
+// Find walks up from path looking for snooty.toml and returns the
+// directory that contains it.
+func Find(path string) (string, bool) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ProjectFile)); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// Load reads the snooty.toml in root.
+func Load(root string) (*Project, error) {
+	return LoadFile(filepath.Join(root, ProjectFile))
+}
+
+// LoadFile reads the project file at path. Its directory is the
+// project's root.
+func LoadFile(path string) (*Project, error) {
+	root := filepath.Dir(path)
+	p := &Project{Root: root, SourceDir: filepath.Join(root, "source")}
+	if _, err := toml.DecodeFile(path, p); err != nil {
+		return nil, fmt.Errorf("loading %s: %w", path, err)
+	}
+	if p.Constants == nil {
+		p.Constants = map[string]string{}
+	}
+	if p.Substitutions == nil {
+		p.Substitutions = map[string]string{}
+	}
+	return p, nil
+}
+
+// LoadFor finds and loads the project that contains path. It returns nil
+// without an error when path is not inside a snooty project.
+func LoadFor(path string) (*Project, error) {
+	root, ok := Find(path)
+	if !ok {
+		return nil, nil
+	}
+	return Load(root)
+}
+
+var constantRE = regexp.MustCompile(`\{\+([\w.-]+)\+\}`)
+
+// ConstantRefs returns the names of the constants s refers to, in order.
+func ConstantRefs(s string) []string {
+	var names []string
+	for _, m := range constantRE.FindAllStringSubmatch(s, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// ExpandConstants replaces {+name+} references with their values. Unknown
+// constants are left in place so they show up as placeholders.
+func (p *Project) ExpandConstants(s string) string {
+	if p == nil {
+		return s
+	}
+	return constantRE.ReplaceAllStringFunc(s, func(m string) string {
+		if v, ok := p.Constants[m[2:len(m)-2]]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// Composable returns the composable with the given ID.
+func (p *Project) Composable(id string) (Composable, bool) {
+	if p != nil {
+		for _, c := range p.Composables {
+			if c.ID == id {
+				return c, true
+			}
+		}
+	}
+	return Composable{}, false
+}
+
+// OptionTitle returns the display title for a composable option, falling
+// back to the option ID.
+func (p *Project) OptionTitle(composable, option string) string {
+	if c, ok := p.Composable(composable); ok {
+		for _, o := range c.Options {
+			if o.ID == option {
+				return o.Title
+			}
+		}
+	}
+	return option
+}
@@ -0,0 +1,61 @@
+package results
+
+import "time"
+
+// EventsVersion is the version of the event stream that "proctest test
+// --reporter ndjson" writes. It changes by the same rules as
+// SchemaVersion.
+const EventsVersion = "1.1"
+
+// Event types, in the order a run reports them. The events of test cases
+// that run in parallel are interleaved; ID tells them apart.
+const (
+	EventRunStart       = "run-start"
+	EventProcedureStart = "procedure-start"
+	EventStepStart      = "step-start"
+	EventActionOutput   = "action-output"
+	EventStepEnd        = "step-end"
+	EventCleanup        = "cleanup"
+	EventProcedureEnd   = "procedure-end"
+	EventRunEnd         = "run-end"
+)
+
+// Event is one line of the event stream: a JSON object written as soon
+// as what it reports happens, so that an editor or a web page can show a
+// run while it is in progress. Only the fields of its type are set.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Version and Tool are set on run-start, and Total, the number of
+	// test cases the run has, when it is known.
+	Version string `json:"version,omitempty"`
+	Tool    *Tool  `json:"tool,omitempty"`
+	Total   int    `json:"total,omitempty"`
+	// ID, File and Name identify the test case, as in Result, on every
+	// event but run-start and run-end.
+	ID   string `json:"id,omitempty"`
+	File string `json:"file,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Step is the step number as the page shows it, "2" or "2.b", on
+	// the step events and action-output. StepTitle is set on the step
+	// events.
+	Step      string `json:"step,omitempty"`
+	StepTitle string `json:"stepTitle,omitempty"`
+	// Status, Duration and Error are the outcome of the step on
+	// step-end. Duration is in milliseconds.
+	Status   string `json:"status,omitempty"`
+	Duration int64  `json:"duration,omitempty"`
+	Error    *Error `json:"error,omitempty"`
+	// Action is where the action that wrote Output is, and Stream,
+	// stdout or stderr, where it wrote it, on action-output. Output is
+	// one line, with its newline unless the process ended without one.
+	Action *Location `json:"action,omitempty"`
+	Stream string    `json:"stream,omitempty"`
+	Output string    `json:"output,omitempty"`
+	// Cleanup is set on cleanup.
+	Cleanup *Cleanup `json:"cleanup,omitempty"`
+	// Result is the complete result of the test case on procedure-end.
+	Result *Result `json:"result,omitempty"`
+	// Summary is set on run-end.
+	Summary *Summary `json:"summary,omitempty"`
+}
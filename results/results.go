@@ -0,0 +1,309 @@
+// Package results defines the JSON document that "proctest test
+// --reporter json" writes. Dashboards and other services can import it to
+// read results instead of scraping the human-readable output.
+//
+// The document carries a schema version. Fields are only added within a
+// major version; removing or changing a field increments the major
+// version. Schema is the JSON Schema of the document.
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the version of the document this package describes.
+const SchemaVersion = "1.2"
+
+// Statuses of results, steps and actions.
+const (
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// Document is a complete test run.
+type Document struct {
+	SchemaVersion string      `json:"schemaVersion"`
+	Tool          Tool        `json:"tool"`
+	GeneratedAt   time.Time   `json:"generatedAt"`
+	Environment   Environment `json:"environment"`
+	Results       []Result    `json:"results"`
+	Summary       Summary     `json:"summary"`
+}
+
+// Tool identifies the program that wrote the document.
+type Tool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Environment describes where the run happened, so that results from
+// different machines can be told apart.
+type Environment struct {
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+	// CI names the CI system the run happened in, if any.
+	CI string `json:"ci,omitempty"`
+	// Software maps the programs that prerequisite checks found to
+	// their versions.
+	Software map[string]string `json:"software,omitempty"`
+	// Variables lists the environment variables that filled in
+	// placeholders. Values are never recorded.
+	Variables []string `json:"variables,omitempty"`
+	// Fingerprint is a hash of the fields above: two runs with the same
+	// fingerprint ran in equivalent environments.
+	Fingerprint string `json:"fingerprint"`
+}
+
+// Result is one test case: a procedure, or one variant of it.
+type Result struct {
+	// ID identifies the test case across runs: the procedure ID, and "@"
+	// and the variant ID for a variant.
+	ID   string `json:"id,omitempty"`
+	File string `json:"file"`
+	// Name is the procedure title with the variant label.
+	Name      string    `json:"name"`
+	Procedure Procedure `json:"procedure"`
+	Variant   *Variant  `json:"variant,omitempty"`
+	// Owner is the team responsible for the procedure, when it is known.
+	Owner string `json:"owner,omitempty"`
+	// Tags categorize the procedure, starting with the page's meta
+	// keywords and facet values.
+	Tags   []string `json:"tags,omitempty"`
+	Status string   `json:"status"`
+	// Flaky is set when the procedure passed only because actions were
+	// retried.
+	Flaky      bool      `json:"flaky,omitempty"`
+	SkipReason string    `json:"skipReason,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	// Duration is in milliseconds.
+	Duration         int64  `json:"duration"`
+	WorkingDirectory string `json:"workingDirectory,omitempty"`
+	// Artifacts is the sandbox kept for debugging, when it was kept.
+	Artifacts string `json:"artifacts,omitempty"`
+	Cassette  string `json:"cassette,omitempty"`
+	// PrerequisitesIgnored is set when unmet prerequisites were
+	// overridden and the procedure ran anyway.
+	PrerequisitesIgnored bool           `json:"prerequisitesIgnored,omitempty"`
+	Prerequisites        []Prerequisite `json:"prerequisites,omitempty"`
+	Steps                []Step         `json:"steps"`
+	Error                *Error         `json:"error,omitempty"`
+	// Cleanup lists what was removed after the procedure, newest first.
+	Cleanup []Cleanup `json:"cleanup,omitempty"`
+}
+
+// Procedure identifies the procedure on its page.
+type Procedure struct {
+	// ID is built from the page's path and the headings the procedure
+	// is under, so that it survives edits elsewhere on the page.
+	ID          string   `json:"id,omitempty"`
+	Title       string   `json:"title"`
+	HeadingPath []string `json:"headingPath,omitempty"`
+	Location    Location `json:"location"`
+}
+
+// Variant is the tab or composable tutorial selection a test case ran.
+type Variant struct {
+	// Type is "tab" or "composable-tutorial".
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	// BaseProcedure is the title shared by every variant.
+	BaseProcedure string            `json:"baseProcedure"`
+	Selection     map[string]string `json:"selection,omitempty"`
+}
+
+// Location is a span of lines in a source file. IncludedFrom is the
+// include directive that pulled the file into the page.
+type Location struct {
+	File         string    `json:"file"`
+	StartLine    int       `json:"startLine"`
+	EndLine      int       `json:"endLine"`
+	IncludedFrom *Location `json:"includedFrom,omitempty"`
+}
+
+// Outermost returns where the location is in the page itself: the include
+// directive that brings it in when it comes from an included file.
+func (l Location) Outermost() Location {
+	for l.IncludedFrom != nil {
+		l = *l.IncludedFrom
+	}
+	return l
+}
+
+// Prerequisite is a requirement that was checked before the procedure
+// ran.
+type Prerequisite struct {
+	// Type is software, environment, service or configuration.
+	Type        string `json:"type"`
+	Subject     string `json:"subject"`
+	Description string `json:"description,omitempty"`
+	Optional    bool   `json:"optional,omitempty"`
+	Met         bool   `json:"met"`
+	// Verified is false when the requirement could not be checked and
+	// was assumed to be met.
+	Verified   bool   `json:"verified"`
+	Message    string `json:"message,omitempty"`
+	SkipReason string `json:"skipReason,omitempty"`
+	Found      string `json:"found,omitempty"`
+	Expected   string `json:"expected,omitempty"`
+}
+
+// Step is a numbered step.
+type Step struct {
+	// ID is the procedure ID, "/" and the step number.
+	ID     string `json:"id,omitempty"`
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Status string `json:"status"`
+	// Flaky is set when the step passed only because an action was
+	// retried.
+	Flaky bool `json:"flaky,omitempty"`
+	// Duration is in milliseconds.
+	Duration int64     `json:"duration"`
+	Location Location  `json:"location"`
+	Actions  []Action  `json:"actions"`
+	SubSteps []SubStep `json:"subSteps,omitempty"`
+	Error    *Error    `json:"error,omitempty"`
+}
+
+// SubStep is a lettered or numbered step inside a step.
+type SubStep struct {
+	// ID is the step ID, "." and the sub-step number.
+	ID     string `json:"id,omitempty"`
+	Number string `json:"number"`
+	Title  string `json:"title"`
+	Status string `json:"status"`
+	// Duration is in milliseconds.
+	Duration int64    `json:"duration"`
+	Location Location `json:"location"`
+	Actions  []Action `json:"actions"`
+	Error    *Error   `json:"error,omitempty"`
+}
+
+// Action is one testable action: a command, a file, a request or a wait.
+type Action struct {
+	// ID is the step or sub-step ID, "/" and the action's position in
+	// it.
+	ID string `json:"id,omitempty"`
+	// Type is code, shell, ui, cli, api, download, url, file or wait.
+	Type     string   `json:"type"`
+	Status   string   `json:"status"`
+	Location Location `json:"location"`
+	// RST is the markup the action was parsed from.
+	RST string `json:"rst,omitempty"`
+	// Command is what ran, with placeholders filled in and secrets
+	// redacted.
+	Command  string `json:"command,omitempty"`
+	ExitCode int    `json:"exitCode"`
+	Stdout   string `json:"stdout,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+	// ExpectedOutput is the output the page shows for the command.
+	ExpectedOutput string `json:"expectedOutput,omitempty"`
+	// Message explains a skipped or failed action.
+	Message string `json:"message,omitempty"`
+	// Duration is in milliseconds.
+	Duration int64 `json:"duration"`
+	TimedOut bool  `json:"timedOut,omitempty"`
+	// Replayed is set when the action came from a cassette.
+	Replayed bool `json:"replayed,omitempty"`
+	// Attempts is how many times the action ran, when it could be
+	// retried.
+	Attempts int `json:"attempts,omitempty"`
+	// Placeholders lists the placeholders that were filled in and the
+	// variables that filled them.
+	Placeholders []Placeholder `json:"placeholders,omitempty"`
+	// Polls lists the checks of a wait action.
+	Polls []Poll `json:"polls,omitempty"`
+	Error *Error `json:"error,omitempty"`
+}
+
+// Placeholder is a placeholder and the variable that filled it in.
+type Placeholder struct {
+	Placeholder string `json:"placeholder"`
+	Variable    string `json:"variable"`
+}
+
+// Poll is one check of a wait action.
+type Poll struct {
+	Satisfied bool   `json:"satisfied"`
+	Observed  string `json:"observed"`
+	// Duration is in milliseconds.
+	Duration int64 `json:"duration"`
+}
+
+// Error describes why a procedure, step or action failed.
+type Error struct {
+	// Type is resolve, execute, cleanup or replay.
+	Type     string   `json:"type"`
+	Message  string   `json:"message"`
+	Location Location `json:"location"`
+	// Step is the step number as the page shows it, such as "2.b".
+	Step        string   `json:"step,omitempty"`
+	StepTitle   string   `json:"stepTitle,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// Cleanup is the outcome of removing one resource.
+type Cleanup struct {
+	// Kind is database, collection, search-index, directory, file,
+	// process or custom.
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	// Status is passed, failed, or skipped when cleanup was turned off.
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Duration is in milliseconds.
+	Duration int64 `json:"duration"`
+}
+
+// Summary totals the run.
+type Summary struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+	Flaky   int `json:"flaky"`
+	// Duration is the sum of the test case durations, in milliseconds.
+	Duration int64        `json:"duration"`
+	Steps    StepSummary  `json:"steps"`
+	Variants VariantStats `json:"variants"`
+}
+
+// StepSummary totals the steps of every test case.
+type StepSummary struct {
+	Total  int `json:"total"`
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+	Flaky  int `json:"flaky"`
+}
+
+// VariantStats counts the procedures that were tested once per variant.
+type VariantStats struct {
+	BaseProcedures int `json:"baseProcedures"`
+	Variants       int `json:"variants"`
+	// ByType counts variants by type: "tab" or "composable-tutorial".
+	ByType map[string]int `json:"byType,omitempty"`
+}
+
+// Read decodes a document, rejecting one written for a different major
+// schema version.
+func Read(r io.Reader) (*Document, error) {
+	var doc Document
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if major(doc.SchemaVersion) != major(SchemaVersion) {
+		return nil, fmt.Errorf("results schema version %q is not supported; want %s.x", doc.SchemaVersion, major(SchemaVersion))
+	}
+	return &doc, nil
+}
+
+func major(version string) string {
+	m, _, _ := strings.Cut(version, ".")
+	return m
+}
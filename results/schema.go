@@ -0,0 +1,9 @@
+package results
+
+import _ "embed"
+
+// Schema is the JSON Schema (draft 2020-12) of Document. "proctest
+// schema" prints it.
+//
+//go:embed schema.json
+var Schema []byte